@@ -2,6 +2,18 @@ package main
 
 import (
 	"log"
+
+	collectionmemory "rag-backend/internal/repositories/collectionstore/memory"
+	conversationmemory "rag-backend/internal/repositories/conversationstore/memory"
+	documentmemory "rag-backend/internal/repositories/documentstore/memory"
+	"rag-backend/internal/repositories/embeddingcache"
+	embeddingdisk "rag-backend/internal/repositories/embeddingcache/disk"
+	embeddingmemory "rag-backend/internal/repositories/embeddingcache/memory"
+	jobmemory "rag-backend/internal/repositories/jobstore/memory"
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/internal/repositories/vectorstore/disk"
+	"rag-backend/internal/repositories/vectorstore/hnsw"
+	"rag-backend/internal/repositories/vectorstore/hybrid"
 	"rag-backend/internal/repositories/vectorstore/memory"
 
 	"github.com/gin-gonic/gin"
@@ -15,14 +27,37 @@ import (
 func main() {
 	cfg := config.Load()
 
-	vectorStore := memory.NewMemoryVectorStore()
+	// Keep a BM25 keyword index in sync with the vectors for hybrid retrieval
+	innerStore := newVectorStore(cfg)
+	vectorStore, err := hybrid.NewHybridVectorStore(innerStore)
+	if err != nil {
+		log.Fatal("Failed to build keyword index:", err)
+	}
+	documentStore := documentmemory.NewMemoryDocumentStore()
+	conversationHistory := services.NewConversationHistory(conversationmemory.NewMemoryConversationStore(cfg.ConversationTTL, cfg.MaxConversations))
 
-	ragPipeline := services.NewRAGPipeline(cfg, vectorStore)
+	ragPipeline := services.NewRAGPipeline(cfg, vectorStore, conversationHistory, newEmbeddingCacheTiers(cfg)...)
 	documentProcessor := services.NewDocumentProcessor()
+	documentRegistry := services.NewDocumentRegistry(documentStore, vectorStore)
+	collectionRegistry, err := services.NewCollectionRegistry(collectionmemory.NewMemoryCollectionStore(), documentRegistry)
+	if err != nil {
+		log.Fatal("Failed to set up collections:", err)
+	}
+
+	if lister, ok := innerStore.(vectorstore.ChunkLister); ok {
+		restoreRegistries(lister, documentRegistry, collectionRegistry)
+	}
 
-	uploadHandler := handlers.NewUploadHandler(ragPipeline, documentProcessor)
-	queryHandler := handlers.NewQueryHandler(ragPipeline)
-	healthHandler := handlers.NewHealthHandler()
+	jobQueue := services.NewJobQueue(jobmemory.NewMemoryJobStore(), cfg.IngestWorkers, cfg.IngestQueueSize)
+
+	uploadHandler := handlers.NewUploadHandler(ragPipeline, documentProcessor, documentRegistry, collectionRegistry, jobQueue)
+	jobHandler := handlers.NewJobHandler(jobQueue)
+	queryHandler := handlers.NewQueryHandler(ragPipeline, collectionRegistry)
+	searchHandler := handlers.NewSearchHandler(ragPipeline, collectionRegistry)
+	documentHandler := handlers.NewDocumentHandler(documentRegistry)
+	collectionHandler := handlers.NewCollectionHandler(collectionRegistry)
+	conversationHandler := handlers.NewConversationHandler(conversationHistory)
+	healthHandler := handlers.NewHealthHandler(ragPipeline)
 
 	router := gin.Default()
 
@@ -43,8 +78,19 @@ func main() {
 	api := router.Group("/api")
 	{
 		api.POST("/upload", uploadHandler.HandleUpload)
+		api.GET("/jobs/:id", jobHandler.HandleGetJob)
+		api.POST("/jobs/:id/cancel", jobHandler.HandleCancelJob)
 		api.POST("/query", queryHandler.HandleQuery)
 		api.POST("/query/stream", queryHandler.HandleQueryStream)
+		api.POST("/search", searchHandler.HandleSearch)
+		api.GET("/documents", documentHandler.HandleListDocuments)
+		api.GET("/documents/:id", documentHandler.HandleGetDocument)
+		api.DELETE("/documents/:id", documentHandler.HandleDeleteDocument)
+		api.GET("/collections", collectionHandler.HandleListCollections)
+		api.POST("/collections", collectionHandler.HandleCreateCollection)
+		api.DELETE("/collections/:name", collectionHandler.HandleDeleteCollection)
+		api.GET("/conversations/:id", conversationHandler.HandleGetConversation)
+		api.DELETE("/conversations/:id", conversationHandler.HandleDeleteConversation)
 	}
 
 	router.GET("/health", healthHandler.HandleHealth)
@@ -54,3 +100,61 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// restoreRegistries rebuilds the in-memory document and collection registries
+// from the chunks a persistent vector store reloaded, so documents uploaded
+// before a restart can still be listed, deleted and replaced
+func restoreRegistries(lister vectorstore.ChunkLister, documentRegistry *services.DocumentRegistry, collectionRegistry *services.CollectionRegistry) {
+	chunks, err := lister.Chunks()
+	if err != nil {
+		log.Fatal("Failed to load stored chunks:", err)
+	}
+	if err := collectionRegistry.RestoreCollections(chunks); err != nil {
+		log.Fatal("Failed to restore collections:", err)
+	}
+	restored, err := documentRegistry.RestoreDocuments(chunks)
+	if err != nil {
+		log.Fatal("Failed to restore documents:", err)
+	}
+	if restored > 0 {
+		log.Printf("Restored %d documents from the vector store", restored)
+	}
+}
+
+func newVectorStore(cfg *config.Config) vectorstore.VectorStore {
+	switch cfg.VectorStoreType {
+	case config.VectorStoreDisk:
+		store, err := disk.NewDiskVectorStore(cfg.VectorStorePath)
+		if err != nil {
+			log.Fatal("Failed to open vector store:", err)
+		}
+		log.Printf("📦 Using disk vector store at %s", cfg.VectorStorePath)
+		return store
+	case config.VectorStoreHNSW:
+		log.Printf("📦 Using HNSW vector store (M=%d, efConstruction=%d, efSearch=%d)", cfg.HNSWM, cfg.HNSWEfConstruction, cfg.HNSWEfSearch)
+		return hnsw.NewHNSWVectorStore(hnsw.Params{
+			M:              cfg.HNSWM,
+			EfConstruction: cfg.HNSWEfConstruction,
+			EfSearch:       cfg.HNSWEfSearch,
+		})
+	default:
+		return memory.NewMemoryVectorStore()
+	}
+}
+
+// newEmbeddingCacheTiers returns the embedding cache tiers, fastest first
+func newEmbeddingCacheTiers(cfg *config.Config) []embeddingcache.EmbeddingCache {
+	if cfg.EmbeddingCacheSize == 0 {
+		return nil
+	}
+	tiers := []embeddingcache.EmbeddingCache{embeddingmemory.NewLRUEmbeddingCache(cfg.EmbeddingCacheSize)}
+	if cfg.EmbeddingCachePath != "" {
+		cache, err := embeddingdisk.NewDiskEmbeddingCache(cfg.EmbeddingCachePath, int64(cfg.EmbeddingCacheMaxMB)<<20)
+		if err != nil {
+			log.Fatal("Failed to open embedding cache:", err)
+		}
+		log.Printf("🗄️ Caching embeddings at %s", cfg.EmbeddingCachePath)
+		tiers = append(tiers, cache)
+	}
+	return tiers
+}
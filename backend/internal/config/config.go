@@ -3,14 +3,118 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	VectorStoreMemory = "memory"
+	VectorStoreDisk   = "disk"
+	VectorStoreHNSW   = "hnsw"
+)
+
+// Units chunk sizes can be measured in
+const (
+	ChunkModeRunes  = "runes"
+	ChunkModeTokens = "tokens"
+)
+
+// Hosted defaults, used when the provider variables are not set
+const (
+	DefaultChatBaseURL      = "https://api.deepseek.com/v1"
+	DefaultChatModel        = "deepseek-chat"
+	DefaultEmbeddingBaseURL = "https://api.openai.com/v1"
+	DefaultEmbeddingModel   = "text-embedding-3-small"
+	DefaultRerankBaseURL    = "https://api.cohere.com/v2"
+	DefaultRerankModel      = "rerank-v3.5"
+)
+
+// Rerankers that can reorder retrieved chunks
+const (
+	RerankerNone    = "none"
+	RerankerLexical = "lexical"
+	RerankerLLM     = "llm"
+	RerankerHTTP    = "http"
+)
+
+// ProviderConfig points one model role at an OpenAI-compatible API, such as
+// OpenAI, DeepSeek, Ollama, vLLM, Azure OpenAI's v1 endpoint or a gateway.
+type ProviderConfig struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+
+	// MaxRetries is how often a call failing with a rate limit, server error
+	// or timeout is retried. RequestTimeout bounds each attempt, 0 for no bound.
+	MaxRetries     int
+	RequestTimeout time.Duration
+	// RequestsPerMinute and TokensPerMinute throttle calls to stay within the
+	// provider's rate limits, 0 for no limit
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
 type Config struct {
-	Port           string
-	DeepSeekAPIKey string
-	OpenAIAPIKey   string
+	Port            string
+	Chat            ProviderConfig
+	Embedding       ProviderConfig
+	VectorStoreType string
+	VectorStorePath string
+
+	// HNSW tuning, only used when VectorStoreType is "hnsw"
+	HNSWM              int
+	HNSWEfConstruction int
+	HNSWEfSearch       int
+
+	// ConfidenceSelfAssessment asks the chat model to rate how well the
+	// sources support each answer and blends that into the confidence score
+	ConfidenceSelfAssessment bool
+
+	// ContextTokenBudget caps the tokens of retrieved passages in a prompt.
+	// ContextWindow is what the chat model accepts in all, of which
+	// AnswerTokenReserve is kept free for the answer; the passages get less
+	// than their budget when the question and history leave less room.
+	ContextTokenBudget int
+	ContextWindow      int
+	AnswerTokenReserve int
+
+	// MinSimilarity is the relevance, from 0 to 1, a retrieved chunk needs to
+	// be used as context. Queries without such chunks are answered without
+	// calling the chat model.
+	MinSimilarity float64
+
+	// Reranker reorders the RerankCandidates best retrieved chunks before
+	// they reach the prompt, dropping those it scores below RerankMinScore.
+	// Rerank is the API used by the "http" reranker.
+	Reranker         string
+	Rerank           ProviderConfig
+	RerankCandidates int
+	RerankMinScore   float64
+
+	// IngestWorkers uploads are processed at once; up to IngestQueueSize more
+	// wait for a worker before uploads are turned away
+	IngestWorkers   int
+	IngestQueueSize int
+
+	// ChunkMode measures ChunkSize and ChunkOverlap in runes or tokens. Zero
+	// sizes use the mode's defaults.
+	ChunkMode    string
+	ChunkSize    int
+	ChunkOverlap int
+
+	// EmbeddingCacheSize is how many embeddings are kept in memory, 0 to
+	// disable caching. EmbeddingCachePath, if set, adds a persistent tier of
+	// at most EmbeddingCacheMaxMB megabytes, 0 for no limit.
+	EmbeddingCacheSize  int
+	EmbeddingCachePath  string
+	EmbeddingCacheMaxMB int
+
+	// ConversationTTL is how long a conversation is kept after its last turn
+	// and MaxConversations how many are kept at most, 0 for no limit.
+	ConversationTTL  time.Duration
+	MaxConversations int
 }
 
 func Load() *Config {
@@ -20,25 +124,214 @@ func Load() *Config {
 	}
 
 	config := &Config{
-		Port:           getEnv("PORT", "3001"),
-		DeepSeekAPIKey: getEnv("DEEPSEEK_API_KEY", ""),
-		OpenAIAPIKey:   getEnv("OPENAI_API_KEY", ""),
+		Port: getEnv("PORT", "3001"),
+		Chat: ProviderConfig{
+			BaseURL: getEnv("CHAT_BASE_URL", DefaultChatBaseURL),
+			// DEEPSEEK_API_KEY is kept as a fallback for existing deployments
+			APIKey: getEnv("CHAT_API_KEY", getEnv("DEEPSEEK_API_KEY", "")),
+			Model:  getEnv("CHAT_MODEL", DefaultChatModel),
+
+			MaxRetries:        getEnvInt("CHAT_MAX_RETRIES", 3),
+			RequestTimeout:    getEnvDuration("CHAT_REQUEST_TIMEOUT", 2*time.Minute),
+			RequestsPerMinute: getEnvInt("CHAT_REQUESTS_PER_MINUTE", 0),
+			TokensPerMinute:   getEnvInt("CHAT_TOKENS_PER_MINUTE", 0),
+		},
+		Embedding: ProviderConfig{
+			BaseURL: getEnv("EMBEDDING_BASE_URL", DefaultEmbeddingBaseURL),
+			APIKey:  getEnv("EMBEDDING_API_KEY", getEnv("OPENAI_API_KEY", "")),
+			Model:   getEnv("EMBEDDING_MODEL", DefaultEmbeddingModel),
+
+			MaxRetries:        getEnvInt("EMBEDDING_MAX_RETRIES", 3),
+			RequestTimeout:    getEnvDuration("EMBEDDING_REQUEST_TIMEOUT", time.Minute),
+			RequestsPerMinute: getEnvInt("EMBEDDING_REQUESTS_PER_MINUTE", 0),
+			TokensPerMinute:   getEnvInt("EMBEDDING_TOKENS_PER_MINUTE", 0),
+		},
+		VectorStoreType: getEnv("VECTOR_STORE", VectorStoreMemory),
+		VectorStorePath: getEnv("VECTOR_STORE_PATH", "data/vectors.log"),
+
+		HNSWM:              getEnvInt("HNSW_M", 16),
+		HNSWEfConstruction: getEnvInt("HNSW_EF_CONSTRUCTION", 200),
+		HNSWEfSearch:       getEnvInt("HNSW_EF_SEARCH", 64),
+
+		ConfidenceSelfAssessment: getEnvBool("CONFIDENCE_SELF_ASSESSMENT", false),
+
+		ContextTokenBudget: getEnvInt("CONTEXT_TOKEN_BUDGET", 2000),
+		ContextWindow:      getEnvInt("CONTEXT_WINDOW", 65536),
+		AnswerTokenReserve: getEnvInt("ANSWER_TOKEN_RESERVE", 1024),
+
+		MinSimilarity: getEnvFloat("MIN_SIMILARITY", 0.2),
+
+		Reranker: getEnv("RERANKER", RerankerNone),
+		Rerank: ProviderConfig{
+			BaseURL: getEnv("RERANK_BASE_URL", DefaultRerankBaseURL),
+			APIKey:  getEnv("RERANK_API_KEY", ""),
+			Model:   getEnv("RERANK_MODEL", DefaultRerankModel),
+
+			MaxRetries:        getEnvInt("RERANK_MAX_RETRIES", 3),
+			RequestTimeout:    getEnvDuration("RERANK_REQUEST_TIMEOUT", 30*time.Second),
+			RequestsPerMinute: getEnvInt("RERANK_REQUESTS_PER_MINUTE", 0),
+			TokensPerMinute:   getEnvInt("RERANK_TOKENS_PER_MINUTE", 0),
+		},
+		RerankCandidates: getEnvInt("RERANK_CANDIDATES", 20),
+		RerankMinScore:   getEnvFloat("RERANK_MIN_SCORE", 0),
+
+		IngestWorkers:   getEnvInt("INGEST_WORKERS", 2),
+		IngestQueueSize: getEnvInt("INGEST_QUEUE_SIZE", 32),
+
+		ChunkMode:    getEnv("CHUNK_MODE", ChunkModeRunes),
+		ChunkSize:    getEnvInt("CHUNK_SIZE", 0),
+		ChunkOverlap: getEnvInt("CHUNK_OVERLAP", 0),
+
+		EmbeddingCacheSize:  getEnvInt("EMBEDDING_CACHE_SIZE", 10000),
+		EmbeddingCachePath:  getEnv("EMBEDDING_CACHE_PATH", ""),
+		EmbeddingCacheMaxMB: getEnvInt("EMBEDDING_CACHE_MAX_MB", 1024),
+
+		ConversationTTL:  getEnvDuration("CONVERSATION_TTL", 24*time.Hour),
+		MaxConversations: getEnvInt("MAX_CONVERSATIONS", 10000),
 	}
 
-	// Validate required environment variables
-	if config.DeepSeekAPIKey == "" {
-		log.Fatal("DEEPSEEK_API_KEY environment variable is required")
+	// Validate required environment variables. Self-hosted endpoints such as
+	// Ollama usually accept any key, so one is only required for the hosted
+	// defaults.
+	if config.Chat.APIKey == "" && config.Chat.BaseURL == DefaultChatBaseURL {
+		log.Fatal("CHAT_API_KEY (or DEEPSEEK_API_KEY) environment variable is required")
+	}
+	if config.Embedding.APIKey == "" && config.Embedding.BaseURL == DefaultEmbeddingBaseURL {
+		log.Fatal("EMBEDDING_API_KEY (or OPENAI_API_KEY) environment variable is required")
+	}
+	switch config.VectorStoreType {
+	case VectorStoreMemory, VectorStoreDisk, VectorStoreHNSW:
+	default:
+		log.Fatalf("VECTOR_STORE must be %q, %q or %q, got %q", VectorStoreMemory, VectorStoreDisk, VectorStoreHNSW, config.VectorStoreType)
+	}
+	validateProvider("CHAT", config.Chat)
+	validateProvider("EMBEDDING", config.Embedding)
+	if config.IngestWorkers < 1 {
+		log.Fatalf("INGEST_WORKERS must be at least 1, got %d", config.IngestWorkers)
 	}
-	if config.OpenAIAPIKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
+	if config.IngestQueueSize < 1 {
+		log.Fatalf("INGEST_QUEUE_SIZE must be at least 1, got %d", config.IngestQueueSize)
+	}
+	if config.ConversationTTL < 0 || config.MaxConversations < 0 {
+		log.Fatalf("CONVERSATION_TTL and MAX_CONVERSATIONS cannot be negative, got %s and %d", config.ConversationTTL, config.MaxConversations)
+	}
+	switch config.ChunkMode {
+	case ChunkModeRunes, ChunkModeTokens:
+	default:
+		log.Fatalf("CHUNK_MODE must be %q or %q, got %q", ChunkModeRunes, ChunkModeTokens, config.ChunkMode)
+	}
+	if config.ChunkSize < 0 || config.ChunkOverlap < 0 {
+		log.Fatalf("CHUNK_SIZE and CHUNK_OVERLAP cannot be negative, got %d and %d", config.ChunkSize, config.ChunkOverlap)
+	}
+	if config.ChunkSize > 0 && config.ChunkOverlap >= config.ChunkSize {
+		log.Fatalf("CHUNK_OVERLAP must be smaller than CHUNK_SIZE, got %d and %d", config.ChunkOverlap, config.ChunkSize)
+	}
+	if config.ContextTokenBudget < 1 {
+		log.Fatalf("CONTEXT_TOKEN_BUDGET must be at least 1, got %d", config.ContextTokenBudget)
+	}
+	if config.AnswerTokenReserve < 0 {
+		log.Fatalf("ANSWER_TOKEN_RESERVE cannot be negative, got %d", config.AnswerTokenReserve)
+	}
+	if config.ContextWindow <= config.AnswerTokenReserve {
+		log.Fatalf("CONTEXT_WINDOW must be larger than ANSWER_TOKEN_RESERVE, got %d and %d", config.ContextWindow, config.AnswerTokenReserve)
+	}
+	if config.MinSimilarity < 0 || config.MinSimilarity > 1 {
+		log.Fatalf("MIN_SIMILARITY must be between 0 and 1, got %g", config.MinSimilarity)
+	}
+	switch config.Reranker {
+	case RerankerNone, RerankerLexical, RerankerLLM:
+	case RerankerHTTP:
+		if config.Rerank.APIKey == "" && config.Rerank.BaseURL == DefaultRerankBaseURL {
+			log.Fatal("RERANK_API_KEY environment variable is required for the http reranker")
+		}
+		validateProvider("RERANK", config.Rerank)
+	default:
+		log.Fatalf("RERANKER must be %q, %q, %q or %q, got %q", RerankerNone, RerankerLexical, RerankerLLM, RerankerHTTP, config.Reranker)
+	}
+	if config.RerankCandidates < 1 {
+		log.Fatalf("RERANK_CANDIDATES must be at least 1, got %d", config.RerankCandidates)
+	}
+	if config.RerankMinScore < 0 || config.RerankMinScore > 1 {
+		log.Fatalf("RERANK_MIN_SCORE must be between 0 and 1, got %g", config.RerankMinScore)
+	}
+	if config.EmbeddingCacheSize < 0 {
+		log.Fatalf("EMBEDDING_CACHE_SIZE cannot be negative, got %d", config.EmbeddingCacheSize)
+	}
+	if config.EmbeddingCacheMaxMB < 0 {
+		log.Fatalf("EMBEDDING_CACHE_MAX_MB cannot be negative, got %d", config.EmbeddingCacheMaxMB)
 	}
 
 	return config
 }
 
+// validateProvider checks the retry and rate limit settings of the provider
+// whose variables start with prefix
+func validateProvider(prefix string, provider ProviderConfig) {
+	if provider.MaxRetries < 0 {
+		log.Fatalf("%s_MAX_RETRIES cannot be negative, got %d", prefix, provider.MaxRetries)
+	}
+	if provider.RequestTimeout < 0 {
+		log.Fatalf("%s_REQUEST_TIMEOUT cannot be negative, got %s", prefix, provider.RequestTimeout)
+	}
+	if provider.RequestsPerMinute < 0 {
+		log.Fatalf("%s_REQUESTS_PER_MINUTE cannot be negative, got %d", prefix, provider.RequestsPerMinute)
+	}
+	if provider.TokensPerMinute < 0 {
+		log.Fatalf("%s_TOKENS_PER_MINUTE cannot be negative, got %d", prefix, provider.TokensPerMinute)
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer, got %q", key, value)
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("%s must be a number, got %q", key, value)
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration such as 30s or 2m, got %q", key, value)
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s must be true or false, got %q", key, value)
+	}
+	return parsed
+}
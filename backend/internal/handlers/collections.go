@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+type CollectionManager interface {
+	CreateCollection(name, description string) (*types.CollectionSummary, error)
+	ListCollections() ([]types.CollectionSummary, error)
+	DeleteCollection(name string) (int, int, error)
+}
+
+// CollectionResolver validates the collections named by a request, resolving
+// none to the default collection.
+type CollectionResolver interface {
+	ResolveCollections(names ...string) ([]string, error)
+}
+
+type CollectionHandler struct {
+	collectionRegistry CollectionManager
+}
+
+func NewCollectionHandler(collectionRegistry CollectionManager) *CollectionHandler {
+	return &CollectionHandler{
+		collectionRegistry: collectionRegistry,
+	}
+}
+
+func (h *CollectionHandler) HandleCreateCollection(c *gin.Context) {
+	var request types.CreateCollectionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error: "Request body must be JSON with a collection name",
+			Code:  codes.ErrInvalidRequest,
+		})
+		return
+	}
+
+	collection, err := h.collectionRegistry.CreateCollection(request.Name, request.Description)
+	if err != nil {
+		respondCollectionError(c, "Failed to create collection", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, types.CollectionResponse{
+		Collection: collection,
+	})
+}
+
+func (h *CollectionHandler) HandleListCollections(c *gin.Context) {
+	collections, err := h.collectionRegistry.ListCollections()
+	if err != nil {
+		respondCollectionError(c, "Failed to list collections", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.CollectionListResponse{
+		Collections: collections,
+	})
+}
+
+func (h *CollectionHandler) HandleDeleteCollection(c *gin.Context) {
+	name := c.Param("name")
+
+	deletedDocuments, deletedChunks, err := h.collectionRegistry.DeleteCollection(name)
+	if err != nil {
+		respondCollectionError(c, "Failed to delete collection", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.DeleteCollectionResponse{
+		Name:             name,
+		DeletedDocuments: deletedDocuments,
+		DeletedChunks:    deletedChunks,
+	})
+}
+
+func respondCollectionError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrCollectionNotFound):
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error:   "Collection not found",
+			Code:    codes.ErrCollectionNotFound,
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrCollectionExists):
+		c.JSON(http.StatusConflict, types.ErrorResponse{
+			Error: "Collection already exists",
+			Code:  codes.ErrCollectionExists,
+		})
+	case errors.Is(err, services.ErrInvalidCollection):
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid collection",
+			Code:    codes.ErrInvalidCollection,
+			Details: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   message,
+			Code:    codes.ErrCollectionError,
+			Details: err.Error(),
+		})
+	}
+}
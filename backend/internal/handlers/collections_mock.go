@@ -0,0 +1,49 @@
+package handlers
+
+import "rag-backend/pkg/types"
+
+type mockCollectionManager struct {
+	createCollectionFunc func(name, description string) (*types.CollectionSummary, error)
+	listCollectionsFunc  func() ([]types.CollectionSummary, error)
+	deleteCollectionFunc func(name string) (int, int, error)
+}
+
+func (m *mockCollectionManager) CreateCollection(name, description string) (*types.CollectionSummary, error) {
+	return m.createCollectionFunc(name, description)
+}
+
+func (m *mockCollectionManager) ListCollections() ([]types.CollectionSummary, error) {
+	return m.listCollectionsFunc()
+}
+
+func (m *mockCollectionManager) DeleteCollection(name string) (int, int, error) {
+	return m.deleteCollectionFunc(name)
+}
+
+type mockCollectionResolver struct {
+	resolveCollectionsFunc func(names ...string) ([]string, error)
+	withCollectionFunc     func(name string, store func() error) error
+}
+
+func (m *mockCollectionResolver) ResolveCollections(names ...string) ([]string, error) {
+	return m.resolveCollectionsFunc(names...)
+}
+
+func (m *mockCollectionResolver) WithCollection(name string, store func() error) error {
+	return m.withCollectionFunc(name, store)
+}
+
+// passthroughCollections resolves names as given, or to the default collection.
+func passthroughCollections() *mockCollectionResolver {
+	return &mockCollectionResolver{
+		resolveCollectionsFunc: func(names ...string) ([]string, error) {
+			if len(names) == 0 {
+				return []string{types.DefaultCollection}, nil
+			}
+			return names, nil
+		},
+		withCollectionFunc: func(_ string, store func() error) error {
+			return store()
+		},
+	}
+}
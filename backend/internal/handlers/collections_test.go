@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+func newCollectionsRouter(manager CollectionManager) *gin.Engine {
+	h := NewCollectionHandler(manager)
+	router := gin.New()
+	router.POST("/api/collections", h.HandleCreateCollection)
+	router.GET("/api/collections", h.HandleListCollections)
+	router.DELETE("/api/collections/:name", h.HandleDeleteCollection)
+	return router
+}
+
+func TestHandleCreateCollection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	created := &types.CollectionSummary{Name: "contracts", Description: "Signed agreements", CreatedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+
+	type expected struct {
+		status int
+		code   string
+		calls  int
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		expected expected
+	}{
+		{
+			name:     "creates collection",
+			body:     `{"name":"contracts","description":"Signed agreements"}`,
+			expected: expected{status: http.StatusCreated, calls: 1},
+		},
+		{
+			name:     "returns 400 without a name",
+			body:     `{"description":"no name"}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name:     "returns 400 for an invalid name",
+			body:     `{"name":"Bad Name"}`,
+			err:      fmt.Errorf("%w: name must be lowercase", services.ErrInvalidCollection),
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidCollection, calls: 1},
+		},
+		{
+			name:     "returns 409 when the collection exists",
+			body:     `{"name":"contracts"}`,
+			err:      fmt.Errorf("failed to create collection: %w", services.ErrCollectionExists),
+			expected: expected{status: http.StatusConflict, code: codes.ErrCollectionExists, calls: 1},
+		},
+		{
+			name:     "returns 500 on store failure",
+			body:     `{"name":"contracts"}`,
+			err:      errors.New("store down"),
+			expected: expected{status: http.StatusInternalServerError, code: codes.ErrCollectionError, calls: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			router := newCollectionsRouter(&mockCollectionManager{
+				createCollectionFunc: func(name, description string) (*types.CollectionSummary, error) {
+					calls++
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &types.CollectionSummary{Name: name, Description: description, CreatedAt: created.CreatedAt}, nil
+				},
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/collections", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, tt.expected.calls, calls)
+
+			if tt.expected.status == http.StatusCreated {
+				var resp types.CollectionResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, created, resp.Collection)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
+
+func TestHandleListCollections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	collections := []types.CollectionSummary{
+		{Name: "contracts", DocumentCount: 2},
+		{Name: types.DefaultCollection, DocumentCount: 5},
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		expected []types.CollectionSummary
+	}{
+		{name: "lists collections with document counts", status: http.StatusOK, expected: collections},
+		{name: "returns 500 on failure", err: errors.New("store down"), status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCollectionsRouter(&mockCollectionManager{
+				listCollectionsFunc: func() ([]types.CollectionSummary, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return collections, nil
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/collections", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				var resp types.CollectionListResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expected, resp.Collections)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, codes.ErrCollectionError, resp.Code)
+		})
+	}
+}
+
+func TestHandleDeleteCollection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type expected struct {
+		status int
+		code   string
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected expected
+	}{
+		{
+			name:     "deletes collection and reports removed documents",
+			expected: expected{status: http.StatusOK},
+		},
+		{
+			name:     "returns 404 when collection is unknown",
+			err:      fmt.Errorf("failed to get collection: %w", services.ErrCollectionNotFound),
+			expected: expected{status: http.StatusNotFound, code: codes.ErrCollectionNotFound},
+		},
+		{
+			name:     "returns 400 for the default collection",
+			err:      fmt.Errorf("%w: the default collection cannot be deleted", services.ErrInvalidCollection),
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidCollection},
+		},
+		{
+			name:     "returns 500 on store failure",
+			err:      errors.New("store down"),
+			expected: expected{status: http.StatusInternalServerError, code: codes.ErrCollectionError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedName string
+			router := newCollectionsRouter(&mockCollectionManager{
+				deleteCollectionFunc: func(name string) (int, int, error) {
+					capturedName = name
+					if tt.err != nil {
+						return 0, 0, tt.err
+					}
+					return 2, 7, nil
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/collections/contracts", nil))
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, "contracts", capturedName)
+
+			if tt.expected.status == http.StatusOK {
+				var resp types.DeleteCollectionResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, types.DeleteCollectionResponse{Name: "contracts", DeletedDocuments: 2, DeletedChunks: 7}, resp)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+type ConversationManager interface {
+	GetConversation(id string) (*types.Conversation, error)
+	DeleteConversation(id string) error
+}
+
+type ConversationHandler struct {
+	conversationHistory ConversationManager
+}
+
+func NewConversationHandler(conversationHistory ConversationManager) *ConversationHandler {
+	return &ConversationHandler{
+		conversationHistory: conversationHistory,
+	}
+}
+
+func (h *ConversationHandler) HandleGetConversation(c *gin.Context) {
+	conversation, err := h.conversationHistory.GetConversation(c.Param("id"))
+	if err != nil {
+		respondConversationError(c, "Failed to get conversation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.ConversationResponse{
+		Conversation: conversation,
+	})
+}
+
+func (h *ConversationHandler) HandleDeleteConversation(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := h.conversationHistory.DeleteConversation(id); err != nil {
+		respondConversationError(c, "Failed to delete conversation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.DeleteConversationResponse{
+		ID: id,
+	})
+}
+
+func respondConversationError(c *gin.Context, message string, err error) {
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error: "Conversation not found",
+			Code:  codes.ErrConversationNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+		Error:   message,
+		Code:    codes.ErrConversationError,
+		Details: err.Error(),
+	})
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import "rag-backend/pkg/types"
+
+type mockConversationManager struct {
+	getConversationFunc    func(id string) (*types.Conversation, error)
+	deleteConversationFunc func(id string) error
+}
+
+func (m *mockConversationManager) GetConversation(id string) (*types.Conversation, error) {
+	return m.getConversationFunc(id)
+}
+
+func (m *mockConversationManager) DeleteConversation(id string) error {
+	return m.deleteConversationFunc(id)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+func newConversationsRouter(manager ConversationManager) *gin.Engine {
+	h := NewConversationHandler(manager)
+	router := gin.New()
+	router.GET("/api/conversations/:id", h.HandleGetConversation)
+	router.DELETE("/api/conversations/:id", h.HandleDeleteConversation)
+	return router
+}
+
+func TestHandleGetConversation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conversation := &types.Conversation{
+		ID: "c1",
+		Messages: []types.ChatMessage{
+			{Role: types.ChatRoleUser, Content: "Who wrote it?"},
+			{Role: types.ChatRoleAssistant, Content: "Ada."},
+		},
+	}
+
+	type mock struct {
+		conversation *types.Conversation
+		err          error
+	}
+	type expected struct {
+		status int
+		code   string
+	}
+
+	tests := []struct {
+		name     string
+		mock     mock
+		expected expected
+	}{
+		{
+			name:     "returns conversation history",
+			mock:     mock{conversation: conversation},
+			expected: expected{status: http.StatusOK},
+		},
+		{
+			name:     "returns 404 when conversation is unknown",
+			mock:     mock{err: fmt.Errorf("failed to get conversation: %w", services.ErrConversationNotFound)},
+			expected: expected{status: http.StatusNotFound, code: codes.ErrConversationNotFound},
+		},
+		{
+			name:     "returns 500 on store failure",
+			mock:     mock{err: errors.New("store down")},
+			expected: expected{status: http.StatusInternalServerError, code: codes.ErrConversationError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedID string
+			router := newConversationsRouter(&mockConversationManager{
+				getConversationFunc: func(id string) (*types.Conversation, error) {
+					capturedID = id
+					return tt.mock.conversation, tt.mock.err
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/conversations/c1", nil))
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, "c1", capturedID)
+
+			if tt.expected.status == http.StatusOK {
+				var resp types.ConversationResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, conversation, resp.Conversation)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
+
+func TestHandleDeleteConversation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type expected struct {
+		status int
+		code   string
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected expected
+	}{
+		{
+			name:     "deletes conversation",
+			expected: expected{status: http.StatusOK},
+		},
+		{
+			name:     "returns 404 when conversation is unknown",
+			err:      fmt.Errorf("failed to delete conversation: %w", services.ErrConversationNotFound),
+			expected: expected{status: http.StatusNotFound, code: codes.ErrConversationNotFound},
+		},
+		{
+			name:     "returns 500 on store failure",
+			err:      errors.New("store down"),
+			expected: expected{status: http.StatusInternalServerError, code: codes.ErrConversationError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedID string
+			router := newConversationsRouter(&mockConversationManager{
+				deleteConversationFunc: func(id string) error {
+					capturedID = id
+					return tt.err
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/conversations/c1", nil))
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, "c1", capturedID)
+
+			if tt.expected.status == http.StatusOK {
+				var resp types.DeleteConversationResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "c1", resp.ID)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
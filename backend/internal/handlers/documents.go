@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+type DocumentManager interface {
+	ListDocuments() ([]types.Document, error)
+	GetDocument(id string) (*types.Document, error)
+	DeleteDocument(id string) (int, error)
+}
+
+type DocumentHandler struct {
+	documentRegistry DocumentManager
+}
+
+func NewDocumentHandler(documentRegistry DocumentManager) *DocumentHandler {
+	return &DocumentHandler{
+		documentRegistry: documentRegistry,
+	}
+}
+
+func (h *DocumentHandler) HandleListDocuments(c *gin.Context) {
+	documents, err := h.documentRegistry.ListDocuments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "Failed to list documents",
+			Code:    codes.ErrDocumentError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// ?collection= narrows the listing to one collection
+	collection := c.Query("collection")
+	summaries := make([]types.UploadDocumentSummary, 0, len(documents))
+	for _, document := range documents {
+		if collection != "" && document.Collection != collection {
+			continue
+		}
+		summaries = append(summaries, *toDocumentSummary(document))
+	}
+
+	c.JSON(http.StatusOK, types.DocumentListResponse{
+		Documents: summaries,
+	})
+}
+
+func (h *DocumentHandler) HandleGetDocument(c *gin.Context) {
+	document, err := h.documentRegistry.GetDocument(c.Param("id"))
+	if err != nil {
+		respondDocumentError(c, "Failed to get document", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.DocumentDetailResponse{
+		Document: toDocumentSummary(*document),
+		Chunks:   document.Chunks,
+	})
+}
+
+func (h *DocumentHandler) HandleDeleteDocument(c *gin.Context) {
+	id := c.Param("id")
+
+	deletedChunks, err := h.documentRegistry.DeleteDocument(id)
+	if err != nil {
+		respondDocumentError(c, "Failed to delete document", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.DeleteDocumentResponse{
+		ID:            id,
+		DeletedChunks: deletedChunks,
+	})
+}
+
+func respondDocumentError(c *gin.Context, message string, err error) {
+	if errors.Is(err, services.ErrDocumentNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error: "Document not found",
+			Code:  codes.ErrDocumentNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+		Error:   message,
+		Code:    codes.ErrDocumentError,
+		Details: err.Error(),
+	})
+}
+
+func toDocumentSummary(document types.Document) *types.UploadDocumentSummary {
+	return &types.UploadDocumentSummary{
+		ID:          document.ID,
+		Name:        document.Name,
+		Collection:  document.Collection,
+		Metadata:    document.Metadata,
+		ContentType: document.ContentType,
+		Info:        document.Info,
+		ChunksCount: len(document.Chunks),
+		UploadedAt:  document.UploadedAt,
+	}
+}
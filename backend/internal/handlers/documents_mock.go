@@ -0,0 +1,21 @@
+package handlers
+
+import "rag-backend/pkg/types"
+
+type mockDocumentManager struct {
+	listDocumentsFunc  func() ([]types.Document, error)
+	getDocumentFunc    func(id string) (*types.Document, error)
+	deleteDocumentFunc func(id string) (int, error)
+}
+
+func (m *mockDocumentManager) ListDocuments() ([]types.Document, error) {
+	return m.listDocumentsFunc()
+}
+
+func (m *mockDocumentManager) GetDocument(id string) (*types.Document, error) {
+	return m.getDocumentFunc(id)
+}
+
+func (m *mockDocumentManager) DeleteDocument(id string) (int, error) {
+	return m.deleteDocumentFunc(id)
+}
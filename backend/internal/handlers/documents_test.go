@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+func newDocumentsRouter(manager DocumentManager) *gin.Engine {
+	h := NewDocumentHandler(manager)
+	router := gin.New()
+	router.GET("/api/documents", h.HandleListDocuments)
+	router.GET("/api/documents/:id", h.HandleGetDocument)
+	router.DELETE("/api/documents/:id", h.HandleDeleteDocument)
+	return router
+}
+
+func TestHandleListDocuments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fixedTime := time.Date(2026, 4, 23, 10, 0, 0, 0, time.UTC)
+
+	type mock struct {
+		documents []types.Document
+		err       error
+	}
+	type expected struct {
+		status    int
+		code      string
+		summaries []types.UploadDocumentSummary
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		mock     mock
+		expected expected
+	}{
+		{
+			name: "returns summaries for registered documents",
+			mock: mock{documents: []types.Document{
+				{ID: "d1", Name: "a.txt", UploadedAt: fixedTime, Chunks: []types.DocumentChunk{{ID: "a.txt-chunk-0"}}},
+				{ID: "d2", Name: "b.pdf", UploadedAt: fixedTime, Chunks: []types.DocumentChunk{{ID: "b.pdf-chunk-0"}, {ID: "b.pdf-chunk-1"}}},
+			}},
+			expected: expected{
+				status: http.StatusOK,
+				summaries: []types.UploadDocumentSummary{
+					{ID: "d1", Name: "a.txt", ChunksCount: 1, UploadedAt: fixedTime},
+					{ID: "d2", Name: "b.pdf", ChunksCount: 2, UploadedAt: fixedTime},
+				},
+			},
+		},
+		{
+			name:  "filters by collection",
+			query: "?collection=contracts",
+			mock: mock{documents: []types.Document{
+				{ID: "d1", Name: "a.txt", Collection: types.DefaultCollection, UploadedAt: fixedTime},
+				{ID: "d2", Name: "nda.pdf", Collection: "contracts", UploadedAt: fixedTime},
+			}},
+			expected: expected{
+				status: http.StatusOK,
+				summaries: []types.UploadDocumentSummary{
+					{ID: "d2", Name: "nda.pdf", Collection: "contracts", UploadedAt: fixedTime},
+				},
+			},
+		},
+		{
+			name: "returns empty list when nothing is registered",
+			mock: mock{documents: []types.Document{}},
+			expected: expected{
+				status:    http.StatusOK,
+				summaries: []types.UploadDocumentSummary{},
+			},
+		},
+		{
+			name: "returns 500 when registry fails",
+			mock: mock{err: errors.New("registry down")},
+			expected: expected{
+				status: http.StatusInternalServerError,
+				code:   codes.ErrDocumentError,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newDocumentsRouter(&mockDocumentManager{
+				listDocumentsFunc: func() ([]types.Document, error) {
+					return tt.mock.documents, tt.mock.err
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/documents"+tt.query, nil))
+
+			assert.Equal(t, tt.expected.status, w.Code)
+
+			if tt.expected.status == http.StatusOK {
+				var resp types.DocumentListResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expected.summaries, resp.Documents)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
+
+func TestHandleGetDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	document := &types.Document{
+		ID:   "d1",
+		Name: "a.txt",
+		Chunks: []types.DocumentChunk{
+			{ID: "a.txt-chunk-0", DocumentID: "d1", Content: "hello"},
+		},
+	}
+
+	type mock struct {
+		document *types.Document
+		err      error
+	}
+	type expected struct {
+		status int
+		code   string
+	}
+
+	tests := []struct {
+		name     string
+		mock     mock
+		expected expected
+	}{
+		{
+			name:     "returns document with chunks",
+			mock:     mock{document: document},
+			expected: expected{status: http.StatusOK},
+		},
+		{
+			name:     "returns 404 when document is unknown",
+			mock:     mock{err: fmt.Errorf("failed to get document: %w", services.ErrDocumentNotFound)},
+			expected: expected{status: http.StatusNotFound, code: codes.ErrDocumentNotFound},
+		},
+		{
+			name:     "returns 500 on registry failure",
+			mock:     mock{err: errors.New("registry down")},
+			expected: expected{status: http.StatusInternalServerError, code: codes.ErrDocumentError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedID string
+			router := newDocumentsRouter(&mockDocumentManager{
+				getDocumentFunc: func(id string) (*types.Document, error) {
+					capturedID = id
+					return tt.mock.document, tt.mock.err
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/documents/d1", nil))
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, "d1", capturedID)
+
+			if tt.expected.status == http.StatusOK {
+				var resp types.DocumentDetailResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "d1", resp.Document.ID)
+				assert.Equal(t, 1, resp.Document.ChunksCount)
+				assert.Equal(t, document.Chunks, resp.Chunks)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
+
+func TestHandleDeleteDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type mock struct {
+		deleted int
+		err     error
+	}
+	type expected struct {
+		status  int
+		code    string
+		deleted int
+	}
+
+	tests := []struct {
+		name     string
+		mock     mock
+		expected expected
+	}{
+		{
+			name:     "returns number of deleted chunks",
+			mock:     mock{deleted: 3},
+			expected: expected{status: http.StatusOK, deleted: 3},
+		},
+		{
+			name:     "returns 404 when document is unknown",
+			mock:     mock{err: fmt.Errorf("failed to get document: %w", services.ErrDocumentNotFound)},
+			expected: expected{status: http.StatusNotFound, code: codes.ErrDocumentNotFound},
+		},
+		{
+			name:     "returns 500 when chunk removal fails",
+			mock:     mock{err: errors.New("vector store down")},
+			expected: expected{status: http.StatusInternalServerError, code: codes.ErrDocumentError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedID string
+			router := newDocumentsRouter(&mockDocumentManager{
+				deleteDocumentFunc: func(id string) (int, error) {
+					capturedID = id
+					return tt.mock.deleted, tt.mock.err
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/documents/d1", nil))
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, "d1", capturedID)
+
+			if tt.expected.status == http.StatusOK {
+				var resp types.DeleteDocumentResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "d1", resp.ID)
+				assert.Equal(t, tt.expected.deleted, resp.DeletedChunks)
+				return
+			}
+
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
@@ -9,15 +9,28 @@ import (
 	"rag-backend/pkg/types"
 )
 
-type HealthHandler struct{}
+type EmbeddingCacheReporter interface {
+	// EmbeddingCacheStats reports false when embeddings are not cached
+	EmbeddingCacheStats() (types.EmbeddingCacheStats, bool)
+}
+
+type HealthHandler struct {
+	embeddingCache EmbeddingCacheReporter
+}
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+func NewHealthHandler(embeddingCache EmbeddingCacheReporter) *HealthHandler {
+	return &HealthHandler{
+		embeddingCache: embeddingCache,
+	}
 }
 
 func (h *HealthHandler) HandleHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, types.HealthResponse{
+	response := types.HealthResponse{
 		Status:    "OK",
 		Timestamp: time.Now(),
-	})
+	}
+	if stats, ok := h.embeddingCache.EmbeddingCacheStats(); ok {
+		response.EmbeddingCache = &stats
+	}
+	c.JSON(http.StatusOK, response)
 }
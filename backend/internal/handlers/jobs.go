@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+type JobManager interface {
+	Job(id string) (types.Job, error)
+	Cancel(id string) (types.Job, error)
+}
+
+type JobHandler struct {
+	jobQueue JobManager
+}
+
+func NewJobHandler(jobQueue JobManager) *JobHandler {
+	return &JobHandler{
+		jobQueue: jobQueue,
+	}
+}
+
+func (h *JobHandler) HandleGetJob(c *gin.Context) {
+	job, err := h.jobQueue.Job(c.Param("id"))
+	if err != nil {
+		respondJobError(c, "Failed to get job", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.JobResponse{
+		Job: &job,
+	})
+}
+
+func (h *JobHandler) HandleCancelJob(c *gin.Context) {
+	job, err := h.jobQueue.Cancel(c.Param("id"))
+	if err != nil {
+		respondJobError(c, "Failed to cancel job", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.JobResponse{
+		Job: &job,
+	})
+}
+
+func respondJobError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error: "Job not found",
+			Code:  codes.ErrJobNotFound,
+		})
+	case errors.Is(err, services.ErrJobNotCancellable):
+		c.JSON(http.StatusConflict, types.ErrorResponse{
+			Error:   "Job can no longer be cancelled",
+			Code:    codes.ErrJobNotCancellable,
+			Details: err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   message,
+			Code:    codes.ErrJobError,
+			Details: err.Error(),
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import "rag-backend/pkg/types"
+
+type mockJobManager struct {
+	jobFunc    func(id string) (types.Job, error)
+	cancelFunc func(id string) (types.Job, error)
+}
+
+func (m *mockJobManager) Job(id string) (types.Job, error) {
+	return m.jobFunc(id)
+}
+
+func (m *mockJobManager) Cancel(id string) (types.Job, error) {
+	return m.cancelFunc(id)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+func newJobsRouter(manager JobManager) *gin.Engine {
+	h := NewJobHandler(manager)
+	router := gin.New()
+	router.GET("/api/jobs/:id", h.HandleGetJob)
+	router.POST("/api/jobs/:id/cancel", h.HandleCancelJob)
+	return router
+}
+
+func TestHandleGetJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	job := types.Job{ID: "j1", Status: types.JobStatusEmbedding, FileName: "report.pdf", ChunksTotal: 40, ChunksProcessed: 16}
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "returns job progress", status: http.StatusOK},
+		{name: "returns 404 when job is unknown", err: services.ErrJobNotFound, status: http.StatusNotFound, code: codes.ErrJobNotFound},
+		{name: "returns 500 on store failure", err: errors.New("store down"), status: http.StatusInternalServerError, code: codes.ErrJobError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var capturedID string
+			router := newJobsRouter(&mockJobManager{
+				jobFunc: func(id string) (types.Job, error) {
+					capturedID = id
+					if tt.err != nil {
+						return types.Job{}, tt.err
+					}
+					return job, nil
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/jobs/j1", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "j1", capturedID)
+
+			if tt.status == http.StatusOK {
+				var resp types.JobResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, &job, resp.Job)
+				return
+			}
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+		})
+	}
+}
+
+func TestHandleCancelJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "cancels the job", status: http.StatusOK},
+		{name: "returns 404 when job is unknown", err: services.ErrJobNotFound, status: http.StatusNotFound, code: codes.ErrJobNotFound},
+		{name: "returns 409 once the job is storing or finished", err: services.ErrJobNotCancellable, status: http.StatusConflict, code: codes.ErrJobNotCancellable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newJobsRouter(&mockJobManager{
+				cancelFunc: func(id string) (types.Job, error) {
+					if tt.err != nil {
+						return types.Job{}, tt.err
+					}
+					return types.Job{ID: id, Status: types.JobStatusCancelled}, nil
+				},
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/jobs/j1/cancel", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+
+			if tt.status == http.StatusOK {
+				var resp types.JobResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, types.JobStatusCancelled, resp.Job.Status)
+				return
+			}
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"rag-backend/pkg/codes"
 
@@ -11,22 +13,75 @@ import (
 	"rag-backend/pkg/types"
 )
 
+// maxMMRCandidates bounds how many chunks a query may ask MMR to choose from
+const maxMMRCandidates = 100
+
 type QueryService interface {
-	Query(question string) (*types.RAGResponse, error)
-	QueryStream(ctx context.Context, question string) (<-chan services.StreamEvent, error)
+	Query(request types.QueryRequest) (*types.RAGResponse, error)
+	QueryStream(ctx context.Context, request types.QueryRequest) (<-chan services.StreamEvent, error)
 }
 
 type QueryHandler struct {
-	ragPipeline QueryService
+	ragPipeline        QueryService
+	collectionRegistry CollectionResolver
 }
 
-func NewQueryHandler(ragPipeline QueryService) *QueryHandler {
+func NewQueryHandler(ragPipeline QueryService, collectionRegistry CollectionResolver) *QueryHandler {
 	return &QueryHandler{
-		ragPipeline: ragPipeline,
+		ragPipeline:        ragPipeline,
+		collectionRegistry: collectionRegistry,
 	}
 }
 
 func (h *QueryHandler) HandleQuery(c *gin.Context) {
+	request, ok := h.bindQueryRequest(c)
+	if !ok {
+		return
+	}
+
+	response, err := h.ragPipeline.Query(request)
+	if err != nil {
+		respondQueryError(c, "Failed to process query", codes.ErrQueryError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.QueryResponse{
+		Answer:             response.Answer,
+		Sources:            response.Sources,
+		SourceScores:       response.SourceScores,
+		DroppedChunks:      response.DroppedChunks,
+		Citations:          response.Citations,
+		InvalidCitations:   response.InvalidCitations,
+		NoAnswer:           response.NoAnswer,
+		NoAnswerCode:       response.NoAnswerCode,
+		Confidence:         response.Confidence,
+		ConversationID:     response.ConversationID,
+		StandaloneQuestion: response.StandaloneQuestion,
+	})
+}
+
+// respondQueryError reports an unknown conversation as 404 and anything else
+// as a 500 with the given code.
+func respondQueryError(c *gin.Context, message, code string, err error) {
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, types.ErrorResponse{
+			Error: "Conversation not found",
+			Code:  codes.ErrConversationNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+		Error:   message,
+		Code:    code,
+		Details: err.Error(),
+	})
+}
+
+// bindQueryRequest parses and validates the body shared by the query
+// endpoints, resolving the requested collections into Collections. On failure
+// it writes an error response and returns false.
+func (h *QueryHandler) bindQueryRequest(c *gin.Context) (types.QueryRequest, bool) {
 	var request types.QueryRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -34,7 +89,7 @@ func (h *QueryHandler) HandleQuery(c *gin.Context) {
 			Error: "Question is required and must be a string",
 			Code:  codes.ErrInvalidRequest,
 		})
-		return
+		return request, false
 	}
 
 	if request.Question == "" {
@@ -42,22 +97,72 @@ func (h *QueryHandler) HandleQuery(c *gin.Context) {
 			Error: "Question cannot be empty",
 			Code:  codes.ErrEmptyQuestion,
 		})
-		return
+		return request, false
 	}
 
-	response, err := h.ragPipeline.Query(request.Question)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "Failed to process query",
-			Code:    codes.ErrQueryError,
+	switch request.Mode {
+	case "", types.RetrievalModeVector, types.RetrievalModeKeyword, types.RetrievalModeHybrid:
+	default:
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error: fmt.Sprintf("Mode must be one of %q, %q or %q", types.RetrievalModeVector, types.RetrievalModeKeyword, types.RetrievalModeHybrid),
+			Code:  codes.ErrInvalidRequest,
+		})
+		return request, false
+	}
+
+	if w := request.KeywordWeight; w != nil && (*w < 0 || *w > 1) {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error: "keywordWeight must be between 0 and 1",
+			Code:  codes.ErrInvalidRequest,
+		})
+		return request, false
+	}
+
+	if message := validateMMR(request); message != "" {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error: message,
+			Code:  codes.ErrInvalidRequest,
+		})
+		return request, false
+	}
+
+	if err := request.Filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid metadata filter",
+			Code:    codes.ErrInvalidFilter,
 			Details: err.Error(),
 		})
-		return
+		return request, false
 	}
 
-	c.JSON(http.StatusOK, types.QueryResponse{
-		Answer:     response.Answer,
-		Sources:    response.Sources,
-		Confidence: response.Confidence,
-	})
+	names := request.Collections
+	if request.Collection != "" {
+		names = append(names, request.Collection)
+	}
+	collections, err := h.collectionRegistry.ResolveCollections(names...)
+	if err != nil {
+		respondCollectionError(c, "Failed to resolve collections", err)
+		return request, false
+	}
+	request.Collection = ""
+	request.Collections = collections
+
+	return request, true
+}
+
+// validateMMR checks the request's MMR settings, returning what is wrong with
+// them or ""
+func validateMMR(request types.QueryRequest) string {
+	switch {
+	case request.MMRCandidates < 0 || request.MMRCandidates > maxMMRCandidates:
+		return fmt.Sprintf("mmrCandidates must be between 1 and %d", maxMMRCandidates)
+	case request.MMRLambda == nil:
+		return ""
+	case *request.MMRLambda < 0 || *request.MMRLambda > 1:
+		return "mmrLambda must be between 0 and 1"
+	case request.Mode == types.RetrievalModeKeyword:
+		// Keyword results carry no embeddings to compare
+		return "mmrLambda needs vector or hybrid retrieval"
+	}
+	return ""
 }
@@ -8,14 +8,14 @@ import (
 )
 
 type mockQueryService struct {
-	queryFunc       func(question string) (*types.RAGResponse, error)
-	queryStreamFunc func(ctx context.Context, question string) (<-chan services.StreamEvent, error)
+	queryFunc       func(request types.QueryRequest) (*types.RAGResponse, error)
+	queryStreamFunc func(ctx context.Context, request types.QueryRequest) (<-chan services.StreamEvent, error)
 }
 
-func (m *mockQueryService) Query(question string) (*types.RAGResponse, error) {
-	return m.queryFunc(question)
+func (m *mockQueryService) Query(request types.QueryRequest) (*types.RAGResponse, error) {
+	return m.queryFunc(request)
 }
 
-func (m *mockQueryService) QueryStream(ctx context.Context, question string) (<-chan services.StreamEvent, error) {
-	return m.queryStreamFunc(ctx, question)
+func (m *mockQueryService) QueryStream(ctx context.Context, request types.QueryRequest) (<-chan services.StreamEvent, error) {
+	return m.queryStreamFunc(ctx, request)
 }
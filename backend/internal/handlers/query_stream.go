@@ -14,47 +14,39 @@ import (
 )
 
 const (
-	sseEventSources = "sources"
-	sseEventToken   = "token"
-	sseEventDone    = "done"
-	sseEventError   = "error"
+	sseEventSources   = "sources"
+	sseEventToken     = "token"
+	sseEventCitations = "citations"
+	sseEventDone      = "done"
+	sseEventError     = "error"
+	sseEventNoAnswer  = "no_answer"
 )
 
 type sseEvent struct {
-	Type       string                `json:"type"`
-	Sources    []types.DocumentChunk `json:"sources,omitempty"`
-	Confidence float64               `json:"confidence,omitempty"`
-	Content    string                `json:"content,omitempty"`
-	Error      string                `json:"error,omitempty"`
-	Code       string                `json:"code,omitempty"`
+	Type               string                `json:"type"`
+	Sources            []types.DocumentChunk `json:"sources,omitempty"`
+	SourceScores       []float64             `json:"sourceScores,omitempty"`
+	DroppedChunks      []string              `json:"droppedChunks,omitempty"`
+	Confidence         *float64              `json:"confidence,omitempty"`
+	ConversationID     string                `json:"conversationId,omitempty"`
+	StandaloneQuestion string                `json:"standaloneQuestion,omitempty"`
+	Content            string                `json:"content,omitempty"`
+	Answer             string                `json:"answer,omitempty"`
+	Citations          []types.Citation      `json:"citations,omitempty"`
+	InvalidCitations   []int                 `json:"invalidCitations,omitempty"`
+	Error              string                `json:"error,omitempty"`
+	Code               string                `json:"code,omitempty"`
 }
 
 func (h *QueryHandler) HandleQueryStream(c *gin.Context) {
-	var request types.QueryRequest
-
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error: "Question is required and must be a string",
-			Code:  codes.ErrInvalidRequest,
-		})
+	request, ok := h.bindQueryRequest(c)
+	if !ok {
 		return
 	}
 
-	if request.Question == "" {
-		c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error: "Question cannot be empty",
-			Code:  codes.ErrEmptyQuestion,
-		})
-		return
-	}
-
-	events, err := h.ragPipeline.QueryStream(c.Request.Context(), request.Question)
+	events, err := h.ragPipeline.QueryStream(c.Request.Context(), request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "Failed to start stream",
-			Code:    codes.ErrStreamError,
-			Details: err.Error(),
-		})
+		respondQueryError(c, "Failed to start stream", codes.ErrStreamError, err)
 		return
 	}
 
@@ -94,14 +86,36 @@ func writeStreamEvent(w io.Writer, ev services.StreamEvent) bool {
 			Code:  codes.ErrStreamError,
 		})
 		return false
+	case ev.NoAnswerCode != "":
+		writeSSEFrame(w, sseEvent{
+			Type:               sseEventNoAnswer,
+			Answer:             ev.Answer,
+			Code:               ev.NoAnswerCode,
+			DroppedChunks:      ev.DroppedChunks,
+			ConversationID:     ev.ConversationID,
+			StandaloneQuestion: ev.StandaloneQuestion,
+		})
+		return false
 	case ev.Done:
-		writeSSEFrame(w, sseEvent{Type: sseEventDone})
+		writeSSEFrame(w, sseEvent{Type: sseEventDone, Confidence: &ev.Confidence})
 		return false
 	case ev.Sources != nil:
 		writeSSEFrame(w, sseEvent{
-			Type:       sseEventSources,
-			Sources:    ev.Sources,
-			Confidence: ev.Confidence,
+			Type:               sseEventSources,
+			Sources:            ev.Sources,
+			SourceScores:       ev.SourceScores,
+			DroppedChunks:      ev.DroppedChunks,
+			Confidence:         &ev.Confidence,
+			ConversationID:     ev.ConversationID,
+			StandaloneQuestion: ev.StandaloneQuestion,
+		})
+		return true
+	case ev.Citations != nil:
+		writeSSEFrame(w, sseEvent{
+			Type:             sseEventCitations,
+			Answer:           ev.Answer,
+			Citations:        ev.Citations,
+			InvalidCitations: ev.InvalidCitations,
 		})
 		return true
 	case ev.Token != "":
@@ -70,7 +70,7 @@ func TestHandleQueryStream_ValidationErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := NewQueryHandler(&mockQueryService{})
+			h := NewQueryHandler(&mockQueryService{}, passthroughCollections())
 
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
@@ -91,25 +91,58 @@ func TestHandleQueryStream_ValidationErrors(t *testing.T) {
 func TestHandleQueryStream_PreStreamError(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	h := NewQueryHandler(&mockQueryService{
-		queryStreamFunc: func(_ context.Context, _ string) (<-chan services.StreamEvent, error) {
-			return nil, errors.New("vector store exploded")
+	type expected struct {
+		status       int
+		code         string
+		detailSubstr string
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected expected
+	}{
+		{
+			name: "returns 500 when retrieval fails",
+			err:  errors.New("vector store exploded"),
+			expected: expected{
+				status:       http.StatusInternalServerError,
+				code:         codes.ErrStreamError,
+				detailSubstr: "vector store exploded",
+			},
 		},
-	})
+		{
+			name:     "returns 404 for unknown conversation",
+			err:      fmt.Errorf("failed to load conversation: %w", services.ErrConversationNotFound),
+			expected: expected{status: http.StatusNotFound, code: codes.ErrConversationNotFound},
+		},
+	}
 
-	w := httptest.NewRecorder()
-	c, _ := gin.CreateTestContext(w)
-	c.Request = newStreamRequest(`{"question":"hi"}`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewQueryHandler(&mockQueryService{
+				queryStreamFunc: func(_ context.Context, _ types.QueryRequest) (<-chan services.StreamEvent, error) {
+					return nil, tt.err
+				},
+			}, passthroughCollections())
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = newStreamRequest(`{"question":"hi","conversationId":"c1"}`)
 
-	h.HandleQueryStream(c)
+			h.HandleQueryStream(c)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, tt.expected.status, w.Code)
 
-	var resp types.ErrorResponse
-	err := json.Unmarshal(w.Body.Bytes(), &resp)
-	assert.NoError(t, err)
-	assert.Equal(t, codes.ErrStreamError, resp.Code)
-	assert.Contains(t, resp.Details, "vector store exploded")
+			var resp types.ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.code, resp.Code)
+			if tt.expected.detailSubstr != "" {
+				assert.Contains(t, resp.Details, tt.expected.detailSubstr)
+			}
+		})
+	}
 }
 
 func TestHandleQueryStream_SuccessPath(t *testing.T) {
@@ -132,10 +165,11 @@ func TestHandleQueryStream_SuccessPath(t *testing.T) {
 				{Token: "Hello"},
 				{Token: " "},
 				{Token: "world"},
+				{Answer: "Hello world", Citations: []types.Citation{}},
 				{Done: true},
 			},
 			expected: expected{
-				frameTypes: []string{"sources", "token", "token", "token", "done"},
+				frameTypes: []string{"sources", "token", "token", "token", "citations", "done"},
 				tokens:     "Hello world",
 			},
 		},
@@ -173,10 +207,10 @@ func TestHandleQueryStream_SuccessPath(t *testing.T) {
 			close(ch)
 
 			h := NewQueryHandler(&mockQueryService{
-				queryStreamFunc: func(_ context.Context, _ string) (<-chan services.StreamEvent, error) {
+				queryStreamFunc: func(_ context.Context, _ types.QueryRequest) (<-chan services.StreamEvent, error) {
 					return ch, nil
 				},
-			})
+			}, passthroughCollections())
 
 			router := gin.New()
 			router.POST("/api/query/stream", h.HandleQueryStream)
@@ -216,3 +250,111 @@ func TestHandleQueryStream_SuccessPath(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteStreamEvent_SourcesCarryConversation(t *testing.T) {
+	var buf bytes.Buffer
+
+	keepGoing := writeStreamEvent(&buf, services.StreamEvent{
+		Sources:            []types.DocumentChunk{{ID: "c1"}},
+		Confidence:         0.8,
+		ConversationID:     "conv-1",
+		StandaloneQuestion: "When did Ada write it?",
+	})
+
+	assert.True(t, keepGoing)
+	frames := parseSSEFrames(buf.String())
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "sources", frames[0]["type"])
+		assert.Equal(t, "conv-1", frames[0]["conversationId"])
+		assert.Equal(t, "When did Ada write it?", frames[0]["standaloneQuestion"])
+	}
+}
+
+func TestWriteStreamEvent_Confidence(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      services.StreamEvent
+		keepGoing  bool
+		frameType  string
+		confidence float64
+		scores     []any
+	}{
+		{
+			name:       "sources carry per-source scores",
+			event:      services.StreamEvent{Sources: []types.DocumentChunk{{ID: "c1"}, {ID: "c2"}}, SourceScores: []float64{0.9, 0.4}, Confidence: 0.7},
+			keepGoing:  true,
+			frameType:  "sources",
+			confidence: 0.7,
+			scores:     []any{0.9, 0.4},
+		},
+		{
+			name:       "done carries the final confidence",
+			event:      services.StreamEvent{Done: true, Confidence: 0.55},
+			frameType:  "done",
+			confidence: 0.55,
+		},
+		{
+			name:       "an ungrounded answer sends a zero confidence",
+			event:      services.StreamEvent{Done: true},
+			frameType:  "done",
+			confidence: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			keepGoing := writeStreamEvent(&buf, tt.event)
+
+			assert.Equal(t, tt.keepGoing, keepGoing)
+			frames := parseSSEFrames(buf.String())
+			if assert.Len(t, frames, 1) {
+				assert.Equal(t, tt.frameType, frames[0]["type"])
+				assert.Contains(t, frames[0], "confidence")
+				assert.Equal(t, tt.confidence, frames[0]["confidence"])
+				if tt.scores != nil {
+					assert.Equal(t, tt.scores, frames[0]["sourceScores"])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteStreamEvent_Citations(t *testing.T) {
+	var buf bytes.Buffer
+
+	keepGoing := writeStreamEvent(&buf, services.StreamEvent{
+		Answer:           "In 1843 [1].",
+		Citations:        []types.Citation{{Number: 1, ChunkID: "c1", Start: 0, End: 12, Text: "In 1843."}},
+		InvalidCitations: []int{4},
+	})
+
+	assert.True(t, keepGoing)
+	frames := parseSSEFrames(buf.String())
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "citations", frames[0]["type"])
+		assert.Equal(t, "In 1843 [1].", frames[0]["answer"])
+		assert.Equal(t, []any{map[string]any{"number": 1.0, "chunkId": "c1", "start": 0.0, "end": 12.0, "text": "In 1843."}}, frames[0]["citations"])
+		assert.Equal(t, []any{4.0}, frames[0]["invalidCitations"])
+	}
+}
+
+func TestWriteStreamEvent_NoAnswer(t *testing.T) {
+	var buf bytes.Buffer
+
+	keepGoing := writeStreamEvent(&buf, services.StreamEvent{
+		NoAnswerCode:   codes.NoDocuments,
+		Answer:         "There are no documents to answer from.",
+		ConversationID: "conv-1",
+	})
+
+	assert.False(t, keepGoing, "no_answer ends the stream")
+	frames := parseSSEFrames(buf.String())
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, "no_answer", frames[0]["type"])
+		assert.Equal(t, codes.NoDocuments, frames[0]["code"])
+		assert.Equal(t, "There are no documents to answer from.", frames[0]["answer"])
+		assert.Equal(t, "conv-1", frames[0]["conversationId"])
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"rag-backend/internal/services"
 	"rag-backend/pkg/codes"
+	"rag-backend/pkg/filter"
 	"rag-backend/pkg/types"
 )
 
@@ -34,15 +38,25 @@ func TestHandleQuery(t *testing.T) {
 		detailSubstr string
 		answer       string
 		sources      []types.DocumentChunk
+		scores       []float64
 		confidence   float64
+		citations    []types.Citation
+		invalid      []int
+		conversation string
+		standalone   string
 	}
 
 	canned := &types.RAGResponse{
-		Answer: "forty-two",
+		Answer: "forty-two [1].",
 		Sources: []types.DocumentChunk{
 			{ID: "c1", Content: "ctx"},
 		},
-		Confidence: 0.8,
+		SourceScores:       []float64{0.91},
+		Citations:          []types.Citation{{Number: 1, ChunkID: "c1", Start: 0, End: 14, Text: "forty-two."}},
+		InvalidCitations:   []int{3},
+		Confidence:         0.8,
+		ConversationID:     "conv-1",
+		StandaloneQuestion: "What is the answer to everything?",
 	}
 
 	tests := []struct {
@@ -61,6 +75,45 @@ func TestHandleQuery(t *testing.T) {
 			body:     `{"question":""}`,
 			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
 		},
+		{
+			name:     "rejects unknown retrieval mode",
+			body:     `{"question":"hi","mode":"semantic"}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name:     "rejects keyword weight above 1",
+			body:     `{"question":"hi","mode":"hybrid","keywordWeight":1.5}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name:     "rejects negative keyword weight",
+			body:     `{"question":"hi","mode":"hybrid","keywordWeight":-0.1}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name:     "rejects MMR lambda above 1",
+			body:     `{"question":"hi","mmrLambda":1.2}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name:     "rejects too many MMR candidates",
+			body:     `{"question":"hi","mmrLambda":0.5,"mmrCandidates":500}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name:     "rejects MMR with keyword retrieval",
+			body:     `{"question":"hi","mode":"keyword","mmrLambda":0.5}`,
+			expected: expected{status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		},
+		{
+			name: "rejects invalid metadata filter",
+			body: `{"question":"hi","filter":{"field":"version","gt":"abc"}}`,
+			expected: expected{
+				status:       http.StatusBadRequest,
+				code:         codes.ErrInvalidFilter,
+				detailSubstr: "neither a number nor a date",
+			},
+		},
 		{
 			name: "returns 500 when pipeline fails",
 			body: `{"question":"hi"}`,
@@ -71,15 +124,29 @@ func TestHandleQuery(t *testing.T) {
 				detailSubstr: "vector store down",
 			},
 		},
+		{
+			name: "returns 404 for unknown conversation",
+			body: `{"question":"hi","conversationId":"missing"}`,
+			mock: mock{err: fmt.Errorf("failed to load conversation: %w", services.ErrConversationNotFound)},
+			expected: expected{
+				status: http.StatusNotFound,
+				code:   codes.ErrConversationNotFound,
+			},
+		},
 		{
 			name: "returns 200 with answer sources and confidence",
 			body: `{"question":"hi"}`,
 			mock: mock{response: canned},
 			expected: expected{
-				status:     http.StatusOK,
-				answer:     canned.Answer,
-				sources:    canned.Sources,
-				confidence: canned.Confidence,
+				status:       http.StatusOK,
+				answer:       canned.Answer,
+				sources:      canned.Sources,
+				scores:       canned.SourceScores,
+				confidence:   canned.Confidence,
+				citations:    canned.Citations,
+				invalid:      canned.InvalidCitations,
+				conversation: canned.ConversationID,
+				standalone:   canned.StandaloneQuestion,
 			},
 		},
 	}
@@ -87,10 +154,10 @@ func TestHandleQuery(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := NewQueryHandler(&mockQueryService{
-				queryFunc: func(string) (*types.RAGResponse, error) {
+				queryFunc: func(types.QueryRequest) (*types.RAGResponse, error) {
 					return tt.mock.response, tt.mock.err
 				},
-			})
+			}, passthroughCollections())
 
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
@@ -106,7 +173,12 @@ func TestHandleQuery(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.expected.answer, resp.Answer)
 				assert.Equal(t, tt.expected.sources, resp.Sources)
+				assert.Equal(t, tt.expected.scores, resp.SourceScores)
 				assert.Equal(t, tt.expected.confidence, resp.Confidence)
+				assert.Equal(t, tt.expected.citations, resp.Citations)
+				assert.Equal(t, tt.expected.invalid, resp.InvalidCitations)
+				assert.Equal(t, tt.expected.conversation, resp.ConversationID)
+				assert.Equal(t, tt.expected.standalone, resp.StandaloneQuestion)
 				return
 			}
 
@@ -120,3 +192,150 @@ func TestHandleQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleQuery_PassesRequestThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var captured types.QueryRequest
+	h := NewQueryHandler(&mockQueryService{
+		queryFunc: func(request types.QueryRequest) (*types.RAGResponse, error) {
+			captured = request
+			return &types.RAGResponse{}, nil
+		},
+	}, passthroughCollections())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newQueryRequest(`{"question":"hi","mode":"hybrid","keywordWeight":0.3,"conversationId":"conv-1","filter":{"field":"department","in":["legal","hr"]},"mmrLambda":0.6,"mmrCandidates":30}`)
+
+	h.HandleQuery(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hi", captured.Question)
+	assert.Equal(t, types.RetrievalModeHybrid, captured.Mode)
+	assert.Equal(t, "conv-1", captured.ConversationID)
+	if assert.NotNil(t, captured.KeywordWeight) {
+		assert.Equal(t, 0.3, *captured.KeywordWeight)
+	}
+	if assert.NotNil(t, captured.MMRLambda) {
+		assert.Equal(t, 0.6, *captured.MMRLambda)
+	}
+	assert.Equal(t, 30, captured.MMRCandidates)
+	if assert.NotNil(t, captured.Filter) {
+		assert.Equal(t, "department", captured.Filter.Field)
+		assert.Equal(t, []filter.Value{"legal", "hr"}, captured.Filter.In)
+	}
+}
+
+func TestHandleQuery_NoAnswer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NewQueryHandler(&mockQueryService{
+		queryFunc: func(types.QueryRequest) (*types.RAGResponse, error) {
+			return &types.RAGResponse{
+				Answer:         "I don't have enough information to answer this question.",
+				Sources:        []types.DocumentChunk{},
+				SourceScores:   []float64{},
+				Citations:      []types.Citation{},
+				NoAnswer:       true,
+				NoAnswerCode:   codes.NoRelevantContext,
+				ConversationID: "conv-1",
+			}, nil
+		},
+	}, passthroughCollections())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newQueryRequest(`{"question":"hi"}`)
+
+	h.HandleQuery(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response types.QueryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.NoAnswer)
+	assert.Equal(t, codes.NoRelevantContext, response.NoAnswerCode)
+	assert.Empty(t, response.Sources)
+}
+
+func TestHandleQuery_ResolvesCollections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type expected struct {
+		status      int
+		code        string
+		resolved    []string
+		collections []string
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		resolveErr error
+		expected   expected
+	}{
+		{
+			name:     "defaults to the default collection",
+			body:     `{"question":"hi"}`,
+			expected: expected{status: http.StatusOK, collections: []string{types.DefaultCollection}},
+		},
+		{
+			name: "merges collection into collections",
+			body: `{"question":"hi","collection":"contracts","collections":["reports"]}`,
+			expected: expected{
+				status:      http.StatusOK,
+				resolved:    []string{"reports", "contracts"},
+				collections: []string{"reports", "contracts"},
+			},
+		},
+		{
+			name:       "returns 404 for an unknown collection",
+			body:       `{"question":"hi","collection":"missing"}`,
+			resolveErr: fmt.Errorf("failed to get collection \"missing\": %w", services.ErrCollectionNotFound),
+			expected:   expected{status: http.StatusNotFound, code: codes.ErrCollectionNotFound, resolved: []string{"missing"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resolved []string
+			var captured *types.QueryRequest
+			h := NewQueryHandler(&mockQueryService{
+				queryFunc: func(request types.QueryRequest) (*types.RAGResponse, error) {
+					captured = &request
+					return &types.RAGResponse{}, nil
+				},
+			}, &mockCollectionResolver{
+				resolveCollectionsFunc: func(names ...string) ([]string, error) {
+					resolved = names
+					if tt.resolveErr != nil {
+						return nil, tt.resolveErr
+					}
+					return passthroughCollections().ResolveCollections(names...)
+				},
+			})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = newQueryRequest(tt.body)
+
+			h.HandleQuery(c)
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, tt.expected.resolved, resolved)
+
+			if tt.expected.status == http.StatusOK {
+				if assert.NotNil(t, captured) {
+					assert.Empty(t, captured.Collection)
+					assert.Equal(t, tt.expected.collections, captured.Collections)
+				}
+				return
+			}
+
+			assert.Nil(t, captured, "query must not run for an unknown collection")
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/types"
+)
+
+// maxSearchResults bounds how many results a search may ask for
+const maxSearchResults = 100
+
+type SearchService interface {
+	Search(request types.SearchRequest) ([]types.SearchResult, error)
+}
+
+type SearchHandler struct {
+	searchService      SearchService
+	collectionRegistry CollectionResolver
+}
+
+func NewSearchHandler(searchService SearchService, collectionRegistry CollectionResolver) *SearchHandler {
+	return &SearchHandler{
+		searchService:      searchService,
+		collectionRegistry: collectionRegistry,
+	}
+}
+
+// HandleSearch returns the chunks most similar to a query, or to an
+// embedding the caller made, without generating an answer
+func (h *SearchHandler) HandleSearch(c *gin.Context) {
+	var request types.SearchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Request body must be JSON with a query or an embedding",
+			Code:    codes.ErrInvalidRequest,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if request.Query == "" && len(request.Embedding) == 0 {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error: "Query or embedding is required",
+			Code:  codes.ErrEmptyQuery,
+		})
+		return
+	}
+
+	if request.TopK < 0 || request.TopK > maxSearchResults {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error: fmt.Sprintf("topK must be between 1 and %d", maxSearchResults),
+			Code:  codes.ErrInvalidRequest,
+		})
+		return
+	}
+
+	if err := request.Filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid metadata filter",
+			Code:    codes.ErrInvalidFilter,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	names := request.Collections
+	if request.Collection != "" {
+		names = append(names, request.Collection)
+	}
+	collections, err := h.collectionRegistry.ResolveCollections(names...)
+	if err != nil {
+		respondCollectionError(c, "Failed to resolve collections", err)
+		return
+	}
+	request.Collection = ""
+	request.Collections = collections
+
+	results, err := h.searchService.Search(request)
+	if errors.Is(err, services.ErrEmbeddingDimension) {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Embedding does not match the index",
+			Code:    codes.ErrInvalidEmbedding,
+			Details: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
+			Error:   "Failed to search",
+			Code:    codes.ErrSearchError,
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.SearchResponse{Results: results})
+}
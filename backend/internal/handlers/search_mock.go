@@ -0,0 +1,11 @@
+package handlers
+
+import "rag-backend/pkg/types"
+
+type mockSearchService struct {
+	searchFunc func(request types.SearchRequest) ([]types.SearchResult, error)
+}
+
+func (m *mockSearchService) Search(request types.SearchRequest) ([]types.SearchResult, error) {
+	return m.searchFunc(request)
+}
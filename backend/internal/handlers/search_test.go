@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/services"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/filter"
+	"rag-backend/pkg/types"
+)
+
+func newSearchRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/search", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestHandleSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	canned := []types.SearchResult{{
+		ScoredChunk: types.ScoredChunk{Chunk: types.DocumentChunk{ID: "c1", Content: "Paris is the capital", Metadata: map[string]string{"source": "a.txt"}}, Score: 0.83},
+		Highlights:  []types.Highlight{{Term: "paris", Start: 0, End: 5}},
+	}}
+
+	tests := []struct {
+		name         string
+		body         string
+		results      []types.SearchResult
+		err          error
+		status       int
+		code         string
+		detailSubstr string
+	}{
+		{name: "rejects malformed JSON", body: "{not-json", status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		{name: "rejects a request without query or embedding", body: `{"topK":5}`, status: http.StatusBadRequest, code: codes.ErrEmptyQuery},
+		{name: "rejects negative topK", body: `{"query":"paris","topK":-1}`, status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		{name: "rejects too large topK", body: `{"query":"paris","topK":500}`, status: http.StatusBadRequest, code: codes.ErrInvalidRequest},
+		{
+			name:         "rejects invalid metadata filter",
+			body:         `{"query":"paris","filter":{"field":"version","gt":"abc"}}`,
+			status:       http.StatusBadRequest,
+			code:         codes.ErrInvalidFilter,
+			detailSubstr: "neither a number nor a date",
+		},
+		{
+			name:   "rejects an embedding of the wrong dimension",
+			body:   `{"embedding":[0.1,0.2]}`,
+			err:    fmt.Errorf("%w: got 2 values, expected 3", services.ErrEmbeddingDimension),
+			status: http.StatusBadRequest,
+			code:   codes.ErrInvalidEmbedding,
+		},
+		{
+			name:         "returns 500 when the search fails",
+			body:         `{"query":"paris"}`,
+			err:          errors.New("embedding API down"),
+			status:       http.StatusInternalServerError,
+			code:         codes.ErrSearchError,
+			detailSubstr: "embedding API down",
+		},
+		{name: "returns results", body: `{"query":"paris"}`, results: canned, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewSearchHandler(&mockSearchService{
+				searchFunc: func(types.SearchRequest) ([]types.SearchResult, error) {
+					return tt.results, tt.err
+				},
+			}, passthroughCollections())
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = newSearchRequest(tt.body)
+
+			h.HandleSearch(c)
+
+			assert.Equal(t, tt.status, w.Code)
+
+			if tt.status == http.StatusOK {
+				var resp types.SearchResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.results, resp.Results)
+				return
+			}
+
+			var resp types.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+			if tt.detailSubstr != "" {
+				assert.Contains(t, resp.Details, tt.detailSubstr)
+			}
+		})
+	}
+}
+
+func TestHandleSearch_PassesRequestThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var captured types.SearchRequest
+	h := NewSearchHandler(&mockSearchService{
+		searchFunc: func(request types.SearchRequest) ([]types.SearchResult, error) {
+			captured = request
+			return []types.SearchResult{}, nil
+		},
+	}, passthroughCollections())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newSearchRequest(`{"query":"paris","embedding":[0.1,0.2,0.3],"topK":5,"collection":"reports","filter":{"field":"department","in":["legal"]}}`)
+
+	h.HandleSearch(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"results":[]}`, w.Body.String())
+	assert.Equal(t, "paris", captured.Query)
+	assert.Equal(t, []float64{0.1, 0.2, 0.3}, captured.Embedding)
+	assert.Equal(t, 5, captured.TopK)
+	assert.Equal(t, "", captured.Collection)
+	assert.Equal(t, []string{"reports"}, captured.Collections)
+	if assert.NotNil(t, captured.Filter) {
+		assert.Equal(t, []filter.Value{"legal"}, captured.Filter.In)
+	}
+}
@@ -1,40 +1,94 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"mime/multipart"
+	"maps"
 	"net/http"
 	"rag-backend/pkg/codes"
+	"slices"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"rag-backend/internal/services"
+	"rag-backend/pkg/filter"
 	"rag-backend/pkg/types"
 )
 
 const maxFileSize = 10 << 20 // 10mb
 
+// Limits on user metadata attached at upload time. Every chunk carries a copy,
+// so keep it small.
+const (
+	maxMetadataFields      = 32
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 512
+)
+
+// queueFullRetryAfter is the Retry-After hint, in seconds, sent when the
+// ingestion queue is full
+const queueFullRetryAfter = 10
+
+// reservedMetadataKeys are set by the pipeline and cannot be supplied by users
+var reservedMetadataKeys = []string{"source", "section", "page_start", "page_end"}
+
 type DocumentIngester interface {
-	ProcessDocument(content string, metadata map[string]string) ([]types.DocumentChunk, error)
+	ProcessDocument(ctx context.Context, file types.ExtractedFile, collection string, metadata map[string]string, progress services.EmbeddingProgress) ([]types.DocumentChunk, error)
 	AddDocumentToVectorStore(chunks []types.DocumentChunk) error
 }
 
 type FileProcessor interface {
-	ProcessFile(fileHeader *multipart.FileHeader) (string, error)
+	Extract(content []byte, filename, declaredType string) (types.ExtractedFile, error)
 	CreateDocument(content, fileName string) types.Document
 }
 
+type DocumentRegistrar interface {
+	RegisterDocument(document types.Document) error
+	ClaimUpload(collection, name, contentHash string) (previous *types.Document, release func(), err error)
+	ReplaceDocument(document types.Document) error
+}
+
+// UploadCollections resolves the collection an upload names and keeps it from
+// being deleted while the upload is stored in it
+type UploadCollections interface {
+	CollectionResolver
+	WithCollection(name string, store func() error) error
+}
+
+type JobSubmitter interface {
+	Submit(fileName, collection string, run services.JobFunc) (types.Job, error)
+}
+
 type UploadHandler struct {
-	ragPipeline       DocumentIngester
-	documentProcessor FileProcessor
+	ragPipeline        DocumentIngester
+	documentProcessor  FileProcessor
+	documentRegistry   DocumentRegistrar
+	collectionRegistry UploadCollections
+	jobQueue           JobSubmitter
 }
 
-func NewUploadHandler(ragPipeline DocumentIngester, documentProcessor FileProcessor) *UploadHandler {
+func NewUploadHandler(ragPipeline DocumentIngester, documentProcessor FileProcessor, documentRegistry DocumentRegistrar, collectionRegistry UploadCollections, jobQueue JobSubmitter) *UploadHandler {
 	return &UploadHandler{
-		ragPipeline:       ragPipeline,
-		documentProcessor: documentProcessor,
+		ragPipeline:        ragPipeline,
+		documentProcessor:  documentProcessor,
+		documentRegistry:   documentRegistry,
+		collectionRegistry: collectionRegistry,
+		jobQueue:           jobQueue,
 	}
 }
 
+// upload is a validated upload waiting to be ingested
+type upload struct {
+	fileName     string
+	contentType  string
+	content      []byte
+	collection   string
+	userMetadata map[string]string
+}
+
 func (h *UploadHandler) HandleUpload(c *gin.Context) {
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
@@ -53,51 +107,206 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 		return
 	}
 
-	content, err := h.documentProcessor.ProcessFile(fileHeader)
+	// Check the collection before paying for extraction and embeddings
+	var names []string
+	if name := c.PostForm("collection"); name != "" {
+		names = append(names, name)
+	}
+	collections, err := h.collectionRegistry.ResolveCollections(names...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "Failed to process document",
-			Code:    codes.ErrProcessing,
+		respondCollectionError(c, "Failed to resolve collection", err)
+		return
+	}
+	collection := collections[0]
+
+	userMetadata, err := parseUserMetadata(c.PostForm("metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.ErrorResponse{
+			Error:   "Invalid metadata",
+			Code:    codes.ErrInvalidMetadata,
 			Details: err.Error(),
 		})
 		return
 	}
 
-	document := h.documentProcessor.CreateDocument(content, fileHeader.Filename)
-
-	// Process into chunks with embeddings
-	metadata := map[string]string{
-		"source": fileHeader.Filename,
-	}
-	chunks, err := h.ragPipeline.ProcessDocument(content, metadata)
+	content, err := services.ReadUpload(fileHeader)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "Failed to process document chunks",
-			Code:    codes.ErrChunking,
+			Error:   "Failed to read file",
+			Code:    codes.ErrProcessing,
 			Details: err.Error(),
 		})
 		return
 	}
 
-	if err := h.ragPipeline.AddDocumentToVectorStore(chunks); err != nil {
+	pending := upload{
+		fileName:     fileHeader.Filename,
+		contentType:  fileHeader.Header.Get("Content-Type"),
+		content:      content,
+		collection:   collection,
+		userMetadata: userMetadata,
+	}
+	job, err := h.jobQueue.Submit(pending.fileName, collection, func(ctx context.Context, progress services.JobProgress) error {
+		return h.ingest(ctx, progress, pending)
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrQueueFull) || errors.Is(err, services.ErrQueueClosed) {
+			c.Header("Retry-After", strconv.Itoa(queueFullRetryAfter))
+			c.JSON(http.StatusServiceUnavailable, types.ErrorResponse{
+				Error:   "Too many uploads in progress",
+				Code:    codes.ErrQueueFull,
+				Details: err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error:   "Failed to store document chunks",
-			Code:    codes.ErrStorage,
+			Error:   "Failed to queue document",
+			Code:    codes.ErrProcessing,
 			Details: err.Error(),
 		})
 		return
 	}
 
+	c.Header("Location", "/api/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, types.JobResponse{
+		Job: &job,
+	})
+}
+
+// ingest extracts, embeds and stores an upload. It runs on a job queue worker,
+// and failures carry the error code a client polling the job will see.
+func (h *UploadHandler) ingest(ctx context.Context, progress services.JobProgress, pending upload) error {
+	extracted, err := h.documentProcessor.Extract(pending.content, pending.fileName, pending.contentType)
+	if err != nil {
+		return &services.CodedError{Code: processingErrorCode(err), Err: err}
+	}
+	content := extracted.Content
+
+	document := h.documentProcessor.CreateDocument(content, pending.fileName)
+	document.ContentType = extracted.ContentType
+	document.Info = extracted.Info
+	document.Collection = pending.collection
+	document.Metadata = pending.userMetadata
+
+	// Re-uploads are matched by name, or by content under another name.
+	// Identical ones are left alone rather than paying for their embeddings
+	// again; changed ones of the same name keep the document ID so links to
+	// it still work. The claim is held until the document is registered, so
+	// a concurrent upload of the same file waits and then finds it.
+	previous, release, err := h.documentRegistry.ClaimUpload(pending.collection, pending.fileName, document.ContentHash)
+	if err != nil {
+		return &services.CodedError{Code: codes.ErrStorage, Err: err}
+	}
+	defer release()
+	outcome := types.UploadOutcomeCreated
+	if previous != nil {
+		if previous.ContentHash == document.ContentHash && maps.Equal(previous.Metadata, document.Metadata) {
+			progress.SetResult(&types.UploadResponse{
+				Document:     toDocumentSummary(*previous),
+				Outcome:      types.UploadOutcomeUnchanged,
+				SkippedPages: extracted.SkippedPages,
+			})
+			return nil
+		}
+		if previous.Name == pending.fileName {
+			document.ID = previous.ID
+			outcome = types.UploadOutcomeReplaced
+		}
+	}
+
+	if err := progress.SetStatus(types.JobStatusEmbedding); err != nil {
+		return err
+	}
+
+	// Process into chunks with embeddings
+	metadata := make(map[string]string, len(pending.userMetadata)+1)
+	for key, value := range pending.userMetadata {
+		metadata[key] = value
+	}
+	metadata["source"] = pending.fileName
+	chunks, err := h.ragPipeline.ProcessDocument(ctx, extracted, pending.collection, metadata, progress.SetChunks)
+	if err != nil {
+		return &services.CodedError{Code: codes.ErrChunking, Err: err}
+	}
+
+	for i := range chunks {
+		chunks[i].DocumentID = document.ID
+	}
 	document.Chunks = chunks
 
-	c.JSON(http.StatusOK, types.UploadResponse{
-		Document: &types.UploadDocumentSummary{
-			ID:          document.ID,
-			Name:        document.Name,
-			ChunksCount: len(document.Chunks),
-			UploadedAt:  document.UploadedAt,
-		},
+	// Storing can't be cancelled, so stop here if the job already was
+	if err := progress.SetStatus(types.JobStatusStoring); err != nil {
+		return err
+	}
+
+	// The collection may have been deleted while the job was queued or
+	// embedding, in which case there is nowhere left to store the document
+	err = h.collectionRegistry.WithCollection(pending.collection, func() error {
+		if outcome == types.UploadOutcomeReplaced {
+			return h.documentRegistry.ReplaceDocument(document)
+		}
+		if err := h.ragPipeline.AddDocumentToVectorStore(chunks); err != nil {
+			return err
+		}
+		return h.documentRegistry.RegisterDocument(document)
 	})
+	if errors.Is(err, services.ErrCollectionNotFound) {
+		return &services.CodedError{Code: codes.ErrCollectionNotFound, Err: err}
+	}
+	if err != nil {
+		return &services.CodedError{Code: codes.ErrStorage, Err: err}
+	}
+
+	progress.SetResult(&types.UploadResponse{
+		Document:     toDocumentSummary(document),
+		Outcome:      outcome,
+		SkippedPages: extracted.SkippedPages,
+	})
+	return nil
+}
+
+func processingErrorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrUnsupportedFileType):
+		return codes.ErrUnsupportedFileType
+	case errors.Is(err, services.ErrContentTypeMismatch):
+		return codes.ErrContentTypeMismatch
+	default:
+		return codes.ErrProcessing
+	}
+}
+
+// parseUserMetadata decodes the optional "metadata" form field, a JSON object
+// of scalar values such as {"department":"legal","version":2}. Numbers and
+// booleans are stored in their JSON text form.
+func parseUserMetadata(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var fields map[string]filter.Value
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object of strings, numbers or booleans: %w", err)
+	}
+	if len(fields) > maxMetadataFields {
+		return nil, fmt.Errorf("metadata has %d fields, the maximum is %d", len(fields), maxMetadataFields)
+	}
+
+	metadata := make(map[string]string, len(fields))
+	for key, value := range fields {
+		switch {
+		case key == "":
+			return nil, errors.New("metadata keys cannot be empty")
+		case len(key) > maxMetadataKeyLength:
+			return nil, fmt.Errorf("metadata key %q is longer than %d characters", key, maxMetadataKeyLength)
+		case slices.Contains(reservedMetadataKeys, key):
+			return nil, fmt.Errorf("metadata key %q is reserved", key)
+		case len(value) > maxMetadataValueLength:
+			return nil, fmt.Errorf("metadata value for %q is longer than %d characters", key, maxMetadataValueLength)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
 }
 
 func userFriendlyFileSizeFormatter(bytes int64) string {
@@ -1,18 +1,19 @@
 package handlers
 
 import (
-	"mime/multipart"
+	"context"
 
+	"rag-backend/internal/services"
 	"rag-backend/pkg/types"
 )
 
 type mockDocumentIngester struct {
-	processDocumentFunc          func(content string, metadata map[string]string) ([]types.DocumentChunk, error)
+	processDocumentFunc          func(file types.ExtractedFile, collection string, metadata map[string]string) ([]types.DocumentChunk, error)
 	addDocumentToVectorStoreFunc func(chunks []types.DocumentChunk) error
 }
 
-func (m *mockDocumentIngester) ProcessDocument(content string, metadata map[string]string) ([]types.DocumentChunk, error) {
-	return m.processDocumentFunc(content, metadata)
+func (m *mockDocumentIngester) ProcessDocument(_ context.Context, file types.ExtractedFile, collection string, metadata map[string]string, _ services.EmbeddingProgress) ([]types.DocumentChunk, error) {
+	return m.processDocumentFunc(file, collection, metadata)
 }
 
 func (m *mockDocumentIngester) AddDocumentToVectorStore(chunks []types.DocumentChunk) error {
@@ -20,14 +21,71 @@ func (m *mockDocumentIngester) AddDocumentToVectorStore(chunks []types.DocumentC
 }
 
 type mockFileProcessor struct {
-	processFileFunc    func(fileHeader *multipart.FileHeader) (string, error)
+	extractFunc        func(content []byte, filename, declaredType string) (types.ExtractedFile, error)
 	createDocumentFunc func(content, fileName string) types.Document
 }
 
-func (m *mockFileProcessor) ProcessFile(fileHeader *multipart.FileHeader) (string, error) {
-	return m.processFileFunc(fileHeader)
+func (m *mockFileProcessor) Extract(content []byte, filename, declaredType string) (types.ExtractedFile, error) {
+	return m.extractFunc(content, filename, declaredType)
 }
 
 func (m *mockFileProcessor) CreateDocument(content, fileName string) types.Document {
 	return m.createDocumentFunc(content, fileName)
 }
+
+type mockDocumentRegistrar struct {
+	registerDocumentFunc func(document types.Document) error
+	claimUploadFunc      func(collection, name, contentHash string) (*types.Document, error)
+	replaceDocumentFunc  func(document types.Document) error
+}
+
+func (m *mockDocumentRegistrar) RegisterDocument(document types.Document) error {
+	return m.registerDocumentFunc(document)
+}
+
+func (m *mockDocumentRegistrar) ClaimUpload(collection, name, contentHash string) (*types.Document, func(), error) {
+	previous, err := m.claimUploadFunc(collection, name, contentHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return previous, func() {}, nil
+}
+
+func (m *mockDocumentRegistrar) ReplaceDocument(document types.Document) error {
+	return m.replaceDocumentFunc(document)
+}
+
+// mockJobSubmitter runs each submitted job straight away and records how it
+// went, so tests can check the outcome once HandleUpload returns.
+type mockJobSubmitter struct {
+	submitErr error
+
+	job      types.Job
+	statuses []string
+	runErr   error
+}
+
+func (m *mockJobSubmitter) Submit(fileName, collection string, run services.JobFunc) (types.Job, error) {
+	if m.submitErr != nil {
+		return types.Job{}, m.submitErr
+	}
+	m.job = types.Job{ID: "job-1", Status: types.JobStatusQueued, FileName: fileName, Collection: collection}
+	queued := m.job
+	m.runErr = run(context.Background(), m)
+	return queued, nil
+}
+
+func (m *mockJobSubmitter) SetStatus(status string) error {
+	m.statuses = append(m.statuses, status)
+	m.job.Status = status
+	return nil
+}
+
+func (m *mockJobSubmitter) SetChunks(processed, total int) {
+	m.job.ChunksProcessed = processed
+	m.job.ChunksTotal = total
+}
+
+func (m *mockJobSubmitter) SetResult(result *types.UploadResponse) {
+	m.job.Result = result
+}
@@ -9,12 +9,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 
+	"rag-backend/internal/services"
 	"rag-backend/pkg/codes"
 	"rag-backend/pkg/types"
 )
@@ -44,6 +47,36 @@ func newUploadRequest(t *testing.T, filename, contentType string, content []byte
 	return req
 }
 
+// newUploadRequestWithFields builds a text upload with extra form fields.
+// Empty field values are left out of the form.
+func newUploadRequestWithFields(t *testing.T, filename string, content []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatalf("newUploadRequestWithFields: write field: %v", err)
+		}
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("newUploadRequestWithFields: create part: %v", err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatalf("newUploadRequestWithFields: write content: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("newUploadRequestWithFields: close writer: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
 func newUploadRequestWithoutFile(t *testing.T) *http.Request {
 	t.Helper()
 	body := new(bytes.Buffer)
@@ -74,26 +107,32 @@ func TestHandleUpload(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	type mock struct {
-		processFileContent string
-		processFileErr     error
-		createDocument     types.Document
-		processDocChunks   []types.DocumentChunk
-		processDocErr      error
-		addToStoreErr      error
+		submitErr        error
+		extractContent   string
+		extractErr       error
+		createDocument   types.Document
+		processDocChunks []types.DocumentChunk
+		processDocErr    error
+		addToStoreErr    error
+		registerErr      error
 	}
 	type calls struct {
-		processFile     int
-		createDocument  int
-		processDocument int
-		addToStore      int
+		extract          int
+		createDocument   int
+		processDocument  int
+		addToStore       int
+		registerDocument int
 	}
 	type expected struct {
 		status        int
 		code          string
 		detailSubstr  string
 		errorContains string
-		document      *types.UploadDocumentSummary
-		calls         calls
+		// jobCode and jobError describe how an accepted upload's job failed
+		jobCode  string
+		jobError string
+		document *types.UploadDocumentSummary
+		calls    calls
 	}
 
 	fixedID := "doc-123"
@@ -140,72 +179,130 @@ func TestHandleUpload(t *testing.T) {
 			},
 		},
 		{
-			name: "returns 500 when document processor fails",
+			name: "returns 503 when the ingestion queue is full",
+			buildRequest: func(t *testing.T) *http.Request {
+				return newUploadRequest(t, "sample.txt", "text/plain", []byte("content"))
+			},
+			mock: mock{submitErr: services.ErrQueueFull},
+			expected: expected{
+				status:       http.StatusServiceUnavailable,
+				code:         codes.ErrQueueFull,
+				detailSubstr: "queue is full",
+				calls:        calls{},
+			},
+		},
+		{
+			name: "fails the job when the document processor fails",
+			buildRequest: func(t *testing.T) *http.Request {
+				return newUploadRequest(t, "hello.txt", "text/plain", []byte("x"))
+			},
+			mock: mock{extractErr: errors.New("read boom")},
+			expected: expected{
+				status:   http.StatusAccepted,
+				jobCode:  codes.ErrProcessing,
+				jobError: "read boom",
+				calls:    calls{extract: 1},
+			},
+		},
+		{
+			name: "fails the job when the file type is unsupported",
+			buildRequest: func(t *testing.T) *http.Request {
+				return newUploadRequest(t, "image.png", "image/png", []byte("x"))
+			},
+			mock: mock{extractErr: fmt.Errorf("%w: image/png", services.ErrUnsupportedFileType)},
+			expected: expected{
+				status:   http.StatusAccepted,
+				jobCode:  codes.ErrUnsupportedFileType,
+				jobError: "image/png",
+				calls:    calls{extract: 1},
+			},
+		},
+		{
+			name: "fails the job when the content contradicts the declared type",
 			buildRequest: func(t *testing.T) *http.Request {
 				return newUploadRequest(t, "hello.txt", "text/plain", []byte("x"))
 			},
-			mock: mock{processFileErr: errors.New("read boom")},
+			mock: mock{extractErr: fmt.Errorf("%w: declared type text/plain says text but the content is not valid UTF-8 text", services.ErrContentTypeMismatch)},
+			expected: expected{
+				status:   http.StatusAccepted,
+				jobCode:  codes.ErrContentTypeMismatch,
+				jobError: "not valid UTF-8",
+				calls:    calls{extract: 1},
+			},
+		},
+		{
+			name: "fails the job when pipeline chunking fails",
+			buildRequest: func(t *testing.T) *http.Request {
+				return newUploadRequest(t, "sample.txt", "text/plain", []byte("content"))
+			},
+			mock: mock{
+				extractContent: "parsed content",
+				createDocument: stubDoc,
+				processDocErr:  errors.New("embed boom"),
+			},
 			expected: expected{
-				status:       http.StatusInternalServerError,
-				code:         codes.ErrProcessing,
-				detailSubstr: "read boom",
-				calls:        calls{processFile: 1},
+				status:   http.StatusAccepted,
+				jobCode:  codes.ErrChunking,
+				jobError: "embed boom",
+				calls:    calls{extract: 1, createDocument: 1, processDocument: 1},
 			},
 		},
 		{
-			name: "returns 500 when pipeline chunking fails",
+			name: "fails the job when vector store storage fails",
 			buildRequest: func(t *testing.T) *http.Request {
 				return newUploadRequest(t, "sample.txt", "text/plain", []byte("content"))
 			},
 			mock: mock{
-				processFileContent: "parsed content",
-				createDocument:     stubDoc,
-				processDocErr:      errors.New("embed boom"),
+				extractContent:   "parsed content",
+				createDocument:   stubDoc,
+				processDocChunks: fixedChunks[:2],
+				addToStoreErr:    errors.New("store boom"),
 			},
 			expected: expected{
-				status:       http.StatusInternalServerError,
-				code:         codes.ErrChunking,
-				detailSubstr: "embed boom",
-				calls:        calls{processFile: 1, createDocument: 1, processDocument: 1},
+				status:   http.StatusAccepted,
+				jobCode:  codes.ErrStorage,
+				jobError: "store boom",
+				calls:    calls{extract: 1, createDocument: 1, processDocument: 1, addToStore: 1},
 			},
 		},
 		{
-			name: "returns 500 when vector store storage fails",
+			name: "fails the job when document registration fails",
 			buildRequest: func(t *testing.T) *http.Request {
 				return newUploadRequest(t, "sample.txt", "text/plain", []byte("content"))
 			},
 			mock: mock{
-				processFileContent: "parsed content",
-				createDocument:     stubDoc,
-				processDocChunks:   fixedChunks[:2],
-				addToStoreErr:      errors.New("store boom"),
+				extractContent:   "parsed content",
+				createDocument:   stubDoc,
+				processDocChunks: fixedChunks,
+				registerErr:      errors.New("registry boom"),
 			},
 			expected: expected{
-				status:       http.StatusInternalServerError,
-				code:         codes.ErrStorage,
-				detailSubstr: "store boom",
-				calls:        calls{processFile: 1, createDocument: 1, processDocument: 1, addToStore: 1},
+				status:   http.StatusAccepted,
+				jobCode:  codes.ErrStorage,
+				jobError: "registry boom",
+				calls:    calls{extract: 1, createDocument: 1, processDocument: 1, addToStore: 1, registerDocument: 1},
 			},
 		},
 		{
-			name: "returns 200 with upload summary on success",
+			name: "returns 202 and completes the job with the upload summary",
 			buildRequest: func(t *testing.T) *http.Request {
 				return newUploadRequest(t, "sample.txt", "text/plain", []byte("full content"))
 			},
 			mock: mock{
-				processFileContent: "parsed content",
-				createDocument:     stubDoc,
-				processDocChunks:   fixedChunks,
+				extractContent:   "parsed content",
+				createDocument:   stubDoc,
+				processDocChunks: fixedChunks,
 			},
 			expected: expected{
-				status: http.StatusOK,
+				status: http.StatusAccepted,
 				document: &types.UploadDocumentSummary{
 					ID:          fixedID,
 					Name:        "sample.txt",
+					ContentType: "text/plain",
 					ChunksCount: 3,
 					UploadedAt:  fixedTime,
 				},
-				calls: calls{processFile: 1, createDocument: 1, processDocument: 1, addToStore: 1},
+				calls: calls{extract: 1, createDocument: 1, processDocument: 1, addToStore: 1, registerDocument: 1},
 			},
 		},
 	}
@@ -213,20 +310,22 @@ func TestHandleUpload(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var got calls
-			var capturedContent string
+			var capturedContent, capturedCollection string
 			var capturedMetadata map[string]string
 			var capturedChunks []types.DocumentChunk
+			var registeredDocument types.Document
 			var createDocumentCalledWith struct {
 				content  string
 				fileName string
 			}
 
 			ingester := &mockDocumentIngester{
-				processDocumentFunc: func(content string, metadata map[string]string) ([]types.DocumentChunk, error) {
+				processDocumentFunc: func(file types.ExtractedFile, collection string, metadata map[string]string) ([]types.DocumentChunk, error) {
 					got.processDocument++
-					capturedContent = content
+					capturedContent = file.Content
+					capturedCollection = collection
 					capturedMetadata = metadata
-					return tt.mock.processDocChunks, tt.mock.processDocErr
+					return slices.Clone(tt.mock.processDocChunks), tt.mock.processDocErr
 				},
 				addDocumentToVectorStoreFunc: func(chunks []types.DocumentChunk) error {
 					got.addToStore++
@@ -235,9 +334,9 @@ func TestHandleUpload(t *testing.T) {
 				},
 			}
 			processor := &mockFileProcessor{
-				processFileFunc: func(*multipart.FileHeader) (string, error) {
-					got.processFile++
-					return tt.mock.processFileContent, tt.mock.processFileErr
+				extractFunc: func([]byte, string, string) (types.ExtractedFile, error) {
+					got.extract++
+					return types.ExtractedFile{Content: tt.mock.extractContent, ContentType: "text/plain"}, tt.mock.extractErr
 				},
 				createDocumentFunc: func(content, fileName string) types.Document {
 					got.createDocument++
@@ -246,7 +345,16 @@ func TestHandleUpload(t *testing.T) {
 					return tt.mock.createDocument
 				},
 			}
-			h := NewUploadHandler(ingester, processor)
+			registrar := &mockDocumentRegistrar{
+				registerDocumentFunc: func(document types.Document) error {
+					got.registerDocument++
+					registeredDocument = document
+					return tt.mock.registerErr
+				},
+				claimUploadFunc: noPreviousDocument,
+			}
+			jobs := &mockJobSubmitter{submitErr: tt.mock.submitErr}
+			h := NewUploadHandler(ingester, processor, registrar, passthroughCollections(), jobs)
 
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
@@ -257,19 +365,52 @@ func TestHandleUpload(t *testing.T) {
 			assert.Equal(t, tt.expected.status, w.Code)
 			assert.Equal(t, tt.expected.calls, got)
 
-			if tt.expected.status == http.StatusOK {
-				var resp types.UploadResponse
-				err := json.Unmarshal(w.Body.Bytes(), &resp)
-				assert.NoError(t, err)
+			if tt.expected.status == http.StatusAccepted {
+				var accepted types.JobResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+				if assert.NotNil(t, accepted.Job) {
+					assert.Equal(t, "job-1", accepted.Job.ID)
+					assert.Equal(t, types.JobStatusQueued, accepted.Job.Status)
+				}
+				assert.Equal(t, "/api/jobs/job-1", w.Header().Get("Location"))
+
+				if tt.expected.jobCode != "" {
+					var coded *services.CodedError
+					if assert.ErrorAs(t, jobs.runErr, &coded) {
+						assert.Equal(t, tt.expected.jobCode, coded.Code)
+					}
+					assert.ErrorContains(t, jobs.runErr, tt.expected.jobError)
+					assert.Nil(t, jobs.job.Result)
+					return
+				}
+
+				assert.NoError(t, jobs.runErr)
+				assert.Equal(t, []string{types.JobStatusEmbedding, types.JobStatusStoring}, jobs.statuses)
+				if !assert.NotNil(t, jobs.job.Result) {
+					return
+				}
+				resp := jobs.job.Result
+				assert.Equal(t, types.UploadOutcomeCreated, resp.Outcome)
 				assert.NotNil(t, resp.Document)
 				assert.Equal(t, tt.expected.document.ID, resp.Document.ID)
 				assert.Equal(t, tt.expected.document.Name, resp.Document.Name)
 				assert.Equal(t, tt.expected.document.ChunksCount, resp.Document.ChunksCount)
+				assert.Equal(t, tt.expected.document.ContentType, resp.Document.ContentType)
+				assert.Equal(t, tt.expected.document.ContentType, registeredDocument.ContentType)
 				assert.True(t, tt.expected.document.UploadedAt.Equal(resp.Document.UploadedAt))
 
 				assert.Equal(t, "parsed content", capturedContent)
+				assert.Equal(t, types.DefaultCollection, capturedCollection)
+				assert.Equal(t, types.DefaultCollection, registeredDocument.Collection)
+				assert.Equal(t, types.DefaultCollection, resp.Document.Collection)
 				assert.Equal(t, map[string]string{"source": "sample.txt"}, capturedMetadata)
-				assert.Equal(t, fixedChunks, capturedChunks)
+				expectedChunks := slices.Clone(fixedChunks)
+				for i := range expectedChunks {
+					expectedChunks[i].DocumentID = fixedID
+				}
+				assert.Equal(t, expectedChunks, capturedChunks)
+				assert.Equal(t, fixedID, registeredDocument.ID)
+				assert.Equal(t, expectedChunks, registeredDocument.Chunks)
 				assert.Equal(t, "parsed content", createDocumentCalledWith.content)
 				assert.Equal(t, "sample.txt", createDocumentCalledWith.fileName)
 				return
@@ -279,6 +420,9 @@ func TestHandleUpload(t *testing.T) {
 			err := json.Unmarshal(w.Body.Bytes(), &resp)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.expected.code, resp.Code)
+			if tt.expected.status == http.StatusServiceUnavailable {
+				assert.NotEmpty(t, w.Header().Get("Retry-After"))
+			}
 			if tt.expected.detailSubstr != "" {
 				assert.Contains(t, resp.Details, tt.expected.detailSubstr)
 			}
@@ -289,6 +433,497 @@ func TestHandleUpload(t *testing.T) {
 	}
 }
 
+func noPreviousDocument(_, _, _ string) (*types.Document, error) {
+	return nil, nil
+}
+
+func TestHandleUpload_ReUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uploadedAt := time.Date(2026, 4, 23, 10, 0, 0, 0, time.UTC)
+	previous := &types.Document{
+		ID:          "doc-old",
+		Name:        "sample.txt",
+		Collection:  types.DefaultCollection,
+		ContentHash: services.ContentHash("parsed content"),
+		Chunks:      []types.DocumentChunk{{ID: "c0"}, {ID: "c1"}},
+		UploadedAt:  uploadedAt,
+	}
+	renamed := &types.Document{
+		ID:          "doc-old",
+		Name:        "copy.txt",
+		Collection:  types.DefaultCollection,
+		ContentHash: services.ContentHash("parsed content"),
+		UploadedAt:  uploadedAt,
+	}
+
+	type expected struct {
+		outcome    string
+		documentID string
+		embedded   bool
+		replaced   bool
+		registered bool
+		jobCode    string
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		metadata string
+		previous *types.Document
+		findErr  error
+		expected expected
+	}{
+		{
+			name:     "identical re-upload is left unchanged without embedding",
+			content:  "parsed content",
+			previous: previous,
+			expected: expected{outcome: types.UploadOutcomeUnchanged, documentID: "doc-old"},
+		},
+		{
+			name:     "changed content replaces the previous version under its ID",
+			content:  "edited content",
+			previous: previous,
+			expected: expected{outcome: types.UploadOutcomeReplaced, documentID: "doc-old", embedded: true, replaced: true},
+		},
+		{
+			name:     "changed metadata replaces the previous version",
+			content:  "parsed content",
+			metadata: `{"version":2}`,
+			previous: previous,
+			expected: expected{outcome: types.UploadOutcomeReplaced, documentID: "doc-old", embedded: true, replaced: true},
+		},
+		{
+			name:     "new file name creates a document",
+			content:  "parsed content",
+			expected: expected{outcome: types.UploadOutcomeCreated, documentID: "doc-new", embedded: true, registered: true},
+		},
+		{
+			name:     "same content under another name is left unchanged",
+			content:  "parsed content",
+			previous: renamed,
+			expected: expected{outcome: types.UploadOutcomeUnchanged, documentID: "doc-old"},
+		},
+		{
+			name:     "same content under another name with other metadata creates a document",
+			content:  "parsed content",
+			metadata: `{"version":2}`,
+			previous: renamed,
+			expected: expected{outcome: types.UploadOutcomeCreated, documentID: "doc-new", embedded: true, registered: true},
+		},
+		{
+			name:     "lookup failure fails the job before embedding",
+			content:  "parsed content",
+			findErr:  errors.New("store down"),
+			expected: expected{jobCode: codes.ErrStorage},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedded, replaced, registered := false, false, false
+			var stored types.Document
+
+			ingester := &mockDocumentIngester{
+				processDocumentFunc: func(types.ExtractedFile, string, map[string]string) ([]types.DocumentChunk, error) {
+					embedded = true
+					return []types.DocumentChunk{{ID: "c0"}}, nil
+				},
+				addDocumentToVectorStoreFunc: func([]types.DocumentChunk) error { return nil },
+			}
+			processor := &mockFileProcessor{
+				extractFunc: func([]byte, string, string) (types.ExtractedFile, error) {
+					return types.ExtractedFile{Content: tt.content, ContentType: "text/plain"}, nil
+				},
+				createDocumentFunc: func(content, fileName string) types.Document {
+					return types.Document{ID: "doc-new", Name: fileName, Content: content, ContentHash: services.ContentHash(content)}
+				},
+			}
+			registrar := &mockDocumentRegistrar{
+				claimUploadFunc: func(collection, _, contentHash string) (*types.Document, error) {
+					assert.Equal(t, types.DefaultCollection, collection)
+					assert.Equal(t, services.ContentHash(tt.content), contentHash)
+					return tt.previous, tt.findErr
+				},
+				registerDocumentFunc: func(document types.Document) error {
+					registered = true
+					stored = document
+					return nil
+				},
+				replaceDocumentFunc: func(document types.Document) error {
+					replaced = true
+					stored = document
+					return nil
+				},
+			}
+			jobs := &mockJobSubmitter{}
+			h := NewUploadHandler(ingester, processor, registrar, passthroughCollections(), jobs)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = newUploadRequestWithFields(t, "sample.txt", []byte("content"), map[string]string{"metadata": tt.metadata})
+
+			h.HandleUpload(c)
+
+			assert.Equal(t, http.StatusAccepted, w.Code)
+			assert.Equal(t, tt.expected.embedded, embedded)
+			assert.Equal(t, tt.expected.replaced, replaced)
+			assert.Equal(t, tt.expected.registered, registered)
+
+			if tt.expected.jobCode != "" {
+				var coded *services.CodedError
+				if assert.ErrorAs(t, jobs.runErr, &coded) {
+					assert.Equal(t, tt.expected.jobCode, coded.Code)
+				}
+				return
+			}
+
+			assert.NoError(t, jobs.runErr)
+			if !assert.NotNil(t, jobs.job.Result) {
+				return
+			}
+			assert.Equal(t, tt.expected.outcome, jobs.job.Result.Outcome)
+			assert.Equal(t, tt.expected.documentID, jobs.job.Result.Document.ID)
+			if tt.expected.embedded {
+				assert.Equal(t, tt.expected.documentID, stored.ID)
+				assert.Equal(t, tt.expected.documentID, stored.Chunks[0].DocumentID)
+			}
+		})
+	}
+}
+
+func TestHandleUpload_Collection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type expected struct {
+		status     int
+		code       string
+		resolved   []string
+		collection string
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		resolveErr error
+		expected   expected
+	}{
+		{
+			name:     "uploads into the default collection when none is given",
+			expected: expected{status: http.StatusAccepted, collection: types.DefaultCollection},
+		},
+		{
+			name:       "uploads into the named collection",
+			collection: "contracts",
+			expected:   expected{status: http.StatusAccepted, resolved: []string{"contracts"}, collection: "contracts"},
+		},
+		{
+			name:       "returns 404 before processing when the collection is unknown",
+			collection: "missing",
+			resolveErr: fmt.Errorf("failed to get collection \"missing\": %w", services.ErrCollectionNotFound),
+			expected:   expected{status: http.StatusNotFound, code: codes.ErrCollectionNotFound, resolved: []string{"missing"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resolved []string
+			var ingestedCollection string
+			processed := false
+
+			resolver := &mockCollectionResolver{
+				resolveCollectionsFunc: func(names ...string) ([]string, error) {
+					resolved = names
+					if tt.resolveErr != nil {
+						return nil, tt.resolveErr
+					}
+					return passthroughCollections().ResolveCollections(names...)
+				},
+				withCollectionFunc: passthroughCollections().WithCollection,
+			}
+			ingester := &mockDocumentIngester{
+				processDocumentFunc: func(_ types.ExtractedFile, collection string, _ map[string]string) ([]types.DocumentChunk, error) {
+					ingestedCollection = collection
+					return []types.DocumentChunk{{ID: "c0", Collection: collection}}, nil
+				},
+				addDocumentToVectorStoreFunc: func([]types.DocumentChunk) error { return nil },
+			}
+			processor := &mockFileProcessor{
+				extractFunc: func([]byte, string, string) (types.ExtractedFile, error) {
+					processed = true
+					return types.ExtractedFile{Content: "parsed content", ContentType: "text/plain"}, nil
+				},
+				createDocumentFunc: func(content, fileName string) types.Document {
+					return types.Document{ID: "doc-1", Name: fileName, Content: content}
+				},
+			}
+			registrar := &mockDocumentRegistrar{
+				registerDocumentFunc: func(types.Document) error { return nil },
+				claimUploadFunc:      noPreviousDocument,
+			}
+			jobs := &mockJobSubmitter{}
+			h := NewUploadHandler(ingester, processor, registrar, resolver, jobs)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = newUploadRequestWithFields(t, "sample.txt", []byte("content"), map[string]string{"collection": tt.collection})
+
+			h.HandleUpload(c)
+
+			assert.Equal(t, tt.expected.status, w.Code)
+			assert.Equal(t, tt.expected.resolved, resolved)
+
+			if tt.expected.status == http.StatusAccepted {
+				var resp types.JobResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expected.collection, resp.Job.Collection)
+				assert.NoError(t, jobs.runErr)
+				assert.Equal(t, tt.expected.collection, ingestedCollection)
+				assert.Equal(t, tt.expected.collection, jobs.job.Result.Document.Collection)
+				return
+			}
+
+			assert.False(t, processed, "file must not be processed for an unknown collection")
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expected.code, resp.Code)
+		})
+	}
+}
+
+func TestHandleUpload_Metadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		metadata string
+		status   int
+		chunk    map[string]string
+		document map[string]string
+	}{
+		{
+			name:   "chunks carry only the source without user metadata",
+			status: http.StatusAccepted,
+			chunk:  map[string]string{"source": "sample.txt"},
+		},
+		{
+			name:     "user metadata is attached to chunks and document",
+			metadata: `{"department":"legal","version":2,"tags":"nda,signed"}`,
+			status:   http.StatusAccepted,
+			chunk:    map[string]string{"source": "sample.txt", "department": "legal", "version": "2", "tags": "nda,signed"},
+			document: map[string]string{"department": "legal", "version": "2", "tags": "nda,signed"},
+		},
+		{
+			name:     "rejects invalid metadata before processing",
+			metadata: `{"source":"spoofed.txt"}`,
+			status:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunkMetadata map[string]string
+			var registered types.Document
+			processed := false
+
+			ingester := &mockDocumentIngester{
+				processDocumentFunc: func(_ types.ExtractedFile, _ string, metadata map[string]string) ([]types.DocumentChunk, error) {
+					chunkMetadata = metadata
+					return []types.DocumentChunk{{ID: "c0", Metadata: metadata}}, nil
+				},
+				addDocumentToVectorStoreFunc: func([]types.DocumentChunk) error { return nil },
+			}
+			processor := &mockFileProcessor{
+				extractFunc: func([]byte, string, string) (types.ExtractedFile, error) {
+					processed = true
+					return types.ExtractedFile{Content: "parsed content", ContentType: "text/plain"}, nil
+				},
+				createDocumentFunc: func(content, fileName string) types.Document {
+					return types.Document{ID: "doc-1", Name: fileName, Content: content}
+				},
+			}
+			registrar := &mockDocumentRegistrar{
+				registerDocumentFunc: func(document types.Document) error {
+					registered = document
+					return nil
+				},
+				claimUploadFunc: noPreviousDocument,
+			}
+			jobs := &mockJobSubmitter{}
+			h := NewUploadHandler(ingester, processor, registrar, passthroughCollections(), jobs)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = newUploadRequestWithFields(t, "sample.txt", []byte("content"), map[string]string{"metadata": tt.metadata})
+
+			h.HandleUpload(c)
+
+			assert.Equal(t, tt.status, w.Code)
+
+			if tt.status == http.StatusAccepted {
+				assert.NoError(t, jobs.runErr)
+				assert.Equal(t, tt.chunk, chunkMetadata)
+				assert.Equal(t, tt.document, registered.Metadata)
+				assert.Equal(t, tt.document, jobs.job.Result.Document.Metadata)
+				return
+			}
+
+			assert.False(t, processed, "file must not be processed with invalid metadata")
+			var resp types.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, codes.ErrInvalidMetadata, resp.Code)
+		})
+	}
+}
+
+func TestHandleUpload_ReportsPDFDetails(t *testing.T) {
+	created := time.Date(2024, 3, 15, 8, 30, 0, 0, time.UTC)
+	info := &types.DocumentInfo{Title: "Annual Report", Author: "Jane Doe", CreatedAt: &created}
+	skipped := []types.SkippedPage{{Page: 2, Reason: "page has no text, it may be a scanned image"}}
+	extracted := types.ExtractedFile{
+		Content:      "First page\n\nThird page",
+		ContentType:  "application/pdf",
+		Pages:        []types.PageOffset{{Page: 1, Offset: 0}, {Page: 3, Offset: 12}},
+		SkippedPages: skipped,
+		Info:         info,
+	}
+
+	var processedFile types.ExtractedFile
+	var registered types.Document
+	ingester := &mockDocumentIngester{
+		processDocumentFunc: func(file types.ExtractedFile, _ string, metadata map[string]string) ([]types.DocumentChunk, error) {
+			processedFile = file
+			return []types.DocumentChunk{{ID: "c0", Metadata: metadata}}, nil
+		},
+		addDocumentToVectorStoreFunc: func([]types.DocumentChunk) error { return nil },
+	}
+	processor := &mockFileProcessor{
+		extractFunc: func([]byte, string, string) (types.ExtractedFile, error) {
+			return extracted, nil
+		},
+		createDocumentFunc: func(content, fileName string) types.Document {
+			return types.Document{ID: "doc-1", Name: fileName, Content: content}
+		},
+	}
+	registrar := &mockDocumentRegistrar{
+		registerDocumentFunc: func(document types.Document) error {
+			registered = document
+			return nil
+		},
+		claimUploadFunc: noPreviousDocument,
+	}
+	jobs := &mockJobSubmitter{}
+	h := NewUploadHandler(ingester, processor, registrar, passthroughCollections(), jobs)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newUploadRequest(t, "report.pdf", "application/pdf", []byte("%PDF-1.4"))
+
+	h.HandleUpload(c)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.NoError(t, jobs.runErr)
+	assert.Equal(t, extracted, processedFile, "pages must reach the pipeline")
+	assert.Equal(t, info, registered.Info)
+	if assert.NotNil(t, jobs.job.Result) {
+		assert.Equal(t, skipped, jobs.job.Result.SkippedPages)
+		assert.Equal(t, info, jobs.job.Result.Document.Info)
+	}
+}
+
+func TestHandleUpload_CollectionDeletedBeforeStoring(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stored := false
+	ingester := &mockDocumentIngester{
+		processDocumentFunc: func(types.ExtractedFile, string, map[string]string) ([]types.DocumentChunk, error) {
+			return []types.DocumentChunk{{ID: "c0"}}, nil
+		},
+		addDocumentToVectorStoreFunc: func([]types.DocumentChunk) error {
+			stored = true
+			return nil
+		},
+	}
+	processor := &mockFileProcessor{
+		extractFunc: func([]byte, string, string) (types.ExtractedFile, error) {
+			return types.ExtractedFile{Content: "parsed content", ContentType: "text/plain"}, nil
+		},
+		createDocumentFunc: func(content, fileName string) types.Document {
+			return types.Document{ID: "doc-1", Name: fileName, Content: content}
+		},
+	}
+	registrar := &mockDocumentRegistrar{
+		registerDocumentFunc: func(types.Document) error {
+			stored = true
+			return nil
+		},
+		claimUploadFunc: noPreviousDocument,
+	}
+	resolver := passthroughCollections()
+	resolver.withCollectionFunc = func(name string, _ func() error) error {
+		return fmt.Errorf("failed to get collection %q: %w", name, services.ErrCollectionNotFound)
+	}
+	jobs := &mockJobSubmitter{}
+	h := NewUploadHandler(ingester, processor, registrar, resolver, jobs)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newUploadRequestWithFields(t, "sample.txt", []byte("content"), map[string]string{"collection": "contracts"})
+
+	h.HandleUpload(c)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var coded *services.CodedError
+	if assert.ErrorAs(t, jobs.runErr, &coded) {
+		assert.Equal(t, codes.ErrCollectionNotFound, coded.Code)
+	}
+	assert.False(t, stored, "nothing is stored in a deleted collection")
+}
+
+func TestParseUserMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected map[string]string
+		err      string
+	}{
+		{name: "empty field means no metadata"},
+		{name: "scalars become strings", raw: `{"team":"ml","version":1.5,"draft":false}`, expected: map[string]string{"team": "ml", "version": "1.5", "draft": "false"}},
+		{name: "rejects non-objects", raw: `["a"]`, err: "must be a JSON object"},
+		{name: "rejects nested values", raw: `{"tags":["a","b"]}`, err: "must be a JSON object"},
+		{name: "rejects reserved keys", raw: `{"source":"x"}`, err: `metadata key "source" is reserved`},
+		{name: "rejects the section key", raw: `{"section":"x"}`, err: `metadata key "section" is reserved`},
+		{name: "rejects page keys", raw: `{"page_start":"1"}`, err: `metadata key "page_start" is reserved`},
+		{name: "rejects empty keys", raw: `{"":"x"}`, err: "metadata keys cannot be empty"},
+		{name: "rejects long keys", raw: fmt.Sprintf(`{"%s":"x"}`, strings.Repeat("k", maxMetadataKeyLength+1)), err: "is longer than 64 characters"},
+		{name: "rejects long values", raw: fmt.Sprintf(`{"k":"%s"}`, strings.Repeat("v", maxMetadataValueLength+1)), err: `metadata value for "k" is longer than 512 characters`},
+		{name: "rejects too many fields", raw: manyMetadataFields(maxMetadataFields + 1), err: "metadata has 33 fields, the maximum is 32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := parseUserMetadata(tt.raw)
+
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				assert.Nil(t, metadata)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, metadata)
+		})
+	}
+}
+
+func manyMetadataFields(n int) string {
+	fields := make(map[string]string, n)
+	for i := range n {
+		fields[fmt.Sprintf("k%d", i)] = "v"
+	}
+	raw, _ := json.Marshal(fields)
+	return string(raw)
+}
+
 func TestUserFriendlyFileSizeFormatter(t *testing.T) {
 	tests := []struct {
 		name     string
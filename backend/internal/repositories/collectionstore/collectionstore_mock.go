@@ -0,0 +1,26 @@
+package collectionstore
+
+import "rag-backend/pkg/types"
+
+type MockCollectionStore struct {
+	CreateFunc func(collection types.Collection) error
+	GetFunc    func(name string) (types.Collection, error)
+	ListFunc   func() ([]types.Collection, error)
+	DeleteFunc func(name string) error
+}
+
+func (m *MockCollectionStore) Create(collection types.Collection) error {
+	return m.CreateFunc(collection)
+}
+
+func (m *MockCollectionStore) Get(name string) (types.Collection, error) {
+	return m.GetFunc(name)
+}
+
+func (m *MockCollectionStore) List() ([]types.Collection, error) {
+	return m.ListFunc()
+}
+
+func (m *MockCollectionStore) Delete(name string) error {
+	return m.DeleteFunc(name)
+}
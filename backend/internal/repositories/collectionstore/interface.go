@@ -0,0 +1,22 @@
+package collectionstore
+
+import (
+	"errors"
+
+	"rag-backend/pkg/types"
+)
+
+var (
+	// ErrCollectionNotFound is returned when no collection has the requested name.
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionExists is returned when creating a collection whose name is taken.
+	ErrCollectionExists = errors.New("collection already exists")
+)
+
+// CollectionStore defines the interface for the registry of named collections
+type CollectionStore interface {
+	Create(collection types.Collection) error
+	Get(name string) (types.Collection, error)
+	List() ([]types.Collection, error)
+	Delete(name string) error
+}
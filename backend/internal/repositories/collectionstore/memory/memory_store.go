@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"rag-backend/internal/repositories/collectionstore"
+	"rag-backend/pkg/types"
+)
+
+type MemoryCollectionStore struct {
+	collections map[string]types.Collection
+	mutex       sync.RWMutex
+}
+
+func NewMemoryCollectionStore() collectionstore.CollectionStore {
+	return &MemoryCollectionStore{
+		collections: make(map[string]types.Collection),
+	}
+}
+
+func (mcs *MemoryCollectionStore) Create(collection types.Collection) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+	if _, ok := mcs.collections[collection.Name]; ok {
+		return collectionstore.ErrCollectionExists
+	}
+	mcs.collections[collection.Name] = collection
+	return nil
+}
+
+func (mcs *MemoryCollectionStore) Get(name string) (types.Collection, error) {
+	mcs.mutex.RLock()
+	defer mcs.mutex.RUnlock()
+	collection, ok := mcs.collections[name]
+	if !ok {
+		return types.Collection{}, collectionstore.ErrCollectionNotFound
+	}
+	return collection, nil
+}
+
+// List returns every collection ordered by name.
+func (mcs *MemoryCollectionStore) List() ([]types.Collection, error) {
+	mcs.mutex.RLock()
+	defer mcs.mutex.RUnlock()
+
+	collections := make([]types.Collection, 0, len(mcs.collections))
+	for _, collection := range mcs.collections {
+		collections = append(collections, collection)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Name < collections[j].Name
+	})
+	return collections, nil
+}
+
+func (mcs *MemoryCollectionStore) Delete(name string) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+	if _, ok := mcs.collections[name]; !ok {
+		return collectionstore.ErrCollectionNotFound
+	}
+	delete(mcs.collections, name)
+	return nil
+}
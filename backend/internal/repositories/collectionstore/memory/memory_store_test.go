@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/repositories/collectionstore"
+	"rag-backend/pkg/types"
+)
+
+func TestMemoryCollectionStore(t *testing.T) {
+	store := NewMemoryCollectionStore()
+
+	assert.NoError(t, store.Create(types.Collection{Name: "hr", Description: "People policies"}))
+	assert.NoError(t, store.Create(types.Collection{Name: "engineering"}))
+
+	t.Run("create rejects duplicate name", func(t *testing.T) {
+		err := store.Create(types.Collection{Name: "hr"})
+		assert.ErrorIs(t, err, collectionstore.ErrCollectionExists)
+
+		collection, err := store.Get("hr")
+		assert.NoError(t, err)
+		assert.Equal(t, "People policies", collection.Description, "duplicate must not overwrite")
+	})
+
+	t.Run("get returns not found for unknown name", func(t *testing.T) {
+		_, err := store.Get("missing")
+		assert.ErrorIs(t, err, collectionstore.ErrCollectionNotFound)
+	})
+
+	t.Run("list is ordered by name", func(t *testing.T) {
+		collections, err := store.List()
+		assert.NoError(t, err)
+		assert.Len(t, collections, 2)
+		assert.Equal(t, "engineering", collections[0].Name)
+		assert.Equal(t, "hr", collections[1].Name)
+	})
+
+	t.Run("delete removes collection", func(t *testing.T) {
+		assert.NoError(t, store.Delete("hr"))
+		_, err := store.Get("hr")
+		assert.ErrorIs(t, err, collectionstore.ErrCollectionNotFound)
+	})
+
+	t.Run("delete returns not found for unknown name", func(t *testing.T) {
+		assert.ErrorIs(t, store.Delete("missing"), collectionstore.ErrCollectionNotFound)
+	})
+}
@@ -0,0 +1,21 @@
+package conversationstore
+
+import "rag-backend/pkg/types"
+
+type MockConversationStore struct {
+	GetFunc    func(id string) (types.Conversation, error)
+	AppendFunc func(id string, messages ...types.ChatMessage) error
+	DeleteFunc func(id string) error
+}
+
+func (m *MockConversationStore) Get(id string) (types.Conversation, error) {
+	return m.GetFunc(id)
+}
+
+func (m *MockConversationStore) Append(id string, messages ...types.ChatMessage) error {
+	return m.AppendFunc(id, messages...)
+}
+
+func (m *MockConversationStore) Delete(id string) error {
+	return m.DeleteFunc(id)
+}
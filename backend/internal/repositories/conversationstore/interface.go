@@ -0,0 +1,18 @@
+package conversationstore
+
+import (
+	"errors"
+
+	"rag-backend/pkg/types"
+)
+
+// ErrConversationNotFound is returned when no conversation matches the requested ID.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ConversationStore defines the interface for chat history storage
+type ConversationStore interface {
+	Get(id string) (types.Conversation, error)
+	// Append adds messages to a conversation, creating it if it doesn't exist
+	Append(id string, messages ...types.ChatMessage) error
+	Delete(id string) error
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"rag-backend/internal/repositories/conversationstore"
+	"rag-backend/pkg/types"
+)
+
+// MemoryConversationStore keeps conversations in memory. A conversation
+// expires ttl after its last turn, and once more than capacity are kept the
+// least recently updated one is dropped. A zero ttl or capacity disables that
+// limit.
+type MemoryConversationStore struct {
+	ttl      time.Duration
+	capacity int
+	// order holds the conversations, most recently updated first
+	order         *list.List
+	conversations map[string]*list.Element
+	now           func() time.Time
+	mutex         sync.RWMutex
+}
+
+func NewMemoryConversationStore(ttl time.Duration, capacity int) conversationstore.ConversationStore {
+	return &MemoryConversationStore{
+		ttl:           ttl,
+		capacity:      capacity,
+		order:         list.New(),
+		conversations: make(map[string]*list.Element),
+		now:           time.Now,
+	}
+}
+
+// Get returns a copy of the conversation so callers can't mutate stored history.
+func (mcs *MemoryConversationStore) Get(id string) (types.Conversation, error) {
+	mcs.mutex.RLock()
+	defer mcs.mutex.RUnlock()
+	element, ok := mcs.conversations[id]
+	if !ok || mcs.expired(element, mcs.now()) {
+		return types.Conversation{}, conversationstore.ErrConversationNotFound
+	}
+	conversation := *element.Value.(*types.Conversation)
+	conversation.Messages = slices.Clone(conversation.Messages)
+	return conversation, nil
+}
+
+func (mcs *MemoryConversationStore) Append(id string, messages ...types.ChatMessage) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	now := mcs.now()
+	mcs.evictExpired(now)
+
+	element, ok := mcs.conversations[id]
+	if !ok {
+		element = mcs.order.PushFront(&types.Conversation{ID: id, CreatedAt: now})
+		mcs.conversations[id] = element
+	}
+	conversation := element.Value.(*types.Conversation)
+	conversation.Messages = append(conversation.Messages, messages...)
+	conversation.UpdatedAt = now
+	mcs.order.MoveToFront(element)
+
+	if mcs.capacity > 0 && mcs.order.Len() > mcs.capacity {
+		mcs.remove(mcs.order.Back())
+	}
+	return nil
+}
+
+func (mcs *MemoryConversationStore) Delete(id string) error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+	element, ok := mcs.conversations[id]
+	if !ok || mcs.expired(element, mcs.now()) {
+		return conversationstore.ErrConversationNotFound
+	}
+	mcs.remove(element)
+	return nil
+}
+
+// evictExpired drops the conversations whose last turn is older than the ttl.
+// They are at the back of order, least recently updated.
+func (mcs *MemoryConversationStore) evictExpired(now time.Time) {
+	for oldest := mcs.order.Back(); oldest != nil && mcs.expired(oldest, now); oldest = mcs.order.Back() {
+		mcs.remove(oldest)
+	}
+}
+
+func (mcs *MemoryConversationStore) expired(element *list.Element, now time.Time) bool {
+	return mcs.ttl > 0 && now.Sub(element.Value.(*types.Conversation).UpdatedAt) >= mcs.ttl
+}
+
+func (mcs *MemoryConversationStore) remove(element *list.Element) {
+	mcs.order.Remove(element)
+	delete(mcs.conversations, element.Value.(*types.Conversation).ID)
+}
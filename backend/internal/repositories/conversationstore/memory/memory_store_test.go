@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/repositories/conversationstore"
+	"rag-backend/pkg/types"
+)
+
+func TestMemoryConversationStore(t *testing.T) {
+	base := time.Date(2026, 4, 23, 10, 0, 0, 0, time.UTC)
+	clock := base
+	store := NewMemoryConversationStore(0, 0).(*MemoryConversationStore)
+	store.now = func() time.Time { return clock }
+
+	question := types.ChatMessage{Role: types.ChatRoleUser, Content: "Who wrote it?"}
+	answer := types.ChatMessage{Role: types.ChatRoleAssistant, Content: "Ada."}
+	followUp := types.ChatMessage{Role: types.ChatRoleUser, Content: "When?"}
+
+	t.Run("get returns not found for unknown id", func(t *testing.T) {
+		_, err := store.Get("c1")
+		assert.ErrorIs(t, err, conversationstore.ErrConversationNotFound)
+	})
+
+	t.Run("append creates the conversation", func(t *testing.T) {
+		assert.NoError(t, store.Append("c1", question, answer))
+
+		conversation, err := store.Get("c1")
+		assert.NoError(t, err)
+		assert.Equal(t, types.Conversation{
+			ID:        "c1",
+			Messages:  []types.ChatMessage{question, answer},
+			CreatedAt: base,
+			UpdatedAt: base,
+		}, conversation)
+	})
+
+	t.Run("append extends existing history", func(t *testing.T) {
+		clock = base.Add(time.Minute)
+		assert.NoError(t, store.Append("c1", followUp))
+
+		conversation, err := store.Get("c1")
+		assert.NoError(t, err)
+		assert.Equal(t, []types.ChatMessage{question, answer, followUp}, conversation.Messages)
+		assert.Equal(t, base, conversation.CreatedAt)
+		assert.Equal(t, clock, conversation.UpdatedAt)
+	})
+
+	t.Run("get returns a copy of the history", func(t *testing.T) {
+		conversation, err := store.Get("c1")
+		assert.NoError(t, err)
+		conversation.Messages[0].Content = "changed"
+
+		stored, err := store.Get("c1")
+		assert.NoError(t, err)
+		assert.Equal(t, question, stored.Messages[0])
+	})
+
+	t.Run("delete removes conversation", func(t *testing.T) {
+		assert.NoError(t, store.Delete("c1"))
+		_, err := store.Get("c1")
+		assert.ErrorIs(t, err, conversationstore.ErrConversationNotFound)
+	})
+
+	t.Run("delete returns not found for unknown id", func(t *testing.T) {
+		assert.ErrorIs(t, store.Delete("missing"), conversationstore.ErrConversationNotFound)
+	})
+}
+
+func TestMemoryConversationStore_Eviction(t *testing.T) {
+	base := time.Date(2026, 4, 23, 10, 0, 0, 0, time.UTC)
+	message := types.ChatMessage{Role: types.ChatRoleUser, Content: "Hi"}
+
+	t.Run("expires conversations idle for the ttl", func(t *testing.T) {
+		clock := base
+		store := NewMemoryConversationStore(time.Hour, 0).(*MemoryConversationStore)
+		store.now = func() time.Time { return clock }
+		assert.NoError(t, store.Append("old", message))
+		clock = base.Add(30 * time.Minute)
+		assert.NoError(t, store.Append("recent", message))
+
+		clock = base.Add(time.Hour)
+		_, err := store.Get("old")
+		assert.ErrorIs(t, err, conversationstore.ErrConversationNotFound)
+		_, err = store.Get("recent")
+		assert.NoError(t, err)
+
+		assert.NoError(t, store.Append("new", message))
+		assert.Len(t, store.conversations, 2)
+	})
+
+	t.Run("a new turn restarts the ttl", func(t *testing.T) {
+		clock := base
+		store := NewMemoryConversationStore(time.Hour, 0).(*MemoryConversationStore)
+		store.now = func() time.Time { return clock }
+		assert.NoError(t, store.Append("c1", message))
+		clock = base.Add(50 * time.Minute)
+		assert.NoError(t, store.Append("c1", message))
+
+		clock = base.Add(90 * time.Minute)
+		conversation, err := store.Get("c1")
+		assert.NoError(t, err)
+		assert.Len(t, conversation.Messages, 2)
+	})
+
+	t.Run("drops the least recently updated conversation over capacity", func(t *testing.T) {
+		store := NewMemoryConversationStore(0, 2)
+		assert.NoError(t, store.Append("c1", message))
+		assert.NoError(t, store.Append("c2", message))
+		assert.NoError(t, store.Append("c1", message))
+		assert.NoError(t, store.Append("c3", message))
+
+		_, err := store.Get("c2")
+		assert.ErrorIs(t, err, conversationstore.ErrConversationNotFound)
+		for _, id := range []string{"c1", "c3"} {
+			_, err := store.Get(id)
+			assert.NoError(t, err, id)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package documentstore
+
+import "rag-backend/pkg/types"
+
+type MockDocumentStore struct {
+	SaveFunc              func(document types.Document) error
+	GetFunc               func(id string) (types.Document, error)
+	ListFunc              func() ([]types.Document, error)
+	DeleteFunc            func(id string) error
+	FindByNameFunc        func(collection, name string) (types.Document, error)
+	FindByContentHashFunc func(collection, contentHash string) (types.Document, error)
+}
+
+func (m *MockDocumentStore) Save(document types.Document) error {
+	return m.SaveFunc(document)
+}
+
+func (m *MockDocumentStore) Get(id string) (types.Document, error) {
+	return m.GetFunc(id)
+}
+
+func (m *MockDocumentStore) List() ([]types.Document, error) {
+	return m.ListFunc()
+}
+
+func (m *MockDocumentStore) Delete(id string) error {
+	return m.DeleteFunc(id)
+}
+
+func (m *MockDocumentStore) FindByName(collection, name string) (types.Document, error) {
+	return m.FindByNameFunc(collection, name)
+}
+
+func (m *MockDocumentStore) FindByContentHash(collection, contentHash string) (types.Document, error) {
+	return m.FindByContentHashFunc(collection, contentHash)
+}
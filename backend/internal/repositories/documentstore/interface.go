@@ -0,0 +1,22 @@
+package documentstore
+
+import (
+	"errors"
+
+	"rag-backend/pkg/types"
+)
+
+// ErrDocumentNotFound is returned when no document matches the requested ID.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// DocumentStore defines the interface for the registry of uploaded documents
+type DocumentStore interface {
+	Save(document types.Document) error
+	Get(id string) (types.Document, error)
+	List() ([]types.Document, error)
+	Delete(id string) error
+	// FindByName and FindByContentHash return the latest document uploaded to
+	// the collection with that file name or content hash.
+	FindByName(collection, name string) (types.Document, error)
+	FindByContentHash(collection, contentHash string) (types.Document, error)
+}
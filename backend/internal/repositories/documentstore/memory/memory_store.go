@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"slices"
+	"sort"
+	"sync"
+
+	"rag-backend/internal/repositories/documentstore"
+	"rag-backend/pkg/types"
+)
+
+// documentKey indexes documents by a name or content hash within a collection
+type documentKey struct {
+	collection string
+	value      string
+}
+
+type MemoryDocumentStore struct {
+	documents map[string]types.Document
+	// byName and byHash hold the IDs of the documents with each file name
+	// and content hash
+	byName map[documentKey][]string
+	byHash map[documentKey][]string
+	mutex  sync.RWMutex
+}
+
+func NewMemoryDocumentStore() documentstore.DocumentStore {
+	return &MemoryDocumentStore{
+		documents: make(map[string]types.Document),
+		byName:    make(map[documentKey][]string),
+		byHash:    make(map[documentKey][]string),
+	}
+}
+
+func (mds *MemoryDocumentStore) Save(document types.Document) error {
+	mds.mutex.Lock()
+	defer mds.mutex.Unlock()
+	if previous, ok := mds.documents[document.ID]; ok {
+		mds.unindex(previous)
+	}
+	mds.documents[document.ID] = document
+	addID(mds.byName, documentKey{document.Collection, document.Name}, document.ID)
+	if document.ContentHash != "" {
+		addID(mds.byHash, documentKey{document.Collection, document.ContentHash}, document.ID)
+	}
+	return nil
+}
+
+func (mds *MemoryDocumentStore) Get(id string) (types.Document, error) {
+	mds.mutex.RLock()
+	defer mds.mutex.RUnlock()
+	document, ok := mds.documents[id]
+	if !ok {
+		return types.Document{}, documentstore.ErrDocumentNotFound
+	}
+	return document, nil
+}
+
+// List returns every registered document, oldest upload first.
+func (mds *MemoryDocumentStore) List() ([]types.Document, error) {
+	mds.mutex.RLock()
+	defer mds.mutex.RUnlock()
+
+	documents := make([]types.Document, 0, len(mds.documents))
+	for _, document := range mds.documents {
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		if documents[i].UploadedAt.Equal(documents[j].UploadedAt) {
+			return documents[i].ID < documents[j].ID
+		}
+		return documents[i].UploadedAt.Before(documents[j].UploadedAt)
+	})
+	return documents, nil
+}
+
+func (mds *MemoryDocumentStore) Delete(id string) error {
+	mds.mutex.Lock()
+	defer mds.mutex.Unlock()
+	document, ok := mds.documents[id]
+	if !ok {
+		return documentstore.ErrDocumentNotFound
+	}
+	mds.unindex(document)
+	delete(mds.documents, id)
+	return nil
+}
+
+func (mds *MemoryDocumentStore) FindByName(collection, name string) (types.Document, error) {
+	mds.mutex.RLock()
+	defer mds.mutex.RUnlock()
+	return mds.latest(mds.byName[documentKey{collection, name}])
+}
+
+func (mds *MemoryDocumentStore) FindByContentHash(collection, contentHash string) (types.Document, error) {
+	mds.mutex.RLock()
+	defer mds.mutex.RUnlock()
+	return mds.latest(mds.byHash[documentKey{collection, contentHash}])
+}
+
+// latest returns the most recently uploaded of the documents with the given
+// IDs. Several share a name only if they were uploaded before re-uploads
+// replaced earlier versions.
+func (mds *MemoryDocumentStore) latest(ids []string) (types.Document, error) {
+	var found *types.Document
+	for _, id := range ids {
+		document := mds.documents[id]
+		if found == nil || document.UploadedAt.After(found.UploadedAt) {
+			found = &document
+		}
+	}
+	if found == nil {
+		return types.Document{}, documentstore.ErrDocumentNotFound
+	}
+	return *found, nil
+}
+
+func (mds *MemoryDocumentStore) unindex(document types.Document) {
+	removeID(mds.byName, documentKey{document.Collection, document.Name}, document.ID)
+	removeID(mds.byHash, documentKey{document.Collection, document.ContentHash}, document.ID)
+}
+
+func addID(index map[documentKey][]string, key documentKey, id string) {
+	index[key] = append(index[key], id)
+}
+
+func removeID(index map[documentKey][]string, key documentKey, id string) {
+	ids := slices.DeleteFunc(index[key], func(indexed string) bool { return indexed == id })
+	if len(ids) == 0 {
+		delete(index, key)
+		return
+	}
+	index[key] = ids
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/repositories/documentstore"
+	"rag-backend/pkg/types"
+)
+
+func TestMemoryDocumentStore(t *testing.T) {
+	base := time.Date(2026, 4, 23, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryDocumentStore()
+
+	assert.NoError(t, store.Save(types.Document{ID: "d2", Name: "second", UploadedAt: base.Add(time.Minute)}))
+	assert.NoError(t, store.Save(types.Document{ID: "d1", Name: "first", UploadedAt: base}))
+
+	t.Run("get returns saved document", func(t *testing.T) {
+		document, err := store.Get("d1")
+		assert.NoError(t, err)
+		assert.Equal(t, "first", document.Name)
+	})
+
+	t.Run("get returns not found for unknown id", func(t *testing.T) {
+		_, err := store.Get("missing")
+		assert.ErrorIs(t, err, documentstore.ErrDocumentNotFound)
+	})
+
+	t.Run("list is ordered by upload time", func(t *testing.T) {
+		documents, err := store.List()
+		assert.NoError(t, err)
+		assert.Len(t, documents, 2)
+		assert.Equal(t, "d1", documents[0].ID)
+		assert.Equal(t, "d2", documents[1].ID)
+	})
+
+	t.Run("delete removes document", func(t *testing.T) {
+		assert.NoError(t, store.Delete("d1"))
+		_, err := store.Get("d1")
+		assert.ErrorIs(t, err, documentstore.ErrDocumentNotFound)
+	})
+
+	t.Run("delete returns not found for unknown id", func(t *testing.T) {
+		assert.ErrorIs(t, store.Delete("missing"), documentstore.ErrDocumentNotFound)
+	})
+}
+
+func TestMemoryDocumentStore_Find(t *testing.T) {
+	base := time.Date(2026, 4, 23, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryDocumentStore()
+	assert.NoError(t, store.Save(types.Document{ID: "d1", Name: "guide.md", Collection: "default", ContentHash: "h1", UploadedAt: base}))
+	assert.NoError(t, store.Save(types.Document{ID: "d2", Name: "guide.md", Collection: "manuals", ContentHash: "h1", UploadedAt: base}))
+	assert.NoError(t, store.Save(types.Document{ID: "d3", Name: "copy.md", Collection: "default", ContentHash: "h1", UploadedAt: base.Add(time.Hour)}))
+
+	t.Run("finds by name within the collection", func(t *testing.T) {
+		document, err := store.FindByName("manuals", "guide.md")
+		assert.NoError(t, err)
+		assert.Equal(t, "d2", document.ID)
+	})
+
+	t.Run("finds the latest upload with the content hash", func(t *testing.T) {
+		document, err := store.FindByContentHash("default", "h1")
+		assert.NoError(t, err)
+		assert.Equal(t, "d3", document.ID)
+	})
+
+	t.Run("saving a new version reindexes it", func(t *testing.T) {
+		assert.NoError(t, store.Save(types.Document{ID: "d3", Name: "copy.md", Collection: "default", ContentHash: "h2", UploadedAt: base.Add(2 * time.Hour)}))
+
+		document, err := store.FindByContentHash("default", "h1")
+		assert.NoError(t, err)
+		assert.Equal(t, "d1", document.ID)
+		document, err = store.FindByContentHash("default", "h2")
+		assert.NoError(t, err)
+		assert.Equal(t, "d3", document.ID)
+	})
+
+	t.Run("delete removes the document from the indexes", func(t *testing.T) {
+		assert.NoError(t, store.Delete("d2"))
+		_, err := store.FindByName("manuals", "guide.md")
+		assert.ErrorIs(t, err, documentstore.ErrDocumentNotFound)
+		_, err = store.FindByContentHash("manuals", "h1")
+		assert.ErrorIs(t, err, documentstore.ErrDocumentNotFound)
+	})
+}
@@ -0,0 +1,354 @@
+package disk
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"rag-backend/internal/repositories/embeddingcache"
+)
+
+const (
+	// frameHeaderSize is the length prefix plus the CRC32 checksum
+	frameHeaderSize = 8
+	// keyLengthSize prefixes the key inside the payload
+	keyLengthSize = 2
+	// maxPayloadSize guards against allocating garbage lengths read from a torn header
+	maxPayloadSize = 1 << 24
+)
+
+// DiskEmbeddingCache keeps embeddings in an append-only file so they survive
+// restarts. Only an index of file offsets is held in memory; vectors are read
+// from disk on a hit.
+//
+// Each entry is framed as [length uint32][crc32 uint32][payload], where the
+// payload is [key length uint16][key][float64 values, little endian]. Writes
+// are not fsynced: losing the last few entries in a crash only costs a few
+// cache misses, and a torn final frame fails its checksum and is truncated on
+// the next open.
+//
+// When an entry would grow the file past maxSize bytes, the file is rewritten
+// with only the most recently used entries, filling at most half of maxSize,
+// so the embeddings that went longest without a hit are the first to go. A
+// zero maxSize lets it grow without limit. Compaction writes entries least
+// recently used first, so their order survives a restart, but hits since the
+// last compaction are only remembered in memory.
+type DiskEmbeddingCache struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	index   map[string]*location
+	// clock stamps entries as they are written or hit
+	clock atomic.Uint64
+	mutex sync.RWMutex
+}
+
+// location is where an entry's payload sits in the file
+type location struct {
+	offset int64
+	length int
+	// lastUsed is the clock reading of the entry's latest write or hit. It is
+	// updated by Get, which holds the read lock only.
+	lastUsed atomic.Uint64
+}
+
+func (c *DiskEmbeddingCache) newLocation(offset int64, length int) *location {
+	loc := &location{offset: offset, length: length}
+	loc.lastUsed.Store(c.clock.Add(1))
+	return loc
+}
+
+func NewDiskEmbeddingCache(path string, maxSize int64) (embeddingcache.EmbeddingCache, error) {
+	cache, err := open(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func open(path string, maxSize int64) (*DiskEmbeddingCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create embedding cache directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache file: %w", err)
+	}
+
+	cache := &DiskEmbeddingCache{
+		path:    path,
+		maxSize: maxSize,
+		file:    file,
+		index:   make(map[string]*location),
+	}
+	if err := cache.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// The limit may have been lowered since the file was written
+	if maxSize > 0 && cache.size > maxSize {
+		if err := cache.compact(); err != nil {
+			cache.file.Close()
+			return nil, err
+		}
+	}
+	return cache, nil
+}
+
+func (c *DiskEmbeddingCache) Get(key string) ([]float64, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	loc, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	payload := make([]byte, loc.length)
+	if _, err := c.file.ReadAt(payload, loc.offset); err != nil {
+		return nil, false
+	}
+	_, embedding, err := decodePayload(payload)
+	if err != nil {
+		return nil, false
+	}
+	loc.lastUsed.Store(c.clock.Add(1))
+	return embedding, true
+}
+
+// Put appends the embedding unless the key is already stored. Embeddings are
+// a pure function of their key, so an existing entry never needs rewriting.
+func (c *DiskEmbeddingCache) Put(key string, embedding []float64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if loc, ok := c.index[key]; ok {
+		loc.lastUsed.Store(c.clock.Add(1))
+		return nil
+	}
+
+	frame, err := encodeFrame(key, embedding)
+	if err != nil {
+		return err
+	}
+	// Compaction keeps half of maxSize, so a larger entry would never survive it
+	if c.maxSize > 0 && int64(len(frame)) > c.maxSize/2 {
+		return fmt.Errorf("embedding cache entry of %d bytes is larger than half the %d byte limit", len(frame), c.maxSize)
+	}
+	if c.maxSize > 0 && c.size+int64(len(frame)) > c.maxSize {
+		if err := c.compact(); err != nil {
+			return err
+		}
+	}
+	if _, err := c.file.WriteAt(frame, c.size); err != nil {
+		// Anything written past size is ignored and overwritten by the next Put
+		return fmt.Errorf("failed to write embedding cache entry: %w", err)
+	}
+	c.index[key] = c.newLocation(c.size+frameHeaderSize, len(frame)-frameHeaderSize)
+	c.size += int64(len(frame))
+	return nil
+}
+
+// Close releases the underlying file handle.
+func (c *DiskEmbeddingCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.file.Close()
+}
+
+// load indexes every complete entry and truncates a torn tail.
+func (c *DiskEmbeddingCache) load() error {
+	reader := bufio.NewReader(c.file)
+	var offset int64
+	for {
+		key, length, err := readFrame(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, errCorruptFrame) {
+			if err := c.file.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to truncate corrupt embedding cache tail: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read embedding cache file: %w", err)
+		}
+
+		// Entries later in the file were written or compacted later
+		c.index[key] = c.newLocation(offset+frameHeaderSize, length)
+		offset += int64(frameHeaderSize + length)
+	}
+	c.size = offset
+	return nil
+}
+
+// compact rewrites the file with the most recently used entries that fit in
+// half of maxSize and drops the rest. The new file replaces the old one by
+// rename, so a crash part way leaves the old file intact.
+func (c *DiskEmbeddingCache) compact() error {
+	type entry struct {
+		key      string
+		offset   int64
+		length   int
+		lastUsed uint64
+	}
+	entries := make([]entry, 0, len(c.index))
+	for key, loc := range c.index {
+		entries = append(entries, entry{key, loc.offset, loc.length, loc.lastUsed.Load()})
+	}
+	// Most recently used first
+	slices.SortFunc(entries, func(a, b entry) int { return cmp.Compare(b.lastUsed, a.lastUsed) })
+	var kept int64
+	for i, e := range entries {
+		if kept+int64(frameHeaderSize+e.length) > c.maxSize/2 {
+			entries = entries[:i]
+			break
+		}
+		kept += int64(frameHeaderSize + e.length)
+	}
+	slices.Reverse(entries)
+
+	tmpPath := c.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create compacted embedding cache file: %w", err)
+	}
+	index := make(map[string]*location, len(entries))
+	var size int64
+	writer := bufio.NewWriter(tmp)
+	err = func() error {
+		for _, e := range entries {
+			payload := make([]byte, e.length)
+			if _, err := c.file.ReadAt(payload, e.offset); err != nil {
+				return err
+			}
+			var header [frameHeaderSize]byte
+			binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+			binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload))
+			if _, err := writer.Write(header[:]); err != nil {
+				return err
+			}
+			if _, err := writer.Write(payload); err != nil {
+				return err
+			}
+			loc := &location{offset: size + frameHeaderSize, length: e.length}
+			loc.lastUsed.Store(e.lastUsed)
+			index[e.key] = loc
+			size += int64(frameHeaderSize + e.length)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		return tmp.Sync()
+	}()
+	if err == nil {
+		err = os.Rename(tmpPath, c.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact embedding cache file: %w", err)
+	}
+
+	c.file.Close()
+	c.file = tmp
+	c.index = index
+	c.size = size
+	return nil
+}
+
+var errCorruptFrame = errors.New("corrupt frame")
+
+func encodeFrame(key string, embedding []float64) ([]byte, error) {
+	if len(key) > math.MaxUint16 {
+		return nil, fmt.Errorf("embedding cache key is %d bytes, the maximum is %d", len(key), math.MaxUint16)
+	}
+	payloadSize := keyLengthSize + len(key) + 8*len(embedding)
+	if payloadSize > maxPayloadSize {
+		return nil, fmt.Errorf("embedding with %d values is too large to cache", len(embedding))
+	}
+
+	frame := make([]byte, frameHeaderSize+payloadSize)
+	payload := frame[frameHeaderSize:]
+	binary.LittleEndian.PutUint16(payload, uint16(len(key)))
+	copy(payload[keyLengthSize:], key)
+	values := payload[keyLengthSize+len(key):]
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint64(values[8*i:], math.Float64bits(v))
+	}
+
+	binary.BigEndian.PutUint32(frame[0:4], uint32(payloadSize))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	return frame, nil
+}
+
+// readFrame returns the key and payload length of the next entry, io.EOF on a
+// clean end of file and errCorruptFrame when the entry is incomplete or fails
+// its checksum.
+func readFrame(reader io.Reader) (string, int, error) {
+	var header [frameHeaderSize]byte
+	n, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		if errors.Is(err, io.EOF) && n == 0 {
+			return "", 0, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", 0, errCorruptFrame
+		}
+		return "", 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > maxPayloadSize {
+		return "", 0, errCorruptFrame
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", 0, errCorruptFrame
+		}
+		return "", 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return "", 0, errCorruptFrame
+	}
+
+	key, _, err := decodePayload(payload)
+	if err != nil {
+		return "", 0, errCorruptFrame
+	}
+	return key, int(length), nil
+}
+
+func decodePayload(payload []byte) (string, []float64, error) {
+	if len(payload) < keyLengthSize {
+		return "", nil, errCorruptFrame
+	}
+	keyLength := int(binary.LittleEndian.Uint16(payload))
+	values := payload[keyLengthSize:]
+	if len(values) < keyLength || (len(values)-keyLength)%8 != 0 {
+		return "", nil, errCorruptFrame
+	}
+	key := string(values[:keyLength])
+	values = values[keyLength:]
+
+	embedding := make([]float64, len(values)/8)
+	for i := range embedding {
+		embedding[i] = math.Float64frombits(binary.LittleEndian.Uint64(values[8*i:]))
+	}
+	return key, embedding, nil
+}
@@ -0,0 +1,133 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskEmbeddingCache_ReloadsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "embeddings.bin")
+
+	cache, err := open(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, cache.Put("a", []float64{0.25, -1.5, 3}))
+	require.NoError(t, cache.Put("b", []float64{0.1}))
+	// Existing keys are not appended again
+	require.NoError(t, cache.Put("a", []float64{9}))
+	require.NoError(t, cache.Close())
+
+	reopened, err := open(path, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	embedding, ok := reopened.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{0.25, -1.5, 3}, embedding)
+
+	embedding, ok = reopened.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{0.1}, embedding)
+
+	_, ok = reopened.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestDiskEmbeddingCache_DropsTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.bin")
+
+	cache, err := open(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, cache.Put("a", []float64{1, 2}))
+	require.NoError(t, cache.Put("b", []float64{3, 4}))
+	require.NoError(t, cache.Close())
+
+	// Cut the last entry short, as a crash mid-write would
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-5))
+
+	reopened, err := open(path, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	embedding, ok := reopened.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{1, 2}, embedding)
+	_, ok = reopened.Get("b")
+	assert.False(t, ok)
+
+	// New entries land after the last good one
+	require.NoError(t, reopened.Put("c", []float64{5}))
+	embedding, ok = reopened.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{5}, embedding)
+}
+
+func TestDiskEmbeddingCache_CompactsPastMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.bin")
+	// Each entry here is 8+2+1+8 = 19 bytes, so 100 bytes holds five and a
+	// compaction keeps the newest two
+	cache, err := open(path, 100)
+	require.NoError(t, err)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, cache.Put(key, []float64{1}))
+	}
+	require.NoError(t, cache.Put("f", []float64{2}))
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, ok := cache.Get(key)
+		assert.False(t, ok, key)
+	}
+	embedding, ok := cache.Get("f")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{2}, embedding)
+	require.NoError(t, cache.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3*19), info.Size())
+
+	// A lower limit compacts the file when it is opened
+	reopened, err := open(path, 40)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, ok = reopened.Get("d")
+	assert.False(t, ok)
+	embedding, ok = reopened.Get("f")
+	assert.True(t, ok)
+	assert.Equal(t, []float64{2}, embedding)
+}
+
+func TestDiskEmbeddingCache_CompactionKeepsRecentlyUsedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.bin")
+	cache, err := open(path, 100)
+	require.NoError(t, err)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, cache.Put(key, []float64{1}))
+	}
+	// "a" was written first but is still in use
+	_, ok := cache.Get("a")
+	require.True(t, ok)
+
+	require.NoError(t, cache.Put("f", []float64{2}))
+
+	for key, kept := range map[string]bool{"a": true, "b": false, "c": false, "d": false, "e": true, "f": true} {
+		_, ok := cache.Get(key)
+		assert.Equal(t, kept, ok, key)
+	}
+	require.NoError(t, cache.Close())
+}
+
+func TestDiskEmbeddingCache_RejectsEntriesLargerThanHalfTheLimit(t *testing.T) {
+	cache, err := open(filepath.Join(t.TempDir(), "embeddings.bin"), 40)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	assert.ErrorContains(t, cache.Put("a", []float64{1, 2, 3}), "larger than half the 40 byte limit")
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+}
@@ -0,0 +1,14 @@
+package embeddingcache
+
+type MockEmbeddingCache struct {
+	GetFunc func(key string) ([]float64, bool)
+	PutFunc func(key string, embedding []float64) error
+}
+
+func (m *MockEmbeddingCache) Get(key string) ([]float64, bool) {
+	return m.GetFunc(key)
+}
+
+func (m *MockEmbeddingCache) Put(key string, embedding []float64) error {
+	return m.PutFunc(key, embedding)
+}
@@ -0,0 +1,8 @@
+package embeddingcache
+
+// EmbeddingCache stores embedding vectors under opaque keys. Caches are best
+// effort: a failed read is reported as a miss.
+type EmbeddingCache interface {
+	Get(key string) ([]float64, bool)
+	Put(key string, embedding []float64) error
+}
@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"container/list"
+	"sync"
+
+	"rag-backend/internal/repositories/embeddingcache"
+)
+
+// LRUEmbeddingCache holds up to capacity embeddings in memory, evicting the
+// least recently used one when full.
+type LRUEmbeddingCache struct {
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+	mutex    sync.Mutex
+}
+
+type lruEntry struct {
+	key       string
+	embedding []float64
+}
+
+func NewLRUEmbeddingCache(capacity int) embeddingcache.EmbeddingCache {
+	return &LRUEmbeddingCache{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUEmbeddingCache) Get(key string) ([]float64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).embedding, true
+}
+
+func (c *LRUEmbeddingCache) Put(key string, embedding []float64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).embedding = embedding
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, embedding: embedding})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEmbeddingCache(t *testing.T) {
+	cache := NewLRUEmbeddingCache(2)
+
+	assert.NoError(t, cache.Put("a", []float64{1}))
+	assert.NoError(t, cache.Put("b", []float64{2}))
+
+	t.Run("returns stored embeddings", func(t *testing.T) {
+		embedding, ok := cache.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, []float64{1}, embedding)
+	})
+
+	t.Run("evicts the least recently used entry", func(t *testing.T) {
+		// "a" was just read, so "b" is the oldest
+		assert.NoError(t, cache.Put("c", []float64{3}))
+
+		_, ok := cache.Get("b")
+		assert.False(t, ok)
+		_, ok = cache.Get("a")
+		assert.True(t, ok)
+		_, ok = cache.Get("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("put replaces an existing entry without evicting", func(t *testing.T) {
+		assert.NoError(t, cache.Put("c", []float64{4}))
+
+		embedding, ok := cache.Get("c")
+		assert.True(t, ok)
+		assert.Equal(t, []float64{4}, embedding)
+		_, ok = cache.Get("a")
+		assert.True(t, ok)
+	})
+}
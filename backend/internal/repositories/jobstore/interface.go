@@ -0,0 +1,19 @@
+package jobstore
+
+import (
+	"errors"
+
+	"rag-backend/pkg/types"
+)
+
+// ErrJobNotFound is returned when no job matches the requested ID.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStore defines the interface for ingestion job state
+type JobStore interface {
+	Get(id string) (types.Job, error)
+	// Save creates the job or replaces the stored copy
+	Save(job types.Job) error
+	List() ([]types.Job, error)
+	Delete(id string) error
+}
@@ -0,0 +1,26 @@
+package jobstore
+
+import "rag-backend/pkg/types"
+
+type MockJobStore struct {
+	GetFunc    func(id string) (types.Job, error)
+	SaveFunc   func(job types.Job) error
+	ListFunc   func() ([]types.Job, error)
+	DeleteFunc func(id string) error
+}
+
+func (m *MockJobStore) Get(id string) (types.Job, error) {
+	return m.GetFunc(id)
+}
+
+func (m *MockJobStore) Save(job types.Job) error {
+	return m.SaveFunc(job)
+}
+
+func (m *MockJobStore) List() ([]types.Job, error) {
+	return m.ListFunc()
+}
+
+func (m *MockJobStore) Delete(id string) error {
+	return m.DeleteFunc(id)
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"rag-backend/internal/repositories/jobstore"
+	"rag-backend/pkg/types"
+)
+
+type MemoryJobStore struct {
+	jobs  map[string]types.Job
+	mutex sync.RWMutex
+}
+
+func NewMemoryJobStore() jobstore.JobStore {
+	return &MemoryJobStore{
+		jobs: make(map[string]types.Job),
+	}
+}
+
+func (mjs *MemoryJobStore) Get(id string) (types.Job, error) {
+	mjs.mutex.RLock()
+	defer mjs.mutex.RUnlock()
+	job, ok := mjs.jobs[id]
+	if !ok {
+		return types.Job{}, jobstore.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (mjs *MemoryJobStore) Save(job types.Job) error {
+	mjs.mutex.Lock()
+	defer mjs.mutex.Unlock()
+	mjs.jobs[job.ID] = job
+	return nil
+}
+
+// List returns every job, oldest first.
+func (mjs *MemoryJobStore) List() ([]types.Job, error) {
+	mjs.mutex.RLock()
+	defer mjs.mutex.RUnlock()
+
+	jobs := make([]types.Job, 0, len(mjs.jobs))
+	for _, job := range mjs.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+func (mjs *MemoryJobStore) Delete(id string) error {
+	mjs.mutex.Lock()
+	defer mjs.mutex.Unlock()
+	if _, ok := mjs.jobs[id]; !ok {
+		return jobstore.ErrJobNotFound
+	}
+	delete(mjs.jobs, id)
+	return nil
+}
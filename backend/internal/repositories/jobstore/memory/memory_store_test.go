@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/repositories/jobstore"
+	"rag-backend/pkg/types"
+)
+
+func TestMemoryJobStore(t *testing.T) {
+	store := NewMemoryJobStore()
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, store.Save(types.Job{ID: "b", Status: types.JobStatusQueued, CreatedAt: start.Add(time.Minute)}))
+	assert.NoError(t, store.Save(types.Job{ID: "a", Status: types.JobStatusQueued, CreatedAt: start}))
+
+	t.Run("save replaces the stored job", func(t *testing.T) {
+		assert.NoError(t, store.Save(types.Job{ID: "a", Status: types.JobStatusEmbedding, CreatedAt: start}))
+
+		job, err := store.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, types.JobStatusEmbedding, job.Status)
+	})
+
+	t.Run("get returns not found for unknown id", func(t *testing.T) {
+		_, err := store.Get("missing")
+		assert.ErrorIs(t, err, jobstore.ErrJobNotFound)
+	})
+
+	t.Run("list is ordered by creation time", func(t *testing.T) {
+		jobs, err := store.List()
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 2) {
+			assert.Equal(t, "a", jobs[0].ID)
+			assert.Equal(t, "b", jobs[1].ID)
+		}
+	})
+
+	t.Run("delete removes job", func(t *testing.T) {
+		assert.NoError(t, store.Delete("a"))
+		_, err := store.Get("a")
+		assert.ErrorIs(t, err, jobstore.ErrJobNotFound)
+	})
+
+	t.Run("delete returns not found for unknown id", func(t *testing.T) {
+		assert.ErrorIs(t, store.Delete("missing"), jobstore.ErrJobNotFound)
+	})
+}
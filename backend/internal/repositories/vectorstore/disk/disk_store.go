@@ -0,0 +1,388 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/similarity"
+	"rag-backend/pkg/types"
+)
+
+const (
+	opStore   = "store"
+	opDelete  = "delete"
+	opReplace = "replace"
+
+	// frameHeaderSize is the length prefix plus the CRC32 checksum
+	frameHeaderSize = 8
+	// maxRecordSize bounds a record's payload. Larger records are refused
+	// when written, so a longer length read back is corruption.
+	maxRecordSize = 1 << 30
+	// compactBatchSize is how many chunks compaction writes per record, which
+	// keeps each record far below maxRecordSize however large the store grows
+	compactBatchSize = 1000
+)
+
+// record is one entry of the append-only log. A store record carries a whole
+// batch so that a single Store call is either fully replayed or not at all; a
+// replace record carries both the document to drop and its new chunks for the
+// same reason.
+type record struct {
+	Op         string                `json:"op"`
+	Chunks     []types.DocumentChunk `json:"chunks,omitempty"`
+	DocumentID string                `json:"documentId,omitempty"`
+}
+
+// DiskVectorStore keeps chunks in memory for search and persists every mutation
+// to an append-only log file that is replayed at startup.
+//
+// Each record is framed as [length uint32][crc32 uint32][json payload] and
+// fsynced before the call returns. A crash mid-write leaves at most one torn
+// frame at the end of the file; it fails the checksum on the next open and is
+// truncated away, so the index always reflects the last completed write. A
+// bad frame anywhere else is not a torn write, and opening the store fails
+// rather than dropping the records after it.
+type DiskVectorStore struct {
+	path      string
+	file      *os.File
+	size      int64
+	documents []types.DocumentChunk
+	mutex     sync.RWMutex
+}
+
+func NewDiskVectorStore(path string) (vectorstore.VectorStore, error) {
+	dvs, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return dvs, nil
+}
+
+func open(path string) (*DiskVectorStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vector store file: %w", err)
+	}
+
+	dvs := &DiskVectorStore{
+		path:      path,
+		file:      file,
+		documents: make([]types.DocumentChunk, 0),
+	}
+
+	compact, err := dvs.replay()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Deletes leave dead chunks in the log; rewrite it so startup cost and
+	// disk usage track the live data instead of the full history.
+	if compact {
+		if err := dvs.compact(); err != nil {
+			dvs.file.Close()
+			return nil, err
+		}
+	}
+
+	return dvs, nil
+}
+
+func (dvs *DiskVectorStore) Store(chunks []types.DocumentChunk) error {
+	dvs.mutex.Lock()
+	defer dvs.mutex.Unlock()
+
+	if err := dvs.append(record{Op: opStore, Chunks: chunks}); err != nil {
+		return err
+	}
+	dvs.documents = append(dvs.documents, chunks...)
+	return nil
+}
+
+func (dvs *DiskVectorStore) Search(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	dvs.mutex.RLock()
+	defer dvs.mutex.RUnlock()
+	return similarity.Search(embedding, options.Filter(dvs.documents), limit)
+}
+
+func (dvs *DiskVectorStore) Dimension() int {
+	dvs.mutex.RLock()
+	defer dvs.mutex.RUnlock()
+	return similarity.Dimension(dvs.documents)
+}
+
+func (dvs *DiskVectorStore) DeleteByDocumentID(documentID string) (int, error) {
+	dvs.mutex.Lock()
+	defer dvs.mutex.Unlock()
+
+	removed := 0
+	for _, chunk := range dvs.documents {
+		if chunk.DocumentID == documentID {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := dvs.append(record{Op: opDelete, DocumentID: documentID}); err != nil {
+		return 0, err
+	}
+	dvs.documents = removeDocument(dvs.documents, documentID)
+	return removed, nil
+}
+
+func (dvs *DiskVectorStore) ReplaceDocument(documentID string, chunks []types.DocumentChunk) (int, error) {
+	dvs.mutex.Lock()
+	defer dvs.mutex.Unlock()
+
+	removed := 0
+	for _, chunk := range dvs.documents {
+		if chunk.DocumentID == documentID {
+			removed++
+		}
+	}
+
+	if err := dvs.append(record{Op: opReplace, DocumentID: documentID, Chunks: chunks}); err != nil {
+		return 0, err
+	}
+	dvs.documents = append(removeDocument(dvs.documents, documentID), chunks...)
+	return removed, nil
+}
+
+// Chunks returns a copy of every stored chunk, in insertion order.
+func (dvs *DiskVectorStore) Chunks() ([]types.DocumentChunk, error) {
+	dvs.mutex.RLock()
+	defer dvs.mutex.RUnlock()
+	return append([]types.DocumentChunk(nil), dvs.documents...), nil
+}
+
+// Close releases the underlying file handle.
+func (dvs *DiskVectorStore) Close() error {
+	dvs.mutex.Lock()
+	defer dvs.mutex.Unlock()
+	return dvs.file.Close()
+}
+
+func (dvs *DiskVectorStore) append(rec record) error {
+	frame, err := encodeFrame(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := dvs.file.Write(frame); err != nil {
+		dvs.rollback()
+		return fmt.Errorf("failed to write vector store record: %w", err)
+	}
+	if err := dvs.file.Sync(); err != nil {
+		dvs.rollback()
+		return fmt.Errorf("failed to sync vector store file: %w", err)
+	}
+	dvs.size += int64(len(frame))
+	return nil
+}
+
+// rollback drops a partially written frame so later appends are not stranded
+// behind it. If this fails too, replay will still truncate the torn frame,
+// losing only the records written after it.
+func (dvs *DiskVectorStore) rollback() {
+	if err := dvs.file.Truncate(dvs.size); err != nil {
+		return
+	}
+	_, _ = dvs.file.Seek(dvs.size, io.SeekStart)
+}
+
+// replay rebuilds the in-memory index from the log and truncates any torn
+// tail. It reports whether the log contains deletes worth compacting away.
+func (dvs *DiskVectorStore) replay() (bool, error) {
+	info, err := dvs.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat vector store file: %w", err)
+	}
+	fileSize := info.Size()
+
+	reader := bufio.NewReader(dvs.file)
+	var offset int64
+	hasDeletes := false
+
+	for {
+		rec, size, err := readFrame(reader, fileSize-offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, errCorruptFrame) {
+			// Only the last frame can be an interrupted write; one followed by
+			// more data means the log itself is damaged
+			if offset+size < fileSize {
+				return false, fmt.Errorf("vector store file %s is corrupt at offset %d", dvs.path, offset)
+			}
+			if err := dvs.file.Truncate(offset); err != nil {
+				return false, fmt.Errorf("failed to truncate torn vector store tail: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read vector store file: %w", err)
+		}
+
+		switch rec.Op {
+		case opStore:
+			dvs.documents = append(dvs.documents, rec.Chunks...)
+		case opDelete:
+			dvs.documents = removeDocument(dvs.documents, rec.DocumentID)
+			hasDeletes = true
+		case opReplace:
+			dvs.documents = append(removeDocument(dvs.documents, rec.DocumentID), rec.Chunks...)
+			hasDeletes = true
+		}
+		offset += size
+	}
+
+	if _, err := dvs.file.Seek(offset, io.SeekStart); err != nil {
+		return false, fmt.Errorf("failed to seek vector store file: %w", err)
+	}
+	dvs.size = offset
+	return hasDeletes, nil
+}
+
+// compact writes the live chunks to a temporary file and atomically renames it
+// over the log, so a crash during compaction leaves the old log untouched.
+// The chunks are written in batches of compactBatchSize, one record each.
+func (dvs *DiskVectorStore) compact() error {
+	tmpPath := dvs.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create compaction file: %w", err)
+	}
+
+	var size int64
+	writer := bufio.NewWriter(tmp)
+	for batch := range slices.Chunk(dvs.documents, compactBatchSize) {
+		frame, err := encodeFrame(record{Op: opStore, Chunks: batch})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := writer.Write(frame); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write compaction file: %w", err)
+		}
+		size += int64(len(frame))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compaction file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync compaction file: %w", err)
+	}
+	if err := os.Rename(tmpPath, dvs.path); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to replace vector store file: %w", err)
+	}
+	syncDir(filepath.Dir(dvs.path))
+
+	dvs.file.Close()
+	dvs.file = tmp
+	dvs.size = size
+	return nil
+}
+
+var errCorruptFrame = errors.New("corrupt frame")
+
+func encodeFrame(rec record) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode vector store record: %w", err)
+	}
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("vector store record of %d bytes is larger than the %d byte limit", len(payload), maxRecordSize)
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[frameHeaderSize:], payload)
+	return frame, nil
+}
+
+// readFrame reads the next frame, with remaining bytes left in the file. It
+// returns io.EOF on a clean end of file and errCorruptFrame when the frame is
+// incomplete, too long or fails its checksum, along with the frame's size as
+// far as its header tells, so the caller can tell a torn tail from damage
+// further up the log.
+func readFrame(reader io.Reader, remaining int64) (record, int64, error) {
+	var header [frameHeaderSize]byte
+	n, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		if errors.Is(err, io.EOF) && n == 0 {
+			return record{}, 0, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return record{}, int64(n), errCorruptFrame
+		}
+		return record{}, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	size := int64(frameHeaderSize) + int64(length)
+	// A length running past the end of the file is a torn write, and one
+	// above the limit was never written; neither is worth allocating for
+	if size > remaining || length > maxRecordSize {
+		return record{}, min(size, remaining), errCorruptFrame
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return record{}, size, errCorruptFrame
+		}
+		return record{}, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return record{}, size, errCorruptFrame
+	}
+
+	var rec record
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return record{}, size, errCorruptFrame
+	}
+	return rec, size, nil
+}
+
+func removeDocument(chunks []types.DocumentChunk, documentID string) []types.DocumentChunk {
+	kept := chunks[:0]
+	for _, chunk := range chunks {
+		if chunk.DocumentID != documentID {
+			kept = append(kept, chunk)
+		}
+	}
+	clear(chunks[len(kept):])
+	return kept
+}
+
+// syncDir flushes the directory entry so a rename survives a power loss.
+// Errors are ignored because not every platform supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
@@ -0,0 +1,287 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/pkg/types"
+)
+
+func chunkIDs(t *testing.T, store *DiskVectorStore) []string {
+	t.Helper()
+	results, err := store.Search([]float64{1, 1}, 100, types.SearchOptions{})
+	require.NoError(t, err)
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Chunk.ID)
+	}
+	return ids
+}
+
+func sampleChunks() []types.DocumentChunk {
+	return []types.DocumentChunk{
+		{ID: "a-0", DocumentID: "doc-a", Content: "alpha", Embedding: []float64{1, 0}, Metadata: map[string]string{"source": "a.txt"}},
+		{ID: "a-1", DocumentID: "doc-a", Content: "beta", Embedding: []float64{1, 1}, Metadata: map[string]string{"source": "a.txt"}},
+		{ID: "b-0", DocumentID: "doc-b", Content: "gamma", Embedding: []float64{0, 1}, Metadata: map[string]string{"source": "b.txt"}},
+	}
+}
+
+func TestNewDiskVectorStore_CreatesMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "vectors.log")
+
+	store, err := NewDiskVectorStore(path)
+
+	require.NoError(t, err)
+	assert.FileExists(t, path)
+	assert.NoError(t, store.(*DiskVectorStore).Close())
+}
+
+func TestDiskVectorStore_ReloadsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.log")
+
+	store, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(sampleChunks()[:2]))
+	require.NoError(t, store.Store(sampleChunks()[2:]))
+	require.NoError(t, store.Close())
+
+	reopened, err := open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	assert.ElementsMatch(t, []string{"a-0", "a-1", "b-0"}, chunkIDs(t, reopened))
+
+	chunks, err := reopened.Chunks()
+	require.NoError(t, err)
+	assert.Equal(t, sampleChunks(), chunks)
+
+	results, err := reopened.Search([]float64{1, 0}, 1, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, sampleChunks()[0], results[0].Chunk)
+}
+
+func TestDiskVectorStore_DeletePersistsAndCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.log")
+
+	store, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(sampleChunks()))
+
+	removed, err := store.DeleteByDocumentID("doc-a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	removed, err = store.DeleteByDocumentID("doc-missing")
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	require.NoError(t, store.Close())
+	sizeBefore := fileSize(t, path)
+
+	reopened, err := open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	assert.Equal(t, []string{"b-0"}, chunkIDs(t, reopened))
+	assert.Less(t, fileSize(t, path), sizeBefore, "log should be compacted on open")
+
+	// Appends after compaction must land in the new file
+	require.NoError(t, reopened.Store(sampleChunks()[:1]))
+	require.NoError(t, reopened.Close())
+
+	final, err := open(path)
+	require.NoError(t, err)
+	defer final.Close()
+	assert.ElementsMatch(t, []string{"a-0", "b-0"}, chunkIDs(t, final))
+}
+
+func TestDiskVectorStore_ReplacePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.log")
+
+	store, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(sampleChunks()))
+
+	replacement := []types.DocumentChunk{
+		{ID: "a-0", DocumentID: "doc-a", Content: "alpha v2", Embedding: []float64{1, 0}, Metadata: map[string]string{"source": "a.txt"}},
+	}
+	removed, err := store.ReplaceDocument("doc-a", replacement)
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.ElementsMatch(t, []string{"a-0", "b-0"}, chunkIDs(t, store))
+	require.NoError(t, store.Close())
+
+	reopened, err := open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	chunks, err := reopened.Chunks()
+	require.NoError(t, err)
+	assert.Equal(t, []types.DocumentChunk{sampleChunks()[2], replacement[0]}, chunks)
+}
+
+func TestDiskVectorStore_RecoversFromTornWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+	}{
+		{
+			name: "truncated frame header",
+			corrupt: func(t *testing.T, path string) {
+				appendBytes(t, path, []byte{0x00, 0x00, 0x01})
+			},
+		},
+		{
+			name: "truncated frame payload",
+			corrupt: func(t *testing.T, path string) {
+				frame, err := encodeFrame(record{Op: opStore, Chunks: sampleChunks()[2:]})
+				require.NoError(t, err)
+				appendBytes(t, path, frame[:len(frame)-5])
+			},
+		},
+		{
+			name: "checksum mismatch",
+			corrupt: func(t *testing.T, path string) {
+				frame, err := encodeFrame(record{Op: opStore, Chunks: sampleChunks()[2:]})
+				require.NoError(t, err)
+				frame[len(frame)-2] ^= 0xFF
+				appendBytes(t, path, frame)
+			},
+		},
+		{
+			name: "garbage length prefix",
+			corrupt: func(t *testing.T, path string) {
+				appendBytes(t, path, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vectors.log")
+
+			store, err := open(path)
+			require.NoError(t, err)
+			require.NoError(t, store.Store(sampleChunks()[:2]))
+			require.NoError(t, store.Close())
+			goodSize := fileSize(t, path)
+
+			tt.corrupt(t, path)
+
+			recovered, err := open(path)
+			require.NoError(t, err)
+			defer recovered.Close()
+
+			assert.ElementsMatch(t, []string{"a-0", "a-1"}, chunkIDs(t, recovered))
+			assert.Equal(t, goodSize, fileSize(t, path), "torn tail should be truncated")
+
+			// New writes after recovery must be readable on the next open
+			require.NoError(t, recovered.Store(sampleChunks()[2:]))
+			require.NoError(t, recovered.Close())
+
+			again, err := open(path)
+			require.NoError(t, err)
+			defer again.Close()
+			assert.ElementsMatch(t, []string{"a-0", "a-1", "b-0"}, chunkIDs(t, again))
+		})
+	}
+}
+
+func TestDiskVectorStore_FailsOnCorruptionBeforeTheTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.log")
+
+	store, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(sampleChunks()[:2]))
+	require.NoError(t, store.Store(sampleChunks()[2:]))
+	require.NoError(t, store.Close())
+	sizeBefore := fileSize(t, path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[frameHeaderSize+2] ^= 0xFF
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err = open(path)
+
+	assert.ErrorContains(t, err, "is corrupt at offset 0")
+	assert.Equal(t, sizeBefore, fileSize(t, path), "the log should be left for inspection")
+}
+
+func TestDiskVectorStore_CompactsInBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.log")
+
+	chunks := make([]types.DocumentChunk, 2*compactBatchSize+1)
+	for i := range chunks {
+		chunks[i] = types.DocumentChunk{ID: fmt.Sprintf("a-%d", i), DocumentID: "doc-a", Embedding: []float64{1, 0}}
+	}
+	store, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(chunks))
+	require.NoError(t, store.Store(sampleChunks()[2:]))
+	_, err = store.DeleteByDocumentID("doc-b")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	compacted, err := open(path)
+	require.NoError(t, err)
+	require.NoError(t, compacted.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var records []int
+	remaining := fileSize(t, path)
+	for {
+		rec, size, err := readFrame(file, remaining)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		records = append(records, len(rec.Chunks))
+		remaining -= size
+	}
+	assert.Equal(t, []int{compactBatchSize, compactBatchSize, 1}, records)
+
+	reopened, err := open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	stored, err := reopened.Chunks()
+	require.NoError(t, err)
+	assert.Equal(t, chunks, stored)
+}
+
+func TestNewDiskVectorStore_ReturnsErrorForUnwritablePath(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(blocker, []byte("x"), 0o644))
+
+	store, err := NewDiskVectorStore(filepath.Join(blocker, "vectors.log"))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create data directory")
+	assert.Nil(t, store)
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.Size()
+}
@@ -0,0 +1,119 @@
+package hnsw
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"rag-backend/pkg/similarity"
+	"rag-backend/pkg/types"
+)
+
+// Benchmarks compare HNSW with the brute-force similarity.Search on the same
+// data. Run them with:
+//
+//	go test ./internal/repositories/vectorstore/hnsw -run '^$' -bench . -benchtime 200x
+//
+// Each HNSW search benchmark also reports recall@10 against the exact results.
+// The vectors are uniformly random, which is a worst case for graph indexes;
+// real embeddings cluster and reach a given recall at a lower efSearch.
+
+const (
+	benchDim     = 128
+	benchK       = 10
+	benchQueries = 100
+)
+
+var benchSizes = []int{1_000, 10_000}
+
+type benchFixture struct {
+	chunks  []types.DocumentChunk
+	queries [][]float64
+	exact   [][]types.ScoredChunk
+	index   *HNSWVectorStore
+}
+
+var benchFixtures = map[int]*benchFixture{}
+
+func fixture(b *testing.B, n int) *benchFixture {
+	b.Helper()
+	if f, ok := benchFixtures[n]; ok {
+		return f
+	}
+
+	rng := rand.New(rand.NewSource(int64(n)))
+	f := &benchFixture{chunks: randomChunks(rng, n, benchDim, "bench")}
+	for _, q := range randomChunks(rng, benchQueries, benchDim, "query") {
+		exact, err := similarity.Search(q.Embedding, f.chunks, benchK)
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.queries = append(f.queries, q.Embedding)
+		f.exact = append(f.exact, exact)
+	}
+	benchFixtures[n] = f
+	return f
+}
+
+func BenchmarkBruteForceSearch(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			f := fixture(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := similarity.Search(f.queries[i%benchQueries], f.chunks, benchK); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// hnswIndex builds the graph once per fixture; efSearch only affects queries so
+// every sub-benchmark can share it.
+func (f *benchFixture) hnswIndex(b *testing.B, efSearch int) *HNSWVectorStore {
+	b.Helper()
+	if f.index == nil {
+		f.index = newStore(Params{M: DefaultM, EfConstruction: DefaultEfConstruction, Seed: 1})
+		if err := f.index.Store(f.chunks); err != nil {
+			b.Fatal(err)
+		}
+	}
+	f.index.graph.params.EfSearch = efSearch
+	return f.index
+}
+
+func BenchmarkHNSWSearch(b *testing.B) {
+	for _, n := range benchSizes {
+		for _, efSearch := range []int{16, 64, 256} {
+			b.Run(fmt.Sprintf("n=%d/efSearch=%d", n, efSearch), func(b *testing.B) {
+				f := fixture(b, n)
+				store := f.hnswIndex(b, efSearch)
+
+				var recall float64
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					q := i % benchQueries
+					results, err := store.Search(f.queries[q], benchK, types.SearchOptions{})
+					if err != nil {
+						b.Fatal(err)
+					}
+					recall += recallAtK(f.exact[q], results)
+				}
+				b.ReportMetric(recall/float64(b.N), "recall@10")
+			})
+		}
+	}
+}
+
+func BenchmarkHNSWInsert(b *testing.B) {
+	f := fixture(b, benchSizes[0])
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store := NewHNSWVectorStore(Params{M: DefaultM, EfConstruction: DefaultEfConstruction, EfSearch: DefaultEfSearch, Seed: 1})
+		if err := store.Store(f.chunks); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(f.chunks)), "ns/insert")
+}
@@ -0,0 +1,295 @@
+package hnsw
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+)
+
+// node is one vector in the graph. neighbors[l] holds the adjacency list for
+// layer l, for every layer from 0 up to the node's level.
+type node struct {
+	vector    []float64
+	level     int
+	neighbors [][]int
+	deleted   bool
+}
+
+// graph is a Hierarchical Navigable Small World index over unit-normalized
+// vectors, so the inner product equals cosine similarity. It is not safe for
+// concurrent use; HNSWVectorStore serializes access.
+//
+// See Malkov & Yashunin, "Efficient and robust approximate nearest neighbor
+// search using Hierarchical Navigable Small World graphs" (2016).
+type graph struct {
+	params     Params
+	levelMult  float64
+	rng        *rand.Rand
+	nodes      []*node
+	entryPoint int
+	maxLevel   int
+	live       int
+}
+
+func newGraph(params Params) *graph {
+	return &graph{
+		params:     params,
+		levelMult:  1 / math.Log(float64(params.M)),
+		rng:        rand.New(rand.NewSource(params.Seed)),
+		entryPoint: -1,
+	}
+}
+
+// insert adds a normalized vector and returns its node ID.
+func (g *graph) insert(vector []float64) int {
+	id := len(g.nodes)
+	level := g.randomLevel()
+	n := &node{
+		vector:    vector,
+		level:     level,
+		neighbors: make([][]int, level+1),
+	}
+	g.nodes = append(g.nodes, n)
+	g.live++
+
+	if g.entryPoint < 0 {
+		g.entryPoint = id
+		g.maxLevel = level
+		return id
+	}
+
+	// Greedy descent through the layers above the new node's level
+	entry := g.entryPoint
+	for l := g.maxLevel; l > level; l-- {
+		entry = g.greedyClosest(vector, entry, l)
+	}
+
+	entries := []int{entry}
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		candidates := g.searchLayer(vector, entries, g.params.EfConstruction, l)
+		selected := g.selectNeighbors(vector, candidates, g.params.M)
+		n.neighbors[l] = selected
+
+		for _, neighborID := range selected {
+			g.connect(neighborID, id, l)
+		}
+
+		// The whole candidate set seeds the next layer down
+		entries = entries[:0]
+		for _, c := range candidates {
+			entries = append(entries, c.id)
+		}
+	}
+
+	if level > g.maxLevel {
+		g.maxLevel = level
+		g.entryPoint = id
+	}
+	return id
+}
+
+// markDeleted tombstones a node. Deleted nodes still route searches through the
+// graph but are never returned as results.
+func (g *graph) markDeleted(id int) {
+	if !g.nodes[id].deleted {
+		g.nodes[id].deleted = true
+		g.live--
+	}
+}
+
+// search returns up to k live nodes closest to the query, best first. A
+// non-nil match restricts results to the nodes it accepts; rejected nodes
+// still route the search.
+func (g *graph) search(query []float64, k int, match func(id int) bool) []candidate {
+	if g.entryPoint < 0 || k <= 0 || g.live == 0 {
+		return nil
+	}
+
+	entry := g.entryPoint
+	for l := g.maxLevel; l > 0; l-- {
+		entry = g.greedyClosest(query, entry, l)
+	}
+
+	// Tombstones and filtered-out nodes occupy slots in the beam, so widen it
+	// until enough results come back or the beam already covers the whole
+	// graph. Selective filters can degrade towards a full scan.
+	ef := max(g.params.EfSearch, k)
+	for {
+		found := g.searchLayer(query, []int{entry}, ef, 0)
+		results := make([]candidate, 0, k)
+		for _, c := range found {
+			if g.nodes[c.id].deleted || (match != nil && !match(c.id)) {
+				continue
+			}
+			results = append(results, c)
+			if len(results) == k {
+				return results
+			}
+		}
+		if ef >= len(g.nodes) || (match == nil && len(results) == g.live) {
+			return results
+		}
+		ef *= 2
+	}
+}
+
+func (g *graph) randomLevel() int {
+	return int(math.Floor(-math.Log(1-g.rng.Float64()) * g.levelMult))
+}
+
+func (g *graph) maxConnections(layer int) int {
+	if layer == 0 {
+		return 2 * g.params.M
+	}
+	return g.params.M
+}
+
+// greedyClosest walks to the neighbor closest to the query until no neighbor
+// improves on the current node.
+func (g *graph) greedyClosest(query []float64, entry, layer int) int {
+	current := entry
+	best := dot(query, g.nodes[current].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, neighborID := range g.nodes[current].neighbors[layer] {
+			if score := dot(query, g.nodes[neighborID].vector); score > best {
+				best = score
+				current = neighborID
+				changed = true
+			}
+		}
+	}
+	return current
+}
+
+// searchLayer runs the beam search from the paper's SEARCH-LAYER routine and
+// returns up to ef candidates ordered best first.
+func (g *graph) searchLayer(query []float64, entries []int, ef, layer int) []candidate {
+	visited := make(map[int]struct{}, ef*g.params.M)
+	frontier := &maxHeap{}
+	results := &minHeap{}
+
+	for _, id := range entries {
+		visited[id] = struct{}{}
+		c := candidate{id: id, score: dot(query, g.nodes[id].vector)}
+		heap.Push(frontier, c)
+		heap.Push(results, c)
+	}
+
+	for frontier.Len() > 0 {
+		current := heap.Pop(frontier).(candidate)
+		if results.Len() >= ef && current.score < (*results)[0].score {
+			break
+		}
+
+		for _, neighborID := range g.nodes[current.id].neighbors[layer] {
+			if _, seen := visited[neighborID]; seen {
+				continue
+			}
+			visited[neighborID] = struct{}{}
+
+			score := dot(query, g.nodes[neighborID].vector)
+			if results.Len() < ef || score > (*results)[0].score {
+				c := candidate{id: neighborID, score: score}
+				heap.Push(frontier, c)
+				heap.Push(results, c)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	ordered := make([]candidate, results.Len())
+	for i := len(ordered) - 1; i >= 0; i-- {
+		ordered[i] = heap.Pop(results).(candidate)
+	}
+	return ordered
+}
+
+// selectNeighbors implements the paper's diversity heuristic: a candidate is
+// kept only if it is closer to the base vector than to any neighbor already
+// kept. Remaining slots are back-filled with the closest discarded candidates
+// so sparse regions still get m links.
+func (g *graph) selectNeighbors(base []float64, candidates []candidate, m int) []int {
+	if len(candidates) <= m {
+		ids := make([]int, len(candidates))
+		for i, c := range candidates {
+			ids[i] = c.id
+		}
+		return ids
+	}
+
+	selected := make([]int, 0, m)
+	var discarded []int
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		keep := true
+		for _, s := range selected {
+			if dot(g.nodes[c.id].vector, g.nodes[s].vector) > c.score {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c.id)
+		} else {
+			discarded = append(discarded, c.id)
+		}
+	}
+
+	for _, id := range discarded {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// connect adds a back-link from node `from` to node `to`, pruning from's list
+// with the selection heuristic when it exceeds the layer's capacity.
+func (g *graph) connect(from, to, layer int) {
+	n := g.nodes[from]
+	n.neighbors[layer] = append(n.neighbors[layer], to)
+
+	limit := g.maxConnections(layer)
+	if len(n.neighbors[layer]) <= limit {
+		return
+	}
+
+	candidates := make([]candidate, len(n.neighbors[layer]))
+	for i, id := range n.neighbors[layer] {
+		candidates[i] = candidate{id: id, score: dot(n.vector, g.nodes[id].vector)}
+	}
+	sortCandidates(candidates)
+	n.neighbors[layer] = g.selectNeighbors(n.vector, candidates, limit)
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// normalize returns a unit-length copy of v, or nil for a zero vector.
+func normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+
+	out := make([]float64, len(v))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package hnsw
+
+import (
+	"fmt"
+	"sync"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/types"
+)
+
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 64
+
+	// rebuildRatio triggers a full rebuild once tombstones make up this share
+	// of the graph, since they still cost traversal time on every search.
+	rebuildRatio = 0.5
+)
+
+// Params tunes the HNSW graph.
+//
+//   - M is the number of links per node on the upper layers (2*M on layer 0).
+//     Higher values improve recall at the cost of memory and insert time.
+//   - EfConstruction is the beam width used while inserting.
+//   - EfSearch is the beam width used while querying; raise it to trade
+//     latency for recall.
+//   - Seed makes level assignment reproducible.
+type Params struct {
+	M              int
+	EfConstruction int
+	EfSearch       int
+	Seed           int64
+}
+
+func DefaultParams() Params {
+	return Params{
+		M:              DefaultM,
+		EfConstruction: DefaultEfConstruction,
+		EfSearch:       DefaultEfSearch,
+	}
+}
+
+// HNSWVectorStore is an approximate nearest neighbour VectorStore. Search cost
+// grows roughly logarithmically with the number of chunks instead of linearly
+// as with the brute-force similarity.Search.
+type HNSWVectorStore struct {
+	params    Params
+	graph     *graph
+	chunks    []types.DocumentChunk
+	byDoc     map[string][]int
+	dimension int
+	mutex     sync.RWMutex
+}
+
+func NewHNSWVectorStore(params Params) vectorstore.VectorStore {
+	return newStore(params)
+}
+
+func newStore(params Params) *HNSWVectorStore {
+	defaults := DefaultParams()
+	if params.M < 2 {
+		params.M = defaults.M
+	}
+	if params.EfConstruction <= 0 {
+		params.EfConstruction = defaults.EfConstruction
+	}
+	if params.EfSearch <= 0 {
+		params.EfSearch = defaults.EfSearch
+	}
+
+	return &HNSWVectorStore{
+		params: params,
+		graph:  newGraph(params),
+		byDoc:  make(map[string][]int),
+	}
+}
+
+func (hvs *HNSWVectorStore) Store(chunks []types.DocumentChunk) error {
+	hvs.mutex.Lock()
+	defer hvs.mutex.Unlock()
+
+	// Validate the whole batch first so a bad chunk doesn't leave it half indexed
+	if err := hvs.checkDimension(chunks); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		hvs.insert(chunk)
+	}
+	return nil
+}
+
+// checkDimension verifies every embedding in the batch has the index's
+// dimension, fixing the dimension if the index is still empty.
+func (hvs *HNSWVectorStore) checkDimension(chunks []types.DocumentChunk) error {
+	dimension := hvs.dimension
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+		if dimension == 0 {
+			dimension = len(chunk.Embedding)
+		}
+		if len(chunk.Embedding) != dimension {
+			return fmt.Errorf("chunk %s has embedding dimension %d, index expects %d", chunk.ID, len(chunk.Embedding), dimension)
+		}
+	}
+	hvs.dimension = dimension
+	return nil
+}
+
+func (hvs *HNSWVectorStore) Dimension() int {
+	hvs.mutex.RLock()
+	defer hvs.mutex.RUnlock()
+	return hvs.dimension
+}
+
+func (hvs *HNSWVectorStore) Search(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	hvs.mutex.RLock()
+	defer hvs.mutex.RUnlock()
+
+	query := normalize(embedding)
+	if query == nil || len(query) != hvs.dimension {
+		return []types.ScoredChunk{}, nil
+	}
+
+	var match func(id int) bool
+	if options.Scoped() {
+		match = func(id int) bool { return options.Matches(hvs.chunks[id]) }
+	}
+
+	found := hvs.graph.search(query, limit, match)
+	scored := make([]types.ScoredChunk, len(found))
+	for i, c := range found {
+		scored[i] = types.ScoredChunk{Chunk: hvs.chunks[c.id], Score: c.score}
+	}
+	return scored, nil
+}
+
+func (hvs *HNSWVectorStore) DeleteByDocumentID(documentID string) (int, error) {
+	hvs.mutex.Lock()
+	defer hvs.mutex.Unlock()
+	return hvs.remove(documentID), nil
+}
+
+func (hvs *HNSWVectorStore) ReplaceDocument(documentID string, chunks []types.DocumentChunk) (int, error) {
+	hvs.mutex.Lock()
+	defer hvs.mutex.Unlock()
+
+	if err := hvs.checkDimension(chunks); err != nil {
+		return 0, err
+	}
+	removed := hvs.remove(documentID)
+	for _, chunk := range chunks {
+		hvs.insert(chunk)
+	}
+	return removed, nil
+}
+
+// remove tombstones the document's chunks, rebuilding the graph once too
+// many nodes are dead.
+func (hvs *HNSWVectorStore) remove(documentID string) int {
+	ids := hvs.byDoc[documentID]
+	for _, id := range ids {
+		hvs.graph.markDeleted(id)
+		hvs.chunks[id] = types.DocumentChunk{}
+	}
+	delete(hvs.byDoc, documentID)
+
+	// Once the last chunk is gone the index starts over, so it can take
+	// embeddings of another dimension, e.g. from a new embedding model
+	if hvs.graph.live == 0 {
+		hvs.graph = newGraph(hvs.params)
+		hvs.chunks = nil
+		hvs.byDoc = make(map[string][]int)
+		hvs.dimension = 0
+	} else if tombstones := len(hvs.graph.nodes) - hvs.graph.live; float64(tombstones) > rebuildRatio*float64(len(hvs.graph.nodes)) {
+		hvs.rebuild()
+	}
+	return len(ids)
+}
+
+// insert adds a chunk to the graph. Chunks without a usable embedding are
+// skipped, matching similarity.Search.
+func (hvs *HNSWVectorStore) insert(chunk types.DocumentChunk) {
+	vector := normalize(chunk.Embedding)
+	if vector == nil {
+		return
+	}
+
+	id := hvs.graph.insert(vector)
+	hvs.chunks = append(hvs.chunks, chunk)
+	hvs.byDoc[chunk.DocumentID] = append(hvs.byDoc[chunk.DocumentID], id)
+}
+
+// rebuild re-inserts the live chunks into a fresh graph, dropping tombstones.
+func (hvs *HNSWVectorStore) rebuild() {
+	live := make([]types.DocumentChunk, 0, hvs.graph.live)
+	for id, n := range hvs.graph.nodes {
+		if !n.deleted {
+			live = append(live, hvs.chunks[id])
+		}
+	}
+
+	hvs.graph = newGraph(hvs.params)
+	hvs.chunks = make([]types.DocumentChunk, 0, len(live))
+	hvs.byDoc = make(map[string][]int)
+	for _, chunk := range live {
+		hvs.insert(chunk)
+	}
+}
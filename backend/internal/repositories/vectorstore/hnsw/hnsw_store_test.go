@@ -0,0 +1,326 @@
+package hnsw
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/pkg/similarity"
+	"rag-backend/pkg/types"
+)
+
+func randomChunks(rng *rand.Rand, n, dim int, documentID string) []types.DocumentChunk {
+	chunks := make([]types.DocumentChunk, n)
+	for i := range chunks {
+		embedding := make([]float64, dim)
+		for j := range embedding {
+			embedding[j] = rng.NormFloat64()
+		}
+		chunks[i] = types.DocumentChunk{
+			ID:         fmt.Sprintf("%s-chunk-%d", documentID, i),
+			DocumentID: documentID,
+			Embedding:  embedding,
+		}
+	}
+	return chunks
+}
+
+func resultIDs(results []types.ScoredChunk) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.Chunk.ID
+	}
+	return ids
+}
+
+// recallAtK reports the fraction of the exact top-k that the approximate search returned.
+func recallAtK(exact, approx []types.ScoredChunk) float64 {
+	if len(exact) == 0 {
+		return 1
+	}
+	want := make(map[string]struct{}, len(exact))
+	for _, r := range exact {
+		want[r.Chunk.ID] = struct{}{}
+	}
+	hits := 0
+	for _, r := range approx {
+		if _, ok := want[r.Chunk.ID]; ok {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact))
+}
+
+func TestNewHNSWVectorStore_AppliesDefaults(t *testing.T) {
+	store := newStore(Params{})
+
+	assert.Equal(t, DefaultM, store.params.M)
+	assert.Equal(t, DefaultEfConstruction, store.params.EfConstruction)
+	assert.Equal(t, DefaultEfSearch, store.params.EfSearch)
+}
+
+func TestHNSWVectorStore_Search(t *testing.T) {
+	chunks := []types.DocumentChunk{
+		{ID: "orthogonal", DocumentID: "d", Embedding: []float64{0, 1, 0}},
+		{ID: "identical", DocumentID: "d", Embedding: []float64{1, 0, 0}},
+		{ID: "similar", DocumentID: "d", Embedding: []float64{1, 1, 0}},
+		{ID: "no-embedding", DocumentID: "d"},
+		{ID: "zero", DocumentID: "d", Embedding: []float64{0, 0, 0}},
+	}
+
+	tests := []struct {
+		name      string
+		embedding []float64
+		limit     int
+		expected  []string
+	}{
+		{
+			name:      "orders results by descending similarity",
+			embedding: []float64{1, 0, 0},
+			limit:     5,
+			expected:  []string{"identical", "similar", "orthogonal"},
+		},
+		{
+			name:      "respects limit",
+			embedding: []float64{1, 0, 0},
+			limit:     1,
+			expected:  []string{"identical"},
+		},
+		{
+			name:      "returns nothing for zero limit",
+			embedding: []float64{1, 0, 0},
+			limit:     0,
+			expected:  []string{},
+		},
+		{
+			name:      "returns nothing for mismatched query dimension",
+			embedding: []float64{1, 0},
+			limit:     5,
+			expected:  []string{},
+		},
+		{
+			name:      "returns nothing for zero query",
+			embedding: []float64{0, 0, 0},
+			limit:     5,
+			expected:  []string{},
+		},
+	}
+
+	store := NewHNSWVectorStore(DefaultParams())
+	require.NoError(t, store.Store(chunks))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := store.Search(tt.embedding, tt.limit, types.SearchOptions{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, resultIDs(results))
+		})
+	}
+}
+
+func TestHNSWVectorStore_Search_EmptyStore(t *testing.T) {
+	store := NewHNSWVectorStore(DefaultParams())
+
+	results, err := store.Search([]float64{1, 0}, 4, types.SearchOptions{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestHNSWVectorStore_ScoresMatchCosine(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	chunks := randomChunks(rng, 50, 8, "d")
+	store := NewHNSWVectorStore(DefaultParams())
+	require.NoError(t, store.Store(chunks))
+
+	query := randomChunks(rng, 1, 8, "q")[0].Embedding
+	approx, err := store.Search(query, 5, types.SearchOptions{})
+	require.NoError(t, err)
+	exact, err := similarity.Search(query, chunks, 5)
+	require.NoError(t, err)
+
+	assert.Equal(t, resultIDs(exact), resultIDs(approx))
+	for i := range exact {
+		assert.InDelta(t, exact[i].Score, approx[i].Score, 1e-9)
+	}
+}
+
+func TestHNSWVectorStore_Store_RejectsDimensionMismatch(t *testing.T) {
+	store := newStore(DefaultParams())
+	require.NoError(t, store.Store([]types.DocumentChunk{{ID: "a", Embedding: []float64{1, 0, 0}}}))
+
+	err := store.Store([]types.DocumentChunk{
+		{ID: "b", Embedding: []float64{0, 1, 0}},
+		{ID: "c", Embedding: []float64{1, 0}},
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "chunk c has embedding dimension 2, index expects 3")
+	assert.Len(t, store.chunks, 1, "rejected batch must not be partially indexed")
+}
+
+func TestHNSWVectorStore_Dimension(t *testing.T) {
+	store := newStore(DefaultParams())
+	assert.Equal(t, 0, store.Dimension())
+
+	require.NoError(t, store.Store([]types.DocumentChunk{{ID: "a", Embedding: []float64{1, 0, 0}}}))
+
+	assert.Equal(t, 3, store.Dimension())
+}
+
+func TestHNSWVectorStore_TakesAnotherDimensionOnceEmpty(t *testing.T) {
+	store := newStore(DefaultParams())
+	require.NoError(t, store.Store([]types.DocumentChunk{
+		{ID: "a", DocumentID: "old", Embedding: []float64{1, 0, 0}},
+		{ID: "b", DocumentID: "old", Embedding: []float64{0, 1, 0}},
+	}))
+
+	removed, err := store.DeleteByDocumentID("old")
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 0, store.Dimension())
+
+	require.NoError(t, store.Store([]types.DocumentChunk{
+		{ID: "c", DocumentID: "new", Embedding: []float64{1, 0}},
+		{ID: "d", DocumentID: "new", Embedding: []float64{0, 1}},
+	}))
+	assert.Equal(t, 2, store.Dimension())
+
+	results, err := store.Search([]float64{0, 1}, 5, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "c"}, resultIDs(results))
+}
+
+func TestHNSWVectorStore_DeleteByDocumentID(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	store := newStore(DefaultParams())
+	keep := randomChunks(rng, 100, 16, "keep")
+	drop := randomChunks(rng, 40, 16, "drop")
+	require.NoError(t, store.Store(keep))
+	require.NoError(t, store.Store(drop))
+
+	removed, err := store.DeleteByDocumentID("drop")
+	require.NoError(t, err)
+	assert.Equal(t, 40, removed)
+	assert.Len(t, store.graph.nodes, 140, "below the rebuild ratio deletes are tombstones")
+
+	// Querying with a deleted chunk's own embedding must not return it
+	results, err := store.Search(drop[0].Embedding, 140, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Len(t, results, 100)
+	for _, r := range results {
+		assert.Equal(t, "keep", r.Chunk.DocumentID)
+	}
+
+	removed, err = store.DeleteByDocumentID("drop")
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestHNSWVectorStore_ReplaceDocument(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	store := newStore(DefaultParams())
+	keep := randomChunks(rng, 50, 16, "keep")
+	require.NoError(t, store.Store(keep))
+	require.NoError(t, store.Store(randomChunks(rng, 10, 16, "doc")))
+
+	replacement := randomChunks(rng, 5, 16, "doc")
+	removed, err := store.ReplaceDocument("doc", replacement)
+	require.NoError(t, err)
+	assert.Equal(t, 10, removed)
+
+	results, err := store.Search(replacement[0].Embedding, 1, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{replacement[0].ID}, resultIDs(results))
+
+	t.Run("rejects a dimension mismatch without removing the old version", func(t *testing.T) {
+		_, err := store.ReplaceDocument("doc", []types.DocumentChunk{{ID: "bad", DocumentID: "doc", Embedding: []float64{1, 0}}})
+		assert.Error(t, err)
+		assert.Len(t, store.byDoc["doc"], 5)
+	})
+}
+
+func TestHNSWVectorStore_RebuildsAfterManyDeletes(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	store := newStore(DefaultParams())
+	keep := randomChunks(rng, 30, 16, "keep")
+	require.NoError(t, store.Store(keep))
+	require.NoError(t, store.Store(randomChunks(rng, 70, 16, "drop")))
+
+	removed, err := store.DeleteByDocumentID("drop")
+	require.NoError(t, err)
+	assert.Equal(t, 70, removed)
+
+	assert.Len(t, store.graph.nodes, 30, "tombstones should be dropped by the rebuild")
+	assert.Equal(t, 30, store.graph.live)
+
+	results, err := store.Search(keep[5].Embedding, 1, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{keep[5].ID}, resultIDs(results))
+
+	// Document IDs must still resolve after the rebuild renumbers nodes
+	removed, err = store.DeleteByDocumentID("keep")
+	require.NoError(t, err)
+	assert.Equal(t, 30, removed)
+}
+
+func TestHNSWVectorStore_Recall(t *testing.T) {
+	const (
+		n       = 2000
+		dim     = 32
+		queries = 50
+		k       = 10
+	)
+	rng := rand.New(rand.NewSource(42))
+	chunks := randomChunks(rng, n, dim, "d")
+	store := NewHNSWVectorStore(Params{M: 16, EfConstruction: 100, EfSearch: 64, Seed: 42})
+	require.NoError(t, store.Store(chunks))
+
+	var total float64
+	for _, q := range randomChunks(rng, queries, dim, "q") {
+		exact, err := similarity.Search(q.Embedding, chunks, k)
+		require.NoError(t, err)
+		approx, err := store.Search(q.Embedding, k, types.SearchOptions{})
+		require.NoError(t, err)
+		total += recallAtK(exact, approx)
+	}
+
+	recall := total / queries
+	assert.GreaterOrEqual(t, recall, 0.9, "mean recall@%d was %.3f", k, recall)
+}
+
+func TestHNSWVectorStore_SearchWithinCollection(t *testing.T) {
+	const (
+		dim = 16
+		k   = 5
+	)
+	rng := rand.New(rand.NewSource(7))
+	store := newStore(DefaultParams())
+	other := randomChunks(rng, 500, dim, "other")
+	scoped := randomChunks(rng, 20, dim, "scoped")
+	for i := range scoped {
+		scoped[i].Collection = "contracts"
+	}
+	require.NoError(t, store.Store(other))
+	require.NoError(t, store.Store(scoped))
+
+	options := types.SearchOptions{Collections: []string{"contracts"}}
+	for _, q := range randomChunks(rng, 10, dim, "q") {
+		exact, err := similarity.Search(q.Embedding, scoped, k)
+		require.NoError(t, err)
+		approx, err := store.Search(q.Embedding, k, options)
+		require.NoError(t, err)
+
+		// A selective filter widens the beam until it finds k matches, so the
+		// exact answer must come back even though most nodes are rejected
+		assert.Equal(t, resultIDs(exact), resultIDs(approx))
+	}
+
+	results, err := store.Search(scoped[0].Embedding, k, types.SearchOptions{Collections: []string{"missing"}})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
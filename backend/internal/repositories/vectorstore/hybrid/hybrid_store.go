@@ -0,0 +1,92 @@
+package hybrid
+
+import (
+	"fmt"
+	"sync"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/bm25"
+	"rag-backend/pkg/types"
+)
+
+// HybridVectorStore wraps any VectorStore with a BM25 keyword index. Every
+// write goes through both, so the two indexes always hold the same chunks.
+// Writes hold mutex across both updates, so a keyword search sees a replaced
+// document's old chunks or its new ones, never both or neither.
+type HybridVectorStore struct {
+	inner vectorstore.VectorStore
+	index *bm25.Index
+	mutex sync.RWMutex
+}
+
+// NewHybridVectorStore decorates inner with a keyword index. If inner already
+// holds chunks (e.g. a disk store reloaded at startup) they are indexed too.
+func NewHybridVectorStore(inner vectorstore.VectorStore) (vectorstore.VectorStore, error) {
+	hvs := &HybridVectorStore{
+		inner: inner,
+		index: bm25.NewIndex(),
+	}
+
+	if lister, ok := inner.(vectorstore.ChunkLister); ok {
+		chunks, err := lister.Chunks()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chunks for keyword index: %w", err)
+		}
+		hvs.index.Add(chunks)
+	}
+
+	return hvs, nil
+}
+
+func (hvs *HybridVectorStore) Store(chunks []types.DocumentChunk) error {
+	hvs.mutex.Lock()
+	defer hvs.mutex.Unlock()
+
+	if err := hvs.inner.Store(chunks); err != nil {
+		return err
+	}
+	hvs.index.Add(chunks)
+	return nil
+}
+
+func (hvs *HybridVectorStore) Search(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	return hvs.inner.Search(embedding, limit, options)
+}
+
+// Dimension reports the inner store's dimension, or 0 when it can't tell.
+func (hvs *HybridVectorStore) Dimension() int {
+	if dimensioner, ok := hvs.inner.(vectorstore.Dimensioner); ok {
+		return dimensioner.Dimension()
+	}
+	return 0
+}
+
+func (hvs *HybridVectorStore) DeleteByDocumentID(documentID string) (int, error) {
+	hvs.mutex.Lock()
+	defer hvs.mutex.Unlock()
+
+	removed, err := hvs.inner.DeleteByDocumentID(documentID)
+	if err != nil {
+		return 0, err
+	}
+	hvs.index.RemoveDocument(documentID)
+	return removed, nil
+}
+
+func (hvs *HybridVectorStore) ReplaceDocument(documentID string, chunks []types.DocumentChunk) (int, error) {
+	hvs.mutex.Lock()
+	defer hvs.mutex.Unlock()
+
+	removed, err := hvs.inner.ReplaceDocument(documentID, chunks)
+	if err != nil {
+		return 0, err
+	}
+	hvs.index.ReplaceDocument(documentID, chunks)
+	return removed, nil
+}
+
+func (hvs *HybridVectorStore) KeywordSearch(query string, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	hvs.mutex.RLock()
+	defer hvs.mutex.RUnlock()
+	return hvs.index.Search(query, limit, options), nil
+}
@@ -0,0 +1,166 @@
+package hybrid
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/internal/repositories/vectorstore/memory"
+	"rag-backend/pkg/types"
+)
+
+type listingStore struct {
+	vectorstore.MockVectorStore
+	chunks []types.DocumentChunk
+	err    error
+}
+
+func (l *listingStore) Chunks() ([]types.DocumentChunk, error) {
+	return l.chunks, l.err
+}
+
+func keywordIDs(t *testing.T, store vectorstore.VectorStore, query string) []string {
+	t.Helper()
+	results, err := store.(vectorstore.KeywordSearcher).KeywordSearch(query, 10, types.SearchOptions{})
+	require.NoError(t, err)
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.Chunk.ID
+	}
+	return ids
+}
+
+func TestHybridVectorStore_KeepsIndexesInSync(t *testing.T) {
+	store, err := NewHybridVectorStore(memory.NewMemoryVectorStore())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Store([]types.DocumentChunk{
+		{ID: "a-0", DocumentID: "a", Content: "ERR_TIMEOUT happens", Embedding: []float64{1, 0}},
+		{ID: "b-0", DocumentID: "b", Content: "install guide", Embedding: []float64{0, 1}},
+	}))
+
+	assert.Equal(t, []string{"a-0"}, keywordIDs(t, store, "err_timeout"))
+
+	vectorResults, err := store.Search([]float64{0, 1}, 1, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "b-0", vectorResults[0].Chunk.ID)
+
+	removed, err := store.DeleteByDocumentID("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Empty(t, keywordIDs(t, store, "err_timeout"))
+}
+
+func TestHybridVectorStore_Dimension(t *testing.T) {
+	store, err := NewHybridVectorStore(memory.NewMemoryVectorStore())
+	require.NoError(t, err)
+	require.NoError(t, store.Store([]types.DocumentChunk{{ID: "a-0", DocumentID: "a", Embedding: []float64{1, 0}}}))
+	assert.Equal(t, 2, store.(vectorstore.Dimensioner).Dimension())
+
+	store, err = NewHybridVectorStore(&listingStore{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, store.(vectorstore.Dimensioner).Dimension(), "inner store can't tell")
+}
+
+func TestHybridVectorStore_ReplaceDocument(t *testing.T) {
+	store, err := NewHybridVectorStore(memory.NewMemoryVectorStore())
+	require.NoError(t, err)
+	require.NoError(t, store.Store([]types.DocumentChunk{
+		{ID: "a-0", DocumentID: "a", Content: "old wording", Embedding: []float64{1, 0}},
+	}))
+
+	removed, err := store.ReplaceDocument("a", []types.DocumentChunk{
+		{ID: "a-0", DocumentID: "a", Content: "new wording", Embedding: []float64{1, 0}},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Empty(t, keywordIDs(t, store, "old"))
+	assert.Equal(t, []string{"a-0"}, keywordIDs(t, store, "new"))
+}
+
+func TestHybridVectorStore_KeywordSearchWaitsForReplace(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	inner := &vectorstore.MockVectorStore{
+		StoreFunc: func([]types.DocumentChunk) error { return nil },
+		ReplaceDocumentFunc: func(string, []types.DocumentChunk) (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		},
+	}
+	store, err := NewHybridVectorStore(inner)
+	require.NoError(t, err)
+	require.NoError(t, store.Store([]types.DocumentChunk{{ID: "a-0", DocumentID: "a", Content: "old wording"}}))
+
+	replaced := make(chan struct{})
+	go func() {
+		defer close(replaced)
+		_, err := store.ReplaceDocument("a", []types.DocumentChunk{{ID: "a-0", DocumentID: "a", Content: "new wording"}})
+		assert.NoError(t, err)
+	}()
+	<-started
+
+	found := make(chan []string)
+	go func() {
+		results, err := store.(vectorstore.KeywordSearcher).KeywordSearch("wording", 10, types.SearchOptions{})
+		assert.NoError(t, err)
+		contents := make([]string, len(results))
+		for i, r := range results {
+			contents[i] = r.Chunk.Content
+		}
+		found <- contents
+	}()
+
+	select {
+	case <-found:
+		t.Fatal("keyword search ran while the replace was half done")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-replaced
+	assert.Equal(t, []string{"new wording"}, <-found)
+}
+
+func TestHybridVectorStore_SkipsIndexOnInnerFailure(t *testing.T) {
+	inner := &vectorstore.MockVectorStore{
+		StoreFunc: func([]types.DocumentChunk) error { return errors.New("disk full") },
+		DeleteByDocumentIDFunc: func(string) (int, error) {
+			return 0, errors.New("disk gone")
+		},
+	}
+	store, err := NewHybridVectorStore(inner)
+	require.NoError(t, err)
+
+	err = store.Store([]types.DocumentChunk{{ID: "a-0", DocumentID: "a", Content: "hello"}})
+	assert.EqualError(t, err, "disk full")
+	assert.Empty(t, keywordIDs(t, store, "hello"))
+
+	_, err = store.DeleteByDocumentID("a")
+	assert.EqualError(t, err, "disk gone")
+}
+
+func TestNewHybridVectorStore_IndexesExistingChunks(t *testing.T) {
+	t.Run("indexes chunks reported by the inner store", func(t *testing.T) {
+		inner := &listingStore{chunks: []types.DocumentChunk{{ID: "old-0", DocumentID: "old", Content: "persisted text"}}}
+
+		store, err := NewHybridVectorStore(inner)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"old-0"}, keywordIDs(t, store, "persisted"))
+	})
+
+	t.Run("returns error when listing fails", func(t *testing.T) {
+		inner := &listingStore{err: errors.New("corrupt")}
+
+		store, err := NewHybridVectorStore(inner)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to load chunks for keyword index")
+		assert.Nil(t, store)
+	})
+}
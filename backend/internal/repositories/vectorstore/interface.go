@@ -5,5 +5,34 @@ import "rag-backend/pkg/types"
 // VectorStore defines the interface for vector storage operations
 type VectorStore interface {
 	Store(chunks []types.DocumentChunk) error
-	Search(embedding []float64, limit int) ([]types.ScoredChunk, error)
+	// Search returns up to limit chunks within the options' scope, most
+	// similar first.
+	Search(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error)
+	// DeleteByDocumentID removes every chunk belonging to the given document
+	// and returns how many chunks were removed.
+	DeleteByDocumentID(documentID string) (int, error)
+	// ReplaceDocument removes the document's chunks and stores chunks in their
+	// place in one step, so searches see either the old or the new version,
+	// never both or neither. It returns how many chunks were removed.
+	ReplaceDocument(documentID string, chunks []types.DocumentChunk) (int, error)
+}
+
+// KeywordSearcher is implemented by stores that also keep a lexical index of
+// chunk text, enabling keyword and hybrid retrieval.
+type KeywordSearcher interface {
+	KeywordSearch(query string, limit int, options types.SearchOptions) ([]types.ScoredChunk, error)
+}
+
+// ChunkLister is implemented by stores that can enumerate their contents,
+// e.g. persistent stores whose chunks survive a restart.
+type ChunkLister interface {
+	Chunks() ([]types.DocumentChunk, error)
+}
+
+// Dimensioner is implemented by stores that know the dimension of the
+// embeddings they hold.
+type Dimensioner interface {
+	// Dimension returns the length of the stored embeddings, or 0 while the
+	// store holds none.
+	Dimension() int
 }
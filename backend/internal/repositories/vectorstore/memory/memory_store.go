@@ -26,8 +26,45 @@ func (mvs *MemoryVectorStore) Store(chunks []types.DocumentChunk) error {
 	return nil
 }
 
-func (mvs *MemoryVectorStore) Search(embedding []float64, limit int) ([]types.ScoredChunk, error) {
+func (mvs *MemoryVectorStore) Search(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
 	mvs.mutex.RLock()
 	defer mvs.mutex.RUnlock()
-	return similarity.Search(embedding, mvs.documents, limit)
+	return similarity.Search(embedding, options.Filter(mvs.documents), limit)
+}
+
+func (mvs *MemoryVectorStore) Dimension() int {
+	mvs.mutex.RLock()
+	defer mvs.mutex.RUnlock()
+	return similarity.Dimension(mvs.documents)
+}
+
+func (mvs *MemoryVectorStore) DeleteByDocumentID(documentID string) (int, error) {
+	mvs.mutex.Lock()
+	defer mvs.mutex.Unlock()
+	return mvs.remove(documentID), nil
+}
+
+func (mvs *MemoryVectorStore) ReplaceDocument(documentID string, chunks []types.DocumentChunk) (int, error) {
+	mvs.mutex.Lock()
+	defer mvs.mutex.Unlock()
+	removed := mvs.remove(documentID)
+	mvs.documents = append(mvs.documents, chunks...)
+	return removed, nil
+}
+
+func (mvs *MemoryVectorStore) remove(documentID string) int {
+	// Filter in place, reusing the backing array
+	kept := mvs.documents[:0]
+	for _, chunk := range mvs.documents {
+		if chunk.DocumentID != documentID {
+			kept = append(kept, chunk)
+		}
+	}
+	removed := len(mvs.documents) - len(kept)
+
+	// Clear the tail so removed chunks (and their embeddings) can be collected
+	clear(mvs.documents[len(kept):])
+	mvs.documents = kept
+
+	return removed
 }
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/pkg/filter"
+	"rag-backend/pkg/types"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestDeleteByDocumentID(t *testing.T) {
+	type expected struct {
+		removed   int
+		remaining []string
+	}
+
+	tests := []struct {
+		name       string
+		documentID string
+		expected   expected
+	}{
+		{
+			name:       "removes every chunk of the document",
+			documentID: "doc-a",
+			expected:   expected{removed: 2, remaining: []string{"b-0"}},
+		},
+		{
+			name:       "removes nothing for unknown document",
+			documentID: "doc-z",
+			expected:   expected{removed: 0, remaining: []string{"a-0", "b-0", "a-1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryVectorStore()
+			err := store.Store([]types.DocumentChunk{
+				{ID: "a-0", DocumentID: "doc-a", Embedding: []float64{1, 0}},
+				{ID: "b-0", DocumentID: "doc-b", Embedding: []float64{0, 1}},
+				{ID: "a-1", DocumentID: "doc-a", Embedding: []float64{1, 1}},
+			})
+			assert.NoError(t, err)
+
+			removed, err := store.DeleteByDocumentID(tt.documentID)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.removed, removed)
+
+			results, err := store.Search([]float64{1, 1}, 10, types.SearchOptions{})
+			assert.NoError(t, err)
+			ids := make([]string, 0, len(results))
+			for _, r := range results {
+				ids = append(ids, r.Chunk.ID)
+			}
+			assert.ElementsMatch(t, tt.expected.remaining, ids)
+		})
+	}
+}
+
+func TestReplaceDocument(t *testing.T) {
+	store := NewMemoryVectorStore()
+	assert.NoError(t, store.Store([]types.DocumentChunk{
+		{ID: "a-0", DocumentID: "doc-a", Content: "old", Embedding: []float64{1, 0}},
+		{ID: "b-0", DocumentID: "doc-b", Embedding: []float64{0, 1}},
+		{ID: "a-1", DocumentID: "doc-a", Content: "old", Embedding: []float64{1, 1}},
+	}))
+
+	removed, err := store.ReplaceDocument("doc-a", []types.DocumentChunk{
+		{ID: "a-0", DocumentID: "doc-a", Content: "new", Embedding: []float64{1, 0}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	results, err := store.Search([]float64{1, 1}, 10, types.SearchOptions{})
+	assert.NoError(t, err)
+	contents := make(map[string]string, len(results))
+	for _, r := range results {
+		contents[r.Chunk.ID] = r.Chunk.Content
+	}
+	assert.Equal(t, map[string]string{"a-0": "new", "b-0": ""}, contents)
+}
+
+func TestSearch_CollectionScope(t *testing.T) {
+	legal := &filter.Expr{Field: "department", Eq: ptr(filter.Value("legal"))}
+
+	tests := []struct {
+		name        string
+		collections []string
+		filter      *filter.Expr
+		expected    []string
+	}{
+		{name: "unscoped searches every collection", expected: []string{"legacy", "default", "contracts"}},
+		{name: "default includes chunks without a collection", collections: []string{types.DefaultCollection}, expected: []string{"legacy", "default"}},
+		{name: "named collection only", collections: []string{"contracts"}, expected: []string{"contracts"}},
+		{name: "unknown collection matches nothing", collections: []string{"other"}, expected: []string{}},
+		{name: "metadata filter alone", filter: legal, expected: []string{"default", "contracts"}},
+		{name: "metadata filter within a collection", collections: []string{types.DefaultCollection}, filter: legal, expected: []string{"default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryVectorStore()
+			err := store.Store([]types.DocumentChunk{
+				{ID: "legacy", Embedding: []float64{1, 0}, Metadata: map[string]string{"department": "hr"}},
+				{ID: "default", Collection: types.DefaultCollection, Embedding: []float64{1, 1}, Metadata: map[string]string{"department": "legal"}},
+				{ID: "contracts", Collection: "contracts", Embedding: []float64{0, 1}, Metadata: map[string]string{"department": "legal"}},
+			})
+			assert.NoError(t, err)
+
+			results, err := store.Search([]float64{1, 1}, 10, types.SearchOptions{Collections: tt.collections, MetadataFilter: tt.filter})
+
+			assert.NoError(t, err)
+			ids := make([]string, 0, len(results))
+			for _, r := range results {
+				ids = append(ids, r.Chunk.ID)
+			}
+			assert.ElementsMatch(t, tt.expected, ids)
+		})
+	}
+}
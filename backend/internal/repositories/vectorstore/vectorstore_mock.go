@@ -3,14 +3,40 @@ package vectorstore
 import "rag-backend/pkg/types"
 
 type MockVectorStore struct {
-	StoreFunc  func(chunks []types.DocumentChunk) error
-	SearchFunc func(embedding []float64, limit int) ([]types.ScoredChunk, error)
+	StoreFunc              func(chunks []types.DocumentChunk) error
+	SearchFunc             func(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error)
+	DeleteByDocumentIDFunc func(documentID string) (int, error)
+	ReplaceDocumentFunc    func(documentID string, chunks []types.DocumentChunk) (int, error)
 }
 
 func (m *MockVectorStore) Store(chunks []types.DocumentChunk) error {
 	return m.StoreFunc(chunks)
 }
 
-func (m *MockVectorStore) Search(embedding []float64, limit int) ([]types.ScoredChunk, error) {
-	return m.SearchFunc(embedding, limit)
+func (m *MockVectorStore) Search(embedding []float64, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	return m.SearchFunc(embedding, limit, options)
+}
+
+func (m *MockVectorStore) DeleteByDocumentID(documentID string) (int, error) {
+	return m.DeleteByDocumentIDFunc(documentID)
+}
+
+func (m *MockVectorStore) ReplaceDocument(documentID string, chunks []types.DocumentChunk) (int, error) {
+	return m.ReplaceDocumentFunc(documentID, chunks)
+}
+
+type MockKeywordSearcher struct {
+	KeywordSearchFunc func(query string, limit int, options types.SearchOptions) ([]types.ScoredChunk, error)
+}
+
+func (m *MockKeywordSearcher) KeywordSearch(query string, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	return m.KeywordSearchFunc(query, limit, options)
+}
+
+type MockDimensioner struct {
+	DimensionFunc func() int
+}
+
+func (m *MockDimensioner) Dimension() int {
+	return m.DimensionFunc()
 }
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"rag-backend/pkg/types"
+)
+
+var (
+	// citationMarker matches markers such as [1], [2, 3] and [4,5]
+	citationMarker = regexp.MustCompile(`\[\s*\d+(?:\s*,\s*\d+)*\s*\]`)
+	// leadingCitationMarker matches a marker at the start of the text
+	leadingCitationMarker = regexp.MustCompile(`^` + citationMarker.String())
+	// spaceBeforePunctuation is left behind when a marker is cut from "claim [1]."
+	spaceBeforePunctuation = regexp.MustCompile(`\s+([.,;:!?])`)
+)
+
+// citedAnswer is an answer with its citation markers validated and parsed.
+type citedAnswer struct {
+	// answer keeps the valid markers; invalid ones are removed
+	answer    string
+	citations []types.Citation
+	// invalid lists the cited numbers that match no source, ascending
+	invalid []int
+}
+
+// parseCitations validates the [n] markers in an answer against the numbered
+// sources it was given. Numbers outside 1..len(sources) are stripped from the
+// answer and reported as invalid. Each remaining marker becomes a citation
+// linking the sentence it ends to the cited chunk.
+func parseCitations(answer string, sources []types.DocumentChunk) citedAnswer {
+	invalid := make(map[int]struct{})
+	cleaned := citationMarker.ReplaceAllStringFunc(answer, func(marker string) string {
+		var valid []string
+		for _, n := range markerNumbers(marker) {
+			if n < 1 || n > len(sources) {
+				invalid[n] = struct{}{}
+				continue
+			}
+			valid = append(valid, strconv.Itoa(n))
+		}
+		if len(valid) == 0 {
+			return "\x00"
+		}
+		return "[" + strings.Join(valid, ", ") + "]"
+	})
+	// Drop emptied markers together with the space that separated them from
+	// the text, so "claim [9]." becomes "claim."
+	cleaned = strings.NewReplacer(" \x00", "", "\x00", "").Replace(cleaned)
+
+	result := citedAnswer{
+		answer:    cleaned,
+		citations: []types.Citation{},
+	}
+	for n := range invalid {
+		result.invalid = append(result.invalid, n)
+	}
+	slices.Sort(result.invalid)
+
+	for _, sentence := range splitSentences(cleaned) {
+		text := sentence.text(cleaned)
+		var cited []int
+		for _, marker := range citationMarker.FindAllString(text, -1) {
+			for _, n := range markerNumbers(marker) {
+				if !slices.Contains(cited, n) {
+					cited = append(cited, n)
+				}
+			}
+		}
+		if len(cited) == 0 {
+			continue
+		}
+
+		claim := strings.Join(strings.Fields(citationMarker.ReplaceAllString(text, "")), " ")
+		claim = spaceBeforePunctuation.ReplaceAllString(claim, "$1")
+		start := utf8.RuneCountInString(cleaned[:sentence.start])
+		end := start + utf8.RuneCountInString(text)
+		for _, n := range cited {
+			result.citations = append(result.citations, types.Citation{
+				Number:  n,
+				ChunkID: sources[n-1].ID,
+				Start:   start,
+				End:     end,
+				Text:    claim,
+			})
+		}
+	}
+	return result
+}
+
+// stripCitations removes every citation marker, for text that outlives the
+// sources the numbers refer to.
+func stripCitations(answer string) string {
+	stripped := citationMarker.ReplaceAllString(answer, "\x00")
+	return strings.NewReplacer(" \x00", "", "\x00", "").Replace(stripped)
+}
+
+func markerNumbers(marker string) []int {
+	fields := strings.Split(strings.Trim(marker, "[] "), ",")
+	numbers := make([]int, 0, len(fields))
+	for _, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// sentenceSpan is a byte range of a sentence within the answer
+type sentenceSpan struct {
+	start, end int
+}
+
+func (s sentenceSpan) text(answer string) string {
+	return answer[s.start:s.end]
+}
+
+// splitSentences splits text after sentence punctuation followed by
+// whitespace, and at line breaks. Markers placed straight after the
+// punctuation, as in "claim.[1]", stay with the sentence they follow. Leading
+// and trailing whitespace is excluded from each span.
+func splitSentences(text string) []sentenceSpan {
+	var spans []sentenceSpan
+	emit := func(start, end int) {
+		for start < end && isSpace(text[start]) {
+			start++
+		}
+		for end > start && isSpace(text[end-1]) {
+			end--
+		}
+		if start < end {
+			spans = append(spans, sentenceSpan{start, end})
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '\n':
+			emit(start, i)
+			start = i + 1
+			i++
+		case '.', '!', '?':
+			j := i + 1
+			for j < len(text) && strings.IndexByte(".!?", text[j]) >= 0 {
+				j++
+			}
+			for {
+				k := j
+				for k < len(text) && text[k] == ' ' {
+					k++
+				}
+				loc := leadingCitationMarker.FindStringIndex(text[k:])
+				if loc == nil {
+					break
+				}
+				j = k + loc[1]
+			}
+			if j == len(text) || isSpace(text[j]) {
+				emit(start, j)
+				start = j
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	emit(start, len(text))
+	return spans
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/types"
+)
+
+func TestParseCitations(t *testing.T) {
+	sources := []types.DocumentChunk{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	tests := []struct {
+		name      string
+		answer    string
+		expected  string
+		citations []types.Citation
+		invalid   []int
+	}{
+		{
+			name:      "no markers",
+			answer:    "Ada Lovelace wrote it.",
+			expected:  "Ada Lovelace wrote it.",
+			citations: []types.Citation{},
+		},
+		{
+			name:     "one citation per sentence",
+			answer:   "Ada wrote it [1]. Babbage built it [2].",
+			expected: "Ada wrote it [1]. Babbage built it [2].",
+			citations: []types.Citation{
+				{Number: 1, ChunkID: "a", Start: 0, End: 17, Text: "Ada wrote it."},
+				{Number: 2, ChunkID: "b", Start: 18, End: 39, Text: "Babbage built it."},
+			},
+		},
+		{
+			name:     "grouped and adjacent markers are normalized",
+			answer:   "Both agree [2,3][1].",
+			expected: "Both agree [2, 3][1].",
+			citations: []types.Citation{
+				{Number: 2, ChunkID: "b", Start: 0, End: 21, Text: "Both agree."},
+				{Number: 3, ChunkID: "c", Start: 0, End: 21, Text: "Both agree."},
+				{Number: 1, ChunkID: "a", Start: 0, End: 21, Text: "Both agree."},
+			},
+		},
+		{
+			name:     "marker after the full stop stays with its sentence",
+			answer:   "Ada wrote it.[1] Babbage built it.",
+			expected: "Ada wrote it.[1] Babbage built it.",
+			citations: []types.Citation{
+				{Number: 1, ChunkID: "a", Start: 0, End: 16, Text: "Ada wrote it."},
+			},
+		},
+		{
+			name:     "hallucinated numbers are stripped",
+			answer:   "Ada wrote it [4]. Babbage built it [2, 7].",
+			expected: "Ada wrote it. Babbage built it [2].",
+			citations: []types.Citation{
+				{Number: 2, ChunkID: "b", Start: 14, End: 35, Text: "Babbage built it."},
+			},
+			invalid: []int{4, 7},
+		},
+		{
+			name:      "zero is never a source",
+			answer:    "Nothing [0]",
+			expected:  "Nothing",
+			citations: []types.Citation{},
+			invalid:   []int{0},
+		},
+		{
+			name:     "offsets count characters, not bytes",
+			answer:   "Ünïcødé wörks [1]. Ja [2].",
+			expected: "Ünïcødé wörks [1]. Ja [2].",
+			citations: []types.Citation{
+				{Number: 1, ChunkID: "a", Start: 0, End: 18, Text: "Ünïcødé wörks."},
+				{Number: 2, ChunkID: "b", Start: 19, End: 26, Text: "Ja."},
+			},
+		},
+		{
+			name:     "lines split sentences",
+			answer:   "- first point [1]\n- second point [3]",
+			expected: "- first point [1]\n- second point [3]",
+			citations: []types.Citation{
+				{Number: 1, ChunkID: "a", Start: 0, End: 17, Text: "- first point"},
+				{Number: 3, ChunkID: "c", Start: 18, End: 36, Text: "- second point"},
+			},
+		},
+		{
+			name:     "decimals do not end sentences",
+			answer:   "Version 2.5 shipped [1].",
+			expected: "Version 2.5 shipped [1].",
+			citations: []types.Citation{
+				{Number: 1, ChunkID: "a", Start: 0, End: 24, Text: "Version 2.5 shipped."},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseCitations(tt.answer, sources)
+
+			assert.Equal(t, tt.expected, result.answer)
+			assert.Equal(t, tt.citations, result.citations)
+			assert.Equal(t, tt.invalid, result.invalid)
+		})
+	}
+}
+
+func TestParseCitations_NoSources(t *testing.T) {
+	result := parseCitations("I don't know [1].", nil)
+
+	assert.Equal(t, "I don't know.", result.answer)
+	assert.Empty(t, result.citations)
+	assert.Equal(t, []int{1}, result.invalid)
+}
+
+func TestStripCitations(t *testing.T) {
+	assert.Equal(t, "Ada wrote it. Babbage built it.", stripCitations("Ada wrote it [1]. Babbage built it [2, 3]."))
+	assert.Equal(t, "No markers.", stripCitations("No markers."))
+}
+
+func TestQuery_Citations(t *testing.T) {
+	ec := &mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	cc := &mockChatCompleter{
+		newFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) (*openai.ChatCompletion, error) {
+			return makeChatCompletion("Ada Lovelace wrote it [1][5]."), nil
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+			return []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "a", Content: "Ada Lovelace wrote the first program."}, Score: 0.9}}, nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+
+	result, err := pipeline.Query(types.QueryRequest{Question: "Who wrote the first program?"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace wrote it [1].", result.Answer)
+	assert.Equal(t, []types.Citation{{Number: 1, ChunkID: "a", Start: 0, End: 26, Text: "Ada Lovelace wrote it."}}, result.Citations)
+	assert.Equal(t, []int{5}, result.InvalidCitations)
+
+	conversation, err := pipeline.conversations.GetConversation(result.ConversationID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ada Lovelace wrote it.", conversation.Messages[1].Content, "history drops the markers")
+}
+
+func TestQueryStream_CitationsEvent(t *testing.T) {
+	ec := &mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	cc := &mockChatCompleter{
+		newStreamingFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) ChatStream {
+			return &mockChatStream{chunks: []openai.ChatCompletionChunk{makeChatCompletionChunk("In 1843 "), makeChatCompletionChunk("[1][2].")}}
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+			return []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "a", Content: "1843"}, Score: 0.9}}, nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+
+	events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "When?"})
+	require.NoError(t, err)
+	received := drainEvents(t, events)
+
+	require.GreaterOrEqual(t, len(received), 3)
+	citations := received[len(received)-2]
+	assert.Equal(t, "In 1843 [1].", citations.Answer)
+	assert.Equal(t, []types.Citation{{Number: 1, ChunkID: "a", Start: 0, End: 12, Text: "In 1843."}}, citations.Citations)
+	assert.Equal(t, []int{2}, citations.InvalidCitations)
+	assert.True(t, received[len(received)-1].Done)
+}
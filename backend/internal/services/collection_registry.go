@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"rag-backend/internal/repositories/collectionstore"
+	"rag-backend/pkg/types"
+)
+
+var (
+	// ErrCollectionNotFound is returned when a collection name is not registered.
+	ErrCollectionNotFound = collectionstore.ErrCollectionNotFound
+	// ErrCollectionExists is returned when creating a collection that already exists.
+	ErrCollectionExists = collectionstore.ErrCollectionExists
+	// ErrInvalidCollection is returned for malformed names and for attempts to
+	// delete the default collection.
+	ErrInvalidCollection = errors.New("invalid collection")
+)
+
+// Collection names end up in chunk IDs and URLs, so keep them URL-safe
+var collectionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// CollectionRegistry manages named collections that isolate document sets
+// from each other. The default collection always exists.
+type CollectionRegistry struct {
+	collectionStore  collectionstore.CollectionStore
+	documentRegistry *DocumentRegistry
+	now              func() time.Time
+	// mutex is held for writing while a collection is deleted and for
+	// reading while documents are stored into one
+	mutex sync.RWMutex
+}
+
+func NewCollectionRegistry(collectionStore collectionstore.CollectionStore, documentRegistry *DocumentRegistry) (*CollectionRegistry, error) {
+	cr := &CollectionRegistry{
+		collectionStore:  collectionStore,
+		documentRegistry: documentRegistry,
+		now:              time.Now,
+	}
+
+	err := collectionStore.Create(types.Collection{
+		Name:        types.DefaultCollection,
+		Description: "Documents uploaded without a collection",
+		CreatedAt:   cr.now(),
+	})
+	if err != nil && !errors.Is(err, ErrCollectionExists) {
+		return nil, fmt.Errorf("failed to create default collection: %w", err)
+	}
+	return cr, nil
+}
+
+func (cr *CollectionRegistry) CreateCollection(name, description string) (*types.CollectionSummary, error) {
+	if !collectionNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be 1-63 lowercase letters, digits, '-' or '_', starting with a letter or digit", ErrInvalidCollection)
+	}
+
+	collection := types.Collection{
+		Name:        name,
+		Description: description,
+		CreatedAt:   cr.now(),
+	}
+	if err := cr.collectionStore.Create(collection); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+	return toCollectionSummary(collection, 0), nil
+}
+
+func (cr *CollectionRegistry) ListCollections() ([]types.CollectionSummary, error) {
+	collections, err := cr.collectionStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	counts, err := cr.documentCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]types.CollectionSummary, len(collections))
+	for i, collection := range collections {
+		summaries[i] = *toCollectionSummary(collection, counts[collection.Name])
+	}
+	return summaries, nil
+}
+
+// RestoreCollections creates the collections of chunks that are not
+// registered yet, such as those a persistent vector store reloads at startup,
+// so their documents can be found again. Their descriptions are lost.
+func (cr *CollectionRegistry) RestoreCollections(chunks []types.DocumentChunk) error {
+	for _, chunk := range chunks {
+		if chunk.Collection == "" {
+			continue
+		}
+		err := cr.collectionStore.Create(types.Collection{Name: chunk.Collection, CreatedAt: cr.now()})
+		if err != nil && !errors.Is(err, ErrCollectionExists) {
+			return fmt.Errorf("failed to restore collection %q: %w", chunk.Collection, err)
+		}
+	}
+	return nil
+}
+
+// DeleteCollection removes every document in the collection, then the
+// collection itself. It returns how many documents and chunks were removed.
+// It waits for documents being stored through WithCollection, so none are
+// left behind in a collection that no longer exists.
+func (cr *CollectionRegistry) DeleteCollection(name string) (int, int, error) {
+	if name == types.DefaultCollection {
+		return 0, 0, fmt.Errorf("%w: the default collection cannot be deleted", ErrInvalidCollection)
+	}
+
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	if _, err := cr.collectionStore.Get(name); err != nil {
+		return 0, 0, fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	documents, err := cr.documentRegistry.ListDocuments()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	deletedDocuments, deletedChunks := 0, 0
+	for _, document := range documents {
+		if documentCollection(document) != name {
+			continue
+		}
+		// Uploads holding a claim on the document wait on the collection
+		// lock held here before storing, so waiting for their claim would
+		// deadlock; they find the collection gone instead
+		removed, err := cr.documentRegistry.deleteDocument(document.ID)
+		deletedChunks += removed
+		if err != nil {
+			return deletedDocuments, deletedChunks, err
+		}
+		deletedDocuments++
+	}
+
+	if err := cr.collectionStore.Delete(name); err != nil {
+		return deletedDocuments, deletedChunks, fmt.Errorf("failed to delete collection: %w", err)
+	}
+	return deletedDocuments, deletedChunks, nil
+}
+
+// WithCollection runs store, which adds documents to the named collection,
+// once it has checked the collection exists. The collection can't be deleted
+// until store returns. Uploads resolve their collection long before they
+// store anything, so they check it again here.
+func (cr *CollectionRegistry) WithCollection(name string, store func() error) error {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+
+	if _, err := cr.collectionStore.Get(name); err != nil {
+		return fmt.Errorf("failed to get collection %q: %w", name, err)
+	}
+	return store()
+}
+
+// ResolveCollections checks that every named collection exists and removes
+// duplicates. No names resolves to the default collection.
+func (cr *CollectionRegistry) ResolveCollections(names ...string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{types.DefaultCollection}, nil
+	}
+
+	resolved := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		if _, err := cr.collectionStore.Get(name); err != nil {
+			return nil, fmt.Errorf("failed to get collection %q: %w", name, err)
+		}
+		resolved = append(resolved, name)
+	}
+	return resolved, nil
+}
+
+func (cr *CollectionRegistry) documentCounts() (map[string]int, error) {
+	documents, err := cr.documentRegistry.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, document := range documents {
+		counts[documentCollection(document)]++
+	}
+	return counts, nil
+}
+
+// documentCollection treats documents registered before collections existed
+// as part of the default collection.
+func documentCollection(document types.Document) string {
+	if document.Collection == "" {
+		return types.DefaultCollection
+	}
+	return document.Collection
+}
+
+func toCollectionSummary(collection types.Collection, documentCount int) *types.CollectionSummary {
+	return &types.CollectionSummary{
+		Name:          collection.Name,
+		Description:   collection.Description,
+		DocumentCount: documentCount,
+		CreatedAt:     collection.CreatedAt,
+	}
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/collectionstore"
+	collectionmemory "rag-backend/internal/repositories/collectionstore/memory"
+	documentmemory "rag-backend/internal/repositories/documentstore/memory"
+	"rag-backend/internal/repositories/vectorstore"
+	vectormemory "rag-backend/internal/repositories/vectorstore/memory"
+	"rag-backend/pkg/types"
+)
+
+// newCollectionFixture returns a registry backed by in-memory stores holding
+// one legacy document, one in the default collection and two in "contracts".
+func newCollectionFixture(t *testing.T) (*CollectionRegistry, vectorstore.VectorStore) {
+	t.Helper()
+	vectorStore := vectormemory.NewMemoryVectorStore()
+	documents := NewDocumentRegistry(documentmemory.NewMemoryDocumentStore(), vectorStore)
+
+	for _, document := range []types.Document{
+		{ID: "legacy"},
+		{ID: "notes", Collection: types.DefaultCollection},
+		{ID: "nda", Collection: "contracts"},
+		{ID: "lease", Collection: "contracts"},
+	} {
+		document.Chunks = []types.DocumentChunk{
+			{ID: document.ID + "-0", DocumentID: document.ID, Collection: document.Collection, Embedding: []float64{1, 0}},
+			{ID: document.ID + "-1", DocumentID: document.ID, Collection: document.Collection, Embedding: []float64{0, 1}},
+		}
+		require.NoError(t, vectorStore.Store(document.Chunks))
+		require.NoError(t, documents.RegisterDocument(document))
+	}
+
+	registry, err := NewCollectionRegistry(collectionmemory.NewMemoryCollectionStore(), documents)
+	require.NoError(t, err)
+	_, err = registry.CreateCollection("contracts", "Signed agreements")
+	require.NoError(t, err)
+	return registry, vectorStore
+}
+
+func TestNewCollectionRegistry(t *testing.T) {
+	tests := []struct {
+		name      string
+		createErr error
+		expected  string
+	}{
+		{name: "creates the default collection"},
+		{name: "tolerates an existing default collection", createErr: collectionstore.ErrCollectionExists},
+		{name: "wraps store errors", createErr: errors.New("disk full"), expected: "failed to create default collection: disk full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created types.Collection
+			store := &collectionstore.MockCollectionStore{
+				CreateFunc: func(collection types.Collection) error {
+					created = collection
+					return tt.createErr
+				},
+			}
+
+			registry, err := NewCollectionRegistry(store, nil)
+
+			assert.Equal(t, types.DefaultCollection, created.Name)
+			if tt.expected != "" {
+				assert.Nil(t, registry)
+				assert.EqualError(t, err, tt.expected)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, registry)
+		})
+	}
+}
+
+func TestCreateCollection(t *testing.T) {
+	tests := []struct {
+		name        string
+		collection  string
+		invalid     bool
+		exists      bool
+		description string
+	}{
+		{name: "creates a collection", collection: "reports-2024", description: "Annual reports"},
+		{name: "rejects an existing name", collection: "contracts", exists: true},
+		{name: "rejects an empty name", collection: "", invalid: true},
+		{name: "rejects uppercase", collection: "Reports", invalid: true},
+		{name: "rejects path separators", collection: "a/b", invalid: true},
+		{name: "rejects a leading dash", collection: "-reports", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, _ := newCollectionFixture(t)
+
+			summary, err := registry.CreateCollection(tt.collection, tt.description)
+
+			switch {
+			case tt.invalid:
+				assert.ErrorIs(t, err, ErrInvalidCollection)
+				assert.Nil(t, summary)
+			case tt.exists:
+				assert.ErrorIs(t, err, ErrCollectionExists)
+				assert.Nil(t, summary)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.collection, summary.Name)
+				assert.Equal(t, tt.description, summary.Description)
+				assert.Zero(t, summary.DocumentCount)
+				assert.False(t, summary.CreatedAt.IsZero())
+			}
+		})
+	}
+}
+
+func TestListCollections(t *testing.T) {
+	registry, _ := newCollectionFixture(t)
+
+	collections, err := registry.ListCollections()
+
+	require.NoError(t, err)
+	require.Len(t, collections, 2)
+	assert.Equal(t, "contracts", collections[0].Name)
+	assert.Equal(t, 2, collections[0].DocumentCount)
+	assert.Equal(t, types.DefaultCollection, collections[1].Name)
+	assert.Equal(t, 2, collections[1].DocumentCount, "documents without a collection count as default")
+}
+
+func TestDeleteCollection(t *testing.T) {
+	t.Run("removes the collection with its documents and chunks", func(t *testing.T) {
+		registry, vectorStore := newCollectionFixture(t)
+
+		documents, chunks, err := registry.DeleteCollection("contracts")
+
+		require.NoError(t, err)
+		assert.Equal(t, 2, documents)
+		assert.Equal(t, 4, chunks)
+
+		_, err = registry.ResolveCollections("contracts")
+		assert.ErrorIs(t, err, ErrCollectionNotFound)
+
+		remaining, err := registry.documentRegistry.ListDocuments()
+		require.NoError(t, err)
+		ids := make([]string, len(remaining))
+		for i, document := range remaining {
+			ids[i] = document.ID
+		}
+		assert.ElementsMatch(t, []string{"legacy", "notes"}, ids)
+
+		results, err := vectorStore.Search([]float64{1, 1}, 10, types.SearchOptions{})
+		require.NoError(t, err)
+		assert.Len(t, results, 4)
+		for _, result := range results {
+			assert.NotEqual(t, "contracts", result.Chunk.Collection)
+		}
+	})
+
+	t.Run("refuses to delete the default collection", func(t *testing.T) {
+		registry, _ := newCollectionFixture(t)
+
+		_, _, err := registry.DeleteCollection(types.DefaultCollection)
+
+		assert.ErrorIs(t, err, ErrInvalidCollection)
+	})
+
+	t.Run("returns not found for unknown collections", func(t *testing.T) {
+		registry, _ := newCollectionFixture(t)
+
+		_, _, err := registry.DeleteCollection("missing")
+
+		assert.ErrorIs(t, err, ErrCollectionNotFound)
+	})
+}
+
+func TestDeleteCollection_UploadInProgress(t *testing.T) {
+	late := types.Document{
+		ID:         "late",
+		Collection: "contracts",
+		Chunks:     []types.DocumentChunk{{ID: "late-0", DocumentID: "late", Collection: "contracts", Embedding: []float64{1, 1}}},
+	}
+
+	t.Run("waits for a document being stored", func(t *testing.T) {
+		registry, vectorStore := newCollectionFixture(t)
+		storing, unblock := make(chan struct{}), make(chan struct{})
+		stored := make(chan error)
+		go func() {
+			stored <- registry.WithCollection("contracts", func() error {
+				close(storing)
+				<-unblock
+				if err := vectorStore.Store(late.Chunks); err != nil {
+					return err
+				}
+				return registry.documentRegistry.RegisterDocument(late)
+			})
+		}()
+		<-storing
+
+		deleted := make(chan int)
+		go func() {
+			documents, _, err := registry.DeleteCollection("contracts")
+			assert.NoError(t, err)
+			deleted <- documents
+		}()
+
+		select {
+		case <-deleted:
+			t.Fatal("collection was deleted while a document was being stored in it")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(unblock)
+		require.NoError(t, <-stored)
+		assert.Equal(t, 3, <-deleted, "the stored document is deleted with the rest")
+
+		results, err := vectorStore.Search([]float64{1, 1}, 10, types.SearchOptions{Collections: []string{"contracts"}})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+	})
+
+	t.Run("refuses to store once the collection is gone", func(t *testing.T) {
+		registry, _ := newCollectionFixture(t)
+		_, _, err := registry.DeleteCollection("contracts")
+		require.NoError(t, err)
+
+		called := false
+		err = registry.WithCollection("contracts", func() error {
+			called = true
+			return nil
+		})
+
+		assert.ErrorIs(t, err, ErrCollectionNotFound)
+		assert.False(t, called)
+	})
+}
+
+func TestResolveCollections(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		expected []string
+		notFound bool
+	}{
+		{name: "no names resolves to default", expected: []string{types.DefaultCollection}},
+		{name: "keeps order and drops duplicates", names: []string{"contracts", "default", "contracts"}, expected: []string{"contracts", "default"}},
+		{name: "fails on an unknown name", names: []string{"contracts", "missing"}, notFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, _ := newCollectionFixture(t)
+
+			resolved, err := registry.ResolveCollections(tt.names...)
+
+			if tt.notFound {
+				assert.ErrorIs(t, err, ErrCollectionNotFound)
+				assert.ErrorContains(t, err, `"missing"`)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, resolved)
+		})
+	}
+}
+
+func TestRestoreCollections(t *testing.T) {
+	registry, _ := newCollectionFixture(t)
+
+	err := registry.RestoreCollections([]types.DocumentChunk{
+		{ID: "a", Collection: "reports"},
+		{ID: "b", Collection: "contracts"},
+		{ID: "c"},
+	})
+
+	require.NoError(t, err)
+	resolved, err := registry.ResolveCollections("reports", "contracts")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reports", "contracts"}, resolved)
+
+	collections, err := registry.ListCollections()
+	require.NoError(t, err)
+	assert.Len(t, collections, 3)
+	assert.Equal(t, "Signed agreements", collections[0].Description, "existing collections are left alone")
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+
+	"rag-backend/pkg/bm25"
+	"rag-backend/pkg/similarity"
+	"rag-backend/pkg/types"
+)
+
+// Confidence blends four signals, each in [0, 1]: the relevance of the best
+// source, the mean relevance of the top sources, the margin between the two
+// best sources, and how much of the answer's vocabulary appears in the
+// sources. The weights sum to 1.
+const (
+	topRelevanceWeight  = 0.45
+	meanRelevanceWeight = 0.2
+	marginWeight        = 0.1
+	coverageWeight      = 0.25
+
+	// meanRelevanceDepth is how many sources the mean relevance looks at
+	meanRelevanceDepth = 3
+	// fullMargin is the relevance gap between the two best sources that
+	// counts as a clear winner
+	fullMargin = 0.15
+	// bm25HalfRelevance is the BM25 score that maps to a relevance of 0.5
+	bm25HalfRelevance = 5.0
+	// selfAssessmentWeight is the share of the chat model's own rating when
+	// self-assessment is enabled
+	selfAssessmentWeight = 0.3
+	// refusalConfidence caps the confidence of answers that decline to answer
+	refusalConfidence = 0.1
+)
+
+// noAnswerReply is what the prompt tells the model to say when the context
+// does not contain the answer
+const noAnswerReply = "I don't have enough information to answer this question."
+
+// noDocumentsReply is the answer when there are no documents to search
+const noDocumentsReply = "There are no documents to answer from. Upload a document, or check the question's collection and filter."
+
+// coverageStopwords are ignored when measuring how much of an answer is
+// grounded in the sources; they'd match almost any text
+var coverageStopwords = map[string]struct{}{
+	"the": {}, "and": {}, "for": {}, "are": {}, "but": {}, "not": {}, "you": {}, "all": {},
+	"any": {}, "can": {}, "had": {}, "has": {}, "have": {}, "was": {}, "were": {}, "been": {},
+	"with": {}, "this": {}, "that": {}, "these": {}, "those": {}, "from": {}, "they": {},
+	"them": {}, "their": {}, "there": {}, "will": {}, "would": {}, "what": {}, "which": {},
+	"when": {}, "where": {}, "who": {}, "how": {}, "about": {}, "into": {}, "than": {},
+	"then": {}, "also": {}, "such": {}, "only": {}, "other": {}, "some": {}, "more": {},
+	"most": {}, "very": {}, "just": {}, "does": {}, "did": {}, "its": {}, "our": {}, "out": {},
+	"one": {}, "her": {}, "his": {}, "she": {}, "him": {}, "based": {}, "context": {},
+	"provided": {}, "according": {},
+}
+
+// relevanceScores maps raw retrieval scores into [0, 1] so every retrieval
+// mode can be judged on the same scale. Vector scores are cosine similarities
+// already; BM25 scores saturate towards 1; fused scores are divided by the
+// best possible fused score.
+func relevanceScores(mode string, scored []types.ScoredChunk) []float64 {
+	scores := make([]float64, len(scored))
+	for i, s := range scored {
+		relevance := s.Score
+		switch mode {
+		case types.RetrievalModeKeyword:
+			relevance = s.Score / (s.Score + bm25HalfRelevance)
+		case types.RetrievalModeHybrid:
+			relevance = s.Score / similarity.MaxFusedScore
+		}
+		scores[i] = clampUnit(relevance)
+	}
+	return scores
+}
+
+// scoreConfidence rates an answer from the relevance of its sources and how
+// well the sources cover it. An empty answer is rated on retrieval alone,
+// which is what streaming reports before the answer exists.
+func scoreConfidence(relevance []float64, answer string, sources []types.DocumentChunk) float64 {
+	if len(relevance) == 0 {
+		return 0
+	}
+
+	ranked := slices.Clone(relevance)
+	slices.SortFunc(ranked, func(a, b float64) int { return cmp.Compare(b, a) })
+
+	top := ranked[0]
+	depth := min(meanRelevanceDepth, len(ranked))
+	var mean float64
+	for _, r := range ranked[:depth] {
+		mean += r / float64(depth)
+	}
+	var second float64
+	if len(ranked) > 1 {
+		second = ranked[1]
+	}
+	margin := min(1, (top-second)/fullMargin)
+
+	retrieval := topRelevanceWeight*top + meanRelevanceWeight*mean + marginWeight*margin
+	coverage, ok := answerCoverage(answer, sources)
+	if !ok {
+		return clampUnit(retrieval / (1 - coverageWeight))
+	}
+
+	confidence := clampUnit(retrieval + coverageWeight*coverage)
+	if isRefusal(answer) {
+		confidence = min(confidence, refusalConfidence)
+	}
+	return confidence
+}
+
+// answerCoverage is the share of the answer's distinct content words that
+// appear in the sources. It reports false when the answer has no content
+// words to check.
+func answerCoverage(answer string, sources []types.DocumentChunk) (float64, bool) {
+	terms := contentTerms(answer)
+	if len(terms) == 0 {
+		return 0, false
+	}
+
+	sourceTerms := make(map[string]struct{})
+	for _, source := range sources {
+		for term := range contentTerms(source.Content) {
+			sourceTerms[term] = struct{}{}
+		}
+	}
+
+	covered := 0
+	for term := range terms {
+		if _, ok := sourceTerms[term]; ok {
+			covered++
+		}
+	}
+	return float64(covered) / float64(len(terms)), true
+}
+
+func contentTerms(text string) map[string]struct{} {
+	terms := make(map[string]struct{})
+	for _, token := range bm25.Tokenize(text) {
+		if utf8.RuneCountInString(token) < 3 {
+			continue
+		}
+		if _, stop := coverageStopwords[token]; stop {
+			continue
+		}
+		terms[token] = struct{}{}
+	}
+	return terms
+}
+
+// isRefusal reports whether the answer is the model declining to answer
+func isRefusal(answer string) bool {
+	normalized := strings.ToLower(strings.ReplaceAll(answer, "’", "'"))
+	return strings.Contains(normalized, strings.ToLower(strings.TrimSuffix(noAnswerReply, ".")))
+}
+
+// answerConfidence scores a finished answer, blending in the chat model's own
+// rating when self-assessment is enabled. A failed self-assessment falls back
+// to the heuristic score rather than failing the query.
+func (rp *RAGPipeline) answerConfidence(ctx context.Context, turn *queryTurn, answer string) float64 {
+	confidence := scoreConfidence(turn.sourceScores, answer, turn.sources)
+	if !rp.config.ConfidenceSelfAssessment || len(turn.sources) == 0 || isRefusal(answer) {
+		return confidence
+	}
+
+	rating, ok := rp.selfAssess(ctx, turn.contextInfo, turn.question, answer)
+	if !ok {
+		return confidence
+	}
+	return (1-selfAssessmentWeight)*confidence + selfAssessmentWeight*rating
+}
+
+// selfAssess asks the chat model how well the context supports the answer.
+// It reports false when the call fails or the reply is not a number in [0, 1].
+func (rp *RAGPipeline) selfAssess(ctx context.Context, contextInfo, question, answer string) (float64, bool) {
+	params := rp.chatCompletionParams(nil, buildSelfAssessmentPrompt(contextInfo, question, answer))
+	params.MaxTokens = openai.Int(8)
+
+	completion, err := rp.chatCompleter.New(ctx, params)
+	if err != nil || len(completion.Choices) == 0 {
+		return 0, false
+	}
+
+	reply := strings.TrimSuffix(strings.TrimSpace(completion.Choices[0].Message.Content), ".")
+	rating, err := strconv.ParseFloat(reply, 64)
+	if err != nil || rating < 0 || rating > 1 {
+		return 0, false
+	}
+	return rating, true
+}
+
+func buildSelfAssessmentPrompt(contextInfo, question, answer string) string {
+	return fmt.Sprintf(`Context information:
+%s
+
+Question: %s
+
+Answer: %s
+
+On a scale from 0 to 1, how fully is the answer supported by the context? Reply with the number only.`, contextInfo, question, answer)
+}
+
+func clampUnit(x float64) float64 {
+	return max(0, min(1, x))
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/similarity"
+	"rag-backend/pkg/types"
+)
+
+func TestRelevanceScores(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		scores   []float64
+		expected []float64
+	}{
+		{name: "vector scores are cosine similarities", mode: types.RetrievalModeVector, scores: []float64{0.9, 0.4}, expected: []float64{0.9, 0.4}},
+		{name: "default mode is vector", scores: []float64{0.7}, expected: []float64{0.7}},
+		{name: "negative cosine clamps to zero", mode: types.RetrievalModeVector, scores: []float64{-0.2}, expected: []float64{0}},
+		{name: "bm25 saturates", mode: types.RetrievalModeKeyword, scores: []float64{bm25HalfRelevance, 0}, expected: []float64{0.5, 0}},
+		{name: "fused scores scale to the best possible", mode: types.RetrievalModeHybrid, scores: []float64{similarity.MaxFusedScore, similarity.MaxFusedScore / 2}, expected: []float64{1, 0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scored := make([]types.ScoredChunk, len(tt.scores))
+			for i, score := range tt.scores {
+				scored[i] = types.ScoredChunk{Score: score}
+			}
+
+			relevance := relevanceScores(tt.mode, scored)
+
+			assert.InDeltaSlice(t, tt.expected, relevance, 1e-9)
+		})
+	}
+}
+
+func TestScoreConfidence(t *testing.T) {
+	sources := []types.DocumentChunk{
+		{Content: "Ada Lovelace wrote the first published program in 1843 for the Analytical Engine."},
+	}
+	grounded := "Ada Lovelace wrote the first program in 1843."
+	ungrounded := "Grace Hopper invented COBOL compilers at Remington Rand."
+
+	t.Run("no sources means no confidence", func(t *testing.T) {
+		assert.Zero(t, scoreConfidence(nil, grounded, nil))
+	})
+
+	t.Run("strong retrieval beats weak retrieval", func(t *testing.T) {
+		strong := scoreConfidence([]float64{0.92, 0.6, 0.55}, grounded, sources)
+		weak := scoreConfidence([]float64{0.35, 0.33, 0.3}, grounded, sources)
+
+		assert.Greater(t, strong, weak)
+		assert.LessOrEqual(t, strong, 1.0)
+		assert.GreaterOrEqual(t, weak, 0.0)
+	})
+
+	t.Run("a clear best source beats a tie", func(t *testing.T) {
+		clear := scoreConfidence([]float64{0.8, 0.5}, grounded, sources)
+		tied := scoreConfidence([]float64{0.8, 0.79}, grounded, sources)
+
+		assert.Greater(t, clear, tied)
+	})
+
+	t.Run("grounded answers beat ungrounded ones", func(t *testing.T) {
+		relevance := []float64{0.8, 0.6}
+
+		assert.Greater(t, scoreConfidence(relevance, grounded, sources), scoreConfidence(relevance, ungrounded, sources))
+	})
+
+	t.Run("source order does not matter", func(t *testing.T) {
+		assert.Equal(t, scoreConfidence([]float64{0.4, 0.9}, grounded, sources), scoreConfidence([]float64{0.9, 0.4}, grounded, sources))
+	})
+
+	t.Run("refusals are capped", func(t *testing.T) {
+		confidence := scoreConfidence([]float64{0.95, 0.5}, "I don’t have enough information to answer this question.", sources)
+
+		assert.LessOrEqual(t, confidence, refusalConfidence)
+	})
+
+	t.Run("empty answers are rated on retrieval alone", func(t *testing.T) {
+		relevance := []float64{1, 0.5}
+		// top 1, mean 0.75, full margin: (0.45 + 0.15 + 0.1) / 0.75
+		assert.InDelta(t, 0.7/0.75, scoreConfidence(relevance, "", sources), 1e-9)
+	})
+
+	t.Run("perfect retrieval and coverage reach one", func(t *testing.T) {
+		assert.InDelta(t, 1.0, scoreConfidence([]float64{1}, "Lovelace 1843", sources), 1e-9)
+	})
+}
+
+func TestAnswerCoverage(t *testing.T) {
+	sources := []types.DocumentChunk{
+		{Content: "The Analytical Engine was designed by Charles Babbage."},
+		{Content: "Ada Lovelace published notes on it in 1843."},
+	}
+
+	tests := []struct {
+		name     string
+		answer   string
+		expected float64
+		ok       bool
+	}{
+		{name: "fully covered across sources", answer: "Babbage designed the engine; Lovelace published notes.", expected: 1, ok: true},
+		{name: "partially covered", answer: "Lovelace published poems.", expected: 2.0 / 3, ok: true},
+		{name: "case insensitive", answer: "LOVELACE", expected: 1, ok: true},
+		{name: "only stopwords and short words", answer: "It is what it is.", ok: false},
+		{name: "empty answer", answer: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coverage, ok := answerCoverage(tt.answer, sources)
+
+			assert.Equal(t, tt.ok, ok)
+			assert.InDelta(t, tt.expected, coverage, 1e-9)
+		})
+	}
+}
+
+func TestQuery_ConfidenceSelfAssessment(t *testing.T) {
+	relevance := []float64{0.9, 0.5}
+	scored := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "a", Content: "Ada Lovelace wrote the first program in 1843."}, Score: relevance[0]},
+		{Chunk: types.DocumentChunk{ID: "b", Content: "Babbage designed the Analytical Engine."}, Score: relevance[1]},
+	}
+	answer := "Ada Lovelace wrote it in 1843."
+	heuristic := scoreConfidence(relevance, answer, []types.DocumentChunk{scored[0].Chunk, scored[1].Chunk})
+
+	tests := []struct {
+		name      string
+		enabled   bool
+		rating    string
+		ratingErr error
+		expected  float64
+		calls     int
+	}{
+		{name: "disabled uses the heuristic only", rating: "0", expected: heuristic, calls: 1},
+		{name: "blends the model rating", enabled: true, rating: " 0.5.\n", expected: 0.7*heuristic + 0.3*0.5, calls: 2},
+		{name: "ignores replies that are not ratings", enabled: true, rating: "very confident", expected: heuristic, calls: 2},
+		{name: "ignores ratings out of range", enabled: true, rating: "7", expected: heuristic, calls: 2},
+		{name: "ignores failed assessments", enabled: true, ratingErr: errors.New("rate limited"), expected: heuristic, calls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []openai.ChatCompletionNewParams
+			ec := &mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					return makeEmbeddingResponse([][]float64{{0.1}}), nil
+				},
+			}
+			cc := &mockChatCompleter{
+				newFunc: func(_ context.Context, body openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+					requests = append(requests, body)
+					if len(requests) == 1 {
+						return makeChatCompletion(answer), nil
+					}
+					if tt.ratingErr != nil {
+						return nil, tt.ratingErr
+					}
+					return makeChatCompletion(tt.rating), nil
+				},
+			}
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+					return scored, nil
+				},
+			}
+			pipeline := newTestPipeline(ec, cc, vs)
+			pipeline.config.ConfidenceSelfAssessment = tt.enabled
+
+			result, err := pipeline.Query(types.QueryRequest{Question: "Who wrote the first program?"})
+
+			require.NoError(t, err)
+			assert.Equal(t, answer, result.Answer)
+			assert.Equal(t, relevance, result.SourceScores)
+			assert.InDelta(t, tt.expected, result.Confidence, 1e-9)
+			require.Len(t, requests, tt.calls)
+			if tt.calls == 2 {
+				prompt := messageTexts(requests[1].Messages)[0]
+				assert.Contains(t, prompt, "Answer: "+answer)
+				assert.Contains(t, prompt, "Ada Lovelace wrote the first program in 1843.")
+			}
+		})
+	}
+}
+
+func TestQueryStream_FinalConfidence(t *testing.T) {
+	scored := []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "a", Content: "Ada Lovelace wrote the first program in 1843."}, Score: 0.9}}
+	ec := &mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	cc := &mockChatCompleter{
+		newStreamingFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) ChatStream {
+			return &mockChatStream{chunks: []openai.ChatCompletionChunk{makeChatCompletionChunk("Grace "), makeChatCompletionChunk("Hopper.")}}
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+			return scored, nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+
+	events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
+	require.NoError(t, err)
+	received := drainEvents(t, events)
+
+	first, last := received[0], received[len(received)-1]
+	assert.Equal(t, []float64{0.9}, first.SourceScores)
+	assert.Equal(t, scoreConfidence([]float64{0.9}, "", nil), first.Confidence)
+	require.True(t, last.Done)
+	assert.Less(t, last.Confidence, first.Confidence, "an answer the sources don't cover lowers the confidence")
+	assert.Equal(t, scoreConfidence([]float64{0.9}, "Grace Hopper.", []types.DocumentChunk{scored[0].Chunk}), last.Confidence)
+}
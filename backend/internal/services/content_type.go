@@ -0,0 +1,94 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnsupportedFileType is returned when no extractor handles the
+	// detected type of an upload
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+	// ErrContentTypeMismatch is returned when an upload's bytes contradict its
+	// declared Content-Type or file extension
+	ErrContentTypeMismatch = errors.New("file content does not match its declared type")
+)
+
+const (
+	docxContentType   = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	binaryContentType = "application/octet-stream"
+)
+
+// textualContentTypes are the non-text/* types whose content is text
+var textualContentTypes = []string{"application/xhtml+xml", "application/csv", "application/json", "application/xml"}
+
+// detectContentType determines a file's type from its bytes. Binary formats
+// are recognised by their magic bytes. Anything else must be UTF-8 without
+// NUL bytes to count as text; the extension then picks the text format, so
+// a README.md is Markdown rather than plain text.
+func (dp *DocumentProcessor) detectContentType(content []byte, filename string) string {
+	switch {
+	case bytes.HasPrefix(content, []byte("%PDF-")):
+		return "application/pdf"
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		if isDOCX(content) {
+			return docxContentType
+		}
+		return "application/zip"
+	}
+
+	if !isUTF8Text(content) {
+		sniffed := mediaType(http.DetectContentType(content))
+		// The standard sniffer calls UTF-16 text "text/plain", which the
+		// extractors can't read
+		if isTextualType(sniffed) {
+			return binaryContentType
+		}
+		return sniffed
+	}
+
+	if extensionType, ok := dp.extractors.TypeForExtension(filename); ok && isTextualType(extensionType) {
+		return extensionType
+	}
+	if mediaType(http.DetectContentType(content)) == "text/html" {
+		return "text/html"
+	}
+	return "text/plain"
+}
+
+// compatibleContentTypes reports whether a declared type agrees with the
+// detected one. Generic declarations agree with anything, and text formats
+// are interchangeable since any text can be read as plain text.
+func compatibleContentTypes(declared, detected string) bool {
+	if declared == "" || declared == binaryContentType || declared == detected {
+		return true
+	}
+	return isTextualType(declared) && isTextualType(detected)
+}
+
+func isTextualType(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || slices.Contains(textualContentTypes, contentType)
+}
+
+func isUTF8Text(content []byte) bool {
+	content = bytes.TrimPrefix(content, []byte("\uFEFF"))
+	return utf8.Valid(content) && bytes.IndexByte(content, 0) < 0
+}
+
+func isDOCX(content []byte) bool {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return false
+	}
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"rag-backend/pkg/types"
+)
+
+const (
+	// messageTokenOverhead approximates the tokens the chat format adds to
+	// each message
+	messageTokenOverhead = 4
+	// minMergeOverlap is the shortest text two neighbouring chunks must share
+	// to be joined on it; shorter matches, such as a closing and a reopened
+	// code fence, are more likely chance than overlap
+	minMergeOverlap = 10
+)
+
+// packedContext is the context the prompt is built from: numbered passages
+// and the chunks that did not fit
+type packedContext struct {
+	// passages are the sources, one per [n] in text. A passage is a chunk, or
+	// neighbouring chunks of one document merged into one.
+	passages []types.ScoredChunk
+	text     string
+	// dropped are the IDs of candidates left out to stay within the budget
+	dropped []string
+	// noAnswerCode is set when there is nothing to answer from, and says why
+	noAnswerCode string
+}
+
+// contextCandidate is a chunk considered for the context, along with where it
+// sits in its document
+type contextCandidate struct {
+	scored   types.ScoredChunk
+	document string
+	index    int
+}
+
+// passage is a run of neighbouring kept candidates, in document order, the
+// chunk they merge into, and what its text costs
+type passage struct {
+	members []contextCandidate
+	merged  types.ScoredChunk
+	tokens  int
+}
+
+// packContext fills the context with candidates in order of relevance until
+// the token budget is spent. A candidate that doesn't fit is left out, but
+// later, shorter ones may still fit. Candidates that are neighbours in one
+// document are merged into a single passage, and the text they overlap by is
+// only counted and shown once. Passages are ordered by their most relevant
+// chunk.
+//
+// The context is costed passage by passage, plus the [n] markers and the
+// separators between passages, so each candidate only counts the tokens of
+// the one passage it adds or grows.
+func packContext(candidates []types.ScoredChunk, budget int, count func(string) int) packedContext {
+	var packed packedContext
+	separatorTokens := count(passageSeparator)
+	// markerTokens[n] is the cost of the markers [1] to [n]
+	markerTokens := []int{0}
+	markers := func(n int) int {
+		for len(markerTokens) <= n {
+			k := len(markerTokens)
+			markerTokens = append(markerTokens, markerTokens[k-1]+count(passageMarker(k)))
+		}
+		return markerTokens[n]
+	}
+
+	var passages []passage
+	// passageTokens is the cost of the passages' text alone
+	passageTokens := 0
+	for _, scored := range candidates {
+		document, index := chunkPosition(scored.Chunk)
+		candidate := contextCandidate{scored: scored, document: document, index: index}
+
+		// The candidate may extend the passage before it, the one after it,
+		// or join the two
+		before, after := -1, -1
+		for i, p := range passages {
+			if neighbours(p.members[len(p.members)-1], candidate) {
+				before = i
+			}
+			if neighbours(candidate, p.members[0]) {
+				after = i
+			}
+		}
+		members := []contextCandidate{candidate}
+		replaced := 0
+		n := len(passages) + 1
+		if before >= 0 {
+			members = append(slices.Clone(passages[before].members), candidate)
+			replaced += passages[before].tokens
+			n--
+		}
+		if after >= 0 {
+			members = append(members, passages[after].members...)
+			replaced += passages[after].tokens
+			n--
+		}
+		merged := mergeChunks(members)
+		grown := passage{members: members, merged: merged, tokens: count(passageText(merged))}
+
+		tokens := passageTokens - replaced + grown.tokens
+		if tokens+markers(n)+(n-1)*separatorTokens > budget {
+			packed.dropped = append(packed.dropped, scored.Chunk.ID)
+			continue
+		}
+		passageTokens = tokens
+
+		// A grown passage keeps the place of its most relevant chunk, the
+		// earlier of the passages it joins
+		switch {
+		case before >= 0 && after >= 0:
+			at, joined := min(before, after), max(before, after)
+			passages[at] = grown
+			passages = slices.Delete(passages, joined, joined+1)
+		case before >= 0:
+			passages[before] = grown
+		case after >= 0:
+			passages[after] = grown
+		default:
+			passages = append(passages, grown)
+		}
+	}
+
+	packed.passages = make([]types.ScoredChunk, len(passages))
+	for i, p := range passages {
+		packed.passages[i] = p.merged
+	}
+	packed.text = formatContext(packed.passages)
+	return packed
+}
+
+// neighbours reports whether b directly follows a in the same document and
+// section
+func neighbours(a, b contextCandidate) bool {
+	return a.document != "" && a.document == b.document && b.index == a.index+1 &&
+		a.scored.Chunk.Metadata["section"] == b.scored.Chunk.Metadata["section"]
+}
+
+// mergeChunks joins a run of neighbouring chunks, in document order, into one
+// passage. It keeps the first chunk's ID and the highest score, and spans the
+// pages of all of them.
+func mergeChunks(members []contextCandidate) types.ScoredChunk {
+	merged := members[0].scored
+	if len(members) == 1 {
+		return merged
+	}
+
+	content := merged.Chunk.Content
+	for _, member := range members[1:] {
+		content = joinOverlapping(content, member.scored.Chunk.Content)
+		merged.Score = max(merged.Score, member.scored.Score)
+	}
+	merged.Chunk.Content = content
+	merged.Chunk.Embedding = nil
+
+	if pageEnd := members[len(members)-1].scored.Chunk.Metadata["page_end"]; pageEnd != "" {
+		merged.Chunk.Metadata = maps.Clone(merged.Chunk.Metadata)
+		merged.Chunk.Metadata["page_end"] = pageEnd
+	}
+	return merged
+}
+
+// joinOverlapping appends b to a, leaving out the start of b that repeats the
+// end of a. Chunks that don't overlap are joined with a blank line.
+func joinOverlapping(a, b string) string {
+	for k := min(len(a), len(b)); k >= minMergeOverlap; k-- {
+		if strings.HasSuffix(a, b[:k]) {
+			return a + b[k:]
+		}
+	}
+	return a + "\n\n" + b
+}
+
+// chunkPosition reads a chunk's document and position in it from its ID,
+// "{collection}/{source}-chunk-{n}". Chunks with IDs of another form have no
+// neighbours.
+func chunkPosition(chunk types.DocumentChunk) (string, int) {
+	at := strings.LastIndex(chunk.ID, "-chunk-")
+	if at < 0 {
+		return "", 0
+	}
+	index, err := strconv.Atoi(chunk.ID[at+len("-chunk-"):])
+	if err != nil {
+		return "", 0
+	}
+	return chunk.ID[:at], index
+}
+
+// passageSeparator goes between the passages of the context
+const passageSeparator = "\n\n"
+
+// formatContext numbers the passages so the answer can cite them as [n]
+func formatContext(passages []types.ScoredChunk) string {
+	var contextBuilder strings.Builder
+	for i, scored := range passages {
+		if i > 0 {
+			contextBuilder.WriteString(passageSeparator)
+		}
+		contextBuilder.WriteString(passageMarker(i + 1))
+		contextBuilder.WriteString(passageText(scored))
+	}
+	return contextBuilder.String()
+}
+
+// passageMarker is the [n] a passage is cited by
+func passageMarker(n int) string {
+	return fmt.Sprintf("[%d] ", n)
+}
+
+// passageText is a passage as the context shows it, after its section if it
+// has one
+func passageText(scored types.ScoredChunk) string {
+	if section := scored.Chunk.Metadata["section"]; section != "" {
+		return fmt.Sprintf("(%s) %s", section, scored.Chunk.Content)
+	}
+	return scored.Chunk.Content
+}
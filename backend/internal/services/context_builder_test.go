@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/tokenizer"
+	"rag-backend/pkg/types"
+)
+
+// countWords stands in for a tokenizer so budgets are easy to work out
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+func scoredChunk(id, content string, score float64, metadata map[string]string) types.ScoredChunk {
+	return types.ScoredChunk{Chunk: types.DocumentChunk{ID: id, Content: content, Metadata: metadata}, Score: score}
+}
+
+func TestPackContext(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []types.ScoredChunk
+		budget     int
+		passages   []types.ScoredChunk
+		text       string
+		dropped    []string
+	}{
+		{
+			name: "everything fits",
+			candidates: []types.ScoredChunk{
+				scoredChunk("x", "one two", 0.9, nil),
+				scoredChunk("y", "three", 0.8, map[string]string{"section": "Intro"}),
+			},
+			budget: 10,
+			passages: []types.ScoredChunk{
+				scoredChunk("x", "one two", 0.9, nil),
+				scoredChunk("y", "three", 0.8, map[string]string{"section": "Intro"}),
+			},
+			text: "[1] one two\n\n[2] (Intro) three",
+		},
+		{
+			name: "a chunk too long for what is left gives way to shorter ones",
+			candidates: []types.ScoredChunk{
+				scoredChunk("x", "one two", 0.9, nil),
+				scoredChunk("y", "three four five six", 0.8, nil),
+				scoredChunk("z", "seven", 0.7, nil),
+			},
+			budget: 6,
+			passages: []types.ScoredChunk{
+				scoredChunk("x", "one two", 0.9, nil),
+				scoredChunk("z", "seven", 0.7, nil),
+			},
+			text:    "[1] one two\n\n[2] seven",
+			dropped: []string{"y"},
+		},
+		{
+			name: "nothing fits",
+			candidates: []types.ScoredChunk{
+				scoredChunk("x", "one two three", 0.9, nil),
+			},
+			budget:   2,
+			passages: []types.ScoredChunk{},
+			dropped:  []string{"x"},
+		},
+		{
+			name: "neighbours merge without repeating their overlap",
+			candidates: []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-1", "The second sentence. The third sentence.", 0.9, map[string]string{"page_start": "1", "page_end": "2"}),
+				scoredChunk("default/b.txt-chunk-0", "Another file.", 0.8, nil),
+				scoredChunk("default/a.txt-chunk-0", "The first sentence. The second sentence.", 0.7, map[string]string{"page_start": "1", "page_end": "1"}),
+			},
+			budget: 20,
+			passages: []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-0", "The first sentence. The second sentence. The third sentence.", 0.9, map[string]string{"page_start": "1", "page_end": "2"}),
+				scoredChunk("default/b.txt-chunk-0", "Another file.", 0.8, nil),
+			},
+			text: "[1] The first sentence. The second sentence. The third sentence.\n\n[2] Another file.",
+		},
+		{
+			name: "merged overlap only counts once against the budget",
+			candidates: []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-0", "one two three four", 0.9, nil),
+				scoredChunk("default/a.txt-chunk-1", "three four five", 0.8, nil),
+			},
+			budget: 6,
+			passages: []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-0", "one two three four five", 0.9, nil),
+			},
+			text: "[1] one two three four five",
+		},
+		{
+			name: "a chunk between two passages joins them",
+			candidates: []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-2", "three", 0.9, nil),
+				scoredChunk("default/b.txt-chunk-0", "other", 0.8, nil),
+				scoredChunk("default/a.txt-chunk-0", "one", 0.7, nil),
+				scoredChunk("default/a.txt-chunk-1", "two", 0.6, nil),
+			},
+			budget: 6,
+			passages: []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-0", "one\n\ntwo\n\nthree", 0.9, nil),
+				scoredChunk("default/b.txt-chunk-0", "other", 0.8, nil),
+			},
+			text: "[1] one\n\ntwo\n\nthree\n\n[2] other",
+		},
+		{
+			name: "chunks apart or in different sections stay separate",
+			candidates: []types.ScoredChunk{
+				scoredChunk("default/a.md-chunk-0", "Setup.", 0.9, map[string]string{"section": "Install"}),
+				scoredChunk("default/a.md-chunk-1", "Run it.", 0.8, map[string]string{"section": "Usage"}),
+				scoredChunk("default/a.md-chunk-3", "Done.", 0.7, map[string]string{"section": "Usage"}),
+			},
+			budget: 20,
+			passages: []types.ScoredChunk{
+				scoredChunk("default/a.md-chunk-0", "Setup.", 0.9, map[string]string{"section": "Install"}),
+				scoredChunk("default/a.md-chunk-1", "Run it.", 0.8, map[string]string{"section": "Usage"}),
+				scoredChunk("default/a.md-chunk-3", "Done.", 0.7, map[string]string{"section": "Usage"}),
+			},
+			text: "[1] (Install) Setup.\n\n[2] (Usage) Run it.\n\n[3] (Usage) Done.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed := packContext(tt.candidates, tt.budget, countWords)
+
+			assert.Equal(t, tt.passages, packed.passages)
+			assert.Equal(t, tt.text, packed.text)
+			assert.Equal(t, tt.dropped, packed.dropped)
+		})
+	}
+}
+
+func TestPackContext_CountsEachPassageOnce(t *testing.T) {
+	var candidates []types.ScoredChunk
+	for i := range 200 {
+		candidates = append(candidates, scoredChunk(fmt.Sprintf("default/doc%d.txt-chunk-%d", i%20, i/20), "some words in a chunk", 1, nil))
+	}
+	counted := 0
+	count := func(text string) int {
+		counted += len(text)
+		return countWords(text)
+	}
+
+	packed := packContext(candidates, 10_000, count)
+
+	assert.Len(t, packed.passages, 20)
+	// Each chunk is counted with the passage it grows, never with the whole
+	// context, so the work stays well under the context's length times the
+	// number of candidates
+	assert.Less(t, counted, 10*len(packed.text))
+}
+
+func TestJoinOverlapping(t *testing.T) {
+	assert.Equal(t, "The first one. The second one. The third one.", joinOverlapping("The first one. The second one.", "The second one. The third one."))
+	assert.Equal(t, "Alpha.\n\nBeta.", joinOverlapping("Alpha.", "Beta."))
+	// A shared closing and opening fence is not overlap
+	assert.Equal(t, "```\na\n```\n\n```\nb\n```", joinOverlapping("```\na\n```", "```\nb\n```"))
+}
+
+func TestChunkPosition(t *testing.T) {
+	document, index := chunkPosition(types.DocumentChunk{ID: "docs/guide-chunk-v2.md-chunk-12"})
+	assert.Equal(t, "docs/guide-chunk-v2.md", document)
+	assert.Equal(t, 12, index)
+
+	document, _ = chunkPosition(types.DocumentChunk{ID: "custom-id"})
+	assert.Equal(t, "", document)
+}
+
+func TestQuery_ContextBudget(t *testing.T) {
+	long := strings.Repeat("filler words that take up room ", 40)
+	ec := &mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	var prompt string
+	cc := &mockChatCompleter{
+		newFunc: func(_ context.Context, body openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+			texts := messageTexts(body.Messages)
+			prompt = texts[len(texts)-1]
+			return makeChatCompletion("answer"), nil
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+			return []types.ScoredChunk{
+				scoredChunk("default/a.txt-chunk-0", "Short and relevant.", 0.9, nil),
+				scoredChunk("default/b.txt-chunk-0", long, 0.8, nil),
+				scoredChunk("default/c.txt-chunk-0", "Also short.", 0.7, nil),
+			}, nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+	pipeline.config.ContextTokenBudget = 50
+
+	response, err := pipeline.Query(types.QueryRequest{Question: "q"})
+
+	require.NoError(t, err)
+	require.Len(t, response.Sources, 2)
+	assert.Equal(t, "default/a.txt-chunk-0", response.Sources[0].ID)
+	assert.Equal(t, "default/c.txt-chunk-0", response.Sources[1].ID)
+	assert.Equal(t, []string{"default/b.txt-chunk-0"}, response.DroppedChunks)
+	assert.Contains(t, prompt, "[1] Short and relevant.\n\n[2] Also short.")
+	assert.NotContains(t, prompt, "filler")
+}
+
+func TestContextBudget(t *testing.T) {
+	pipeline := newTestPipeline(nil, nil, nil)
+	pipeline.config.ContextTokenBudget = 2000
+	pipeline.config.AnswerTokenReserve = 1000
+	overhead := tokenizer.Compact().Count(buildPrompt("", "q")) + messageTokenOverhead
+
+	pipeline.config.ContextWindow = 8000
+	assert.Equal(t, 2000, pipeline.contextBudget(nil, "q"), "capped by the budget")
+
+	pipeline.config.ContextWindow = 2500
+	assert.Equal(t, 1500-overhead, pipeline.contextBudget(nil, "q"), "what the window leaves")
+
+	history := []types.ChatMessage{{Role: types.ChatRoleUser, Content: "earlier question"}}
+	assert.Equal(t, 1500-overhead-tokenizer.Compact().Count("earlier question")-messageTokenOverhead, pipeline.contextBudget(history, "q"), "history takes room too")
+
+	pipeline.config.ContextWindow = 1000
+	assert.Equal(t, 0, pipeline.contextBudget(nil, "q"))
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+
+	"rag-backend/internal/repositories/conversationstore"
+	"rag-backend/pkg/types"
+)
+
+// ErrConversationNotFound is returned when a conversation ID is unknown.
+var ErrConversationNotFound = conversationstore.ErrConversationNotFound
+
+// maxHistoryMessages caps how much history is sent to the model, so long
+// conversations don't crowd the retrieved context out of the prompt.
+const maxHistoryMessages = 10
+
+type ConversationHistory struct {
+	conversationStore conversationstore.ConversationStore
+}
+
+func NewConversationHistory(conversationStore conversationstore.ConversationStore) *ConversationHistory {
+	return &ConversationHistory{
+		conversationStore: conversationStore,
+	}
+}
+
+// RecentMessages returns the latest messages of a conversation, oldest first.
+func (ch *ConversationHistory) RecentMessages(id string) ([]types.ChatMessage, error) {
+	conversation, err := ch.conversationStore.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+
+	messages := conversation.Messages
+	if len(messages) > maxHistoryMessages {
+		messages = messages[len(messages)-maxHistoryMessages:]
+	}
+	return messages, nil
+}
+
+// RecordTurn stores a question and its answer, creating the conversation on
+// its first turn.
+func (ch *ConversationHistory) RecordTurn(id, question, answer string) error {
+	err := ch.conversationStore.Append(id,
+		types.ChatMessage{Role: types.ChatRoleUser, Content: question},
+		types.ChatMessage{Role: types.ChatRoleAssistant, Content: answer},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	return nil
+}
+
+func (ch *ConversationHistory) GetConversation(id string) (*types.Conversation, error) {
+	conversation, err := ch.conversationStore.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	return &conversation, nil
+}
+
+func (ch *ConversationHistory) DeleteConversation(id string) error {
+	if err := ch.conversationStore.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	return nil
+}
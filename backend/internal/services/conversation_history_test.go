@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/internal/repositories/conversationstore"
+	"rag-backend/pkg/types"
+)
+
+func makeHistory(turns int) []types.ChatMessage {
+	messages := make([]types.ChatMessage, 0, 2*turns)
+	for i := range turns {
+		messages = append(messages,
+			types.ChatMessage{Role: types.ChatRoleUser, Content: fmt.Sprintf("question %d", i)},
+			types.ChatMessage{Role: types.ChatRoleAssistant, Content: fmt.Sprintf("answer %d", i)},
+		)
+	}
+	return messages
+}
+
+func TestConversationHistory_RecentMessages(t *testing.T) {
+	type expected struct {
+		messages []types.ChatMessage
+		notFound bool
+		err      string
+	}
+
+	tests := []struct {
+		name     string
+		stored   []types.ChatMessage
+		storeErr error
+		expected expected
+	}{
+		{
+			name:     "returns short history unchanged",
+			stored:   makeHistory(2),
+			expected: expected{messages: makeHistory(2)},
+		},
+		{
+			name:     "keeps only the latest messages",
+			stored:   makeHistory(8),
+			expected: expected{messages: makeHistory(8)[16-maxHistoryMessages:]},
+		},
+		{
+			name:     "wraps not found",
+			storeErr: conversationstore.ErrConversationNotFound,
+			expected: expected{notFound: true, err: "failed to load conversation"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := NewConversationHistory(&conversationstore.MockConversationStore{
+				GetFunc: func(id string) (types.Conversation, error) {
+					assert.Equal(t, "c1", id)
+					return types.Conversation{ID: id, Messages: tt.stored}, tt.storeErr
+				},
+			})
+
+			messages, err := history.RecentMessages("c1")
+
+			if tt.expected.err != "" {
+				assert.ErrorContains(t, err, tt.expected.err)
+				assert.Equal(t, tt.expected.notFound, errors.Is(err, ErrConversationNotFound))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.messages, messages)
+		})
+	}
+}
+
+func TestConversationHistory_RecordTurn(t *testing.T) {
+	tests := []struct {
+		name     string
+		storeErr error
+		expected string
+	}{
+		{name: "appends question then answer"},
+		{name: "wraps store errors", storeErr: errors.New("disk full"), expected: "failed to save conversation: disk full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var appended []types.ChatMessage
+			history := NewConversationHistory(&conversationstore.MockConversationStore{
+				AppendFunc: func(id string, messages ...types.ChatMessage) error {
+					assert.Equal(t, "c1", id)
+					appended = messages
+					return tt.storeErr
+				},
+			})
+
+			err := history.RecordTurn("c1", "Who wrote it?", "Ada.")
+
+			assert.Equal(t, []types.ChatMessage{
+				{Role: types.ChatRoleUser, Content: "Who wrote it?"},
+				{Role: types.ChatRoleAssistant, Content: "Ada."},
+			}, appended)
+			if tt.expected != "" {
+				assert.EqualError(t, err, tt.expected)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestConversationHistory_GetAndDelete(t *testing.T) {
+	conversation := types.Conversation{ID: "c1", Messages: makeHistory(1)}
+	history := NewConversationHistory(&conversationstore.MockConversationStore{
+		GetFunc: func(id string) (types.Conversation, error) {
+			if id != "c1" {
+				return types.Conversation{}, conversationstore.ErrConversationNotFound
+			}
+			return conversation, nil
+		},
+		DeleteFunc: func(id string) error {
+			if id != "c1" {
+				return conversationstore.ErrConversationNotFound
+			}
+			return nil
+		},
+	})
+
+	got, err := history.GetConversation("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, &conversation, got)
+
+	_, err = history.GetConversation("missing")
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+
+	assert.NoError(t, history.DeleteConversation("c1"))
+	assert.ErrorIs(t, history.DeleteConversation("missing"), ErrConversationNotFound)
+}
@@ -1,89 +1,127 @@
 package services
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"strings"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/ledongthuc/pdf"
 
 	"rag-backend/pkg/types"
 )
 
-type DocumentProcessor struct{}
+// DocumentProcessor extracts text from uploaded files using the extractor
+// registered for their type.
+type DocumentProcessor struct {
+	extractors *ExtractorRegistry
+}
 
 func NewDocumentProcessor() *DocumentProcessor {
-	return &DocumentProcessor{}
+	dp := &DocumentProcessor{extractors: NewExtractorRegistry()}
+	dp.RegisterExtractor(FileExtractorFunc(dp.processPDF), []string{"application/pdf"}, []string{".pdf"})
+	dp.RegisterExtractor(ExtractorFunc(extractPlainText), []string{"text/plain"}, []string{".txt", ".text"})
+	dp.RegisterExtractor(ExtractorFunc(extractMarkdown), []string{"text/markdown", "text/x-markdown"}, []string{".md", ".markdown"})
+	dp.RegisterExtractor(ExtractorFunc(extractHTML), []string{"text/html", "application/xhtml+xml"}, []string{".html", ".htm", ".xhtml"})
+	dp.RegisterExtractor(ExtractorFunc(extractCSV), []string{"text/csv", "application/csv"}, []string{".csv"})
+	dp.RegisterExtractor(ExtractorFunc(extractTSV), []string{"text/tab-separated-values"}, []string{".tsv"})
+	dp.RegisterExtractor(ExtractorFunc(extractDOCX), []string{docxContentType}, []string{".docx"})
+	return dp
+}
+
+// RegisterExtractor adds support for a file type, or replaces the extractor
+// of one already supported.
+func (dp *DocumentProcessor) RegisterExtractor(extractor Extractor, mimeTypes, extensions []string) {
+	dp.extractors.Register(extractor, mimeTypes, extensions)
 }
 
-func (dp *DocumentProcessor) ProcessFile(fileHeader *multipart.FileHeader) (string, error) {
+// ProcessFile extracts the text of an upload, see Extract.
+func (dp *DocumentProcessor) ProcessFile(fileHeader *multipart.FileHeader) (types.ExtractedFile, error) {
+	content, err := ReadUpload(fileHeader)
+	if err != nil {
+		return types.ExtractedFile{}, err
+	}
+	return dp.Extract(content, fileHeader.Filename, fileHeader.Header.Get("Content-Type"))
+}
+
+// ReadUpload reads the whole of an uploaded file. Uploads spooled to disk are
+// removed when the request ends, so anything processed later must be read
+// first.
+func ReadUpload(fileHeader *multipart.FileHeader) ([]byte, error) {
 	file, err := fileHeader.Open()
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	content, err := io.ReadAll(file)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
-	}
-
-	contentType := fileHeader.Header.Get("Content-Type")
-
-	switch contentType {
-	case "application/pdf":
-		return dp.processPDF(content)
-	case "text/plain":
-		return string(content), nil
-	default:
-		return "", fmt.Errorf("unsupported file type: %s", contentType)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	return content, nil
 }
 
-func (dp *DocumentProcessor) processPDF(content []byte) (string, error) {
-	reader := bytes.NewReader(content)
+// Extract returns the text of a file. The file's type is detected from its
+// content; the client's declared type and the file extension are only checked
+// against it, and a contradiction is an ErrContentTypeMismatch.
+func (dp *DocumentProcessor) Extract(content []byte, filename, declaredType string) (types.ExtractedFile, error) {
+	detected := dp.detectContentType(content, filename)
+	declared := mediaType(declaredType)
+	if !compatibleContentTypes(declared, detected) {
+		return types.ExtractedFile{}, contentTypeMismatch("declared type "+declared, declared, detected)
+	}
+	if extensionType, ok := dp.extractors.TypeForExtension(filename); ok && !compatibleContentTypes(extensionType, detected) {
+		return types.ExtractedFile{}, contentTypeMismatch("extension "+filepath.Ext(filename), extensionType, detected)
+	}
 
-	pdfReader, err := pdf.NewReader(reader, int64(len(content)))
+	extractor, ok := dp.extractors.Lookup(detected, filename)
+	if !ok {
+		return types.ExtractedFile{}, fmt.Errorf("%w: %s", ErrUnsupportedFileType, detected)
+	}
+	file, err := extractFile(extractor, content)
 	if err != nil {
-		return "", fmt.Errorf("failed to create PDF reader: %w", err)
+		return types.ExtractedFile{}, err
 	}
+	file.ContentType = detected
+	return file, nil
+}
 
-	var textBuilder strings.Builder
-	numPages := pdfReader.NumPage()
-
-	for i := 1; i <= numPages; i++ {
-		page := pdfReader.Page(i)
-		if page.V.IsNull() {
-			continue
-		}
-
-		text, err := page.GetPlainText(nil)
-		if err != nil {
-			continue // Skip pages that can't be processed
-		}
-
-		textBuilder.WriteString(text)
-		textBuilder.WriteString("\n")
+func extractFile(extractor Extractor, content []byte) (types.ExtractedFile, error) {
+	if fileExtractor, ok := extractor.(FileExtractor); ok {
+		return fileExtractor.ExtractFile(content)
 	}
+	text, err := extractor.Extract(content)
+	return types.ExtractedFile{Content: text}, err
+}
 
-	text := textBuilder.String()
-	if text == "" {
-		return "", fmt.Errorf("no text could be extracted from PDF")
+func contentTypeMismatch(claim, claimedType, detected string) error {
+	if isTextualType(claimedType) && !isTextualType(detected) {
+		return fmt.Errorf("%w: %s says text but the content is not valid UTF-8 text", ErrContentTypeMismatch, claim)
 	}
+	return fmt.Errorf("%w: %s says %s but the content is %s", ErrContentTypeMismatch, claim, claimedType, detected)
+}
 
-	return strings.TrimSpace(text), nil
+func extractPlainText(content []byte) (string, error) {
+	return string(content), nil
 }
 
 func (dp *DocumentProcessor) CreateDocument(content, fileName string) types.Document {
 	return types.Document{
-		ID:         uuid.New().String(),
-		Name:       fileName,
-		Content:    content,
-		Chunks:     []types.DocumentChunk{},
-		UploadedAt: time.Now(),
+		ID:          uuid.New().String(),
+		Name:        fileName,
+		Content:     content,
+		ContentHash: ContentHash(content),
+		Chunks:      []types.DocumentChunk{},
+		UploadedAt:  time.Now(),
 	}
 }
+
+// ContentHash fingerprints extracted text, so re-uploads of a file whose text
+// has not changed can be recognised
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
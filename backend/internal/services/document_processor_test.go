@@ -5,14 +5,26 @@ import (
 	"fmt"
 	"mime/multipart"
 	"net/textproto"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+
+	"rag-backend/pkg/types"
 )
 
 func buildTestPDF(contentStream string) []byte {
+	if contentStream == "" {
+		return buildTestPDFPages("")
+	}
+	return buildTestPDFPages("", contentStream)
+}
+
+// buildTestPDFPages builds a PDF with one page per content stream. info, if
+// set, is the body of its document information dictionary.
+func buildTestPDFPages(info string, contentStreams ...string) []byte {
 	var buf bytes.Buffer
 	var offsets []int
 
@@ -25,13 +37,23 @@ func buildTestPDF(contentStream string) []byte {
 
 	writeObj(1, "<< /Type /Catalog /Pages 2 0 R >>")
 
-	if contentStream == "" {
-		writeObj(2, "<< /Type /Pages /Kids [] /Count 0 >>")
-	} else {
-		writeObj(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
-		writeObj(3, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << >> >>")
+	var kids []string
+	for i := range contentStreams {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 3+2*i))
+	}
+	writeObj(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(contentStreams)))
+	for i, contentStream := range contentStreams {
+		pageObj := 3 + 2*i
+		writeObj(pageObj, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << >> >>", pageObj+1))
 		streamContent := contentStream + "\n"
-		writeObj(4, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(streamContent), streamContent))
+		writeObj(pageObj+1, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(streamContent), streamContent))
+	}
+
+	infoRef := ""
+	if info != "" {
+		infoObj := len(offsets) + 1
+		writeObj(infoObj, "<< "+info+" >>")
+		infoRef = fmt.Sprintf(" /Info %d 0 R", infoObj)
 	}
 
 	xrefOffset := buf.Len()
@@ -41,7 +63,7 @@ func buildTestPDF(contentStream string) []byte {
 	for _, off := range offsets {
 		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
 	}
-	fmt.Fprintf(&buf, "trailer << /Size %d /Root 1 0 R >>\n", numObjs+1)
+	fmt.Fprintf(&buf, "trailer << /Size %d /Root 1 0 R%s >>\n", numObjs+1, infoRef)
 	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
 
 	return buf.Bytes()
@@ -89,9 +111,11 @@ func TestNewDocumentProcessor(t *testing.T) {
 
 func TestProcessFile(t *testing.T) {
 	type expected struct {
-		result   string
-		nonEmpty bool
-		err      string
+		result      string
+		contentType string
+		nonEmpty    bool
+		err         error
+		errContains string
 	}
 
 	tests := []struct {
@@ -106,42 +130,119 @@ func TestProcessFile(t *testing.T) {
 			filename:    "hello.txt",
 			contentType: "text/plain",
 			content:     []byte("hello world"),
-			expected:    expected{result: "hello world"},
+			expected:    expected{result: "hello world", contentType: "text/plain"},
 		},
 		{
 			name:        "preserves unicode content in text/plain",
 			filename:    "unicode.txt",
 			contentType: "text/plain",
 			content:     []byte("日本語テスト"),
-			expected:    expected{result: "日本語テスト"},
+			expected:    expected{result: "日本語テスト", contentType: "text/plain"},
+		},
+		{
+			name:        "accepts text sent as octet-stream",
+			filename:    "notes.txt",
+			contentType: "application/octet-stream",
+			content:     []byte("plain notes"),
+			expected:    expected{result: "plain notes", contentType: "text/plain"},
+		},
+		{
+			name:        "detects a PDF whatever the client claims",
+			filename:    "scan",
+			contentType: "application/octet-stream",
+			content:     minimalPDFWithText,
+			expected:    expected{nonEmpty: true, contentType: "application/pdf"},
+		},
+		{
+			name:        "sniffs HTML without an extension",
+			filename:    "page",
+			contentType: "",
+			content:     []byte("<!DOCTYPE html><html><body><p>Hi</p></body></html>"),
+			expected:    expected{result: "Hi", contentType: "text/html"},
+		},
+		{
+			name:        "rejects binary labelled as text",
+			filename:    "hello.txt",
+			contentType: "text/plain",
+			content:     []byte{0x00, 0x01, 0xff, 0xfe, 0x10},
+			expected:    expected{err: ErrContentTypeMismatch, errContains: "not valid UTF-8 text"},
+		},
+		{
+			name:        "rejects text that is not UTF-8",
+			filename:    "latin1.txt",
+			contentType: "text/plain",
+			content:     []byte("caf\xe9"),
+			expected:    expected{err: ErrContentTypeMismatch, errContains: "not valid UTF-8 text"},
+		},
+		{
+			name:        "rejects content contradicting its extension",
+			filename:    "report.pdf",
+			contentType: "application/octet-stream",
+			content:     []byte("just text"),
+			expected:    expected{err: ErrContentTypeMismatch, errContains: "extension .pdf says application/pdf but the content is text/plain"},
+		},
+		{
+			name:        "rejects a PDF labelled as Word",
+			filename:    "report",
+			contentType: docxContentType,
+			content:     minimalPDFWithText,
+			expected:    expected{err: ErrContentTypeMismatch, errContains: "but the content is application/pdf"},
+		},
+		{
+			name:        "falls back to the extension for generic content types",
+			filename:    "README.md",
+			contentType: "application/octet-stream",
+			content:     []byte("# Title\n\nSee [docs](https://example.com)."),
+			expected:    expected{result: "# Title\n\nSee docs.", contentType: "text/markdown"},
+		},
+		{
+			name:        "renders CSV rows with their headers",
+			filename:    "people.csv",
+			contentType: "text/csv",
+			content:     []byte("name,born\nAda,1815\n"),
+			expected:    expected{result: "name: Ada; born: 1815", contentType: "text/csv"},
+		},
+		{
+			name:        "strips HTML markup",
+			filename:    "page.html",
+			contentType: "text/html; charset=utf-8",
+			content:     []byte("<html><body><script>x()</script><p>Hello <b>world</b></p></body></html>"),
+			expected:    expected{result: "Hello world", contentType: "text/html"},
 		},
 		{
 			name:        "returns error for unsupported content type",
 			filename:    "image.png",
 			contentType: "image/png",
-			content:     []byte{0x89, 0x50, 0x4e, 0x47},
-			expected:    expected{err: "unsupported file type: image/png"},
+			content:     []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			expected:    expected{err: ErrUnsupportedFileType, errContains: "unsupported file type: image/png"},
 		},
 		{
-			name:        "returns error when PDF bytes are invalid",
+			name:        "rejects text labelled as PDF",
 			filename:    "bad.pdf",
 			contentType: "application/pdf",
 			content:     []byte("not a pdf"),
-			expected:    expected{err: "failed to create PDF reader"},
+			expected:    expected{err: ErrContentTypeMismatch, errContains: "declared type application/pdf says application/pdf but the content is text/plain"},
+		},
+		{
+			name:        "returns error when PDF bytes are invalid",
+			filename:    "bad.pdf",
+			contentType: "application/pdf",
+			content:     []byte("%PDF-1.4 truncated"),
+			expected:    expected{errContains: "failed to create PDF reader"},
 		},
 		{
 			name:        "extracts text from valid PDF",
 			filename:    "text.pdf",
 			contentType: "application/pdf",
 			content:     minimalPDFWithText,
-			expected:    expected{nonEmpty: true},
+			expected:    expected{nonEmpty: true, contentType: "application/pdf"},
 		},
 		{
 			name:        "returns error when PDF has no extractable text",
 			filename:    "empty.pdf",
 			contentType: "application/pdf",
 			content:     minimalPDFNoText,
-			expected:    expected{err: "no text could be extracted from PDF"},
+			expected:    expected{errContains: "no text could be extracted from PDF"},
 		},
 	}
 
@@ -152,16 +253,21 @@ func TestProcessFile(t *testing.T) {
 
 			result, err := dp.ProcessFile(fh)
 
-			if tt.expected.err != "" {
+			if tt.expected.err != nil || tt.expected.errContains != "" {
 				assert.Error(t, err)
-				assert.Contains(t, err.Error(), tt.expected.err)
+				if tt.expected.err != nil {
+					assert.ErrorIs(t, err, tt.expected.err)
+				}
+				assert.Contains(t, err.Error(), tt.expected.errContains)
 				assert.Empty(t, result)
-			} else if tt.expected.nonEmpty {
-				assert.NoError(t, err)
-				assert.NotEmpty(t, result)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.contentType, result.ContentType)
+			if tt.expected.nonEmpty {
+				assert.NotEmpty(t, result.Content)
 			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.expected.result, result)
+				assert.Equal(t, tt.expected.result, result.Content)
 			}
 		})
 	}
@@ -218,6 +324,83 @@ func TestProcessPDF(t *testing.T) {
 	}
 }
 
+func TestProcessPDF_PagesAndInfo(t *testing.T) {
+	content := buildTestPDFPages(
+		"/Title (Annual Report) /Author (Jane Doe) /CreationDate (D:20240315093000+01'00')",
+		"BT /F1 12 Tf 72 720 Td (First page) Tj ET",
+		"",
+		"BT /F1 12 Tf 72 720 Td (Third page) Tj ET",
+	)
+
+	file, err := NewDocumentProcessor().processPDF(content)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "First page\n\nThird page", file.Content)
+	assert.Equal(t, []types.PageOffset{{Page: 1, Offset: 0}, {Page: 3, Offset: 12}}, file.Pages)
+	assert.Equal(t, []types.SkippedPage{{Page: 2, Reason: "page has no text, it may be a scanned image"}}, file.SkippedPages)
+	if assert.NotNil(t, file.Info) {
+		assert.Equal(t, "Annual Report", file.Info.Title)
+		assert.Equal(t, "Jane Doe", file.Info.Author)
+		if assert.NotNil(t, file.Info.CreatedAt) {
+			assert.True(t, time.Date(2024, 3, 15, 8, 30, 0, 0, time.UTC).Equal(*file.Info.CreatedAt))
+		}
+	}
+}
+
+func TestProcessPDF_NoInfo(t *testing.T) {
+	file, err := NewDocumentProcessor().processPDF(minimalPDFWithText)
+
+	assert.NoError(t, err)
+	assert.Nil(t, file.Info)
+	assert.Empty(t, file.SkippedPages)
+	assert.Equal(t, []types.PageOffset{{Page: 1, Offset: 0}}, file.Pages)
+}
+
+func TestProcessPDF_MalformedInfo(t *testing.T) {
+	// The PDF library panics reading the invalid hex string
+	content := buildTestPDFPages("/Title <zz>", "BT /F1 12 Tf 72 720 Td (First page) Tj ET")
+
+	file, err := NewDocumentProcessor().processPDF(content)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "First page", file.Content)
+	assert.Nil(t, file.Info)
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{name: "full date with offset", value: "D:20240315093000+01'00'", want: time.Date(2024, 3, 15, 8, 30, 0, 0, time.UTC), ok: true},
+		{name: "negative offset without quotes", value: "D:20240315093000-0530", want: time.Date(2024, 3, 15, 15, 0, 0, 0, time.UTC), ok: true},
+		{name: "Z means UTC", value: "D:20240315093000Z", want: time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC), ok: true},
+		{name: "no time zone is UTC", value: "D:20240315093000", want: time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC), ok: true},
+		{name: "year only", value: "D:2024", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{name: "without the D: prefix", value: "20240315", want: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), ok: true},
+		{name: "empty", value: "", ok: false},
+		{name: "not a date", value: "March 2024", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePDFDate(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.True(t, tt.want.Equal(got), "got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", ContentHash(""))
+	assert.Equal(t, ContentHash("same text"), ContentHash("same text"))
+	assert.NotEqual(t, ContentHash("same text"), ContentHash("same text."))
+}
+
 func TestCreateDocument(t *testing.T) {
 	type expected struct {
 		name    string
@@ -259,6 +442,7 @@ func TestCreateDocument(t *testing.T) {
 
 			assert.Equal(t, tt.expected.name, doc.Name)
 			assert.Equal(t, tt.expected.content, doc.Content)
+			assert.Equal(t, ContentHash(tt.content), doc.ContentHash)
 			assert.NotEmpty(t, doc.ID)
 			_, parseErr := uuid.Parse(doc.ID)
 			assert.NoError(t, parseErr, "ID should be a valid UUID")
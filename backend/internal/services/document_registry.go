@@ -0,0 +1,262 @@
+package services
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"rag-backend/internal/repositories/documentstore"
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/types"
+)
+
+// ErrDocumentNotFound is returned when a document ID is not registered.
+var ErrDocumentNotFound = documentstore.ErrDocumentNotFound
+
+// pipelineMetadataKeys are the chunk metadata the pipeline sets itself, as
+// opposed to the user metadata a document was uploaded with
+var pipelineMetadataKeys = []string{"source", "section", "page_start", "page_end"}
+
+// DocumentRegistry keeps track of uploaded documents and removes their chunks
+// from the vector store when a document is deleted.
+type DocumentRegistry struct {
+	documentStore documentstore.DocumentStore
+	vectorStore   vectorstore.VectorStore
+	uploads       uploadLocks
+}
+
+func NewDocumentRegistry(documentStore documentstore.DocumentStore, vectorStore vectorstore.VectorStore) *DocumentRegistry {
+	return &DocumentRegistry{
+		documentStore: documentStore,
+		vectorStore:   vectorStore,
+		uploads:       uploadLocks{locks: make(map[string]*uploadLock)},
+	}
+}
+
+func (dr *DocumentRegistry) RegisterDocument(document types.Document) error {
+	// Embeddings already live in the vector store; keeping a second copy here
+	// would only double the memory footprint.
+	chunks := make([]types.DocumentChunk, len(document.Chunks))
+	for i, chunk := range document.Chunks {
+		chunk.Embedding = nil
+		chunks[i] = chunk
+	}
+	document.Chunks = chunks
+
+	if err := dr.documentStore.Save(document); err != nil {
+		return fmt.Errorf("failed to register document: %w", err)
+	}
+	return nil
+}
+
+// RestoreDocuments registers the documents of chunks that are not registered
+// yet, such as those a persistent vector store reloads at startup. A document
+// is rebuilt from what its chunks record: its name, collection and upload
+// metadata, and its text joined back from the chunks. Its content hash is
+// unknown, so the next upload of the same file replaces it. It returns how
+// many documents were restored.
+func (dr *DocumentRegistry) RestoreDocuments(chunks []types.DocumentChunk) (int, error) {
+	byDocument := make(map[string][]types.DocumentChunk)
+	var order []string
+	for _, chunk := range chunks {
+		if chunk.DocumentID == "" {
+			continue
+		}
+		if _, ok := byDocument[chunk.DocumentID]; !ok {
+			order = append(order, chunk.DocumentID)
+		}
+		byDocument[chunk.DocumentID] = append(byDocument[chunk.DocumentID], chunk)
+	}
+
+	restored := 0
+	now := time.Now()
+	for _, id := range order {
+		if _, err := dr.documentStore.Get(id); err == nil {
+			continue
+		}
+		if err := dr.RegisterDocument(restoreDocument(id, byDocument[id], now)); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// restoreDocument rebuilds a document from its chunks
+func restoreDocument(id string, chunks []types.DocumentChunk, uploadedAt time.Time) types.Document {
+	slices.SortStableFunc(chunks, func(a, b types.DocumentChunk) int {
+		_, i := chunkPosition(a)
+		_, j := chunkPosition(b)
+		return cmp.Compare(i, j)
+	})
+
+	content := chunks[0].Content
+	for _, chunk := range chunks[1:] {
+		content = joinOverlapping(content, chunk.Content)
+	}
+
+	metadata := maps.Clone(chunks[0].Metadata)
+	for _, key := range pipelineMetadataKeys {
+		delete(metadata, key)
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	return types.Document{
+		ID:         id,
+		Name:       chunks[0].Metadata["source"],
+		Collection: chunks[0].Collection,
+		Content:    content,
+		Chunks:     chunks,
+		Metadata:   metadata,
+		UploadedAt: uploadedAt,
+	}
+}
+
+// FindDocument returns the document uploaded to the collection under the
+// given file name. If several match, which only happens for uploads made
+// before re-uploads replaced earlier versions, the latest one wins.
+func (dr *DocumentRegistry) FindDocument(collection, name string) (*types.Document, error) {
+	document, err := dr.documentStore.FindByName(collection, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find document %q: %w", name, err)
+	}
+	return &document, nil
+}
+
+// ClaimUpload holds the file name and content of an upload to a collection
+// until release is called, so concurrent uploads of the same file run one
+// after the other instead of both registering it. It returns the document
+// the upload is a re-upload of: the one with the same name or, failing that,
+// the latest with the same content. It is nil if there is none.
+func (dr *DocumentRegistry) ClaimUpload(collection, name, contentHash string) (previous *types.Document, release func(), err error) {
+	release = dr.uploads.lock(uploadKeys(collection, name, contentHash)...)
+
+	document, err := dr.documentStore.FindByName(collection, name)
+	if errors.Is(err, ErrDocumentNotFound) {
+		document, err = dr.documentStore.FindByContentHash(collection, contentHash)
+	}
+	switch {
+	case errors.Is(err, ErrDocumentNotFound):
+		return nil, release, nil
+	case err != nil:
+		release()
+		return nil, nil, fmt.Errorf("failed to find document %q: %w", name, err)
+	}
+	return &document, release, nil
+}
+
+// ReplaceDocument swaps the chunks of the registered document with the same
+// ID for the new version's in a single vector store write, so searches never
+// see both versions or neither, then registers the new version.
+func (dr *DocumentRegistry) ReplaceDocument(document types.Document) error {
+	if _, err := dr.vectorStore.ReplaceDocument(document.ID, document.Chunks); err != nil {
+		return fmt.Errorf("failed to replace document chunks: %w", err)
+	}
+	return dr.RegisterDocument(document)
+}
+
+func (dr *DocumentRegistry) ListDocuments() ([]types.Document, error) {
+	documents, err := dr.documentStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	return documents, nil
+}
+
+func (dr *DocumentRegistry) GetDocument(id string) (*types.Document, error) {
+	document, err := dr.documentStore.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	return &document, nil
+}
+
+// DeleteDocument removes the document's chunks from the vector store and then
+// drops it from the registry. Chunks go first so a failed removal leaves the
+// document listed and the delete can be retried. It waits for an upload that
+// has claimed the document, which would otherwise store it again afterwards.
+func (dr *DocumentRegistry) DeleteDocument(id string) (int, error) {
+	document, err := dr.documentStore.Get(id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	release := dr.uploads.lock(uploadKeys(documentCollection(document), document.Name, document.ContentHash)...)
+	defer release()
+	return dr.deleteDocument(id)
+}
+
+// deleteDocument is DeleteDocument for callers that already keep uploads
+// from storing the document, such as DeleteCollection
+func (dr *DocumentRegistry) deleteDocument(id string) (int, error) {
+	if _, err := dr.documentStore.Get(id); err != nil {
+		return 0, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	removed, err := dr.vectorStore.DeleteByDocumentID(id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete document chunks: %w", err)
+	}
+
+	if err := dr.documentStore.Delete(id); err != nil {
+		return removed, fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	return removed, nil
+}
+
+// uploadKeys are the upload locks for a file name and content in a collection
+func uploadKeys(collection, name, contentHash string) []string {
+	return []string{"name\x00" + collection + "\x00" + name, "hash\x00" + collection + "\x00" + contentHash}
+}
+
+// uploadLocks hands out a mutex per key, kept only while an upload holds or
+// waits for it
+type uploadLocks struct {
+	mutex sync.Mutex
+	locks map[string]*uploadLock
+}
+
+type uploadLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock locks every key, in sorted order so two uploads sharing keys can't
+// deadlock, and returns the func that unlocks them.
+func (ul *uploadLocks) lock(keys ...string) func() {
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	held := make([]*uploadLock, len(keys))
+	for i, key := range keys {
+		ul.mutex.Lock()
+		lock, ok := ul.locks[key]
+		if !ok {
+			lock = &uploadLock{}
+			ul.locks[key] = lock
+		}
+		lock.users++
+		ul.mutex.Unlock()
+
+		lock.Lock()
+		held[i] = lock
+	}
+
+	return sync.OnceFunc(func() {
+		ul.mutex.Lock()
+		defer ul.mutex.Unlock()
+		for i, key := range keys {
+			held[i].Unlock()
+			if held[i].users--; held[i].users == 0 {
+				delete(ul.locks, key)
+			}
+		}
+	})
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/documentstore"
+	documentmemory "rag-backend/internal/repositories/documentstore/memory"
+	"rag-backend/internal/repositories/vectorstore"
+	vectormemory "rag-backend/internal/repositories/vectorstore/memory"
+	"rag-backend/pkg/types"
+)
+
+func TestRegisterDocument(t *testing.T) {
+	type expected struct {
+		err string
+	}
+
+	tests := []struct {
+		name     string
+		saveErr  error
+		expected expected
+	}{
+		{
+			name: "stores document without chunk embeddings",
+		},
+		{
+			name:     "wraps store error",
+			saveErr:  errors.New("disk full"),
+			expected: expected{err: "failed to register document"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var saved types.Document
+			ds := &documentstore.MockDocumentStore{
+				SaveFunc: func(document types.Document) error {
+					saved = document
+					return tt.saveErr
+				},
+			}
+			registry := NewDocumentRegistry(ds, &vectorstore.MockVectorStore{})
+
+			original := types.Document{
+				ID: "d1",
+				Chunks: []types.DocumentChunk{
+					{ID: "c1", Content: "hello", Embedding: []float64{0.1, 0.2}},
+				},
+			}
+			err := registry.RegisterDocument(original)
+
+			if tt.expected.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expected.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "d1", saved.ID)
+			assert.Len(t, saved.Chunks, 1)
+			assert.Nil(t, saved.Chunks[0].Embedding)
+			assert.Equal(t, []float64{0.1, 0.2}, original.Chunks[0].Embedding, "caller's chunks must not be mutated")
+		})
+	}
+}
+
+func TestFindDocument(t *testing.T) {
+	earlier := time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC)
+	documents := documentmemory.NewMemoryDocumentStore()
+	require.NoError(t, documents.Save(types.Document{ID: "d1", Name: "guide.md", Collection: "default", UploadedAt: earlier}))
+	require.NoError(t, documents.Save(types.Document{ID: "d2", Name: "guide.md", Collection: "manuals", UploadedAt: earlier}))
+	require.NoError(t, documents.Save(types.Document{ID: "d3", Name: "guide.md", Collection: "default", UploadedAt: earlier.Add(time.Hour)}))
+
+	tests := []struct {
+		name       string
+		collection string
+		fileName   string
+		expectedID string
+		err        error
+	}{
+		{name: "matches name within the collection", collection: "manuals", fileName: "guide.md", expectedID: "d2"},
+		{name: "prefers the latest of several matches", collection: "default", fileName: "guide.md", expectedID: "d3"},
+		{name: "returns not found for an unknown name", collection: "default", fileName: "other.md", err: ErrDocumentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewDocumentRegistry(documents, &vectorstore.MockVectorStore{})
+
+			document, err := registry.FindDocument(tt.collection, tt.fileName)
+
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedID, document.ID)
+		})
+	}
+}
+
+func TestClaimUpload(t *testing.T) {
+	documents := documentmemory.NewMemoryDocumentStore()
+	require.NoError(t, documents.Save(types.Document{ID: "d1", Name: "guide.md", Collection: "default", ContentHash: "h1"}))
+	require.NoError(t, documents.Save(types.Document{ID: "d2", Name: "notes.md", Collection: "default", ContentHash: "h2"}))
+
+	tests := []struct {
+		name        string
+		fileName    string
+		contentHash string
+		expectedID  string
+	}{
+		{name: "finds the document with the same name", fileName: "guide.md", contentHash: "h2", expectedID: "d1"},
+		{name: "falls back to the document with the same content", fileName: "copy.md", contentHash: "h2", expectedID: "d2"},
+		{name: "returns nil for a new file", fileName: "new.md", contentHash: "h3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewDocumentRegistry(documents, &vectorstore.MockVectorStore{})
+
+			previous, release, err := registry.ClaimUpload("default", tt.fileName, tt.contentHash)
+
+			require.NoError(t, err)
+			defer release()
+			if tt.expectedID == "" {
+				assert.Nil(t, previous)
+				return
+			}
+			require.NotNil(t, previous)
+			assert.Equal(t, tt.expectedID, previous.ID)
+		})
+	}
+
+	t.Run("wraps store error", func(t *testing.T) {
+		ds := &documentstore.MockDocumentStore{
+			FindByNameFunc: func(string, string) (types.Document, error) {
+				return types.Document{}, errors.New("store down")
+			},
+		}
+
+		_, _, err := NewDocumentRegistry(ds, &vectorstore.MockVectorStore{}).ClaimUpload("default", "guide.md", "h1")
+
+		assert.ErrorContains(t, err, `failed to find document "guide.md": store down`)
+	})
+
+	t.Run("uploads of the same file wait for the claim", func(t *testing.T) {
+		registry := NewDocumentRegistry(documentmemory.NewMemoryDocumentStore(), &vectorstore.MockVectorStore{})
+		_, release, err := registry.ClaimUpload("default", "first.md", "same")
+		require.NoError(t, err)
+
+		claimed := make(chan *types.Document)
+		go func() {
+			previous, release, err := registry.ClaimUpload("default", "second.md", "same")
+			assert.NoError(t, err)
+			release()
+			claimed <- previous
+		}()
+
+		select {
+		case <-claimed:
+			t.Fatal("second upload claimed the content while the first held it")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		require.NoError(t, registry.RegisterDocument(types.Document{ID: "d1", Name: "first.md", Collection: "default", ContentHash: "same"}))
+		release()
+
+		previous := <-claimed
+		require.NotNil(t, previous)
+		assert.Equal(t, "d1", previous.ID)
+		assert.Empty(t, registry.uploads.locks, "locks are dropped once released")
+	})
+}
+
+func TestReplaceDocument(t *testing.T) {
+	document := types.Document{
+		ID:     "d1",
+		Chunks: []types.DocumentChunk{{ID: "c1", DocumentID: "d1", Embedding: []float64{0.1}}},
+	}
+
+	t.Run("swaps chunks then saves the new version", func(t *testing.T) {
+		var replacedID string
+		var saved types.Document
+		vs := &vectorstore.MockVectorStore{
+			ReplaceDocumentFunc: func(documentID string, chunks []types.DocumentChunk) (int, error) {
+				replacedID = documentID
+				assert.Equal(t, document.Chunks, chunks, "vector store needs the embeddings")
+				return 3, nil
+			},
+		}
+		ds := &documentstore.MockDocumentStore{
+			SaveFunc: func(document types.Document) error {
+				saved = document
+				return nil
+			},
+		}
+
+		err := NewDocumentRegistry(ds, vs).ReplaceDocument(document)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "d1", replacedID)
+		assert.Equal(t, "d1", saved.ID)
+		assert.Nil(t, saved.Chunks[0].Embedding)
+	})
+
+	t.Run("keeps the registry untouched when the chunks can't be replaced", func(t *testing.T) {
+		vs := &vectorstore.MockVectorStore{
+			ReplaceDocumentFunc: func(string, []types.DocumentChunk) (int, error) {
+				return 0, errors.New("disk full")
+			},
+		}
+		ds := &documentstore.MockDocumentStore{
+			SaveFunc: func(types.Document) error {
+				t.Fatal("document must not be saved")
+				return nil
+			},
+		}
+
+		err := NewDocumentRegistry(ds, vs).ReplaceDocument(document)
+
+		assert.ErrorContains(t, err, "failed to replace document chunks: disk full")
+	})
+}
+
+func TestListDocuments(t *testing.T) {
+	t.Run("returns documents from store", func(t *testing.T) {
+		ds := &documentstore.MockDocumentStore{
+			ListFunc: func() ([]types.Document, error) {
+				return []types.Document{{ID: "d1"}, {ID: "d2"}}, nil
+			},
+		}
+		registry := NewDocumentRegistry(ds, &vectorstore.MockVectorStore{})
+
+		documents, err := registry.ListDocuments()
+
+		assert.NoError(t, err)
+		assert.Len(t, documents, 2)
+	})
+
+	t.Run("wraps store error", func(t *testing.T) {
+		ds := &documentstore.MockDocumentStore{
+			ListFunc: func() ([]types.Document, error) {
+				return nil, errors.New("boom")
+			},
+		}
+		registry := NewDocumentRegistry(ds, &vectorstore.MockVectorStore{})
+
+		documents, err := registry.ListDocuments()
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list documents")
+		assert.Nil(t, documents)
+	})
+}
+
+func TestGetDocument(t *testing.T) {
+	t.Run("returns stored document", func(t *testing.T) {
+		ds := &documentstore.MockDocumentStore{
+			GetFunc: func(id string) (types.Document, error) {
+				return types.Document{ID: id, Name: "a.txt"}, nil
+			},
+		}
+		registry := NewDocumentRegistry(ds, &vectorstore.MockVectorStore{})
+
+		document, err := registry.GetDocument("d1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "a.txt", document.Name)
+	})
+
+	t.Run("preserves not found sentinel", func(t *testing.T) {
+		ds := &documentstore.MockDocumentStore{
+			GetFunc: func(string) (types.Document, error) {
+				return types.Document{}, documentstore.ErrDocumentNotFound
+			},
+		}
+		registry := NewDocumentRegistry(ds, &vectorstore.MockVectorStore{})
+
+		document, err := registry.GetDocument("missing")
+
+		assert.ErrorIs(t, err, ErrDocumentNotFound)
+		assert.Nil(t, document)
+	})
+}
+
+func TestDeleteDocument(t *testing.T) {
+	type mock struct {
+		getErr          error
+		deleteChunksErr error
+		deleteDocErr    error
+		removed         int
+	}
+	type calls struct {
+		deleteChunks int
+		deleteDoc    int
+	}
+	type expected struct {
+		removed  int
+		err      string
+		notFound bool
+		calls    calls
+	}
+
+	tests := []struct {
+		name     string
+		mock     mock
+		expected expected
+	}{
+		{
+			name:     "removes chunks then document",
+			mock:     mock{removed: 4},
+			expected: expected{removed: 4, calls: calls{deleteChunks: 1, deleteDoc: 1}},
+		},
+		{
+			name:     "returns not found without touching the vector store",
+			mock:     mock{getErr: documentstore.ErrDocumentNotFound},
+			expected: expected{err: "failed to get document", notFound: true},
+		},
+		{
+			name:     "keeps document registered when chunk removal fails",
+			mock:     mock{deleteChunksErr: errors.New("vector store down")},
+			expected: expected{err: "failed to delete document chunks", calls: calls{deleteChunks: 1}},
+		},
+		{
+			name:     "wraps registry delete error",
+			mock:     mock{removed: 2, deleteDocErr: errors.New("boom")},
+			expected: expected{removed: 2, err: "failed to delete document", calls: calls{deleteChunks: 1, deleteDoc: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got calls
+			ds := &documentstore.MockDocumentStore{
+				GetFunc: func(id string) (types.Document, error) {
+					return types.Document{ID: id}, tt.mock.getErr
+				},
+				DeleteFunc: func(string) error {
+					got.deleteDoc++
+					return tt.mock.deleteDocErr
+				},
+			}
+			vs := &vectorstore.MockVectorStore{
+				DeleteByDocumentIDFunc: func(documentID string) (int, error) {
+					got.deleteChunks++
+					assert.Equal(t, "d1", documentID)
+					return tt.mock.removed, tt.mock.deleteChunksErr
+				},
+			}
+			registry := NewDocumentRegistry(ds, vs)
+
+			removed, err := registry.DeleteDocument("d1")
+
+			assert.Equal(t, tt.expected.calls, got)
+			assert.Equal(t, tt.expected.removed, removed)
+			if tt.expected.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expected.err)
+				assert.Equal(t, tt.expected.notFound, errors.Is(err, ErrDocumentNotFound))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDeleteDocument_WaitsForReplace(t *testing.T) {
+	vectorStore := vectormemory.NewMemoryVectorStore()
+	registry := NewDocumentRegistry(documentmemory.NewMemoryDocumentStore(), vectorStore)
+	original := types.Document{
+		ID: "d1", Name: "guide.md", Collection: "default", ContentHash: "v1",
+		Chunks: []types.DocumentChunk{{ID: "c1", DocumentID: "d1", Collection: "default", Embedding: []float64{1, 0}}},
+	}
+	require.NoError(t, vectorStore.Store(original.Chunks))
+	require.NoError(t, registry.RegisterDocument(original))
+
+	previous, release, err := registry.ClaimUpload("default", "guide.md", "v2")
+	require.NoError(t, err)
+	require.NotNil(t, previous)
+
+	deleted := make(chan error)
+	go func() {
+		_, err := registry.DeleteDocument("d1")
+		deleted <- err
+	}()
+
+	select {
+	case <-deleted:
+		t.Fatal("document was deleted while an upload replacing it held its claim")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	replacement := original
+	replacement.ContentHash = "v2"
+	replacement.Chunks = []types.DocumentChunk{{ID: "c2", DocumentID: "d1", Collection: "default", Embedding: []float64{0, 1}}}
+	require.NoError(t, registry.ReplaceDocument(replacement))
+	release()
+
+	require.NoError(t, <-deleted)
+	_, err = registry.GetDocument("d1")
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+	results, err := vectorStore.Search([]float64{1, 1}, 10, types.SearchOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, results, "the replaced version stays deleted")
+}
+
+func TestRestoreDocuments(t *testing.T) {
+	documents := documentmemory.NewMemoryDocumentStore()
+	require.NoError(t, documents.Save(types.Document{ID: "known", Name: "kept.txt", ContentHash: "abc"}))
+	registry := NewDocumentRegistry(documents, &vectorstore.MockVectorStore{})
+
+	chunks := []types.DocumentChunk{
+		{ID: "manuals/guide.md-chunk-1", DocumentID: "d1", Collection: "manuals", Content: "The second part. The third part.", Embedding: []float64{0.1},
+			Metadata: map[string]string{"source": "guide.md", "section": "Usage", "team": "docs"}},
+		{ID: "default/kept.txt-chunk-0", DocumentID: "known", Content: "kept"},
+		{ID: "manuals/guide.md-chunk-0", DocumentID: "d1", Collection: "manuals", Content: "The first part. The second part.", Embedding: []float64{0.2},
+			Metadata: map[string]string{"source": "guide.md", "section": "Install", "team": "docs"}},
+		{ID: "orphan", Content: "no document"},
+	}
+
+	restored, err := registry.RestoreDocuments(chunks)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	document, err := registry.GetDocument("d1")
+	require.NoError(t, err)
+	assert.Equal(t, "guide.md", document.Name)
+	assert.Equal(t, "manuals", document.Collection)
+	assert.Equal(t, "The first part. The second part. The third part.", document.Content)
+	assert.Equal(t, map[string]string{"team": "docs"}, document.Metadata)
+	require.Len(t, document.Chunks, 2)
+	assert.Equal(t, "manuals/guide.md-chunk-0", document.Chunks[0].ID)
+	assert.Nil(t, document.Chunks[0].Embedding)
+
+	known, err := registry.GetDocument("known")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", known.ContentHash, "registered documents are left alone")
+
+	found, err := registry.FindDocument("manuals", "guide.md")
+	require.NoError(t, err)
+	assert.Equal(t, "d1", found.ID, "a re-upload finds the restored document")
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+
+	"rag-backend/internal/repositories/embeddingcache"
+	"rag-backend/pkg/types"
+)
+
+// CachingEmbeddingCreator is an EmbeddingCreator that remembers the vector of
+// every text it has embedded. Only texts missing from every cache tier are
+// sent upstream, in a single request, and the response lists embeddings in
+// the order of the input texts exactly as the API does.
+type CachingEmbeddingCreator struct {
+	next EmbeddingCreator
+	// baseURL is the embeddings API the vectors come from. Two providers can
+	// serve models of the same name that embed differently.
+	baseURL string
+	// tiers are checked in order, so the fastest comes first. A hit in a
+	// slower tier is copied into the faster ones.
+	tiers  []embeddingcache.EmbeddingCache
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewCachingEmbeddingCreator(next EmbeddingCreator, baseURL string, tiers ...embeddingcache.EmbeddingCache) *CachingEmbeddingCreator {
+	return &CachingEmbeddingCreator{
+		next:    next,
+		baseURL: baseURL,
+		tiers:   tiers,
+	}
+}
+
+func (c *CachingEmbeddingCreator) New(ctx context.Context, body openai.EmbeddingNewParams, opts ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+	texts, ok := embeddingTexts(body.Input)
+	// Token inputs and base64 responses are rare enough not to be worth caching
+	if !ok || body.EncodingFormat == openai.EmbeddingNewParamsEncodingFormatBase64 {
+		return c.next.New(ctx, body, opts...)
+	}
+
+	embeddings := make([][]float64, len(texts))
+	keys := make([]string, len(texts))
+	// Each missing text is sent once, however often it repeats in the input
+	var missing []string
+	missingByKey := make(map[string]int)
+	for i, text := range texts {
+		keys[i] = embeddingCacheKey(c.baseURL, body, text)
+		if embedding, ok := c.lookup(keys[i]); ok {
+			embeddings[i] = embedding
+			continue
+		}
+		if _, ok := missingByKey[keys[i]]; !ok {
+			missingByKey[keys[i]] = len(missing)
+			missing = append(missing, text)
+		}
+	}
+	c.hits.Add(int64(len(texts) - len(missing)))
+	c.misses.Add(int64(len(missing)))
+
+	response := &openai.CreateEmbeddingResponse{Model: string(body.Model)}
+	if len(missing) > 0 {
+		upstream := body
+		upstream.Input = openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: missing}
+		fetched, err := c.next.New(ctx, upstream, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if len(fetched.Data) != len(missing) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(missing), len(fetched.Data))
+		}
+
+		for key, j := range missingByKey {
+			c.store(key, fetched.Data[j].Embedding)
+		}
+		for i, key := range keys {
+			if embeddings[i] == nil {
+				embeddings[i] = fetched.Data[missingByKey[key]].Embedding
+			}
+		}
+		response.Model = fetched.Model
+		response.Usage = fetched.Usage
+	}
+
+	response.Data = make([]openai.Embedding, len(embeddings))
+	for i, embedding := range embeddings {
+		// Callers own the returned vectors; the cached copies must not change
+		response.Data[i] = openai.Embedding{Embedding: slices.Clone(embedding), Index: int64(i)}
+	}
+	return response, nil
+}
+
+// Stats reports how many texts were served from the cache and how many were
+// sent to the embeddings API.
+func (c *CachingEmbeddingCreator) Stats() types.EmbeddingCacheStats {
+	return types.EmbeddingCacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+func (c *CachingEmbeddingCreator) lookup(key string) ([]float64, bool) {
+	for i, tier := range c.tiers {
+		embedding, ok := tier.Get(key)
+		if !ok {
+			continue
+		}
+		for _, faster := range c.tiers[:i] {
+			_ = faster.Put(key, embedding)
+		}
+		return embedding, true
+	}
+	return nil, false
+}
+
+// store saves a fetched embedding in every tier. The cache is best effort, so
+// a tier that fails to store it only costs a later miss.
+func (c *CachingEmbeddingCreator) store(key string, embedding []float64) {
+	embedding = slices.Clone(embedding)
+	for _, tier := range c.tiers {
+		_ = tier.Put(key, embedding)
+	}
+}
+
+func embeddingTexts(input openai.EmbeddingNewParamsInputUnion) ([]string, bool) {
+	switch {
+	case input.OfString.Valid():
+		return []string{input.OfString.Value}, true
+	case input.OfArrayOfStrings != nil:
+		return input.OfArrayOfStrings, true
+	default:
+		return nil, false
+	}
+}
+
+// embeddingCacheKey identifies a text's embedding. The provider, model and
+// requested dimensions are part of the key because they change the vector;
+// runs of whitespace are collapsed because they don't meaningfully change it.
+func embeddingCacheKey(baseURL string, body openai.EmbeddingNewParams, text string) string {
+	normalized := strings.Join(strings.Fields(text), " ")
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%s", baseURL, body.Model, body.Dimensions.Value, normalized)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/embeddingcache"
+	"rag-backend/internal/repositories/embeddingcache/disk"
+	"rag-backend/internal/repositories/embeddingcache/memory"
+	"rag-backend/pkg/types"
+)
+
+const testEmbeddingBaseURL = "https://embeddings.example.com/v1"
+
+// recordingEmbedder embeds each text as [len(text)] and records the texts of
+// every request it receives
+func recordingEmbedder(requests *[][]string) *mockEmbeddingCreator {
+	return &mockEmbeddingCreator{
+		newFunc: func(_ context.Context, body openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			texts, _ := embeddingTexts(body.Input)
+			*requests = append(*requests, texts)
+			embeddings := make([][]float64, len(texts))
+			for i, text := range texts {
+				embeddings[i] = []float64{float64(len(text))}
+			}
+			return makeEmbeddingResponse(embeddings), nil
+		},
+	}
+}
+
+func embedTexts(t *testing.T, creator EmbeddingCreator, model string, texts ...string) [][]float64 {
+	t.Helper()
+	response, err := creator.New(context.Background(), openai.EmbeddingNewParams{
+		Model: openai.EmbeddingModel(model),
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+	})
+	require.NoError(t, err)
+	embeddings := make([][]float64, len(response.Data))
+	for i, data := range response.Data {
+		assert.Equal(t, int64(i), data.Index)
+		embeddings[i] = data.Embedding
+	}
+	return embeddings
+}
+
+func TestCachingEmbeddingCreator_SendsOnlyMisses(t *testing.T) {
+	var requests [][]string
+	creator := NewCachingEmbeddingCreator(recordingEmbedder(&requests), testEmbeddingBaseURL, memory.NewLRUEmbeddingCache(10))
+
+	embeddings := embedTexts(t, creator, "m", "a", "bb")
+	assert.Equal(t, [][]float64{{1}, {2}}, embeddings)
+
+	// Cached texts are answered locally, in input order, and a text repeated
+	// within one request is only sent once
+	embeddings = embedTexts(t, creator, "m", "ccc", "bb", "ccc", "a")
+	assert.Equal(t, [][]float64{{3}, {2}, {3}, {1}}, embeddings)
+
+	assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, requests)
+	assert.Equal(t, types.EmbeddingCacheStats{Hits: 3, Misses: 3}, creator.Stats())
+
+	// Fully cached requests never reach the API
+	embedTexts(t, creator, "m", "a", "bb", "ccc")
+	assert.Len(t, requests, 2)
+}
+
+func TestCachingEmbeddingCreator_Keys(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		model   string
+		text    string
+		cached  bool
+	}{
+		{name: "same text", baseURL: testEmbeddingBaseURL, model: "m", text: "hello world", cached: true},
+		{name: "whitespace differences are ignored", baseURL: testEmbeddingBaseURL, model: "m", text: "  hello\n\tworld ", cached: true},
+		{name: "different text", baseURL: testEmbeddingBaseURL, model: "m", text: "hello there", cached: false},
+		{name: "different model", baseURL: testEmbeddingBaseURL, model: "other", text: "hello world", cached: false},
+		{name: "different provider", baseURL: "http://localhost:11434/v1", model: "m", text: "hello world", cached: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests [][]string
+			cache := memory.NewLRUEmbeddingCache(10)
+			embedTexts(t, NewCachingEmbeddingCreator(recordingEmbedder(&requests), testEmbeddingBaseURL, cache), "m", "hello world")
+
+			embedTexts(t, NewCachingEmbeddingCreator(recordingEmbedder(&requests), tt.baseURL, cache), tt.model, tt.text)
+
+			if tt.cached {
+				assert.Len(t, requests, 1)
+			} else {
+				assert.Len(t, requests, 2)
+			}
+		})
+	}
+}
+
+func TestCachingEmbeddingCreator_SingleStringInput(t *testing.T) {
+	var requests [][]string
+	creator := NewCachingEmbeddingCreator(recordingEmbedder(&requests), testEmbeddingBaseURL, memory.NewLRUEmbeddingCache(10))
+	params := openai.EmbeddingNewParams{
+		Model: "m",
+		Input: openai.EmbeddingNewParamsInputUnion{OfString: openai.String("query")},
+	}
+
+	for range 2 {
+		response, err := creator.New(context.Background(), params)
+		require.NoError(t, err)
+		require.Len(t, response.Data, 1)
+		assert.Equal(t, []float64{5}, response.Data[0].Embedding)
+	}
+	assert.Equal(t, [][]string{{"query"}}, requests)
+}
+
+func TestCachingEmbeddingCreator_PromotesSlowerTierHits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.bin")
+	diskCache, err := disk.NewDiskEmbeddingCache(path, 0)
+	require.NoError(t, err)
+
+	var requests [][]string
+	creator := NewCachingEmbeddingCreator(recordingEmbedder(&requests), testEmbeddingBaseURL, memory.NewLRUEmbeddingCache(10), diskCache)
+	embedTexts(t, creator, "m", "persisted")
+	require.Len(t, requests, 1)
+
+	// A fresh memory tier, as after a restart, is filled from disk
+	fastTier := memory.NewLRUEmbeddingCache(10)
+	restarted := NewCachingEmbeddingCreator(recordingEmbedder(&requests), testEmbeddingBaseURL, fastTier, diskCache)
+	assert.Equal(t, [][]float64{{9}}, embedTexts(t, restarted, "m", "persisted"))
+	assert.Len(t, requests, 1)
+
+	_, ok := fastTier.Get(embeddingCacheKey(testEmbeddingBaseURL, openai.EmbeddingNewParams{Model: "m"}, "persisted"))
+	assert.True(t, ok)
+}
+
+func TestCachingEmbeddingCreator_ReturnedVectorsAreCopies(t *testing.T) {
+	var requests [][]string
+	creator := NewCachingEmbeddingCreator(recordingEmbedder(&requests), testEmbeddingBaseURL, memory.NewLRUEmbeddingCache(10))
+
+	embeddings := embedTexts(t, creator, "m", "abc")
+	embeddings[0][0] = 42
+
+	assert.Equal(t, [][]float64{{3}}, embedTexts(t, creator, "m", "abc"))
+}
+
+func TestCachingEmbeddingCreator_UpstreamFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		response *openai.CreateEmbeddingResponse
+		err      error
+		wantErr  string
+	}{
+		{name: "API error", err: errors.New("rate limited"), wantErr: "rate limited"},
+		{name: "short response", response: makeEmbeddingResponse([][]float64{{1}}), wantErr: "expected 2 embeddings, got 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			puts := 0
+			cache := &embeddingcache.MockEmbeddingCache{
+				GetFunc: func(string) ([]float64, bool) { return nil, false },
+				PutFunc: func(string, []float64) error {
+					puts++
+					return nil
+				},
+			}
+			creator := NewCachingEmbeddingCreator(&mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					return tt.response, tt.err
+				},
+			}, testEmbeddingBaseURL, cache)
+
+			_, err := creator.New(context.Background(), openai.EmbeddingNewParams{
+				Model: "m",
+				Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: []string{"a", "b"}},
+			})
+
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Zero(t, puts, "nothing is cached from a failed request")
+		})
+	}
+}
+
+func TestCachingEmbeddingCreator_PassesThroughTokenInput(t *testing.T) {
+	calls := 0
+	creator := NewCachingEmbeddingCreator(&mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			calls++
+			return makeEmbeddingResponse([][]float64{{1}}), nil
+		},
+	}, testEmbeddingBaseURL, memory.NewLRUEmbeddingCache(10))
+	params := openai.EmbeddingNewParams{
+		Model: "m",
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfTokens: []int64{1, 2, 3}},
+	}
+
+	for range 2 {
+		_, err := creator.New(context.Background(), params)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, types.EmbeddingCacheStats{}, creator.Stats())
+}
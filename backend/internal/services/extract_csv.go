@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func extractCSV(content []byte) (string, error) {
+	return extractDelimited(content, ',')
+}
+
+func extractTSV(content []byte) (string, error) {
+	return extractDelimited(content, '\t')
+}
+
+// extractDelimited renders each data row on its own line as "header: value"
+// pairs, so a chunk holding a row still says what each value means. The
+// first row is taken as the header; empty values are left out.
+func extractDelimited(content []byte, comma rune) (string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\uFEFF"))))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("no text could be extracted from CSV")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var out strings.Builder
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		var fields []string
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			name := fmt.Sprintf("Column %d", i+1)
+			if i < len(header) && header[i] != "" {
+				name = header[i]
+			}
+			fields = append(fields, name+": "+value)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		out.WriteString(strings.Join(fields, "; "))
+		out.WriteString("\n")
+	}
+
+	if out.Len() == 0 {
+		return "", fmt.Errorf("no text could be extracted from CSV")
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// wordNamespace is the WordprocessingML namespace of document.xml elements
+	wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	// maxDocxXMLSize caps the decompressed document.xml, guarding against zip bombs
+	maxDocxXMLSize = 64 << 20
+)
+
+// extractDOCX reads the body text of a Word document. Paragraphs become lines,
+// heading styles become Markdown headings and table rows become lines of
+// cells separated by " | ".
+func extractDOCX(content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX archive: %w", err)
+	}
+
+	var documentXML *zip.File
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			documentXML = file
+			break
+		}
+	}
+	if documentXML == nil {
+		return "", fmt.Errorf("DOCX archive has no word/document.xml")
+	}
+
+	reader, err := documentXML.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX body: %w", err)
+	}
+	defer reader.Close()
+
+	text, err := docxText(io.LimitReader(reader, maxDocxXMLSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse DOCX body: %w", err)
+	}
+	if text == "" {
+		return "", fmt.Errorf("no text could be extracted from DOCX")
+	}
+	return text, nil
+}
+
+func docxText(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+
+	var (
+		out       strings.Builder
+		paragraph strings.Builder
+		heading   int
+		// inRun tells run content apart from paragraph properties, which
+		// also contain tab elements (tab stops)
+		inRun bool
+		// tables holds the open tables, innermost last
+		tables []*docxTable
+	)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch el := token.(type) {
+		case xml.StartElement:
+			if el.Name.Space != wordNamespace {
+				continue
+			}
+			switch el.Name.Local {
+			case "p":
+				paragraph.Reset()
+				heading = 0
+			case "pStyle":
+				heading = headingLevel(xmlAttr(el, "val"))
+			case "r":
+				inRun = true
+			case "tab":
+				if inRun {
+					paragraph.WriteString("\t")
+				}
+			case "br", "cr":
+				if inRun {
+					paragraph.WriteString("\n")
+				}
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &el); err != nil {
+					return "", err
+				}
+				paragraph.WriteString(text)
+			case "tbl":
+				tables = append(tables, &docxTable{})
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].row = nil
+				}
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].cell = nil
+				}
+			}
+
+		case xml.EndElement:
+			if el.Name.Space != wordNamespace {
+				continue
+			}
+			switch el.Name.Local {
+			case "r":
+				inRun = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				paragraph.Reset()
+				if text == "" {
+					continue
+				}
+				// Paragraphs inside a cell are collected into the cell text
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.cell = append(table.cell, text)
+					continue
+				}
+				if heading > 0 {
+					text = strings.Repeat("#", heading) + " " + text
+				}
+				out.WriteString(text)
+				out.WriteString("\n\n")
+			case "tc":
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.row = append(table.row, strings.Join(table.cell, " "))
+				}
+			case "tr":
+				if len(tables) > 0 {
+					if row := tables[len(tables)-1].row; strings.Join(row, "") != "" {
+						out.WriteString(strings.Join(row, " | "))
+						out.WriteString("\n")
+					}
+				}
+			case "tbl":
+				if len(tables) > 0 {
+					tables = tables[:len(tables)-1]
+				}
+				out.WriteString("\n")
+			}
+		}
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// docxTable collects the cells of the row being read
+type docxTable struct {
+	row  []string
+	cell []string
+}
+
+func xmlAttr(el xml.StartElement, local string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// headingLevel maps Word's built-in heading styles to a Markdown level
+func headingLevel(style string) int {
+	switch style := strings.ToLower(style); {
+	case style == "title":
+		return 1
+	case strings.HasPrefix(style, "heading"):
+		level := strings.TrimPrefix(style, "heading")
+		if len(level) == 1 && level[0] >= '1' && level[0] <= '6' {
+			return int(level[0] - '0')
+		}
+	}
+	return 0
+}
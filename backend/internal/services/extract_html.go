@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlBoilerplate holds elements that never carry document content: scripts
+// and styles, plus the navigation chrome around wiki and blog pages.
+var htmlBoilerplate = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Nav: true, atom.Header: true, atom.Footer: true,
+	atom.Aside: true, atom.Form: true, atom.Button: true, atom.Select: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Object: true,
+	atom.Embed: true,
+}
+
+// htmlBlocks start and end on their own lines
+var htmlBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Main: true, atom.Ul: true, atom.Ol: true, atom.Dl: true, atom.Dt: true,
+	atom.Dd: true, atom.Table: true, atom.Blockquote: true, atom.Figure: true,
+	atom.Figcaption: true, atom.Hr: true, atom.Address: true, atom.Details: true,
+	atom.Summary: true, atom.Caption: true,
+}
+
+var htmlHeadings = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+var (
+	whitespaceRun = regexp.MustCompile(`\s+`)
+	blankLineRun  = regexp.MustCompile(`\n{3,}`)
+)
+
+// extractHTML reads the visible text of an HTML page. When the page marks its
+// content with <main> or <article> only that is read; headings become
+// Markdown headings, list items "- " lines, table rows " | " separated cells
+// and <pre> blocks fenced code.
+func extractHTML(content []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	root := findElement(doc, atom.Main)
+	if root == nil {
+		root = findElement(doc, atom.Article)
+	}
+	if root == nil {
+		root = doc
+	}
+
+	var out strings.Builder
+	renderHTML(&out, root)
+
+	text := tidyExtractedText(out.String())
+	if text == "" {
+		return "", fmt.Errorf("no text could be extracted from HTML")
+	}
+	return text, nil
+}
+
+func renderHTML(out *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		out.WriteString(whitespaceRun.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+		if htmlBoilerplate[n.DataAtom] || isHiddenHTML(n) {
+			return
+		}
+	case html.DocumentNode:
+	default:
+		return
+	}
+
+	if level, ok := htmlHeadings[n.DataAtom]; ok {
+		out.WriteString("\n\n" + strings.Repeat("#", level) + " ")
+		renderHTMLChildren(out, n)
+		out.WriteString("\n\n")
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		out.WriteString("\n")
+	case atom.Li:
+		out.WriteString("\n- ")
+		renderHTMLChildren(out, n)
+	case atom.Tr:
+		out.WriteString("\n")
+		renderHTMLChildren(out, n)
+	case atom.Td, atom.Th:
+		if previousCell(n) {
+			out.WriteString(" | ")
+		}
+		renderHTMLChildren(out, n)
+	case atom.Pre:
+		out.WriteString("\n\n```\n")
+		out.WriteString(strings.Trim(textContent(n), "\n"))
+		out.WriteString("\n```\n\n")
+	default:
+		if htmlBlocks[n.DataAtom] {
+			out.WriteString("\n\n")
+			renderHTMLChildren(out, n)
+			out.WriteString("\n\n")
+			return
+		}
+		renderHTMLChildren(out, n)
+	}
+}
+
+func renderHTMLChildren(out *strings.Builder, n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		renderHTML(out, child)
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func isHiddenHTML(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		switch {
+		case attr.Key == "hidden",
+			attr.Key == "aria-hidden" && attr.Val == "true",
+			attr.Key == "role" && attr.Val == "navigation":
+			return true
+		}
+	}
+	return false
+}
+
+// previousCell reports whether a table cell follows another in its row
+func previousCell(n *html.Node) bool {
+	for sibling := n.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+		if sibling.Type == html.ElementNode && (sibling.DataAtom == atom.Td || sibling.DataAtom == atom.Th) {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent is the raw text below a node, whitespace preserved
+func textContent(n *html.Node) string {
+	var text strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return text.String()
+}
+
+// tidyExtractedText trims each line and collapses runs of blank lines,
+// leaving the contents of fenced code blocks untouched.
+func tidyExtractedText(text string) string {
+	lines := strings.Split(text, "\n")
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			lines[i] = trimmed
+			continue
+		}
+		if inFence {
+			lines[i] = strings.TrimRight(line, " \t\r")
+			continue
+		}
+		lines[i] = whitespaceRun.ReplaceAllString(trimmed, " ")
+	}
+	return strings.TrimSpace(blankLineRun.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownImage         = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink          = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownReferenceLink = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s+\S+`)
+)
+
+// extractMarkdown keeps the Markdown structure (headings, lists, tables and
+// code blocks) and drops what only matters when rendering: front matter, HTML
+// comments, link targets and image URLs. Code blocks are left as they are.
+func extractMarkdown(content []byte) (string, error) {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\uFEFF")
+	text = stripFrontMatter(text)
+
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	fence := ""
+	inComment := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			kept = append(kept, line)
+			continue
+		}
+		if !inComment && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			fence = trimmed[:3]
+			kept = append(kept, line)
+			continue
+		}
+
+		line, inComment = stripHTMLComments(line, inComment)
+		if markdownReferenceLink.MatchString(line) {
+			continue
+		}
+		line = markdownImage.ReplaceAllString(line, "$1")
+		line = markdownLink.ReplaceAllString(line, "$1")
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+
+	return strings.TrimSpace(blankLineRun.ReplaceAllString(strings.Join(kept, "\n"), "\n\n")), nil
+}
+
+// stripFrontMatter removes a leading YAML (---) or TOML (+++) block
+func stripFrontMatter(text string) string {
+	for _, delimiter := range []string{"---", "+++"} {
+		if !strings.HasPrefix(text, delimiter+"\n") {
+			continue
+		}
+		body := text[len(delimiter)+1:]
+		if end := strings.Index(body, "\n"+delimiter+"\n"); end >= 0 {
+			return body[end+len(delimiter)+2:]
+		}
+		if strings.HasSuffix(body, "\n"+delimiter) {
+			return ""
+		}
+	}
+	return text
+}
+
+// stripHTMLComments removes <!-- --> comments from a line. inComment carries
+// an unterminated comment over to the next line.
+func stripHTMLComments(line string, inComment bool) (string, bool) {
+	var out strings.Builder
+	for {
+		if inComment {
+			end := strings.Index(line, "-->")
+			if end < 0 {
+				return out.String(), true
+			}
+			line = line[end+3:]
+			inComment = false
+		}
+		start := strings.Index(line, "<!--")
+		if start < 0 {
+			out.WriteString(line)
+			return out.String(), false
+		}
+		out.WriteString(line[:start])
+		line = line[start+4:]
+		inComment = true
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+
+	"rag-backend/pkg/types"
+)
+
+// processPDF extracts the text of each page, separated by blank lines, and
+// records where each page starts so chunks can cite page numbers. Pages
+// without readable text are skipped and reported rather than failing the
+// whole file.
+func (dp *DocumentProcessor) processPDF(content []byte) (types.ExtractedFile, error) {
+	reader := bytes.NewReader(content)
+
+	pdfReader, err := pdf.NewReader(reader, int64(len(content)))
+	if err != nil {
+		return types.ExtractedFile{}, fmt.Errorf("failed to create PDF reader: %w", err)
+	}
+
+	var file types.ExtractedFile
+	var textBuilder strings.Builder
+	numPages := pdfReader.NumPage()
+
+	for i := 1; i <= numPages; i++ {
+		text, err := pdfPageText(pdfReader, i)
+		if err != nil {
+			file.SkippedPages = append(file.SkippedPages, types.SkippedPage{Page: i, Reason: err.Error()})
+			continue
+		}
+
+		if textBuilder.Len() > 0 {
+			textBuilder.WriteString("\n\n")
+		}
+		file.Pages = append(file.Pages, types.PageOffset{Page: i, Offset: textBuilder.Len()})
+		textBuilder.WriteString(text)
+	}
+
+	if textBuilder.Len() == 0 {
+		return types.ExtractedFile{}, fmt.Errorf("no text could be extracted from PDF")
+	}
+	file.Content = textBuilder.String()
+	file.Info = pdfInfo(pdfReader)
+
+	return file, nil
+}
+
+// pdfPageText returns the trimmed text of a page, or an error saying why it
+// has none
+func pdfPageText(r *pdf.Reader, number int) (text string, err error) {
+	// The PDF library panics on some malformed content streams
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			text, err = "", fmt.Errorf("page could not be read: %v", recovered)
+		}
+	}()
+
+	page := r.Page(number)
+	if page.V.IsNull() {
+		return "", errors.New("page is missing from the document")
+	}
+	text, err = page.GetPlainText(nil)
+	if err != nil {
+		return "", fmt.Errorf("page could not be read: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", errors.New("page has no text, it may be a scanned image")
+	}
+	return text, nil
+}
+
+// pdfInfo reads the title, author and creation date from a PDF's document
+// information dictionary. It returns nil when none of them are set or the
+// dictionary can't be read.
+func pdfInfo(r *pdf.Reader) (info *types.DocumentInfo) {
+	// The PDF library panics on malformed objects here too, and losing the
+	// info shouldn't fail an upload whose text was read
+	defer func() {
+		if recover() != nil {
+			info = nil
+		}
+	}()
+
+	dict := r.Trailer().Key("Info")
+	if dict.IsNull() {
+		return nil
+	}
+
+	read := types.DocumentInfo{
+		Title:  strings.TrimSpace(dict.Key("Title").Text()),
+		Author: strings.TrimSpace(dict.Key("Author").Text()),
+	}
+	if created, ok := parsePDFDate(dict.Key("CreationDate").Text()); ok {
+		read.CreatedAt = &created
+	}
+
+	if read == (types.DocumentInfo{}) {
+		return nil
+	}
+	return &read
+}
+
+// parsePDFDate parses a PDF date, D:YYYYMMDDHHmmSSOHH'mm', in which
+// everything after the year is optional. Dates without a time zone are taken
+// to be UTC.
+func parsePDFDate(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "D:")
+
+	// year, month, day, hour, minute, second
+	fields := []int{0, 1, 1, 0, 0, 0}
+	widths := []int{4, 2, 2, 2, 2, 2}
+	for i, width := range widths {
+		n, ok := leadingNumber(value, width)
+		if !ok {
+			if i == 0 {
+				return time.Time{}, false
+			}
+			break
+		}
+		fields[i] = n
+		value = value[width:]
+	}
+
+	location := time.UTC
+	if len(value) > 0 && (value[0] == '+' || value[0] == '-') {
+		zone := strings.ReplaceAll(value[1:], "'", "")
+		hours, ok := leadingNumber(zone, 2)
+		if !ok {
+			return time.Time{}, false
+		}
+		minutes, _ := leadingNumber(zone[2:], 2)
+		offset := hours*3600 + minutes*60
+		if value[0] == '-' {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, location), true
+}
+
+// leadingNumber parses the first width characters of s if they are all digits
+func leadingNumber(s string, width int) (int, bool) {
+	if len(s) < width {
+		return 0, false
+	}
+	for _, c := range s[:width] {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s[:width])
+	return n, err == nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"mime"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"rag-backend/pkg/types"
+)
+
+// Extractor turns the raw bytes of an uploaded file into plain text. Formats
+// with structure render headings as Markdown "#" lines so it survives
+// extraction.
+type Extractor interface {
+	Extract(content []byte) (string, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface
+type ExtractorFunc func(content []byte) (string, error)
+
+func (f ExtractorFunc) Extract(content []byte) (string, error) {
+	return f(content)
+}
+
+// FileExtractor is an Extractor that can also report what it learned about
+// a file besides its text, such as where its pages start. Extract prefers it.
+type FileExtractor interface {
+	Extractor
+	ExtractFile(content []byte) (types.ExtractedFile, error)
+}
+
+// FileExtractorFunc adapts a function to the FileExtractor interface
+type FileExtractorFunc func(content []byte) (types.ExtractedFile, error)
+
+func (f FileExtractorFunc) Extract(content []byte) (string, error) {
+	file, err := f(content)
+	return file.Content, err
+}
+
+func (f FileExtractorFunc) ExtractFile(content []byte) (types.ExtractedFile, error) {
+	return f(content)
+}
+
+// genericContentTypes say nothing about the format, so the file extension
+// decides instead
+var genericContentTypes = []string{"", "application/octet-stream", "text/plain"}
+
+// ExtractorRegistry finds the extractor for an upload by MIME type, falling
+// back to the file extension when the client sent a generic or unknown type.
+type ExtractorRegistry struct {
+	byMIMEType  map[string]Extractor
+	byExtension map[string]Extractor
+	// extensionTypes maps each extension to the first MIME type registered
+	// with it
+	extensionTypes map[string]string
+}
+
+func NewExtractorRegistry() *ExtractorRegistry {
+	return &ExtractorRegistry{
+		byMIMEType:     make(map[string]Extractor),
+		byExtension:    make(map[string]Extractor),
+		extensionTypes: make(map[string]string),
+	}
+}
+
+// Register maps MIME types and extensions (with the leading dot) to an
+// extractor, replacing any earlier registration for the same keys.
+func (r *ExtractorRegistry) Register(extractor Extractor, mimeTypes, extensions []string) {
+	for _, mimeType := range mimeTypes {
+		r.byMIMEType[strings.ToLower(mimeType)] = extractor
+	}
+	for _, extension := range extensions {
+		r.byExtension[strings.ToLower(extension)] = extractor
+		if len(mimeTypes) > 0 {
+			r.extensionTypes[strings.ToLower(extension)] = strings.ToLower(mimeTypes[0])
+		}
+	}
+}
+
+// TypeForExtension returns the MIME type registered for a file's extension
+func (r *ExtractorRegistry) TypeForExtension(filename string) (string, bool) {
+	mimeType, ok := r.extensionTypes[strings.ToLower(filepath.Ext(filename))]
+	return mimeType, ok
+}
+
+// Lookup returns the extractor for a file. A specific MIME type wins over the
+// extension; a generic one only applies when the extension is unknown.
+func (r *ExtractorRegistry) Lookup(contentType, filename string) (Extractor, bool) {
+	mimeType := mediaType(contentType)
+	byExtension, extensionOK := r.byExtension[strings.ToLower(filepath.Ext(filename))]
+
+	if slices.Contains(genericContentTypes, mimeType) && extensionOK {
+		return byExtension, true
+	}
+
+	if extractor, ok := r.byMIMEType[mimeType]; ok {
+		return extractor, true
+	}
+	return byExtension, extensionOK
+}
+
+// mediaType strips parameters such as charset from a Content-Type header
+func mediaType(contentType string) string {
+	mimeType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mimeType, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTestDOCX(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	file, err := archive.Create("word/document.xml")
+	require.NoError(t, err)
+	_, err = file.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body + `</w:body></w:document>`))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestExtractorRegistry_Lookup(t *testing.T) {
+	pdf := ExtractorFunc(func([]byte) (string, error) { return "pdf", nil })
+	text := ExtractorFunc(func([]byte) (string, error) { return "text", nil })
+	markdown := ExtractorFunc(func([]byte) (string, error) { return "markdown", nil })
+	registry := NewExtractorRegistry()
+	registry.Register(pdf, []string{"application/pdf"}, []string{".pdf"})
+	registry.Register(text, []string{"text/plain"}, []string{".txt"})
+	registry.Register(markdown, []string{"text/markdown"}, []string{".md"})
+
+	tests := []struct {
+		name        string
+		contentType string
+		filename    string
+		expected    string
+	}{
+		{name: "by MIME type", contentType: "application/pdf", filename: "report", expected: "pdf"},
+		{name: "ignores MIME parameters and case", contentType: "Text/Markdown; charset=utf-8", filename: "notes", expected: "markdown"},
+		{name: "specific MIME type beats extension", contentType: "application/pdf", filename: "report.md", expected: "pdf"},
+		{name: "extension beats octet-stream", contentType: "application/octet-stream", filename: "README.MD", expected: "markdown"},
+		{name: "extension beats text/plain", contentType: "text/plain", filename: "README.md", expected: "markdown"},
+		{name: "extension when no MIME type is sent", filename: "report.pdf", expected: "pdf"},
+		{name: "extension when the MIME type is unknown", contentType: "application/x-unknown", filename: "notes.txt", expected: "text"},
+		{name: "text/plain without a known extension", contentType: "text/plain", filename: "notes", expected: "text"},
+		{name: "unsupported", contentType: "image/png", filename: "image.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, ok := registry.Lookup(tt.contentType, tt.filename)
+
+			if tt.expected == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			result, err := extractor.Extract(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestDocumentProcessor_RegisterExtractor(t *testing.T) {
+	dp := NewDocumentProcessor()
+	dp.RegisterExtractor(ExtractorFunc(func(content []byte) (string, error) {
+		return "org: " + string(content), nil
+	}), []string{"text/x-org"}, []string{".org"})
+
+	result, err := dp.ProcessFile(makeFileHeader(t, "notes.org", "application/octet-stream", []byte("* body")))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "org: * body", result.Content)
+	assert.Equal(t, "text/x-org", result.ContentType)
+}
+
+func TestExtractDOCX(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+		err      string
+	}{
+		{
+			name: "paragraphs, headings, tabs and breaks",
+			content: buildTestDOCX(t, `<w:p><w:pPr><w:pStyle w:val="Title"/><w:tabs><w:tab w:val="left" w:pos="720"/></w:tabs></w:pPr><w:r><w:t>Handbook</w:t></w:r></w:p>`+
+				`<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Leave</w:t></w:r></w:p>`+
+				`<w:p><w:r><w:t xml:space="preserve">Staff get </w:t></w:r><w:r><w:t>25 days.</w:t></w:r></w:p>`+
+				`<w:p><w:r><w:t>Name</w:t><w:tab/><w:t>Days</w:t><w:br/><w:t>Next line</w:t></w:r></w:p>`+
+				`<w:p></w:p>`),
+			expected: "# Handbook\n\n## Leave\n\nStaff get 25 days.\n\nName\tDays\nNext line",
+		},
+		{
+			name: "tables render one row per line",
+			content: buildTestDOCX(t, `<w:p><w:r><w:t>Before</w:t></w:r></w:p><w:tbl>`+
+				`<w:tr><w:tc><w:p><w:r><w:t>Region</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Days</w:t></w:r></w:p></w:tc></w:tr>`+
+				`<w:tr><w:tc><w:p><w:r><w:t>EU</w:t></w:r></w:p><w:p><w:r><w:t>(all)</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>25</w:t></w:r></w:p></w:tc></w:tr>`+
+				`</w:tbl><w:p><w:r><w:t>After</w:t></w:r></w:p>`),
+			expected: "Before\n\nRegion | Days\nEU (all) | 25\n\nAfter",
+		},
+		{
+			name:    "not a zip archive",
+			content: []byte("plain text"),
+			err:     "failed to open DOCX archive",
+		},
+		{
+			name: "archive without a document",
+			content: func() []byte {
+				var buf bytes.Buffer
+				archive := zip.NewWriter(&buf)
+				_, _ = archive.Create("word/styles.xml")
+				_ = archive.Close()
+				return buf.Bytes()
+			}(),
+			err: "DOCX archive has no word/document.xml",
+		},
+		{
+			name:    "empty document",
+			content: buildTestDOCX(t, `<w:p/>`),
+			err:     "no text could be extracted from DOCX",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := extractDOCX(tt.content)
+
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestExtractHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		err      string
+	}{
+		{
+			name: "strips scripts, styles and navigation",
+			content: `<html><head><title>Wiki</title><style>p{color:red}</style><script>track()</script></head>
+				<body><nav><a href="/">Home</a></nav><header>Site header</header>
+				<h1>Proxy   setup</h1><p>Set <code>HTTP_PROXY</code> &amp; restart.</p>
+				<div hidden>secret</div><footer>© 2024</footer><script>more()</script></body></html>`,
+			expected: "# Proxy setup\n\nSet HTTP_PROXY & restart.",
+		},
+		{
+			name:     "prefers the main element",
+			content:  `<body><div class="sidebar">Related pages</div><main><h2>Install</h2><p>Run the installer.</p></main></body>`,
+			expected: "## Install\n\nRun the installer.",
+		},
+		{
+			name:     "lists and tables",
+			content:  `<ul><li>one</li><li>two</li></ul><table><tr><th>OS</th><th>Path</th></tr><tr><td>Linux</td><td>/etc</td></tr></table>`,
+			expected: "- one\n- two\n\nOS | Path\nLinux | /etc",
+		},
+		{
+			name:     "pre blocks keep their layout",
+			content:  "<p>Config:</p><pre>server {\n    listen 80;\n}</pre>",
+			expected: "Config:\n\n```\nserver {\n    listen 80;\n}\n```",
+		},
+		{
+			name:    "no visible text",
+			content: `<html><head><script>x()</script></head><body><nav>Menu</nav></body></html>`,
+			err:     "no text could be extracted from HTML",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := extractHTML([]byte(tt.content))
+
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestExtractMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "drops front matter and comments",
+			content:  "---\ntitle: Guide\n---\n# Guide\n<!-- draft\nnotes -->\nIntro <!-- todo --> text.\r\n",
+			expected: "# Guide\n\nIntro  text.",
+		},
+		{
+			name:     "keeps link text and image alt text",
+			content:  "See [the docs](https://example.com/docs) and ![diagram](img.png).\n\n[ref]: https://example.com",
+			expected: "See the docs and diagram.",
+		},
+		{
+			name:     "leaves code blocks alone",
+			content:  "Example:\n\n```html\n<!-- kept -->\n[x](y)\n```\n\n| a | b |\n|---|---|",
+			expected: "Example:\n\n```html\n<!-- kept -->\n[x](y)\n```\n\n| a | b |\n|---|---|",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := extractMarkdown([]byte(tt.content))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestExtractDelimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		comma    rune
+		expected string
+		err      string
+	}{
+		{
+			name:     "rows carry their headers",
+			content:  "\uFEFFname,born,field\nAda Lovelace,1815,mathematics\n\"Hopper, Grace\",1906,\n",
+			comma:    ',',
+			expected: "name: Ada Lovelace; born: 1815; field: mathematics\nname: Hopper, Grace; born: 1906",
+		},
+		{
+			name:     "extra columns are numbered",
+			content:  "name\nAda,extra\n,\n",
+			comma:    ',',
+			expected: "name: Ada; Column 2: extra",
+		},
+		{
+			name:     "tab separated",
+			content:  "os\tpath\nlinux\t/etc\n",
+			comma:    '\t',
+			expected: "os: linux; path: /etc",
+		},
+		{
+			name:    "header only",
+			content: "name,born\n",
+			comma:   ',',
+			err:     "no text could be extracted from CSV",
+		},
+		{
+			name:  "empty",
+			comma: ',',
+			err:   "no text could be extracted from CSV",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := extractDelimited([]byte(tt.content), tt.comma)
+
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"rag-backend/internal/repositories/jobstore"
+	"rag-backend/pkg/types"
+)
+
+var (
+	// ErrJobNotFound is returned when no job matches the requested ID
+	ErrJobNotFound = jobstore.ErrJobNotFound
+	// ErrQueueFull is returned by Submit when every queue slot is taken
+	ErrQueueFull = errors.New("ingestion queue is full")
+	// ErrQueueClosed is returned by Submit once the queue is shutting down
+	ErrQueueClosed = errors.New("ingestion queue is closed")
+	// ErrJobNotCancellable is returned when cancelling a job that is already
+	// storing its chunks or has finished
+	ErrJobNotCancellable = errors.New("job can no longer be cancelled")
+	// ErrJobCancelled is returned by JobProgress once the job was cancelled
+	ErrJobCancelled = errors.New("job cancelled")
+)
+
+// jobRetention is how long finished jobs stay available for status checks
+const jobRetention = time.Hour
+
+// JobFunc does the work of a job, reporting progress as it goes. ctx is
+// cancelled when the job is.
+type JobFunc func(ctx context.Context, progress JobProgress) error
+
+// CodedError attaches an API error code to a job failure, so clients polling
+// the job get the same code a synchronous request would have returned.
+type CodedError struct {
+	Code string
+	Err  error
+}
+
+func (e *CodedError) Error() string { return e.Err.Error() }
+
+func (e *CodedError) Unwrap() error { return e.Err }
+
+// JobQueue runs ingestion jobs on a fixed pool of workers. The queue is
+// bounded: when it is full Submit fails with ErrQueueFull rather than
+// buffering uploads without limit.
+type JobQueue struct {
+	store   jobstore.JobStore
+	pending chan pendingJob
+	now     func() time.Time
+
+	mutex sync.Mutex
+	// cancels holds the cancel function of every queued or running job
+	cancels map[string]context.CancelFunc
+	closed  bool
+	workers sync.WaitGroup
+}
+
+type pendingJob struct {
+	id  string
+	ctx context.Context
+	run JobFunc
+}
+
+// NewJobQueue starts workers that run submitted jobs, holding at most
+// capacity jobs waiting for a worker.
+func NewJobQueue(store jobstore.JobStore, workers, capacity int) *JobQueue {
+	q := &JobQueue{
+		store:   store,
+		pending: make(chan pendingJob, capacity),
+		now:     time.Now,
+		cancels: make(map[string]context.CancelFunc),
+	}
+	for range workers {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Submit queues a job and returns it in the queued status.
+func (q *JobQueue) Submit(fileName, collection string, run JobFunc) (types.Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return types.Job{}, ErrQueueClosed
+	}
+	if len(q.pending) == cap(q.pending) {
+		return types.Job{}, ErrQueueFull
+	}
+	q.pruneLocked()
+
+	now := q.now()
+	job := types.Job{
+		ID:         uuid.New().String(),
+		Status:     types.JobStatusQueued,
+		FileName:   fileName,
+		Collection: collection,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := q.store.Save(job); err != nil {
+		return types.Job{}, err
+	}
+
+	// Workers only take from the channel, and submissions hold the lock, so
+	// the capacity check above guarantees room
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancels[job.ID] = cancel
+	q.pending <- pendingJob{id: job.ID, ctx: ctx, run: run}
+	return job, nil
+}
+
+// Job returns the current state of a job
+func (q *JobQueue) Job(id string) (types.Job, error) {
+	return q.store.Get(id)
+}
+
+// Cancel stops a queued or running job. Jobs that have started storing their
+// chunks run to completion so the stores never hold half a document.
+func (q *JobQueue) Cancel(id string) (types.Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, err := q.store.Get(id)
+	if err != nil {
+		return types.Job{}, err
+	}
+	if job.Finished() || job.Status == types.JobStatusStoring {
+		return job, ErrJobNotCancellable
+	}
+
+	job.Status = types.JobStatusCancelled
+	job.UpdatedAt = q.now()
+	if err := q.store.Save(job); err != nil {
+		return types.Job{}, err
+	}
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+	}
+	return job, nil
+}
+
+// Close stops accepting jobs, cancels the ones not yet storing and waits for
+// the workers to finish.
+func (q *JobQueue) Close() {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.pending)
+	ids := make([]string, 0, len(q.cancels))
+	for id := range q.cancels {
+		ids = append(ids, id)
+	}
+	q.mutex.Unlock()
+
+	for _, id := range ids {
+		_, _ = q.Cancel(id)
+	}
+	q.workers.Wait()
+}
+
+func (q *JobQueue) work() {
+	defer q.workers.Done()
+	for pending := range q.pending {
+		q.run(pending)
+	}
+}
+
+func (q *JobQueue) run(pending pendingJob) {
+	defer func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		if cancel, ok := q.cancels[pending.id]; ok {
+			cancel()
+			delete(q.cancels, pending.id)
+		}
+	}()
+
+	progress := &jobProgress{queue: q, id: pending.id}
+	// Jobs cancelled while queued are skipped
+	if err := progress.SetStatus(types.JobStatusExtracting); err != nil {
+		return
+	}
+
+	err := pending.run(pending.ctx, progress)
+	q.update(pending.id, func(job *types.Job) {
+		if err == nil {
+			job.Status = types.JobStatusDone
+			return
+		}
+		job.Status = types.JobStatusFailed
+		job.Error = err.Error()
+		var coded *CodedError
+		if errors.As(err, &coded) {
+			job.ErrorCode = coded.Code
+		}
+	})
+}
+
+// update applies a change to a job that has not finished. It reports false
+// when the job has finished, which for a running job means it was cancelled.
+func (q *JobQueue) update(id string, change func(job *types.Job)) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, err := q.store.Get(id)
+	if err != nil || job.Finished() {
+		return false
+	}
+	change(&job)
+	job.UpdatedAt = q.now()
+	return q.store.Save(job) == nil
+}
+
+// pruneLocked drops finished jobs older than jobRetention. The caller holds
+// the mutex.
+func (q *JobQueue) pruneLocked() {
+	jobs, err := q.store.List()
+	if err != nil {
+		return
+	}
+	cutoff := q.now().Add(-jobRetention)
+	for _, job := range jobs {
+		if job.Finished() && job.UpdatedAt.Before(cutoff) {
+			_ = q.store.Delete(job.ID)
+		}
+	}
+}
+
+// JobProgress lets a running job report how far it has got
+type JobProgress interface {
+	// SetStatus moves the job to a new status. It returns ErrJobCancelled
+	// when the job was cancelled, after which the job must stop without side
+	// effects.
+	SetStatus(status string) error
+	// SetChunks records how many of the document's chunks have been embedded
+	SetChunks(processed, total int)
+	// SetResult records what the job produced
+	SetResult(result *types.UploadResponse)
+}
+
+type jobProgress struct {
+	queue *JobQueue
+	id    string
+}
+
+func (p *jobProgress) SetStatus(status string) error {
+	if !p.queue.update(p.id, func(job *types.Job) { job.Status = status }) {
+		return ErrJobCancelled
+	}
+	return nil
+}
+
+func (p *jobProgress) SetChunks(processed, total int) {
+	p.queue.update(p.id, func(job *types.Job) {
+		job.ChunksProcessed = processed
+		job.ChunksTotal = total
+	})
+}
+
+func (p *jobProgress) SetResult(result *types.UploadResponse) {
+	p.queue.update(p.id, func(job *types.Job) { job.Result = result })
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/jobstore/memory"
+	"rag-backend/pkg/types"
+)
+
+func newTestJobQueue(t *testing.T, workers, capacity int) *JobQueue {
+	t.Helper()
+	q := NewJobQueue(memory.NewMemoryJobStore(), workers, capacity)
+	t.Cleanup(q.Close)
+	return q
+}
+
+// waitForJob waits until the job reaches the given status and returns it
+func waitForJob(t *testing.T, q *JobQueue, id, status string) types.Job {
+	t.Helper()
+	var job types.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = q.Job(id)
+		return err == nil && job.Status == status
+	}, time.Second, time.Millisecond, "job never reached %q, last status %q", status, job.Status)
+	return job
+}
+
+func TestJobQueue_RunsJobToCompletion(t *testing.T) {
+	q := newTestJobQueue(t, 1, 4)
+	result := &types.UploadResponse{Document: &types.UploadDocumentSummary{ID: "doc-1", ChunksCount: 3}}
+
+	job, err := q.Submit("report.pdf", "contracts", func(_ context.Context, progress JobProgress) error {
+		if err := progress.SetStatus(types.JobStatusEmbedding); err != nil {
+			return err
+		}
+		progress.SetChunks(3, 3)
+		if err := progress.SetStatus(types.JobStatusStoring); err != nil {
+			return err
+		}
+		progress.SetResult(result)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, types.JobStatusQueued, job.Status)
+	assert.Equal(t, "report.pdf", job.FileName)
+	assert.Equal(t, "contracts", job.Collection)
+
+	done := waitForJob(t, q, job.ID, types.JobStatusDone)
+	assert.Equal(t, 3, done.ChunksProcessed)
+	assert.Equal(t, 3, done.ChunksTotal)
+	assert.Equal(t, result, done.Result)
+	assert.Empty(t, done.Error)
+}
+
+func TestJobQueue_RecordsFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{name: "plain error", err: errors.New("embed boom")},
+		{name: "coded error keeps its code", err: &CodedError{Code: "CHUNKING_ERROR", Err: errors.New("embed boom")}, code: "CHUNKING_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestJobQueue(t, 1, 4)
+
+			job, err := q.Submit("report.pdf", types.DefaultCollection, func(context.Context, JobProgress) error {
+				return tt.err
+			})
+			require.NoError(t, err)
+
+			failed := waitForJob(t, q, job.ID, types.JobStatusFailed)
+			assert.Equal(t, "embed boom", failed.Error)
+			assert.Equal(t, tt.code, failed.ErrorCode)
+		})
+	}
+}
+
+func TestJobQueue_Cancel(t *testing.T) {
+	t.Run("queued job never runs", func(t *testing.T) {
+		q := newTestJobQueue(t, 1, 4)
+		release := make(chan struct{})
+		blocker, err := q.Submit("first.txt", types.DefaultCollection, func(context.Context, JobProgress) error {
+			<-release
+			return nil
+		})
+		require.NoError(t, err)
+		waitForJob(t, q, blocker.ID, types.JobStatusExtracting)
+
+		ran := make(chan struct{}, 1)
+		queued, err := q.Submit("second.txt", types.DefaultCollection, func(context.Context, JobProgress) error {
+			ran <- struct{}{}
+			return nil
+		})
+		require.NoError(t, err)
+
+		cancelled, err := q.Cancel(queued.ID)
+		require.NoError(t, err)
+		assert.Equal(t, types.JobStatusCancelled, cancelled.Status)
+
+		close(release)
+		waitForJob(t, q, blocker.ID, types.JobStatusDone)
+		q.Close()
+		assert.Empty(t, ran, "cancelled job must not run")
+		waitForJob(t, q, queued.ID, types.JobStatusCancelled)
+	})
+
+	t.Run("running job sees its context cancelled", func(t *testing.T) {
+		q := newTestJobQueue(t, 1, 4)
+		stopped := make(chan error, 1)
+		job, err := q.Submit("report.pdf", types.DefaultCollection, func(ctx context.Context, progress JobProgress) error {
+			if err := progress.SetStatus(types.JobStatusEmbedding); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			stopped <- ctx.Err()
+			return progress.SetStatus(types.JobStatusStoring)
+		})
+		require.NoError(t, err)
+		waitForJob(t, q, job.ID, types.JobStatusEmbedding)
+
+		_, err = q.Cancel(job.ID)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, <-stopped, context.Canceled)
+		q.Close()
+		final := waitForJob(t, q, job.ID, types.JobStatusCancelled)
+		assert.Empty(t, final.Error)
+	})
+
+	t.Run("storing job cannot be cancelled", func(t *testing.T) {
+		q := newTestJobQueue(t, 1, 4)
+		release := make(chan struct{})
+		job, err := q.Submit("report.pdf", types.DefaultCollection, func(_ context.Context, progress JobProgress) error {
+			if err := progress.SetStatus(types.JobStatusStoring); err != nil {
+				return err
+			}
+			<-release
+			return nil
+		})
+		require.NoError(t, err)
+		waitForJob(t, q, job.ID, types.JobStatusStoring)
+
+		_, err = q.Cancel(job.ID)
+		assert.ErrorIs(t, err, ErrJobNotCancellable)
+
+		close(release)
+		waitForJob(t, q, job.ID, types.JobStatusDone)
+		_, err = q.Cancel(job.ID)
+		assert.ErrorIs(t, err, ErrJobNotCancellable)
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		q := newTestJobQueue(t, 1, 4)
+		_, err := q.Cancel("missing")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func TestJobQueue_Backpressure(t *testing.T) {
+	q := newTestJobQueue(t, 1, 1)
+	release := make(chan struct{})
+	block := func(context.Context, JobProgress) error {
+		<-release
+		return nil
+	}
+
+	running, err := q.Submit("running.txt", types.DefaultCollection, block)
+	require.NoError(t, err)
+	waitForJob(t, q, running.ID, types.JobStatusExtracting)
+
+	_, err = q.Submit("waiting.txt", types.DefaultCollection, block)
+	require.NoError(t, err)
+
+	_, err = q.Submit("rejected.txt", types.DefaultCollection, block)
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	close(release)
+	q.Close()
+	_, err = q.Submit("late.txt", types.DefaultCollection, block)
+	assert.ErrorIs(t, err, ErrQueueClosed)
+}
+
+func TestJobQueue_PrunesOldFinishedJobs(t *testing.T) {
+	q := newTestJobQueue(t, 1, 4)
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	old, err := q.Submit("old.txt", types.DefaultCollection, func(context.Context, JobProgress) error { return nil })
+	require.NoError(t, err)
+	waitForJob(t, q, old.ID, types.JobStatusDone)
+
+	now = now.Add(jobRetention + time.Minute)
+	_, err = q.Submit("new.txt", types.DefaultCollection, func(context.Context, JobProgress) error { return nil })
+	require.NoError(t, err)
+
+	_, err = q.Job(old.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+
+	"rag-backend/internal/config"
+	"rag-backend/pkg/ratelimit"
+)
+
+// Backoff bounds for retried provider calls
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// RetryPolicy decides how provider calls that fail transiently are retried.
+// Delays grow exponentially from BaseDelay with full jitter, capped at
+// MaxDelay. A Retry-After from the provider is always waited out, unless it is
+// longer than MaxDelay, in which case the call fails straight away.
+type RetryPolicy struct {
+	// MaxAttempts includes the first call; 1 disables retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// AttemptTimeout bounds each attempt, 0 for no bound. For streams it
+	// bounds the wait for the first chunk.
+	AttemptTimeout time.Duration
+}
+
+// NewRetryPolicy builds the retry policy configured for a provider
+func NewRetryPolicy(provider config.ProviderConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    provider.MaxRetries + 1,
+		BaseDelay:      retryBaseDelay,
+		MaxDelay:       retryMaxDelay,
+		AttemptTimeout: provider.RequestTimeout,
+	}
+}
+
+// retrier runs provider calls under a retry policy and a rate limiter
+type retrier struct {
+	policy  RetryPolicy
+	limiter *ratelimit.Limiter
+	// sleep and jitter are replaced in tests
+	sleep  func(ctx context.Context, d time.Duration) error
+	jitter func(d time.Duration) time.Duration
+}
+
+func newRetrier(policy RetryPolicy, limiter *ratelimit.Limiter) retrier {
+	return retrier{
+		policy:  policy,
+		limiter: limiter,
+		sleep:   ratelimit.Sleep,
+		jitter:  func(d time.Duration) time.Duration { return rand.N(d + 1) },
+	}
+}
+
+// do calls attempt until it succeeds, fails permanently or runs out of
+// attempts. Every attempt waits for the limiter first, since every attempt is
+// a request the provider counts.
+func (r retrier) do(ctx context.Context, tokens int, attempt func(ctx context.Context) error) error {
+	for n := 1; ; n++ {
+		if err := r.limiter.Wait(ctx, tokens); err != nil {
+			return err
+		}
+
+		attemptCtx, cancel := r.attemptContext(ctx)
+		err := attempt(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		delay, ok := r.retryDelay(ctx, err, n)
+		if !ok {
+			return err
+		}
+		if err := r.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (r retrier) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.policy.AttemptTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.policy.AttemptTimeout)
+}
+
+// retryDelay reports whether the n-th attempt's error is worth another
+// attempt, and how long to wait before it.
+func (r retrier) retryDelay(ctx context.Context, err error, n int) (time.Duration, bool) {
+	if n >= r.policy.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	retryAfter, ok := transientFailure(err)
+	if !ok || retryAfter > r.policy.MaxDelay {
+		return 0, false
+	}
+	backoff := min(r.policy.MaxDelay, r.policy.BaseDelay<<(n-1))
+	return max(retryAfter, r.jitter(backoff)), true
+}
+
+// transientFailure reports whether err may succeed when retried, along with
+// any delay the provider asked for.
+func transientFailure(err error) (time.Duration, bool) {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		if !retryableStatus(apiErr.StatusCode) {
+			return 0, false
+		}
+		if apiErr.Response == nil {
+			return 0, true
+		}
+		return retryAfter(apiErr.Response.Header, time.Now()), true
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		if !retryableStatus(statusErr.StatusCode) {
+			return 0, false
+		}
+		return retryAfter(statusErr.Header, time.Now()), true
+	}
+
+	// The caller has already ruled out its own context ending, so a deadline
+	// here is the attempt timing out
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, true
+	}
+	var netErr net.Error
+	return 0, errors.As(err, &netErr)
+}
+
+// retryableStatus reports whether a request that failed with an HTTP status
+// may succeed when retried
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusConflict ||
+		code == http.StatusTooManyRequests ||
+		code >= http.StatusInternalServerError
+}
+
+// httpStatusError is a failed response from a provider called without the
+// OpenAI SDK
+type httpStatusError struct {
+	StatusCode int
+	Header     http.Header
+	Message    string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// retryAfter reads the delay a provider asked for. OpenAI sends retry-after-ms
+// alongside the standard Retry-After, which may be seconds or an HTTP date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, date.Sub(now))
+	}
+	return 0
+}
+
+// estimateTokens approximates the tokens a request uses for rate limiting, at
+// four bytes of request body per token.
+func estimateTokens(body any) int {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return 0
+	}
+	return len(encoded) / 4
+}
+
+// RetryingEmbeddingCreator retries embedding calls that fail transiently and
+// keeps them within the provider's rate limits
+type RetryingEmbeddingCreator struct {
+	next    EmbeddingCreator
+	retrier retrier
+}
+
+func NewRetryingEmbeddingCreator(next EmbeddingCreator, policy RetryPolicy, limiter *ratelimit.Limiter) *RetryingEmbeddingCreator {
+	return &RetryingEmbeddingCreator{
+		next:    next,
+		retrier: newRetrier(policy, limiter),
+	}
+}
+
+func (c *RetryingEmbeddingCreator) New(ctx context.Context, body openai.EmbeddingNewParams, opts ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+	var response *openai.CreateEmbeddingResponse
+	err := c.retrier.do(ctx, estimateTokens(body), func(ctx context.Context) error {
+		var err error
+		response, err = c.next.New(ctx, body, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RetryingChatCompleter retries chat completions that fail transiently and
+// keeps them within the provider's rate limits. A stream is only retried
+// until its first chunk arrives, so callers never see tokens twice.
+type RetryingChatCompleter struct {
+	next    ChatCompletionCreator
+	retrier retrier
+}
+
+func NewRetryingChatCompleter(next ChatCompletionCreator, policy RetryPolicy, limiter *ratelimit.Limiter) *RetryingChatCompleter {
+	return &RetryingChatCompleter{
+		next:    next,
+		retrier: newRetrier(policy, limiter),
+	}
+}
+
+func (c *RetryingChatCompleter) New(ctx context.Context, body openai.ChatCompletionNewParams, opts ...option.RequestOption) (*openai.ChatCompletion, error) {
+	var completion *openai.ChatCompletion
+	err := c.retrier.do(ctx, estimateTokens(body), func(ctx context.Context) error {
+		var err error
+		completion, err = c.next.New(ctx, body, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
+
+func (c *RetryingChatCompleter) NewStreamingIter(ctx context.Context, body openai.ChatCompletionNewParams, opts ...option.RequestOption) ChatStream {
+	// The stream outlives this call, so it owns a context cancelled on Close
+	ctx, cancel := context.WithCancel(ctx)
+	return &retryingChatStream{
+		ctx:    ctx,
+		cancel: cancel,
+		open: func(ctx context.Context) ChatStream {
+			return c.next.NewStreamingIter(ctx, body, opts...)
+		},
+		retrier: c.retrier,
+		tokens:  estimateTokens(body),
+	}
+}
+
+// retryingChatStream opens its stream on the first call to Next, retrying
+// until the first chunk arrives. After that, errors are passed through.
+type retryingChatStream struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	open    func(ctx context.Context) ChatStream
+	retrier retrier
+	tokens  int
+
+	stream ChatStream
+	err    error
+}
+
+func (s *retryingChatStream) Next() bool {
+	if s.stream != nil {
+		return s.stream.Next()
+	}
+	if s.err != nil {
+		return false
+	}
+
+	var first bool
+	s.err = s.retrier.do(s.ctx, s.tokens, func(ctx context.Context) error {
+		// The attempt timeout only applies until the first chunk; the stream
+		// then runs under the caller's context
+		streamCtx, cancelStream := context.WithCancel(s.ctx)
+		stop := context.AfterFunc(ctx, func() {
+			if ctx.Err() == context.DeadlineExceeded {
+				cancelStream()
+			}
+		})
+		stream := s.open(streamCtx)
+		first = stream.Next()
+		stop()
+		// A stream that ended cleanly without a chunk is not retried either
+		if first || stream.Err() == nil {
+			s.stream = stream
+			return nil
+		}
+
+		err := stream.Err()
+		stream.Close()
+		cancelStream()
+		if ctx.Err() == context.DeadlineExceeded {
+			return context.DeadlineExceeded
+		}
+		return err
+	})
+	return first
+}
+
+func (s *retryingChatStream) Current() openai.ChatCompletionChunk {
+	if s.stream == nil {
+		return openai.ChatCompletionChunk{}
+	}
+	return s.stream.Current()
+}
+
+func (s *retryingChatStream) Err() error {
+	if s.stream == nil {
+		return s.err
+	}
+	return s.stream.Err()
+}
+
+func (s *retryingChatStream) Close() error {
+	defer s.cancel()
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.Close()
+}
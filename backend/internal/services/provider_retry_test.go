@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/config"
+	"rag-backend/pkg/ratelimit"
+)
+
+// flakyProvider fails requests according to a script before handing them to
+// a working fake provider. Each entry answers one request; once the script
+// runs out every request succeeds.
+type flakyProvider struct {
+	*fakeProvider
+	mutex    sync.Mutex
+	script   []http.HandlerFunc
+	requests int
+}
+
+func newFlakyProvider(t *testing.T, answer string, script ...http.HandlerFunc) *flakyProvider {
+	t.Helper()
+	fp := &flakyProvider{fakeProvider: newFakeProvider(t, answer), script: script}
+	working := fp.server.Config.Handler
+	fp.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp.mutex.Lock()
+		fp.requests++
+		var fail http.HandlerFunc
+		if len(fp.script) > 0 {
+			fail, fp.script = fp.script[0], fp.script[1:]
+		}
+		fp.mutex.Unlock()
+
+		if fail != nil {
+			fail(w, r)
+			return
+		}
+		working.ServeHTTP(w, r)
+	})
+	return fp
+}
+
+func (fp *flakyProvider) Attempts() int {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	return fp.requests
+}
+
+// failWith answers with an API error, setting the given headers first
+func failWith(status int, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error":{"message":"%s","type":"server_error"}}`, http.StatusText(status))
+	}
+}
+
+// hang never answers, until the client gives up. The body has to be read for
+// the server to notice the client closing the connection.
+func hang(_ http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+	<-r.Context().Done()
+}
+
+func testRetryPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// recordDelays makes the retrier skip its waits and record them instead, with
+// jitter disabled so backoff is predictable
+func recordDelays(r *retrier) *[]time.Duration {
+	var delays []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	r.jitter = func(d time.Duration) time.Duration { return d }
+	return &delays
+}
+
+func newRetryingEmbedder(provider *flakyProvider, policy RetryPolicy, limiter *ratelimit.Limiter) *RetryingEmbeddingCreator {
+	client := newProviderClient(config.ProviderConfig{BaseURL: provider.URL(), APIKey: "key"})
+	return NewRetryingEmbeddingCreator(&client.Embeddings, policy, limiter)
+}
+
+func newRetryingChat(provider *flakyProvider, policy RetryPolicy) *RetryingChatCompleter {
+	client := newProviderClient(config.ProviderConfig{BaseURL: provider.URL(), APIKey: "key"})
+	return NewRetryingChatCompleter(&chatCompletionsAdapter{inner: &client.Chat.Completions}, policy, nil)
+}
+
+func embeddingParams(texts ...string) openai.EmbeddingNewParams {
+	return openai.EmbeddingNewParams{
+		Model: "embed",
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+	}
+}
+
+func chatParams() openai.ChatCompletionNewParams {
+	return openai.ChatCompletionNewParams{
+		Model:    "chat",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hello")},
+	}
+}
+
+func TestRetryingEmbeddingCreator(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       []http.HandlerFunc
+		maxAttempts  int
+		wantAttempts int
+		wantDelays   []time.Duration
+		wantErr      string
+	}{
+		{
+			name:         "succeeds first time",
+			maxAttempts:  3,
+			wantAttempts: 1,
+		},
+		{
+			name:         "backs off exponentially on server errors",
+			script:       []http.HandlerFunc{failWith(500), failWith(502), failWith(503)},
+			maxAttempts:  4,
+			wantAttempts: 4,
+			wantDelays:   []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond},
+		},
+		{
+			name:         "honours Retry-After in seconds",
+			script:       []http.HandlerFunc{failWith(429, "Retry-After", "2")},
+			maxAttempts:  3,
+			wantAttempts: 2,
+			wantDelays:   []time.Duration{2 * time.Second},
+		},
+		{
+			name:         "prefers retry-after-ms",
+			script:       []http.HandlerFunc{failWith(429, "Retry-After", "2", "Retry-After-Ms", "1500")},
+			maxAttempts:  3,
+			wantAttempts: 2,
+			wantDelays:   []time.Duration{1500 * time.Millisecond},
+		},
+		{
+			name:         "gives up when Retry-After exceeds the longest delay",
+			script:       []http.HandlerFunc{failWith(429, "Retry-After", "60")},
+			maxAttempts:  3,
+			wantAttempts: 1,
+			wantErr:      "429 Too Many Requests",
+		},
+		{
+			name:         "gives up after the last attempt",
+			script:       []http.HandlerFunc{failWith(500), failWith(500), failWith(500)},
+			maxAttempts:  2,
+			wantAttempts: 2,
+			wantDelays:   []time.Duration{10 * time.Millisecond},
+			wantErr:      "500 Internal Server Error",
+		},
+		{
+			name:         "does not retry client errors",
+			script:       []http.HandlerFunc{failWith(400)},
+			maxAttempts:  3,
+			wantAttempts: 1,
+			wantErr:      "400 Bad Request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newFlakyProvider(t, "", tt.script...)
+			embedder := newRetryingEmbedder(provider, testRetryPolicy(tt.maxAttempts), nil)
+			delays := recordDelays(&embedder.retrier)
+
+			response, err := embedder.New(context.Background(), embeddingParams("abc"))
+
+			assert.Equal(t, tt.wantAttempts, provider.Attempts())
+			assert.Equal(t, tt.wantDelays, *delays)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, response.Data, 1)
+			assert.Equal(t, fakeEmbedding("abc"), response.Data[0].Embedding)
+		})
+	}
+}
+
+func TestRetryingEmbeddingCreator_RetriesTimedOutAttempts(t *testing.T) {
+	provider := newFlakyProvider(t, "", hang)
+	policy := testRetryPolicy(2)
+	policy.AttemptTimeout = 50 * time.Millisecond
+	embedder := newRetryingEmbedder(provider, policy, nil)
+	recordDelays(&embedder.retrier)
+
+	response, err := embedder.New(context.Background(), embeddingParams("abc"))
+
+	require.NoError(t, err)
+	assert.Len(t, response.Data, 1)
+	assert.Equal(t, 2, provider.Attempts())
+}
+
+func TestRetryingEmbeddingCreator_StopsWhenCallerGivesUp(t *testing.T) {
+	provider := newFlakyProvider(t, "", failWith(503), failWith(503))
+	embedder := newRetryingEmbedder(provider, testRetryPolicy(5), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	embedder.retrier.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return context.Canceled
+	}
+
+	_, err := embedder.New(ctx, embeddingParams("abc"))
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, provider.Attempts())
+}
+
+func TestRetryingEmbeddingCreator_RateLimited(t *testing.T) {
+	provider := newFlakyProvider(t, "")
+	embedder := newRetryingEmbedder(provider, testRetryPolicy(1), ratelimit.NewLimiter(1, 0))
+
+	_, err := embedder.New(context.Background(), embeddingParams("abc"))
+	require.NoError(t, err)
+
+	// The next request has to wait a minute for the bucket to refill
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = embedder.New(ctx, embeddingParams("def"))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, provider.Attempts())
+}
+
+func TestRetryingChatCompleter_New(t *testing.T) {
+	provider := newFlakyProvider(t, "Hello there.", failWith(502))
+	chat := newRetryingChat(provider, testRetryPolicy(3))
+	recordDelays(&chat.retrier)
+
+	completion, err := chat.New(context.Background(), chatParams())
+
+	require.NoError(t, err)
+	assert.Equal(t, "Hello there.", completion.Choices[0].Message.Content)
+	assert.Equal(t, 2, provider.Attempts())
+}
+
+func TestRetryingChatCompleter_NewStreamingIter(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       []http.HandlerFunc
+		maxAttempts  int
+		timeout      time.Duration
+		wantAttempts int
+		wantErr      string
+	}{
+		{
+			name:         "retries until the stream opens",
+			script:       []http.HandlerFunc{failWith(503), failWith(429, "Retry-After", "1")},
+			maxAttempts:  3,
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries a stream that never sends its first chunk",
+			script:       []http.HandlerFunc{hang},
+			maxAttempts:  2,
+			timeout:      50 * time.Millisecond,
+			wantAttempts: 2,
+		},
+		{
+			name:         "reports the last failure",
+			script:       []http.HandlerFunc{failWith(503), failWith(503)},
+			maxAttempts:  2,
+			wantAttempts: 2,
+			wantErr:      "503 Service Unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newFlakyProvider(t, "Hello there.", tt.script...)
+			policy := testRetryPolicy(tt.maxAttempts)
+			policy.AttemptTimeout = tt.timeout
+			chat := newRetryingChat(provider, policy)
+			recordDelays(&chat.retrier)
+
+			stream := chat.NewStreamingIter(context.Background(), chatParams())
+			var answer strings.Builder
+			for stream.Next() {
+				for _, choice := range stream.Current().Choices {
+					answer.WriteString(choice.Delta.Content)
+				}
+			}
+			require.NoError(t, stream.Close())
+
+			assert.Equal(t, tt.wantAttempts, provider.Attempts())
+			if tt.wantErr != "" {
+				require.Error(t, stream.Err())
+				assert.Contains(t, stream.Err().Error(), tt.wantErr)
+				assert.Empty(t, answer.String())
+				return
+			}
+			require.NoError(t, stream.Err())
+			assert.Equal(t, "Hello there.", answer.String())
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "absent", header: http.Header{}, want: 0},
+		{name: "seconds", header: http.Header{"Retry-After": {"3"}}, want: 3 * time.Second},
+		{name: "fractional seconds", header: http.Header{"Retry-After": {"0.5"}}, want: 500 * time.Millisecond},
+		{name: "milliseconds", header: http.Header{"Retry-After-Ms": {"250"}}, want: 250 * time.Millisecond},
+		{name: "HTTP date", header: http.Header{"Retry-After": {now.Add(7 * time.Second).Format(http.TimeFormat)}}, want: 7 * time.Second},
+		{name: "date in the past", header: http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, want: 0},
+		{name: "garbage", header: http.Header{"Retry-After": {"soon"}}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryAfter(tt.header, now))
+		})
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	policy := NewRetryPolicy(config.ProviderConfig{MaxRetries: 3, RequestTimeout: time.Minute})
+
+	assert.Equal(t, RetryPolicy{
+		MaxAttempts:    4,
+		BaseDelay:      retryBaseDelay,
+		MaxDelay:       retryMaxDelay,
+		AttemptTimeout: time.Minute,
+	}, policy)
+}
@@ -1,84 +1,273 @@
 package services
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
 	"rag-backend/internal/repositories/vectorstore"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 
 	"rag-backend/internal/config"
+	"rag-backend/internal/repositories/embeddingcache"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/ratelimit"
+	"rag-backend/pkg/similarity"
+	"rag-backend/pkg/tokenizer"
 	"rag-backend/pkg/types"
 	"rag-backend/pkg/utils"
 )
 
 const (
-	defaultConfidence = 0.8
+	// Chunk sizes used when none are configured, in runes and in tokens. A
+	// token is about four characters of English.
 	chunkSize         = 1000
 	chunkOverlap      = 200
-	maxContentChunks  = 4
-	maxBatchSize      = 40
-	maxConcurrency    = 5
+	tokenChunkSize    = 250
+	tokenChunkOverlap = 50
+
+	maxBatchSize   = 40
+	maxConcurrency = 5
+
+	// contextCandidates is how many chunks are retrieved for the context to
+	// be packed from
+	contextCandidates = 20
+
+	// hybridCandidates is how deep each ranking is read before fusion
+	hybridCandidates     = 20
+	defaultKeywordWeight = 0.5
+	// mmrCandidates is how many chunks MMR chooses from by default
+	mmrCandidates = 20
 )
 
 type RAGPipeline struct {
 	config           *config.Config
 	embeddingCreator EmbeddingCreator
-	chatCompleter    ChatCompletionCreator
-	vectorStore      vectorstore.VectorStore
-	textSplitter     *utils.TextSplitter
-	mutex            sync.RWMutex
+	// embeddingCache is the embeddingCreator when embeddings are cached
+	embeddingCache  *CachingEmbeddingCreator
+	chatCompleter   ChatCompletionCreator
+	vectorStore     vectorstore.VectorStore
+	keywordSearcher vectorstore.KeywordSearcher
+	// dimensioner reports the store's embedding dimension, nil when the store
+	// can't tell
+	dimensioner vectorstore.Dimensioner
+	// reranker reorders retrieved chunks, nil when reranking is off
+	reranker      Reranker
+	conversations *ConversationHistory
+	textSplitter  *utils.TextSplitter
+	mutex         sync.RWMutex
 }
 
-func NewRAGPipeline(cfg *config.Config, vectorStore vectorstore.VectorStore) *RAGPipeline {
-	openaiClient := openai.NewClient(option.WithAPIKey(cfg.OpenAIAPIKey))
-	deepseekClient := openai.NewClient(
-		option.WithAPIKey(cfg.DeepSeekAPIKey),
-		option.WithBaseURL("https://api.deepseek.com/v1"),
+// NewRAGPipeline builds the pipeline. Embeddings are cached in cacheTiers,
+// fastest first, when any are given.
+func NewRAGPipeline(cfg *config.Config, vectorStore vectorstore.VectorStore, conversations *ConversationHistory, cacheTiers ...embeddingcache.EmbeddingCache) *RAGPipeline {
+	embeddingClient := newProviderClient(cfg.Embedding)
+	chatClient := newProviderClient(cfg.Chat)
+	// Keyword and hybrid retrieval are only available when the store keeps a
+	// lexical index alongside the vectors
+	keywordSearcher, _ := vectorStore.(vectorstore.KeywordSearcher)
+	dimensioner, _ := vectorStore.(vectorstore.Dimensioner)
+
+	rp := &RAGPipeline{
+		config: cfg,
+		embeddingCreator: NewRetryingEmbeddingCreator(&embeddingClient.Embeddings, NewRetryPolicy(cfg.Embedding),
+			ratelimit.NewLimiter(cfg.Embedding.RequestsPerMinute, cfg.Embedding.TokensPerMinute)),
+		chatCompleter: NewRetryingChatCompleter(&chatCompletionsAdapter{inner: &chatClient.Chat.Completions}, NewRetryPolicy(cfg.Chat),
+			ratelimit.NewLimiter(cfg.Chat.RequestsPerMinute, cfg.Chat.TokensPerMinute)),
+		vectorStore:     vectorStore,
+		keywordSearcher: keywordSearcher,
+		dimensioner:     dimensioner,
+		conversations:   conversations,
+		textSplitter:    newTextSplitter(cfg),
+	}
+	if len(cacheTiers) > 0 {
+		rp.embeddingCache = NewCachingEmbeddingCreator(rp.embeddingCreator, cfg.Embedding.BaseURL, cacheTiers...)
+		rp.embeddingCreator = rp.embeddingCache
+	}
+	rp.reranker = newReranker(cfg, rp.chatCompleter)
+	return rp
+}
+
+// EmbeddingCacheStats reports the embedding cache's hit and miss counts, or
+// false when embeddings are not cached.
+func (rp *RAGPipeline) EmbeddingCacheStats() (types.EmbeddingCacheStats, bool) {
+	if rp.embeddingCache == nil {
+		return types.EmbeddingCacheStats{}, false
+	}
+	return rp.embeddingCache.Stats(), true
+}
+
+// newTextSplitter builds the splitter for the configured chunk mode
+func newTextSplitter(cfg *config.Config) *utils.TextSplitter {
+	size, overlap := cfg.ChunkSize, cfg.ChunkOverlap
+	if cfg.ChunkMode == config.ChunkModeTokens {
+		if size == 0 {
+			size, overlap = tokenChunkSize, tokenChunkOverlap
+		}
+		return utils.NewTokenTextSplitter(size, overlap, tokenizer.Compact())
+	}
+	if size == 0 {
+		size, overlap = chunkSize, chunkOverlap
+	}
+	return utils.NewTextSplitter(size, overlap)
+}
+
+// newProviderClient builds an OpenAI SDK client for any OpenAI-compatible API.
+// The base URL is always set explicitly so the SDK's OPENAI_BASE_URL
+// environment default can't redirect one role to another provider. The SDK's
+// own retries are off; RetryPolicy handles them so they are rate limited too.
+func newProviderClient(provider config.ProviderConfig) openai.Client {
+	return openai.NewClient(
+		option.WithAPIKey(provider.APIKey),
+		option.WithBaseURL(provider.BaseURL),
+		option.WithMaxRetries(0),
 	)
-	return &RAGPipeline{
-		config:           cfg,
-		embeddingCreator: &openaiClient.Embeddings,
-		chatCompleter:    &chatCompletionsAdapter{inner: &deepseekClient.Chat.Completions},
-		vectorStore:      vectorStore,
-		textSplitter:     utils.NewTextSplitter(chunkSize, chunkOverlap),
+}
+
+// EmbeddingProgress is told how many of a document's chunks have been
+// embedded so far
+type EmbeddingProgress func(embedded, total int)
+
+func (p EmbeddingProgress) report(embedded, total int) {
+	if p != nil {
+		p(embedded, total)
 	}
 }
 
-func (rp *RAGPipeline) ProcessDocument(content string, metadata map[string]string) ([]types.DocumentChunk, error) {
-	textChunks := rp.textSplitter.SplitText(content)
+// errNoDocuments is returned by selectChunks when nothing is indexed in the
+// request's collections that matches its filter
+var errNoDocuments = errors.New("no documents to search")
+
+// structuredContentTypes are the file types whose extracted text is Markdown,
+// headings and all, so they can be split by section
+var structuredContentTypes = []string{"text/markdown", "text/x-markdown", "text/html", "application/xhtml+xml", docxContentType}
+
+// ProcessDocument splits a file's text into embedded chunks for the given
+// collection. Chunk IDs are prefixed with the collection so the same file can
+// be uploaded to several collections without ID clashes. progress may be nil.
+//
+// Markdown, HTML and DOCX files are split by section. Each of their chunks
+// records its heading path in the "section" metadata, and the path is
+// embedded along with the chunk so a passage matches questions about the
+// section it is in. Chunks of files with pages record the pages they span in
+// "page_start" and "page_end".
+func (rp *RAGPipeline) ProcessDocument(ctx context.Context, file types.ExtractedFile, collection string, metadata map[string]string, progress EmbeddingProgress) ([]types.DocumentChunk, error) {
+	fileChunks := rp.splitFile(file, metadata)
+	if len(fileChunks) == 0 {
+		return nil, fmt.Errorf("document has no text to index")
+	}
+	progress.report(0, len(fileChunks))
+
+	texts := make([]string, len(fileChunks))
+	for i, fileChunk := range fileChunks {
+		texts[i] = fileChunk.embeddingText
+	}
 
 	var embeddings [][]float64
 	var err error
 
-	if len(textChunks) > maxBatchSize {
+	if len(texts) > maxBatchSize {
 		// Use parallel batch processing for large documents
-		embeddings, err = rp.generateEmbeddingParallel(textChunks)
+		embeddings, err = rp.generateEmbeddingParallel(ctx, texts, progress)
 	} else {
 		// Use single batch processing for small documents
-		embeddings, err = rp.generateEmbeddingBatch(textChunks)
+		embeddings, err = rp.generateEmbeddingBatch(ctx, texts)
+		if err == nil {
+			progress.report(len(texts), len(texts))
+		}
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
 	}
 
-	chunks := make([]types.DocumentChunk, len(textChunks))
-	for i, textChunk := range textChunks {
+	chunks := make([]types.DocumentChunk, len(fileChunks))
+	for i, fileChunk := range fileChunks {
 		chunks[i] = types.DocumentChunk{
-			ID:        fmt.Sprintf("%s-chunk-%d", metadata["source"], i),
-			Content:   textChunk,
-			Embedding: embeddings[i],
-			Metadata:  metadata,
+			ID:         fmt.Sprintf("%s/%s-chunk-%d", collection, metadata["source"], i),
+			Collection: collection,
+			Content:    fileChunk.content,
+			Embedding:  embeddings[i],
+			Metadata:   fileChunk.metadata,
 		}
 	}
 
 	return chunks, nil
 }
 
+// fileChunk is a chunk of a file before it is embedded
+type fileChunk struct {
+	content string
+	// embeddingText is the content, after the section path if it has one
+	embeddingText string
+	metadata      map[string]string
+}
+
+// splitFile splits a file's text into chunks, adding what each chunk's
+// position in the file says about it to a copy of metadata. Chunks share
+// metadata when there is nothing to add.
+func (rp *RAGPipeline) splitFile(file types.ExtractedFile, metadata map[string]string) []fileChunk {
+	var fileChunks []fileChunk
+
+	if slices.Contains(structuredContentTypes, file.ContentType) {
+		for _, chunk := range rp.textSplitter.SplitMarkdown(file.Content) {
+			section := chunk.Section()
+			if section == "" {
+				fileChunks = append(fileChunks, fileChunk{content: chunk.Content, embeddingText: chunk.Content, metadata: metadata})
+				continue
+			}
+			fileChunks = append(fileChunks, fileChunk{
+				content:       chunk.Content,
+				embeddingText: section + "\n\n" + chunk.Content,
+				metadata:      withMetadata(metadata, "section", section),
+			})
+		}
+		return fileChunks
+	}
+
+	for _, chunk := range rp.textSplitter.SplitTextWithOffsets(file.Content) {
+		chunkMetadata := metadata
+		if len(file.Pages) > 0 {
+			chunkMetadata = withMetadata(metadata,
+				"page_start", strconv.Itoa(pageAt(file.Pages, chunk.Start)),
+				"page_end", strconv.Itoa(pageAt(file.Pages, chunk.End-1)))
+		}
+		fileChunks = append(fileChunks, fileChunk{content: chunk.Content, embeddingText: chunk.Content, metadata: chunkMetadata})
+	}
+	return fileChunks
+}
+
+// withMetadata returns a copy of metadata with the given key and value pairs
+// set
+func withMetadata(metadata map[string]string, keyValues ...string) map[string]string {
+	copied := make(map[string]string, len(metadata)+len(keyValues)/2)
+	maps.Copy(copied, metadata)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		copied[keyValues[i]] = keyValues[i+1]
+	}
+	return copied
+}
+
+// pageAt returns the number of the page the byte offset falls on
+func pageAt(pages []types.PageOffset, offset int) int {
+	i, _ := slices.BinarySearchFunc(pages, offset, func(page types.PageOffset, offset int) int {
+		return cmp.Compare(page.Offset, offset)
+	})
+	if i == len(pages) || pages[i].Offset > offset {
+		i--
+	}
+	return pages[max(i, 0)].Page
+}
+
 func (rp *RAGPipeline) AddDocumentToVectorStore(chunks []types.DocumentChunk) error {
 	if err := rp.vectorStore.Store(chunks); err != nil {
 		return fmt.Errorf("failed to store chunks: %w", err)
@@ -86,50 +275,332 @@ func (rp *RAGPipeline) AddDocumentToVectorStore(chunks []types.DocumentChunk) er
 	return nil
 }
 
+// StreamEvent is one step of a streamed answer. The first event carries the
+// sources with a retrieval-only confidence. Once the answer is complete a
+// citations event carries the validated answer and its citations, and the
+// Done event carries the final confidence, which also accounts for the answer.
+// A question without relevant context gets a single NoAnswer event with the
+// reply as Answer instead.
 type StreamEvent struct {
-	Sources    []types.DocumentChunk
-	Confidence float64
-	Token      string
-	Err        error
-	Done       bool
+	Sources            []types.DocumentChunk
+	SourceScores       []float64
+	DroppedChunks      []string
+	Confidence         float64
+	ConversationID     string
+	StandaloneQuestion string
+	Token              string
+	Answer             string
+	Citations          []types.Citation
+	InvalidCitations   []int
+	NoAnswerCode       string
+	Err                error
+	Done               bool
 }
 
-func (rp *RAGPipeline) QueryStream(ctx context.Context, question string) (<-chan StreamEvent, error) {
-	relevantDocs, contextInfo, err := rp.retrieveContext(question)
+// queryTurn is one question resolved against its conversation, ready for the
+// completion call.
+type queryTurn struct {
+	conversationID     string
+	history            []types.ChatMessage
+	question           string
+	standaloneQuestion string
+	sources            []types.DocumentChunk
+	sourceScores       []float64
+	contextInfo        string
+	// droppedChunks are the IDs of retrieved chunks that did not fit in the
+	// context
+	droppedChunks []string
+	// noAnswerCode says why there is no context to answer from, if there is
+	// none
+	noAnswerCode string
+}
+
+func (rp *RAGPipeline) QueryStream(ctx context.Context, request types.QueryRequest) (<-chan StreamEvent, error) {
+	turn, err := rp.prepareTurn(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
 	events := make(chan StreamEvent)
-	go rp.streamCompletion(ctx, relevantDocs, contextInfo, question, events)
+	if turn.noAnswerCode != "" {
+		go rp.streamNoAnswer(ctx, turn, events)
+		return events, nil
+	}
+	go rp.streamCompletion(ctx, turn, events)
 	return events, nil
 }
 
-func (rp *RAGPipeline) retrieveContext(question string) ([]types.DocumentChunk, string, error) {
-	queryEmbedding, err := rp.generateEmbedding(question)
+// prepareTurn loads the conversation history, rewrites a follow-up into a
+// standalone question and retrieves context for it. Requests without a
+// conversation ID start a new conversation.
+func (rp *RAGPipeline) prepareTurn(ctx context.Context, request types.QueryRequest) (*queryTurn, error) {
+	turn := &queryTurn{
+		conversationID:     request.ConversationID,
+		question:           request.Question,
+		standaloneQuestion: request.Question,
+	}
+
+	if turn.conversationID == "" {
+		turn.conversationID = uuid.New().String()
+	} else {
+		history, err := rp.conversations.RecentMessages(turn.conversationID)
+		if err != nil {
+			return nil, err
+		}
+		turn.history = history
+
+		turn.standaloneQuestion, err = rp.condenseQuestion(ctx, history, request.Question)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Retrieval only sees the standalone question; a follow-up such as "what
+	// about the second one?" has nothing to match on by itself
+	request.Question = turn.standaloneQuestion
+	packed, err := rp.retrieveContext(ctx, request, rp.contextBudget(turn.history, turn.question))
+	if err != nil {
+		return nil, err
+	}
+	turn.sources = make([]types.DocumentChunk, len(packed.passages))
+	for i, scored := range packed.passages {
+		turn.sources[i] = scored.Chunk
+	}
+	turn.sourceScores = relevanceScores(rp.scoreMode(request.Mode), packed.passages)
+	turn.contextInfo = packed.text
+	turn.droppedChunks = packed.dropped
+	turn.noAnswerCode = packed.noAnswerCode
+	return turn, nil
+}
+
+// condenseQuestion asks the chat model to rewrite a follow-up question so it
+// can be understood without the conversation. It returns the question
+// unchanged when there is no history or the model replies with nothing.
+func (rp *RAGPipeline) condenseQuestion(ctx context.Context, history []types.ChatMessage, question string) (string, error) {
+	if len(history) == 0 {
+		return question, nil
+	}
+
+	completion, err := rp.chatCompleter.New(ctx, rp.chatCompletionParams(nil, buildCondensePrompt(history, question)))
+	if err != nil {
+		return "", fmt.Errorf("failed to condense question: %w", err)
+	}
+
+	if len(completion.Choices) == 0 {
+		return question, nil
+	}
+	if standalone := strings.TrimSpace(completion.Choices[0].Message.Content); standalone != "" {
+		return standalone, nil
+	}
+	return question, nil
+}
+
+// retrieveContext retrieves chunks for the question and packs the most
+// relevant ones into a context of at most budget tokens. An empty context
+// comes with the code saying why it is empty.
+func (rp *RAGPipeline) retrieveContext(ctx context.Context, request types.QueryRequest, budget int) (packedContext, error) {
+	scoredChunks, err := rp.selectChunks(ctx, request)
+	if errors.Is(err, errNoDocuments) {
+		return packedContext{passages: []types.ScoredChunk{}, noAnswerCode: codes.NoDocuments}, nil
+	}
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate embedding for query: %w", err)
+		return packedContext{}, err
 	}
 
-	scoredChunks, err := rp.vectorStore.Search(queryEmbedding, maxContentChunks)
+	packed := packContext(scoredChunks, budget, tokenizer.Compact().Count)
+	if len(packed.passages) == 0 {
+		packed.noAnswerCode = codes.NoRelevantContext
+	}
+	return packed, nil
+}
+
+// contextBudget is how many tokens the context may take: the configured
+// budget, or less if the rest of the prompt, the conversation history and
+// the room kept for the answer leave less of the chat model's window.
+// Tokens are counted with the compact bundled tokenizer, which only roughly
+// matches the chat model's own.
+func (rp *RAGPipeline) contextBudget(history []types.ChatMessage, question string) int {
+	count := tokenizer.Compact().Count
+	used := rp.config.AnswerTokenReserve + count(buildPrompt("", question)) + messageTokenOverhead
+	for _, message := range history {
+		used += count(message.Content) + messageTokenOverhead
+	}
+	return max(0, min(rp.config.ContextTokenBudget, rp.config.ContextWindow-used))
+}
+
+// selectChunks ranks the candidates for the context, most relevant first,
+// leaving out those less relevant than MinSimilarity. It returns
+// errNoDocuments when there is nothing in the request's scope to search. A
+// reranker is given more candidates to reorder, and drops those it scores
+// too low. MMR is given its own number of candidates, or chooses among those
+// the reranker kept, and reorders them so the ones that best cover the
+// question without repeating each other come first, since overlapping
+// neighbouring chunks otherwise often fill the whole context.
+func (rp *RAGPipeline) selectChunks(ctx context.Context, request types.QueryRequest) ([]types.ScoredChunk, error) {
+	depth := contextCandidates
+	if request.MMRLambda != nil {
+		depth = mmrCandidates
+		if request.MMRCandidates > 0 {
+			depth = request.MMRCandidates
+		}
+	}
+	if rp.reranker != nil {
+		depth = max(depth, rp.config.RerankCandidates)
+	}
+
+	scoredChunks, relevance, err := rp.searchChunks(request, depth)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to search vector store: %w", err)
+		return nil, err
+	}
+	// Vector search returns the nearest chunks however far away they are, so
+	// it only finds nothing when there is nothing to search. Keyword search
+	// also finds nothing when no chunk shares a word with the question.
+	if len(scoredChunks) == 0 && request.Mode != types.RetrievalModeKeyword {
+		return nil, errNoDocuments
 	}
 
-	var contextBuilder strings.Builder
-	relevantDocs := make([]types.DocumentChunk, len(scoredChunks))
+	if rp.reranker != nil {
+		scoredChunks = rp.rerank(ctx, request.Question, scoredChunks)
+		relevance = relevanceScores(rp.scoreMode(request.Mode), scoredChunks)
+	}
+	relevant := make([]types.ScoredChunk, 0, len(scoredChunks))
 	for i, scored := range scoredChunks {
-		if i > 0 {
-			contextBuilder.WriteString("\n\n")
+		if relevance[i] >= rp.config.MinSimilarity {
+			relevant = append(relevant, scored)
 		}
-		contextBuilder.WriteString(scored.Chunk.Content)
-		relevantDocs[i] = scored.Chunk
 	}
 
-	return relevantDocs, contextBuilder.String(), nil
+	if request.MMRLambda != nil {
+		return similarity.MaximalMarginalRelevance(relevant, *request.MMRLambda, len(relevant)), nil
+	}
+	return relevant, nil
 }
 
-func (rp *RAGPipeline) streamCompletion(ctx context.Context, sources []types.DocumentChunk, contextInfo, question string, events chan<- StreamEvent) {
+// scoreMode is the retrieval mode whose scale chunk scores are on. Rerank
+// scores are in [0, 1] already, whatever the retrieval mode.
+func (rp *RAGPipeline) scoreMode(mode string) string {
+	if rp.reranker != nil {
+		return types.RetrievalModeVector
+	}
+	return mode
+}
+
+// rerank reorders candidates with the configured reranker and drops those
+// scored below the minimum. A failed rerank is logged and falls back to
+// lexical overlap rather than failing the query.
+func (rp *RAGPipeline) rerank(ctx context.Context, question string, candidates []types.ScoredChunk) []types.ScoredChunk {
+	reranked, err := rp.reranker.Rerank(ctx, question, candidates)
+	if err != nil {
+		log.Printf("Reranking with %s failed, falling back to lexical overlap: %v", rp.config.Reranker, err)
+		reranked, _ = LexicalReranker{}.Rerank(ctx, question, candidates)
+	}
+	return slices.DeleteFunc(reranked, func(scored types.ScoredChunk) bool {
+		return scored.Score < rp.config.RerankMinScore
+	})
+}
+
+// searchChunks ranks up to limit chunks for the question using the request's
+// retrieval mode. It also returns each chunk's relevance, in [0, 1], for the
+// MinSimilarity threshold. Fused hybrid scores only reflect ranks, so a
+// hybrid result is as relevant as its vector or keyword hit, whichever is
+// more: a chunk ranked first is not relevant if nothing was.
+func (rp *RAGPipeline) searchChunks(request types.QueryRequest, limit int) ([]types.ScoredChunk, []float64, error) {
+	options := searchOptions(request)
+
+	switch request.Mode {
+	case "", types.RetrievalModeVector:
+		results, err := rp.vectorSearch(request.Question, limit, options)
+		return results, relevanceScores(types.RetrievalModeVector, results), err
+	case types.RetrievalModeKeyword:
+		results, err := rp.keywordSearch(request.Question, limit, options)
+		return results, relevanceScores(types.RetrievalModeKeyword, results), err
+	case types.RetrievalModeHybrid:
+		depth := max(hybridCandidates, limit)
+		vectorResults, err := rp.vectorSearch(request.Question, depth, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		keywordResults, err := rp.keywordSearch(request.Question, depth, options)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		keywordWeight := defaultKeywordWeight
+		if request.KeywordWeight != nil {
+			keywordWeight = *request.KeywordWeight
+		}
+		fused := similarity.ReciprocalRankFusion(vectorResults, keywordResults, keywordWeight, limit)
+		return fused, hybridRelevance(fused, vectorResults, keywordResults), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown retrieval mode: %s", request.Mode)
+	}
+}
+
+// hybridRelevance returns the relevance of each fused result: the higher of
+// its cosine similarity and its keyword relevance, from the lists it was
+// fused from
+func hybridRelevance(fused, vectorResults, keywordResults []types.ScoredChunk) []float64 {
+	best := make(map[string]float64, len(vectorResults)+len(keywordResults))
+	for mode, results := range map[string][]types.ScoredChunk{
+		types.RetrievalModeVector:  vectorResults,
+		types.RetrievalModeKeyword: keywordResults,
+	} {
+		for i, relevance := range relevanceScores(mode, results) {
+			key := fusionKey(results[i].Chunk)
+			best[key] = max(best[key], relevance)
+		}
+	}
+
+	relevance := make([]float64, len(fused))
+	for i, scored := range fused {
+		relevance[i] = best[fusionKey(scored.Chunk)]
+	}
+	return relevance
+}
+
+// fusionKey identifies a chunk across result lists, as ReciprocalRankFusion
+// does
+func fusionKey(chunk types.DocumentChunk) string {
+	return chunk.DocumentID + "\x00" + chunk.ID
+}
+
+// searchOptions scopes retrieval to the request's collections and metadata
+// filter. Callers resolve the default collection; an empty scope here
+// searches everything.
+func searchOptions(request types.QueryRequest) types.SearchOptions {
+	collections := request.Collections
+	if request.Collection != "" && !slices.Contains(collections, request.Collection) {
+		collections = append(slices.Clone(collections), request.Collection)
+	}
+	return types.SearchOptions{Collections: collections, MetadataFilter: request.Filter}
+}
+
+func (rp *RAGPipeline) vectorSearch(question string, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	queryEmbedding, err := rp.generateEmbedding(question)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embedding for query: %w", err)
+	}
+
+	scoredChunks, err := rp.vectorStore.Search(queryEmbedding, limit, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vector store: %w", err)
+	}
+	return scoredChunks, nil
+}
+
+func (rp *RAGPipeline) keywordSearch(question string, limit int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+	if rp.keywordSearcher == nil {
+		return nil, fmt.Errorf("keyword search is not available for this vector store")
+	}
+
+	scoredChunks, err := rp.keywordSearcher.KeywordSearch(question, limit, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search keyword index: %w", err)
+	}
+	return scoredChunks, nil
+}
+
+func (rp *RAGPipeline) streamCompletion(ctx context.Context, turn *queryTurn, events chan<- StreamEvent) {
 	defer close(events)
 
 	send := func(ev StreamEvent) bool {
@@ -141,13 +612,21 @@ func (rp *RAGPipeline) streamCompletion(ctx context.Context, sources []types.Doc
 		}
 	}
 
-	if !send(StreamEvent{Sources: sources, Confidence: defaultConfidence}) {
+	if !send(StreamEvent{
+		Sources:            turn.sources,
+		SourceScores:       turn.sourceScores,
+		DroppedChunks:      turn.droppedChunks,
+		Confidence:         scoreConfidence(turn.sourceScores, "", turn.sources),
+		ConversationID:     turn.conversationID,
+		StandaloneQuestion: turn.condensedQuestion(),
+	}) {
 		return
 	}
 
-	stream := rp.chatCompleter.NewStreamingIter(ctx, chatCompletionParams(buildPrompt(contextInfo, question)))
+	stream := rp.chatCompleter.NewStreamingIter(ctx, rp.chatCompletionParams(turn.history, buildPrompt(turn.contextInfo, turn.question)))
 	defer stream.Close()
 
+	var answer strings.Builder
 	for stream.Next() {
 		chunk := stream.Current()
 		if len(chunk.Choices) == 0 {
@@ -157,6 +636,7 @@ func (rp *RAGPipeline) streamCompletion(ctx context.Context, sources []types.Doc
 		if content == "" {
 			continue
 		}
+		answer.WriteString(content)
 		if !send(StreamEvent{Token: content}) {
 			return
 		}
@@ -167,33 +647,124 @@ func (rp *RAGPipeline) streamCompletion(ctx context.Context, sources []types.Doc
 		return
 	}
 
-	send(StreamEvent{Done: true})
+	cited := parseCitations(answer.String(), turn.sources)
+
+	// Only completed answers join the history
+	if err := rp.conversations.RecordTurn(turn.conversationID, turn.question, stripCitations(cited.answer)); err != nil {
+		send(StreamEvent{Err: err})
+		return
+	}
+
+	// The streamed tokens may contain invalid markers, so send the cleaned answer
+	if !send(StreamEvent{Answer: cited.answer, Citations: cited.citations, InvalidCitations: cited.invalid}) {
+		return
+	}
+
+	send(StreamEvent{Done: true, Confidence: rp.answerConfidence(ctx, turn, cited.answer)})
+}
+
+// streamNoAnswer replies to a question without relevant context without
+// asking the chat model
+func (rp *RAGPipeline) streamNoAnswer(ctx context.Context, turn *queryTurn, events chan<- StreamEvent) {
+	defer close(events)
+
+	answer := noContextReply(turn.noAnswerCode)
+	event := StreamEvent{
+		NoAnswerCode:       turn.noAnswerCode,
+		Answer:             answer,
+		DroppedChunks:      turn.droppedChunks,
+		ConversationID:     turn.conversationID,
+		StandaloneQuestion: turn.condensedQuestion(),
+	}
+	if err := rp.conversations.RecordTurn(turn.conversationID, turn.question, answer); err != nil {
+		event = StreamEvent{Err: err}
+	}
+
+	select {
+	case <-ctx.Done():
+	case events <- event:
+	}
 }
 
-func (rp *RAGPipeline) Query(question string) (*types.RAGResponse, error) {
-	relevantDocs, contextInfo, err := rp.retrieveContext(question)
+func (rp *RAGPipeline) Query(request types.QueryRequest) (*types.RAGResponse, error) {
+	turn, err := rp.prepareTurn(context.TODO(), request)
 	if err != nil {
 		return nil, err
 	}
+	if turn.noAnswerCode != "" {
+		return rp.noAnswer(turn)
+	}
 
-	answer, err := rp.generateResponse(contextInfo, question)
+	answer, err := rp.generateResponse(turn.history, turn.contextInfo, turn.question)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
+	cited := parseCitations(answer, turn.sources)
+
+	// History keeps the answer without markers; their numbers only make sense
+	// next to this turn's sources
+	if err := rp.conversations.RecordTurn(turn.conversationID, turn.question, stripCitations(cited.answer)); err != nil {
+		return nil, err
+	}
 
 	return &types.RAGResponse{
-		Answer:     answer,
-		Sources:    relevantDocs,
-		Confidence: defaultConfidence, // Static confidence for now
+		Answer:             cited.answer,
+		Sources:            turn.sources,
+		SourceScores:       turn.sourceScores,
+		DroppedChunks:      turn.droppedChunks,
+		Citations:          cited.citations,
+		InvalidCitations:   cited.invalid,
+		Confidence:         rp.answerConfidence(context.TODO(), turn, cited.answer),
+		ConversationID:     turn.conversationID,
+		StandaloneQuestion: turn.condensedQuestion(),
 	}, nil
 }
 
+// noAnswer replies to a question without relevant context without asking
+// the chat model. The reply still joins the conversation, so a follow-up
+// knows the question went unanswered.
+func (rp *RAGPipeline) noAnswer(turn *queryTurn) (*types.RAGResponse, error) {
+	answer := noContextReply(turn.noAnswerCode)
+	if err := rp.conversations.RecordTurn(turn.conversationID, turn.question, answer); err != nil {
+		return nil, err
+	}
+
+	return &types.RAGResponse{
+		Answer:             answer,
+		Sources:            turn.sources,
+		SourceScores:       turn.sourceScores,
+		DroppedChunks:      turn.droppedChunks,
+		Citations:          []types.Citation{},
+		NoAnswer:           true,
+		NoAnswerCode:       turn.noAnswerCode,
+		ConversationID:     turn.conversationID,
+		StandaloneQuestion: turn.condensedQuestion(),
+	}, nil
+}
+
+// noContextReply is the answer to a question without relevant context
+func noContextReply(code string) string {
+	if code == codes.NoDocuments {
+		return noDocumentsReply
+	}
+	return noAnswerReply
+}
+
+// condensedQuestion returns the rewritten question, or "" when retrieval used
+// the question as asked.
+func (t *queryTurn) condensedQuestion() string {
+	if t.standaloneQuestion == t.question {
+		return ""
+	}
+	return t.standaloneQuestion
+}
+
 func (rp *RAGPipeline) generateEmbedding(text string) ([]float64, error) {
 	embedding, err := rp.embeddingCreator.New(context.TODO(), openai.EmbeddingNewParams{
 		Input: openai.EmbeddingNewParamsInputUnion{
 			OfString: openai.String(text),
 		},
-		Model: openai.EmbeddingModelTextEmbedding3Small,
+		Model: rp.config.Embedding.Model,
 	})
 	if err != nil {
 		return nil, err
@@ -212,16 +783,16 @@ func (rp *RAGPipeline) generateEmbedding(text string) ([]float64, error) {
 	return embedding64, nil
 }
 
-func (rp *RAGPipeline) generateEmbeddingBatch(texts []string) ([][]float64, error) {
+func (rp *RAGPipeline) generateEmbeddingBatch(ctx context.Context, texts []string) ([][]float64, error) {
 	if len(texts) == 0 {
 		return nil, fmt.Errorf("no texts provided for batch embedding")
 	}
 
-	embedding, err := rp.embeddingCreator.New(context.TODO(), openai.EmbeddingNewParams{
+	embedding, err := rp.embeddingCreator.New(ctx, openai.EmbeddingNewParams{
 		Input: openai.EmbeddingNewParamsInputUnion{
 			OfArrayOfStrings: texts,
 		},
-		Model: openai.EmbeddingModelTextEmbedding3Small,
+		Model: rp.config.Embedding.Model,
 	})
 	if err != nil {
 		return nil, err
@@ -245,7 +816,7 @@ func (rp *RAGPipeline) generateEmbeddingBatch(texts []string) ([][]float64, erro
 	return embeddings, nil
 }
 
-func (rp *RAGPipeline) generateEmbeddingParallel(texts []string) ([][]float64, error) {
+func (rp *RAGPipeline) generateEmbeddingParallel(ctx context.Context, texts []string, progress EmbeddingProgress) ([][]float64, error) {
 	// Split texts into batches of size equals to maxBatchSize
 	batches := make([][]string, 0)
 	for i := 0; i < len(texts); i += maxBatchSize {
@@ -272,10 +843,16 @@ func (rp *RAGPipeline) generateEmbeddingParallel(texts []string) ([][]float64, e
 		go func(idx int, textBatch []string) {
 			defer wg.Done()
 
-			semaphore <- struct{}{}
+			// Batches still waiting for a slot give up once the caller does
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				resultChan <- batchResult{index: idx, err: ctx.Err()}
+				return
+			}
 			defer func() { <-semaphore }()
 
-			embeddings, err := rp.generateEmbeddingBatch(textBatch)
+			embeddings, err := rp.generateEmbeddingBatch(ctx, textBatch)
 			resultChan <- batchResult{
 				index:      idx,
 				embeddings: embeddings,
@@ -284,16 +861,23 @@ func (rp *RAGPipeline) generateEmbeddingParallel(texts []string) ([][]float64, e
 		}(i, batch)
 	}
 
-	wg.Wait()
-	close(resultChan)
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
 
-	// Collect results in order
+	// Collect results as they arrive, reporting progress, then put them in
+	// order. The channel is buffered for every batch, so returning early
+	// leaves no goroutine blocked.
 	results := make([]batchResult, len(batches))
+	embedded := 0
 	for result := range resultChan {
 		if result.err != nil {
 			return nil, fmt.Errorf("failed to generate embeddings for batch %d: %w", result.index, result.err)
 		}
 		results[result.index] = result
+		embedded += len(result.embeddings)
+		progress.report(embedded, len(texts))
 	}
 
 	// Combine all embeddings in the correct order
@@ -311,27 +895,54 @@ func buildPrompt(contextInfo, question string) string {
 
 Question: %s
 
-Please answer the question based on the context provided. If the answer is not in the context, say "I don't have enough information to answer this question."`, contextInfo, question)
+Please answer the question based on the context provided. After each sentence, cite the numbered passages that support it in square brackets, for example [1] or [2, 3]. Only cite numbers that appear in the context. If the answer is not in the context, say "%s"`, contextInfo, question, noAnswerReply)
+}
+
+func buildCondensePrompt(history []types.ChatMessage, question string) string {
+	var transcript strings.Builder
+	for _, message := range history {
+		role := "User"
+		if message.Role == types.ChatRoleAssistant {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", role, message.Content)
+	}
+
+	return fmt.Sprintf(`Given the following conversation and a follow-up question, rephrase the follow-up question to be a standalone question that can be understood without the conversation. Keep the language of the follow-up question. Reply with the standalone question only.
+
+Conversation:
+%s
+Follow-up question: %s`, transcript.String(), question)
 }
 
-func chatCompletionParams(prompt string) openai.ChatCompletionNewParams {
+// chatCompletionParams sends the conversation history, oldest first, followed
+// by the prompt as the latest user message.
+func (rp *RAGPipeline) chatCompletionParams(history []types.ChatMessage, prompt string) openai.ChatCompletionNewParams {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(history)+1)
+	for _, message := range history {
+		if message.Role == types.ChatRoleAssistant {
+			messages = append(messages, openai.AssistantMessage(message.Content))
+		} else {
+			messages = append(messages, openai.UserMessage(message.Content))
+		}
+	}
+	messages = append(messages, openai.UserMessage(prompt))
+
 	return openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(prompt),
-		},
-		Model:       "deepseek-chat",
+		Messages:    messages,
+		Model:       rp.config.Chat.Model,
 		Temperature: openai.Float(0.0), // Deterministic: same question = same answer.
 	}
 }
 
-func (rp *RAGPipeline) generateResponse(contextInfo, question string) (string, error) {
-	completion, err := rp.chatCompleter.New(context.TODO(), chatCompletionParams(buildPrompt(contextInfo, question)))
+func (rp *RAGPipeline) generateResponse(history []types.ChatMessage, contextInfo, question string) (string, error) {
+	completion, err := rp.chatCompleter.New(context.TODO(), rp.chatCompletionParams(history, buildPrompt(contextInfo, question)))
 	if err != nil {
 		return "", fmt.Errorf("failed to generate response: %w", err)
 	}
 
 	if len(completion.Choices) == 0 {
-		return "", fmt.Errorf("no response from DeepSeek API")
+		return "", fmt.Errorf("no response from chat completion API")
 	}
 
 	return completion.Choices[0].Message.Content, nil
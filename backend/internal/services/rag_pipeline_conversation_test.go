@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/conversationstore"
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/types"
+)
+
+// conversationFixture records what the pipeline sent to the models during a
+// conversation test.
+type conversationFixture struct {
+	pipeline        *RAGPipeline
+	embeddedQueries []string
+	chatRequests    []openai.ChatCompletionNewParams
+	replies         []string
+}
+
+func newConversationFixture(t *testing.T, replies ...string) *conversationFixture {
+	t.Helper()
+	f := &conversationFixture{replies: replies}
+	ec := &mockEmbeddingCreator{
+		newFunc: func(_ context.Context, body openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			f.embeddedQueries = append(f.embeddedQueries, body.Input.OfString.Value)
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	cc := &mockChatCompleter{
+		newFunc: func(_ context.Context, body openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+			f.chatRequests = append(f.chatRequests, body)
+			require.NotEmpty(t, f.replies, "unexpected chat completion call")
+			reply := f.replies[0]
+			f.replies = f.replies[1:]
+			return makeChatCompletion(reply), nil
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
+			return []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "c", Content: "Ada Lovelace wrote the first program in 1843."}}}, nil
+		},
+	}
+	f.pipeline = newTestPipeline(ec, cc, vs)
+	return f
+}
+
+// messageTexts flattens chat messages to "role: content" for easy comparison.
+func messageTexts(messages []openai.ChatCompletionMessageParamUnion) []string {
+	texts := make([]string, len(messages))
+	for i, message := range messages {
+		switch {
+		case message.OfUser != nil:
+			texts[i] = "user: " + message.OfUser.Content.OfString.Value
+		case message.OfAssistant != nil:
+			texts[i] = "assistant: " + message.OfAssistant.Content.OfString.Value
+		}
+	}
+	return texts
+}
+
+func TestQuery_StartsConversation(t *testing.T) {
+	f := newConversationFixture(t, "Ada Lovelace.")
+
+	result, err := f.pipeline.Query(types.QueryRequest{Question: "Who wrote the first program?"})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.ConversationID)
+	assert.Empty(t, result.StandaloneQuestion, "first questions are not condensed")
+	assert.Equal(t, []string{"Who wrote the first program?"}, f.embeddedQueries)
+	require.Len(t, f.chatRequests, 1)
+	assert.Len(t, f.chatRequests[0].Messages, 1)
+
+	conversation, err := f.pipeline.conversations.GetConversation(result.ConversationID)
+	require.NoError(t, err)
+	assert.Equal(t, []types.ChatMessage{
+		{Role: types.ChatRoleUser, Content: "Who wrote the first program?"},
+		{Role: types.ChatRoleAssistant, Content: "Ada Lovelace."},
+	}, conversation.Messages)
+}
+
+func TestQuery_FollowUpUsesHistory(t *testing.T) {
+	f := newConversationFixture(t, "Ada Lovelace.", "  When did Ada Lovelace write the first program?\n", "In 1843.")
+
+	first, err := f.pipeline.Query(types.QueryRequest{Question: "Who wrote the first program?"})
+	require.NoError(t, err)
+
+	second, err := f.pipeline.Query(types.QueryRequest{Question: "When?", ConversationID: first.ConversationID})
+	require.NoError(t, err)
+
+	assert.Equal(t, first.ConversationID, second.ConversationID)
+	assert.Equal(t, "In 1843.", second.Answer)
+	assert.Equal(t, "When did Ada Lovelace write the first program?", second.StandaloneQuestion)
+	assert.Equal(t, []string{"Who wrote the first program?", "When did Ada Lovelace write the first program?"}, f.embeddedQueries,
+		"retrieval must use the condensed question")
+
+	require.Len(t, f.chatRequests, 3)
+	condense := messageTexts(f.chatRequests[1].Messages)
+	require.Len(t, condense, 1)
+	assert.Contains(t, condense[0], "User: Who wrote the first program?\nAssistant: Ada Lovelace.\n")
+	assert.Contains(t, condense[0], "Follow-up question: When?")
+
+	answer := messageTexts(f.chatRequests[2].Messages)
+	require.Len(t, answer, 3)
+	assert.Equal(t, "user: Who wrote the first program?", answer[0])
+	assert.Equal(t, "assistant: Ada Lovelace.", answer[1])
+	assert.Contains(t, answer[2], "Question: When?")
+	assert.Contains(t, answer[2], "Ada Lovelace wrote the first program in 1843.")
+
+	conversation, err := f.pipeline.conversations.GetConversation(first.ConversationID)
+	require.NoError(t, err)
+	assert.Len(t, conversation.Messages, 4)
+}
+
+func TestQuery_EmptyCondensationFallsBackToQuestion(t *testing.T) {
+	f := newConversationFixture(t, "Ada Lovelace.", "   ", "In 1843.")
+
+	first, err := f.pipeline.Query(types.QueryRequest{Question: "Who wrote the first program?"})
+	require.NoError(t, err)
+	second, err := f.pipeline.Query(types.QueryRequest{Question: "When?", ConversationID: first.ConversationID})
+	require.NoError(t, err)
+
+	assert.Empty(t, second.StandaloneQuestion)
+	assert.Equal(t, "When?", f.embeddedQueries[1])
+}
+
+func TestQuery_ConversationErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		store    *conversationstore.MockConversationStore
+		chatErr  error
+		notFound bool
+		expected string
+	}{
+		{
+			name: "unknown conversation",
+			store: &conversationstore.MockConversationStore{
+				GetFunc: func(string) (types.Conversation, error) {
+					return types.Conversation{}, conversationstore.ErrConversationNotFound
+				},
+			},
+			notFound: true,
+			expected: "failed to load conversation",
+		},
+		{
+			name: "condensing fails",
+			store: &conversationstore.MockConversationStore{
+				GetFunc: func(id string) (types.Conversation, error) {
+					return types.Conversation{ID: id, Messages: makeHistory(1)}, nil
+				},
+			},
+			chatErr:  errors.New("model overloaded"),
+			expected: "failed to condense question: model overloaded",
+		},
+		{
+			name: "saving history fails",
+			store: &conversationstore.MockConversationStore{
+				GetFunc: func(id string) (types.Conversation, error) {
+					return types.Conversation{ID: id}, nil
+				},
+				AppendFunc: func(string, ...types.ChatMessage) error {
+					return errors.New("disk full")
+				},
+			},
+			expected: "failed to save conversation: disk full",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newConversationFixture(t, "answer")
+			f.pipeline.conversations = NewConversationHistory(tt.store)
+			if tt.chatErr != nil {
+				f.pipeline.chatCompleter = &mockChatCompleter{
+					newFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) (*openai.ChatCompletion, error) {
+						return nil, tt.chatErr
+					},
+				}
+			}
+
+			result, err := f.pipeline.Query(types.QueryRequest{Question: "When?", ConversationID: "c1"})
+
+			assert.Nil(t, result)
+			assert.ErrorContains(t, err, tt.expected)
+			assert.Equal(t, tt.notFound, errors.Is(err, ErrConversationNotFound))
+		})
+	}
+}
+
+func TestQueryStream_RecordsConversation(t *testing.T) {
+	f := newConversationFixture(t, "Ada Lovelace.", "When did Ada Lovelace write the first program?")
+	first, err := f.pipeline.Query(types.QueryRequest{Question: "Who wrote the first program?"})
+	require.NoError(t, err)
+
+	var streamed openai.ChatCompletionNewParams
+	f.pipeline.chatCompleter.(*mockChatCompleter).newStreamingFunc = func(_ context.Context, body openai.ChatCompletionNewParams, _ ...option.RequestOption) ChatStream {
+		streamed = body
+		return &mockChatStream{chunks: []openai.ChatCompletionChunk{makeChatCompletionChunk("In "), makeChatCompletionChunk("1843.")}}
+	}
+
+	events, err := f.pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "When?", ConversationID: first.ConversationID})
+	require.NoError(t, err)
+	received := drainEvents(t, events)
+
+	assert.Equal(t, first.ConversationID, received[0].ConversationID)
+	assert.Equal(t, "When did Ada Lovelace write the first program?", received[0].StandaloneQuestion)
+	assert.True(t, received[len(received)-1].Done)
+	assert.Len(t, streamed.Messages, 3, "history precedes the prompt")
+
+	conversation, err := f.pipeline.conversations.GetConversation(first.ConversationID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ChatMessage{Role: types.ChatRoleAssistant, Content: "In 1843."}, conversation.Messages[3])
+}
+
+func TestQueryStream_ConversationErrors(t *testing.T) {
+	t.Run("failed stream is not recorded", func(t *testing.T) {
+		f := newConversationFixture(t)
+		f.pipeline.chatCompleter.(*mockChatCompleter).newStreamingFunc = func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) ChatStream {
+			return &mockChatStream{err: errors.New("disconnected")}
+		}
+
+		events, err := f.pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
+		require.NoError(t, err)
+		received := drainEvents(t, events)
+
+		assert.Error(t, received[len(received)-1].Err)
+		_, err = f.pipeline.conversations.GetConversation(received[0].ConversationID)
+		assert.ErrorIs(t, err, ErrConversationNotFound)
+	})
+
+	t.Run("save failure ends the stream with an error", func(t *testing.T) {
+		f := newConversationFixture(t)
+		f.pipeline.conversations = NewConversationHistory(&conversationstore.MockConversationStore{
+			AppendFunc: func(string, ...types.ChatMessage) error { return errors.New("disk full") },
+		})
+		f.pipeline.chatCompleter.(*mockChatCompleter).newStreamingFunc = func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) ChatStream {
+			return &mockChatStream{chunks: []openai.ChatCompletionChunk{makeChatCompletionChunk("answer")}}
+		}
+
+		events, err := f.pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
+		require.NoError(t, err)
+		received := drainEvents(t, events)
+
+		last := received[len(received)-1]
+		assert.EqualError(t, last.Err, "failed to save conversation: disk full")
+		assert.False(t, last.Done)
+	})
+
+	t.Run("unknown conversation fails before streaming", func(t *testing.T) {
+		f := newConversationFixture(t)
+
+		events, err := f.pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q", ConversationID: "missing"})
+
+		assert.Nil(t, events)
+		assert.ErrorIs(t, err, ErrConversationNotFound)
+	})
+}
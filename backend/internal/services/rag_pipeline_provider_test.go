@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/config"
+	conversationmemory "rag-backend/internal/repositories/conversationstore/memory"
+	"rag-backend/internal/repositories/vectorstore/memory"
+	"rag-backend/pkg/types"
+)
+
+// providerRequest is what the fake provider saw for one API call.
+type providerRequest struct {
+	Path          string
+	Authorization string
+	Model         string
+	Stream        bool
+}
+
+// fakeProvider is a minimal OpenAI-compatible server implementing the
+// embeddings and chat completions endpoints, streaming included.
+type fakeProvider struct {
+	server   *httptest.Server
+	answer   string
+	mutex    sync.Mutex
+	requests []providerRequest
+}
+
+func newFakeProvider(t *testing.T, answer string) *fakeProvider {
+	t.Helper()
+	fp := &fakeProvider{answer: answer}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/embeddings", fp.handleEmbeddings)
+	mux.HandleFunc("POST /v1/chat/completions", fp.handleChatCompletions)
+	fp.server = httptest.NewServer(mux)
+	t.Cleanup(fp.server.Close)
+	return fp
+}
+
+func (fp *fakeProvider) URL() string {
+	return fp.server.URL + "/v1"
+}
+
+func (fp *fakeProvider) Requests() []providerRequest {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	return append([]providerRequest(nil), fp.requests...)
+}
+
+func (fp *fakeProvider) record(r *http.Request, model string, stream bool) {
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+	fp.requests = append(fp.requests, providerRequest{
+		Path:          r.URL.Path,
+		Authorization: r.Header.Get("Authorization"),
+		Model:         model,
+		Stream:        stream,
+	})
+}
+
+func (fp *fakeProvider) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fp.record(r, body.Model, false)
+
+	var inputs []string
+	if err := json.Unmarshal(body.Input, &inputs); err != nil {
+		var single string
+		if err := json.Unmarshal(body.Input, &single); err != nil {
+			http.Error(w, "input must be a string or an array of strings", http.StatusBadRequest)
+			return
+		}
+		inputs = []string{single}
+	}
+
+	data := make([]map[string]any, len(inputs))
+	for i, input := range inputs {
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": fakeEmbedding(input)}
+	}
+	writeJSON(w, map[string]any{"object": "list", "model": body.Model, "data": data})
+}
+
+func (fp *fakeProvider) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fp.record(r, body.Model, body.Stream)
+
+	if !body.Stream {
+		writeJSON(w, map[string]any{
+			"id":     "chatcmpl-fake",
+			"object": "chat.completion",
+			"model":  body.Model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": fp.answer},
+			}},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, token := range strings.SplitAfter(fp.answer, " ") {
+		chunk, _ := json.Marshal(map[string]any{
+			"id":      "chatcmpl-fake",
+			"object":  "chat.completion.chunk",
+			"model":   body.Model,
+			"choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": token}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// fakeEmbedding counts letters so texts sharing words land close together.
+func fakeEmbedding(text string) []float64 {
+	embedding := make([]float64, 26)
+	for _, r := range strings.ToLower(text) {
+		if r >= 'a' && r <= 'z' {
+			embedding[r-'a']++
+		}
+	}
+	return embedding
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestNewRAGPipeline_OpenAICompatibleProviders(t *testing.T) {
+	chatProvider := newFakeProvider(t, "Paris is the capital of France.")
+	embeddingProvider := newFakeProvider(t, "")
+
+	cfg := &config.Config{
+		Chat:      config.ProviderConfig{BaseURL: chatProvider.URL(), APIKey: "chat-key", Model: "llama3.1:8b"},
+		Embedding: config.ProviderConfig{BaseURL: embeddingProvider.URL(), APIKey: "embedding-key", Model: "nomic-embed-text"},
+
+		ContextTokenBudget: 2000,
+		ContextWindow:      8192,
+		AnswerTokenReserve: 1024,
+	}
+	pipeline := NewRAGPipeline(cfg, memory.NewMemoryVectorStore(), NewConversationHistory(conversationmemory.NewMemoryConversationStore(0, 0)))
+
+	chunks, err := pipeline.ProcessDocument(context.Background(), types.ExtractedFile{Content: "Paris is the capital of France.", ContentType: "text/plain"}, types.DefaultCollection, map[string]string{"source": "facts.txt"}, nil)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, fakeEmbedding("Paris is the capital of France."), chunks[0].Embedding)
+	require.NoError(t, pipeline.AddDocumentToVectorStore(chunks))
+
+	result, err := pipeline.Query(types.QueryRequest{Question: "What is the capital of France?"})
+	require.NoError(t, err)
+	assert.Equal(t, "Paris is the capital of France.", result.Answer)
+	require.Len(t, result.Sources, 1)
+	assert.Equal(t, "default/facts.txt-chunk-0", result.Sources[0].ID)
+
+	events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "What is the capital of France?"})
+	require.NoError(t, err)
+	var answer strings.Builder
+	for _, ev := range drainEvents(t, events) {
+		require.NoError(t, ev.Err)
+		answer.WriteString(ev.Token)
+	}
+	assert.Equal(t, "Paris is the capital of France.", answer.String())
+
+	assert.Equal(t, []providerRequest{
+		{Path: "/v1/embeddings", Authorization: "Bearer embedding-key", Model: "nomic-embed-text"},
+		{Path: "/v1/embeddings", Authorization: "Bearer embedding-key", Model: "nomic-embed-text"},
+		{Path: "/v1/embeddings", Authorization: "Bearer embedding-key", Model: "nomic-embed-text"},
+	}, embeddingProvider.Requests(), "embeddings must only go to the embedding provider")
+	assert.Equal(t, []providerRequest{
+		{Path: "/v1/chat/completions", Authorization: "Bearer chat-key", Model: "llama3.1:8b"},
+		{Path: "/v1/chat/completions", Authorization: "Bearer chat-key", Model: "llama3.1:8b", Stream: true},
+	}, chatProvider.Requests(), "completions must only go to the chat provider")
+}
+
+func TestNewRAGPipeline_ProviderErrorsSurface(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"message":"model not found","type":"invalid_request_error"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		Chat:      config.ProviderConfig{BaseURL: server.URL + "/v1", Model: "missing"},
+		Embedding: config.ProviderConfig{BaseURL: server.URL + "/v1", Model: "missing"},
+	}
+	pipeline := NewRAGPipeline(cfg, memory.NewMemoryVectorStore(), NewConversationHistory(conversationmemory.NewMemoryConversationStore(0, 0)))
+
+	_, err := pipeline.Query(types.QueryRequest{Question: "anything"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to generate embedding for query")
+	assert.Contains(t, err.Error(), "model not found")
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/codes"
 	"rag-backend/pkg/types"
 )
 
@@ -86,13 +88,13 @@ func TestQueryStream_PreStreamErrors(t *testing.T) {
 				},
 			}
 			vs := &vectorstore.MockVectorStore{
-				SearchFunc: func(_ []float64, _ int) ([]types.ScoredChunk, error) {
+				SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 					return tt.mock.search.result, tt.mock.search.err
 				},
 			}
 			pipeline := newTestPipeline(ec, &mockChatCompleter{}, vs)
 
-			events, err := pipeline.QueryStream(context.Background(), "q")
+			events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
 
 			assert.Error(t, err)
 			assert.Contains(t, err.Error(), tt.expected.err)
@@ -154,16 +156,6 @@ func TestQueryStream_Success(t *testing.T) {
 			},
 			expected: expected{tokens: "", sources: 1},
 		},
-		{
-			name: "handles no search results",
-			mock: mock{
-				searchResults: []types.ScoredChunk{},
-				streamChunks: []openai.ChatCompletionChunk{
-					makeChatCompletionChunk("no info"),
-				},
-			},
-			expected: expected{tokens: "no info", sources: 0},
-		},
 	}
 
 	for _, tt := range tests {
@@ -180,29 +172,34 @@ func TestQueryStream_Success(t *testing.T) {
 				},
 			}
 			vs := &vectorstore.MockVectorStore{
-				SearchFunc: func(_ []float64, _ int) ([]types.ScoredChunk, error) {
+				SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 					return tt.mock.searchResults, nil
 				},
 			}
 			pipeline := newTestPipeline(ec, cc, vs)
 
-			events, err := pipeline.QueryStream(context.Background(), "q")
+			events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
 			assert.NoError(t, err)
 			assert.NotNil(t, events)
 
 			received := drainEvents(t, events)
 
-			assert.GreaterOrEqual(t, len(received), 2, "expected at least sources + done")
+			assert.GreaterOrEqual(t, len(received), 3, "expected at least sources + citations + done")
 			assert.NotNil(t, received[0].Sources)
 			assert.Len(t, received[0].Sources, tt.expected.sources)
-			assert.Equal(t, defaultConfidence, received[0].Confidence)
+			assert.Equal(t, scoreConfidence(received[0].SourceScores, "", received[0].Sources), received[0].Confidence)
+			assert.Len(t, received[0].SourceScores, tt.expected.sources)
 
 			var tokens string
-			for _, ev := range received[1 : len(received)-1] {
+			for _, ev := range received[1 : len(received)-2] {
 				tokens += ev.Token
 			}
 			assert.Equal(t, tt.expected.tokens, tokens)
 
+			citations := received[len(received)-2]
+			assert.NotNil(t, citations.Citations)
+			assert.Equal(t, tt.expected.tokens, citations.Answer)
+
 			last := received[len(received)-1]
 			assert.True(t, last.Done)
 			assert.NoError(t, last.Err)
@@ -211,6 +208,41 @@ func TestQueryStream_Success(t *testing.T) {
 	}
 }
 
+func TestQueryStream_NoAnswer(t *testing.T) {
+	ec := &mockEmbeddingCreator{
+		newFunc: func(_ context.Context, _ openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	cc := &mockChatCompleter{
+		newStreamingFunc: func(_ context.Context, _ openai.ChatCompletionNewParams, _ ...option.RequestOption) ChatStream {
+			t.Error("the chat model should not be asked")
+			return &mockChatStream{}
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
+			return []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "c1", Content: "ctx"}, Score: 0.1}}, nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+	pipeline.config.MinSimilarity = 0.5
+
+	events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
+	require.NoError(t, err)
+
+	received := drainEvents(t, events)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, codes.NoRelevantContext, received[0].NoAnswerCode)
+	assert.Equal(t, noAnswerReply, received[0].Answer)
+	assert.NoError(t, received[0].Err)
+
+	conversation, err := pipeline.conversations.GetConversation(received[0].ConversationID)
+	require.NoError(t, err)
+	assert.Len(t, conversation.Messages, 2, "the reply is recorded")
+}
+
 func TestQueryStream_UpstreamError(t *testing.T) {
 	ec := &mockEmbeddingCreator{
 		newFunc: func(_ context.Context, _ openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
@@ -227,13 +259,13 @@ func TestQueryStream_UpstreamError(t *testing.T) {
 		},
 	}
 	vs := &vectorstore.MockVectorStore{
-		SearchFunc: func(_ []float64, _ int) ([]types.ScoredChunk, error) {
+		SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 			return []types.ScoredChunk{{Chunk: types.DocumentChunk{Content: "ctx"}}}, nil
 		},
 	}
 	pipeline := newTestPipeline(ec, cc, vs)
 
-	events, err := pipeline.QueryStream(context.Background(), "q")
+	events, err := pipeline.QueryStream(context.Background(), types.QueryRequest{Question: "q"})
 	assert.NoError(t, err)
 
 	received := drainEvents(t, events)
@@ -263,14 +295,14 @@ func TestQueryStream_ContextCancellation(t *testing.T) {
 		},
 	}
 	vs := &vectorstore.MockVectorStore{
-		SearchFunc: func(_ []float64, _ int) ([]types.ScoredChunk, error) {
+		SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 			return []types.ScoredChunk{{Chunk: types.DocumentChunk{Content: "ctx"}}}, nil
 		},
 	}
 	pipeline := newTestPipeline(ec, cc, vs)
 
 	ctx, cancel := context.WithCancel(context.Background())
-	events, err := pipeline.QueryStream(ctx, "q")
+	events, err := pipeline.QueryStream(ctx, types.QueryRequest{Question: "q"})
 	assert.NoError(t, err)
 
 	// Consume the initial sources event, then cancel and stop reading.
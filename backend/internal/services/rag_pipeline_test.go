@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -12,19 +13,32 @@ import (
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"rag-backend/internal/config"
+	conversationmemory "rag-backend/internal/repositories/conversationstore/memory"
 	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/codes"
+	"rag-backend/pkg/filter"
 	"rag-backend/pkg/types"
 	"rag-backend/pkg/utils"
 )
 
 func newTestPipeline(ec EmbeddingCreator, cc ChatCompletionCreator, vs *vectorstore.MockVectorStore) *RAGPipeline {
 	return &RAGPipeline{
-		config:           &config.Config{Port: "3001", OpenAIAPIKey: "test-key", DeepSeekAPIKey: "test-key"},
+		config: &config.Config{
+			Port:      "3001",
+			Chat:      config.ProviderConfig{APIKey: "test-key", Model: config.DefaultChatModel},
+			Embedding: config.ProviderConfig{APIKey: "test-key", Model: config.DefaultEmbeddingModel},
+
+			ContextTokenBudget: 2000,
+			ContextWindow:      65536,
+			AnswerTokenReserve: 1024,
+		},
 		embeddingCreator: ec,
 		chatCompleter:    cc,
 		vectorStore:      vs,
+		conversations:    NewConversationHistory(conversationmemory.NewMemoryConversationStore(0, 0)),
 		textSplitter:     utils.NewTextSplitter(chunkSize, chunkOverlap),
 	}
 }
@@ -47,24 +61,53 @@ func makeChatCompletion(content string) *openai.ChatCompletion {
 
 func TestNewRAGPipeline(t *testing.T) {
 	cfg := &config.Config{
-		Port:           "3001",
-		OpenAIAPIKey:   "test-openai-key",
-		DeepSeekAPIKey: "test-deepseek-key",
+		Port:      "3001",
+		Chat:      config.ProviderConfig{BaseURL: config.DefaultChatBaseURL, APIKey: "test-chat-key", Model: config.DefaultChatModel},
+		Embedding: config.ProviderConfig{BaseURL: config.DefaultEmbeddingBaseURL, APIKey: "test-embedding-key", Model: config.DefaultEmbeddingModel},
 	}
 	vs := &vectorstore.MockVectorStore{}
 
-	pipeline := NewRAGPipeline(cfg, vs)
+	conversations := NewConversationHistory(conversationmemory.NewMemoryConversationStore(0, 0))
+
+	pipeline := NewRAGPipeline(cfg, vs, conversations)
 
 	assert.NotNil(t, pipeline)
 	assert.Equal(t, cfg, pipeline.config)
 	assert.Equal(t, vs, pipeline.vectorStore)
+	assert.Equal(t, conversations, pipeline.conversations)
 	assert.NotNil(t, pipeline.embeddingCreator)
 	assert.NotNil(t, pipeline.chatCompleter)
 	assert.NotNil(t, pipeline.textSplitter)
+	assert.Nil(t, pipeline.keywordSearcher, "plain vector stores have no keyword index")
 	assert.Equal(t, chunkSize, pipeline.textSplitter.ChunkSize)
 	assert.Equal(t, chunkOverlap, pipeline.textSplitter.ChunkOverlap)
 }
 
+func TestNewTextSplitter(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		wantSize    int
+		wantOverlap int
+		wantTokens  bool
+	}{
+		{name: "rune defaults", cfg: config.Config{}, wantSize: chunkSize, wantOverlap: chunkOverlap},
+		{name: "configured runes", cfg: config.Config{ChunkMode: config.ChunkModeRunes, ChunkSize: 500, ChunkOverlap: 50}, wantSize: 500, wantOverlap: 50},
+		{name: "token defaults", cfg: config.Config{ChunkMode: config.ChunkModeTokens}, wantSize: tokenChunkSize, wantOverlap: tokenChunkOverlap, wantTokens: true},
+		{name: "configured tokens", cfg: config.Config{ChunkMode: config.ChunkModeTokens, ChunkSize: 512, ChunkOverlap: 64}, wantSize: 512, wantOverlap: 64, wantTokens: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := newTextSplitter(&tt.cfg)
+
+			assert.Equal(t, tt.wantSize, splitter.ChunkSize)
+			assert.Equal(t, tt.wantOverlap, splitter.ChunkOverlap)
+			assert.Equal(t, tt.wantTokens, splitter.Tokenizer != nil)
+		})
+	}
+}
+
 func TestGenerateEmbedding(t *testing.T) {
 	type expected struct {
 		result []float64
@@ -206,7 +249,7 @@ func TestGenerateEmbeddingBatch(t *testing.T) {
 			}
 			pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
 
-			result, err := pipeline.generateEmbeddingBatch(tt.texts)
+			result, err := pipeline.generateEmbeddingBatch(context.Background(), tt.texts)
 
 			if tt.expected.err != "" {
 				assert.Error(t, err)
@@ -281,7 +324,7 @@ func TestGenerateEmbeddingParallel(t *testing.T) {
 			texts, ec := makeTextsAndMock(tt.numTexts, tt.shouldFail)
 			pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
 
-			result, err := pipeline.generateEmbeddingParallel(texts)
+			result, err := pipeline.generateEmbeddingParallel(context.Background(), texts, nil)
 
 			if tt.expected.err != "" {
 				assert.Error(t, err)
@@ -331,7 +374,7 @@ func TestGenerateEmbeddingParallel_ConcurrencyLimit(t *testing.T) {
 	}
 
 	pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
-	result, err := pipeline.generateEmbeddingParallel(texts)
+	result, err := pipeline.generateEmbeddingParallel(context.Background(), texts, nil)
 
 	assert.NoError(t, err)
 	assert.Len(t, result, numTexts)
@@ -386,7 +429,7 @@ func TestGenerateResponse(t *testing.T) {
 				response: &openai.ChatCompletion{Choices: []openai.ChatCompletionChoice{}},
 			},
 			expected: expected{
-				err: "no response from DeepSeek API",
+				err: "no response from chat completion API",
 			},
 		},
 		{
@@ -415,7 +458,7 @@ func TestGenerateResponse(t *testing.T) {
 			}
 			pipeline := newTestPipeline(nil, cc, &vectorstore.MockVectorStore{})
 
-			result, err := pipeline.generateResponse(tt.contextInfo, tt.question)
+			result, err := pipeline.generateResponse(nil, tt.contextInfo, tt.question)
 
 			if tt.expected.err != "" {
 				assert.Error(t, err)
@@ -486,14 +529,25 @@ func TestProcessDocument(t *testing.T) {
 			},
 		},
 		{
-			name:     "empty content produces single chunk",
+			name:     "empty content is rejected",
 			content:  "",
 			metadata: map[string]string{"source": "empty"},
 			mock: mock{
 				response: makeEmbeddingResponse([][]float64{{0.0}}),
 			},
 			expected: expected{
-				chunks: 1,
+				err: "document has no text to index",
+			},
+		},
+		{
+			name:     "blank content is rejected",
+			content:  " \n\n ",
+			metadata: map[string]string{"source": "empty"},
+			mock: mock{
+				response: makeEmbeddingResponse([][]float64{{0.0}}),
+			},
+			expected: expected{
+				err: "document has no text to index",
 			},
 		},
 	}
@@ -507,7 +561,7 @@ func TestProcessDocument(t *testing.T) {
 			}
 			pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
 
-			chunks, err := pipeline.ProcessDocument(tt.content, tt.metadata)
+			chunks, err := pipeline.ProcessDocument(context.Background(), types.ExtractedFile{Content: tt.content, ContentType: "text/plain"}, types.DefaultCollection, tt.metadata, nil)
 
 			if tt.expected.err != "" {
 				assert.Error(t, err)
@@ -518,9 +572,10 @@ func TestProcessDocument(t *testing.T) {
 				assert.Len(t, chunks, tt.expected.chunks)
 
 				for i, chunk := range chunks {
-					expectedID := fmt.Sprintf("%s-chunk-%d", tt.metadata["source"], i)
+					expectedID := fmt.Sprintf("%s/%s-chunk-%d", types.DefaultCollection, tt.metadata["source"], i)
 					assert.Equal(t, expectedID, chunk.ID, "chunk %d should have correct ID", i)
 					assert.Equal(t, tt.metadata, chunk.Metadata)
+					assert.Equal(t, types.DefaultCollection, chunk.Collection)
 					assert.NotNil(t, chunk.Embedding)
 				}
 			}
@@ -546,13 +601,185 @@ func TestProcessDocument_LargeDocumentUsesParallelPath(t *testing.T) {
 	}
 	pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
 
-	chunks, err := pipeline.ProcessDocument(content, metadata)
+	chunks, err := pipeline.ProcessDocument(context.Background(), types.ExtractedFile{Content: content, ContentType: "text/plain"}, types.DefaultCollection, metadata, nil)
 
 	assert.NoError(t, err)
 	assert.Greater(t, len(chunks), maxBatchSize, "should have more than maxBatchSize chunks to trigger parallel path")
 	assert.Greater(t, int(callCount.Load()), 1, "parallel path should call embedding API multiple times")
 }
 
+func TestProcessDocument_ReportsEmbeddingProgress(t *testing.T) {
+	content := strings.Repeat("x", 33_000)
+
+	ec := &mockEmbeddingCreator{
+		newFunc: func(_ context.Context, body openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			embeddings := make([][]float64, len(body.Input.OfArrayOfStrings))
+			for i := range embeddings {
+				embeddings[i] = []float64{0.1}
+			}
+			return makeEmbeddingResponse(embeddings), nil
+		},
+	}
+	pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
+
+	var reports [][2]int
+	chunks, err := pipeline.ProcessDocument(context.Background(), types.ExtractedFile{Content: content, ContentType: "text/plain"}, types.DefaultCollection, nil, func(embedded, total int) {
+		reports = append(reports, [2]int{embedded, total})
+	})
+
+	assert.NoError(t, err)
+	if assert.Greater(t, len(reports), 2, "expected a report before embedding and one per batch") {
+		assert.Equal(t, [2]int{0, len(chunks)}, reports[0])
+		assert.Equal(t, [2]int{len(chunks), len(chunks)}, reports[len(reports)-1])
+		for i := 1; i < len(reports); i++ {
+			assert.Greater(t, reports[i][0], reports[i-1][0])
+		}
+	}
+}
+
+func TestProcessDocument_StopsWhenCancelled(t *testing.T) {
+	content := strings.Repeat("x", 33_000)
+
+	ec := &mockEmbeddingCreator{
+		newFunc: func(ctx context.Context, _ openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return nil, ctx.Err()
+		},
+	}
+	pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chunks, err := pipeline.ProcessDocument(ctx, types.ExtractedFile{Content: content, ContentType: "text/plain"}, types.DefaultCollection, nil, nil)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, chunks)
+}
+
+func TestProcessDocument_SplitsStructuredFilesBySection(t *testing.T) {
+	content := "Overview.\n\n# Install\n\n## Linux\n\n### Proxy\n\nSet HTTPS_PROXY first."
+
+	tests := []struct {
+		name         string
+		contentType  string
+		wantSections []string
+		wantInputs   []string
+	}{
+		{
+			name:         "markdown",
+			contentType:  "text/markdown",
+			wantSections: []string{"", "Install > Linux > Proxy"},
+			wantInputs:   []string{"Overview.", "Install > Linux > Proxy\n\nSet HTTPS_PROXY first."},
+		},
+		{
+			name:         "html",
+			contentType:  "text/html",
+			wantSections: []string{"", "Install > Linux > Proxy"},
+			wantInputs:   []string{"Overview.", "Install > Linux > Proxy\n\nSet HTTPS_PROXY first."},
+		},
+		{
+			name:         "plain text is not",
+			contentType:  "text/plain",
+			wantSections: []string{""},
+			wantInputs:   []string{content},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inputs []string
+			ec := &mockEmbeddingCreator{
+				newFunc: func(_ context.Context, body openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					inputs = append(inputs, body.Input.OfArrayOfStrings...)
+					embeddings := make([][]float64, len(body.Input.OfArrayOfStrings))
+					for i := range embeddings {
+						embeddings[i] = []float64{0.1}
+					}
+					return makeEmbeddingResponse(embeddings), nil
+				},
+			}
+			pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
+			metadata := map[string]string{"source": "guide"}
+
+			chunks, err := pipeline.ProcessDocument(context.Background(), types.ExtractedFile{Content: content, ContentType: tt.contentType}, types.DefaultCollection, metadata, nil)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantInputs, inputs)
+			sections := make([]string, len(chunks))
+			for i, chunk := range chunks {
+				sections[i] = chunk.Metadata["section"]
+				assert.Equal(t, "guide", chunk.Metadata["source"])
+			}
+			assert.Equal(t, tt.wantSections, sections)
+			assert.Equal(t, map[string]string{"source": "guide"}, metadata, "the caller's metadata must not change")
+		})
+	}
+}
+
+func TestProcessDocument_RecordsPages(t *testing.T) {
+	// Pages 1, 2, 4 and 5 of a PDF whose page 3 was skipped; each page's
+	// sentences name the page
+	pageNumbers := []int{1, 2, 4, 5}
+	var content strings.Builder
+	var pages []types.PageOffset
+	for _, number := range pageNumbers {
+		if content.Len() > 0 {
+			content.WriteString("\n\n")
+		}
+		pages = append(pages, types.PageOffset{Page: number, Offset: content.Len()})
+		content.WriteString(strings.TrimSpace(strings.Repeat(fmt.Sprintf("This sentence is on page%d. ", number), 15)))
+	}
+
+	ec := &mockEmbeddingCreator{
+		newFunc: func(_ context.Context, body openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			embeddings := make([][]float64, len(body.Input.OfArrayOfStrings))
+			for i := range embeddings {
+				embeddings[i] = []float64{0.1}
+			}
+			return makeEmbeddingResponse(embeddings), nil
+		},
+	}
+	pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
+
+	file := types.ExtractedFile{Content: content.String(), ContentType: "application/pdf", Pages: pages}
+	chunks, err := pipeline.ProcessDocument(context.Background(), file, types.DefaultCollection, map[string]string{"source": "report.pdf"}, nil)
+
+	assert.NoError(t, err)
+	assert.Greater(t, len(chunks), 1)
+	spansPages := false
+	for _, chunk := range chunks {
+		var onPages []int
+		for _, number := range pageNumbers {
+			if strings.Contains(chunk.Content, fmt.Sprintf("page%d.", number)) {
+				onPages = append(onPages, number)
+			}
+		}
+		assert.Equal(t, strconv.Itoa(onPages[0]), chunk.Metadata["page_start"], "chunk %q", chunk.Content)
+		assert.Equal(t, strconv.Itoa(onPages[len(onPages)-1]), chunk.Metadata["page_end"], "chunk %q", chunk.Content)
+		assert.Equal(t, "report.pdf", chunk.Metadata["source"])
+		spansPages = spansPages || len(onPages) > 1
+	}
+	assert.True(t, spansPages, "expected a chunk spanning pages")
+}
+
+func TestPageAt(t *testing.T) {
+	pages := []types.PageOffset{{Page: 1, Offset: 0}, {Page: 2, Offset: 10}, {Page: 5, Offset: 25}}
+
+	tests := []struct {
+		offset int
+		want   int
+	}{
+		{offset: 0, want: 1},
+		{offset: 9, want: 1},
+		{offset: 10, want: 2},
+		{offset: 24, want: 2},
+		{offset: 25, want: 5},
+		{offset: 100, want: 5},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, pageAt(pages, tt.offset), "offset %d", tt.offset)
+	}
+}
+
 func TestAddDocumentToVectorStore(t *testing.T) {
 	sampleChunks := []types.DocumentChunk{
 		{ID: "c1", Content: "hello", Embedding: []float64{0.1}},
@@ -712,15 +939,14 @@ func TestQuery(t *testing.T) {
 			},
 		},
 		{
-			name:     "handles no search results with empty context",
+			name:     "answers an empty store without the chat model",
 			question: "obscure topic",
 			mock: mock{
 				embedding: embeddingMock{response: makeEmbeddingResponse([][]float64{{0.1}})},
 				search:    searchMock{result: []types.ScoredChunk{}},
-				chat:      chatMock{response: makeChatCompletion("I don't have enough information.")},
 			},
 			expected: expected{
-				answer:  "I don't have enough information.",
+				answer:  noDocumentsReply,
 				sources: 0,
 			},
 		},
@@ -745,13 +971,13 @@ func TestQuery(t *testing.T) {
 			}
 
 			vs := &vectorstore.MockVectorStore{
-				SearchFunc: func(embedding []float64, limit int) ([]types.ScoredChunk, error) {
+				SearchFunc: func(embedding []float64, limit int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 					return tt.mock.search.result, tt.mock.search.err
 				},
 			}
 
 			pipeline := newTestPipeline(ec, cc, vs)
-			result, err := pipeline.Query(tt.question)
+			result, err := pipeline.Query(types.QueryRequest{Question: tt.question})
 
 			if tt.expected.err != "" {
 				assert.Error(t, err)
@@ -762,7 +988,8 @@ func TestQuery(t *testing.T) {
 				assert.NotNil(t, result)
 				assert.Equal(t, tt.expected.answer, result.Answer)
 				assert.Len(t, result.Sources, tt.expected.sources)
-				assert.Equal(t, defaultConfidence, result.Confidence)
+				assert.Len(t, result.SourceScores, tt.expected.sources)
+				assert.Equal(t, scoreConfidence(result.SourceScores, result.Answer, result.Sources), result.Confidence)
 
 				for _, sc := range tt.mock.search.result {
 					assert.Contains(t, capturedContext, sc.Chunk.Content)
@@ -790,19 +1017,64 @@ func TestQuery_ContextBuiltFromMultipleSources(t *testing.T) {
 	}
 
 	vs := &vectorstore.MockVectorStore{
-		SearchFunc: func(_ []float64, _ int) ([]types.ScoredChunk, error) {
+		SearchFunc: func(_ []float64, _ int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 			return []types.ScoredChunk{
 				{Chunk: types.DocumentChunk{Content: "First chunk"}, Score: 0.9},
-				{Chunk: types.DocumentChunk{Content: "Second chunk"}, Score: 0.8},
+				{Chunk: types.DocumentChunk{Content: "Second chunk", Metadata: map[string]string{"section": "Install > Linux"}}, Score: 0.8},
 			}, nil
 		},
 	}
 
 	pipeline := newTestPipeline(ec, cc, vs)
-	_, err := pipeline.Query("test question")
+	_, err := pipeline.Query(types.QueryRequest{Question: "test question"})
 
 	assert.NoError(t, err)
-	assert.Contains(t, capturedPrompt, "First chunk\n\nSecond chunk")
+	assert.Contains(t, capturedPrompt, "[1] First chunk\n\n[2] (Install > Linux) Second chunk")
+}
+
+func TestQuery_MMRSkipsNearDuplicates(t *testing.T) {
+	// The query embedding points along the first axis. The first three
+	// results are overlapping neighbours of one passage.
+	candidates := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "a", Content: "passage a", Embedding: []float64{0.99, 0.14, 0}}, Score: 0.99},
+		{Chunk: types.DocumentChunk{ID: "a2", Content: "passage a, again", Embedding: []float64{0.98, 0.17, 0}}, Score: 0.98},
+		{Chunk: types.DocumentChunk{ID: "a3", Content: "passage a, once more", Embedding: []float64{0.97, 0.2, 0}}, Score: 0.97},
+		{Chunk: types.DocumentChunk{ID: "b", Content: "passage b", Embedding: []float64{0.8, 0, 0.6}}, Score: 0.8},
+		{Chunk: types.DocumentChunk{ID: "c", Content: "passage c", Embedding: []float64{0.7, -0.7, 0.1}}, Score: 0.7},
+		{Chunk: types.DocumentChunk{ID: "d", Content: "passage d", Embedding: []float64{0.6, 0.1, -0.8}}, Score: 0.6},
+	}
+
+	ec := &mockEmbeddingCreator{
+		newFunc: func(_ context.Context, _ openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{1, 0, 0}}), nil
+		},
+	}
+	cc := &mockChatCompleter{
+		newFunc: func(_ context.Context, _ openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+			return makeChatCompletion("answer"), nil
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func(_ []float64, limit int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
+			return candidates[:min(limit, len(candidates))], nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+
+	sourceIDs := func(request types.QueryRequest) []string {
+		response, err := pipeline.Query(request)
+		assert.NoError(t, err)
+		ids := make([]string, len(response.Sources))
+		for i, source := range response.Sources {
+			ids[i] = source.ID
+		}
+		return ids
+	}
+
+	// MMR moves the near-duplicates behind the passages that add something
+	lambda := 0.5
+	assert.Equal(t, []string{"a", "a2", "a3", "b", "c", "d"}, sourceIDs(types.QueryRequest{Question: "q"}))
+	assert.Equal(t, []string{"a", "c", "b", "d", "a2", "a3"}, sourceIDs(types.QueryRequest{Question: "q", MMRLambda: &lambda}))
 }
 
 func TestQuery_PassesCorrectSearchLimit(t *testing.T) {
@@ -819,15 +1091,411 @@ func TestQuery_PassesCorrectSearchLimit(t *testing.T) {
 
 	var capturedLimit int
 	vs := &vectorstore.MockVectorStore{
-		SearchFunc: func(_ []float64, limit int) ([]types.ScoredChunk, error) {
+		SearchFunc: func(_ []float64, limit int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
 			capturedLimit = limit
 			return []types.ScoredChunk{}, nil
 		},
 	}
 
 	pipeline := newTestPipeline(ec, cc, vs)
-	_, err := pipeline.Query("test")
+	_, err := pipeline.Query(types.QueryRequest{Question: "test"})
 
 	assert.NoError(t, err)
-	assert.Equal(t, maxContentChunks, capturedLimit)
+	assert.Equal(t, contextCandidates, capturedLimit)
+}
+
+func TestQuery_RetrievalModes(t *testing.T) {
+	vectorResults := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "v1", Content: "vector one"}, Score: 0.9},
+		{Chunk: types.DocumentChunk{ID: "both", Content: "shared"}, Score: 0.8},
+	}
+	keywordResults := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "both", Content: "shared"}, Score: 7.1},
+		{Chunk: types.DocumentChunk{ID: "k1", Content: "keyword one"}, Score: 3.2},
+	}
+	zero, half := 0.0, 0.5
+
+	type calls struct {
+		embedding int
+		vector    int
+		keyword   int
+	}
+	type expected struct {
+		sources      []string
+		vectorLimit  int
+		keywordLimit int
+		calls        calls
+		err          string
+	}
+
+	tests := []struct {
+		name         string
+		request      types.QueryRequest
+		noKeywordIdx bool
+		expected     expected
+	}{
+		{
+			name:    "defaults to vector search",
+			request: types.QueryRequest{Question: "q"},
+			expected: expected{
+				sources:     []string{"v1", "both"},
+				vectorLimit: contextCandidates,
+				calls:       calls{embedding: 1, vector: 1},
+			},
+		},
+		{
+			name:    "keyword mode skips embeddings",
+			request: types.QueryRequest{Question: "q", Mode: types.RetrievalModeKeyword},
+			expected: expected{
+				sources:      []string{"both", "k1"},
+				keywordLimit: contextCandidates,
+				calls:        calls{keyword: 1},
+			},
+		},
+		{
+			name:    "hybrid mode fuses both rankings",
+			request: types.QueryRequest{Question: "q", Mode: types.RetrievalModeHybrid},
+			expected: expected{
+				sources:      []string{"both", "v1", "k1"},
+				vectorLimit:  hybridCandidates,
+				keywordLimit: hybridCandidates,
+				calls:        calls{embedding: 1, vector: 1, keyword: 1},
+			},
+		},
+		{
+			name:    "hybrid mode honours keyword weight",
+			request: types.QueryRequest{Question: "q", Mode: types.RetrievalModeHybrid, KeywordWeight: &zero},
+			expected: expected{
+				sources:      []string{"v1", "both", "k1"},
+				vectorLimit:  hybridCandidates,
+				keywordLimit: hybridCandidates,
+				calls:        calls{embedding: 1, vector: 1, keyword: 1},
+			},
+		},
+		{
+			name:    "MMR over-fetches candidates",
+			request: types.QueryRequest{Question: "q", MMRLambda: &half},
+			expected: expected{
+				sources:     []string{"v1", "both"},
+				vectorLimit: mmrCandidates,
+				calls:       calls{embedding: 1, vector: 1},
+			},
+		},
+		{
+			name:    "MMR candidates can be set per request",
+			request: types.QueryRequest{Question: "q", Mode: types.RetrievalModeHybrid, MMRLambda: &half, MMRCandidates: 50},
+			expected: expected{
+				sources:      []string{"both", "v1", "k1"},
+				vectorLimit:  50,
+				keywordLimit: 50,
+				calls:        calls{embedding: 1, vector: 1, keyword: 1},
+			},
+		},
+		{
+			name:         "keyword mode fails without a keyword index",
+			request:      types.QueryRequest{Question: "q", Mode: types.RetrievalModeKeyword},
+			noKeywordIdx: true,
+			expected:     expected{err: "keyword search is not available"},
+		},
+		{
+			name:     "rejects unknown mode",
+			request:  types.QueryRequest{Question: "q", Mode: "semantic"},
+			expected: expected{err: "unknown retrieval mode: semantic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got calls
+			var vectorLimit, keywordLimit int
+			ec := &mockEmbeddingCreator{
+				newFunc: func(_ context.Context, _ openai.EmbeddingNewParams, _ ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					got.embedding++
+					return makeEmbeddingResponse([][]float64{{0.1}}), nil
+				},
+			}
+			cc := &mockChatCompleter{
+				newFunc: func(_ context.Context, _ openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+					return makeChatCompletion("answer"), nil
+				},
+			}
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func(_ []float64, limit int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
+					got.vector++
+					vectorLimit = limit
+					return vectorResults, nil
+				},
+			}
+			pipeline := newTestPipeline(ec, cc, vs)
+			if !tt.noKeywordIdx {
+				pipeline.keywordSearcher = &vectorstore.MockKeywordSearcher{
+					KeywordSearchFunc: func(query string, limit int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
+						got.keyword++
+						keywordLimit = limit
+						assert.Equal(t, tt.request.Question, query)
+						return keywordResults, nil
+					},
+				}
+			}
+
+			result, err := pipeline.Query(tt.request)
+
+			if tt.expected.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expected.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.calls, got)
+			assert.Equal(t, tt.expected.vectorLimit, vectorLimit)
+			assert.Equal(t, tt.expected.keywordLimit, keywordLimit)
+
+			ids := make([]string, len(result.Sources))
+			for i, source := range result.Sources {
+				ids[i] = source.ID
+			}
+			assert.Equal(t, tt.expected.sources, ids)
+		})
+	}
+}
+
+func TestQuery_KeywordSearchError(t *testing.T) {
+	pipeline := newTestPipeline(nil, nil, &vectorstore.MockVectorStore{})
+	pipeline.keywordSearcher = &vectorstore.MockKeywordSearcher{
+		KeywordSearchFunc: func(string, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+			return nil, errors.New("index broken")
+		},
+	}
+
+	result, err := pipeline.Query(types.QueryRequest{Question: "q", Mode: types.RetrievalModeKeyword})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to search keyword index")
+	assert.Nil(t, result)
+}
+
+func TestQuery_ScopesSearchToCollections(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  types.QueryRequest
+		expected []string
+		filter   *filter.Expr
+	}{
+		{name: "unscoped request searches everything", request: types.QueryRequest{Question: "q"}},
+		{name: "single collection", request: types.QueryRequest{Question: "q", Collection: "contracts"}, expected: []string{"contracts"}},
+		{
+			name:     "collection is merged into collections",
+			request:  types.QueryRequest{Question: "q", Collection: "contracts", Collections: []string{"default", "contracts"}},
+			expected: []string{"default", "contracts"},
+		},
+		{
+			name:    "metadata filter is passed to both searches",
+			request: types.QueryRequest{Question: "q", Filter: &filter.Expr{Field: "department", In: []filter.Value{"legal"}}},
+			filter:  &filter.Expr{Field: "department", In: []filter.Value{"legal"}},
+		},
+		{
+			name:     "collection is appended after collections",
+			request:  types.QueryRequest{Question: "q", Collection: "reports", Collections: []string{"default"}},
+			expected: []string{"default", "reports"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var vectorOptions, keywordOptions types.SearchOptions
+			ec := &mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					return makeEmbeddingResponse([][]float64{{0.1}}), nil
+				},
+			}
+			cc := &mockChatCompleter{
+				newFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) (*openai.ChatCompletion, error) {
+					return makeChatCompletion("answer"), nil
+				},
+			}
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func(_ []float64, _ int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+					vectorOptions = options
+					return nil, nil
+				},
+			}
+			pipeline := newTestPipeline(ec, cc, vs)
+			pipeline.keywordSearcher = &vectorstore.MockKeywordSearcher{
+				KeywordSearchFunc: func(_ string, _ int, options types.SearchOptions) ([]types.ScoredChunk, error) {
+					keywordOptions = options
+					return nil, nil
+				},
+			}
+
+			request := tt.request
+			request.Mode = types.RetrievalModeHybrid
+			_, err := pipeline.Query(request)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, vectorOptions.Collections)
+			assert.Equal(t, tt.expected, keywordOptions.Collections)
+			assert.Equal(t, tt.filter, vectorOptions.MetadataFilter)
+			assert.Equal(t, tt.filter, keywordOptions.MetadataFilter)
+		})
+	}
+}
+
+func TestQuery_NoAnswer(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		minSimilarity float64
+		searchResults []types.ScoredChunk
+		code          string
+		answer        string
+	}{
+		{name: "nothing indexed", minSimilarity: 0.2, code: codes.NoDocuments, answer: noDocumentsReply},
+		{
+			name:          "no chunk similar enough",
+			minSimilarity: 0.5,
+			searchResults: []types.ScoredChunk{
+				{Chunk: types.DocumentChunk{ID: "a", Content: "unrelated"}, Score: 0.3},
+				{Chunk: types.DocumentChunk{ID: "b", Content: "also unrelated"}, Score: 0.1},
+			},
+			code:   codes.NoRelevantContext,
+			answer: noAnswerReply,
+		},
+		{name: "keyword search finds no shared words", mode: types.RetrievalModeKeyword, code: codes.NoRelevantContext, answer: noAnswerReply},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					return makeEmbeddingResponse([][]float64{{0.1}}), nil
+				},
+			}
+			cc := &mockChatCompleter{
+				newFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) (*openai.ChatCompletion, error) {
+					t.Error("the chat model should not be asked")
+					return makeChatCompletion("answer"), nil
+				},
+			}
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+					return tt.searchResults, nil
+				},
+			}
+			pipeline := newTestPipeline(ec, cc, vs)
+			pipeline.config.MinSimilarity = tt.minSimilarity
+			pipeline.keywordSearcher = &vectorstore.MockKeywordSearcher{
+				KeywordSearchFunc: func(string, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+					return nil, nil
+				},
+			}
+
+			response, err := pipeline.Query(types.QueryRequest{Question: "q", Mode: tt.mode})
+
+			require.NoError(t, err)
+			assert.True(t, response.NoAnswer)
+			assert.Equal(t, tt.code, response.NoAnswerCode)
+			assert.Equal(t, tt.answer, response.Answer)
+			assert.Empty(t, response.Sources)
+			assert.Equal(t, 0.0, response.Confidence)
+			assert.NotEmpty(t, response.ConversationID)
+		})
+	}
+}
+
+func TestQuery_MinSimilarity(t *testing.T) {
+	ec := &mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return makeEmbeddingResponse([][]float64{{0.1}}), nil
+		},
+	}
+	var prompt string
+	cc := &mockChatCompleter{
+		newFunc: func(_ context.Context, body openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+			texts := messageTexts(body.Messages)
+			prompt = texts[len(texts)-1]
+			return makeChatCompletion("answer"), nil
+		},
+	}
+	vs := &vectorstore.MockVectorStore{
+		SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+			return []types.ScoredChunk{
+				{Chunk: types.DocumentChunk{ID: "a", Content: "close"}, Score: 0.8},
+				{Chunk: types.DocumentChunk{ID: "b", Content: "on the line"}, Score: 0.4},
+				{Chunk: types.DocumentChunk{ID: "c", Content: "far away"}, Score: 0.39},
+			}, nil
+		},
+	}
+	pipeline := newTestPipeline(ec, cc, vs)
+	pipeline.config.MinSimilarity = 0.4
+
+	response, err := pipeline.Query(types.QueryRequest{Question: "q"})
+
+	require.NoError(t, err)
+	assert.False(t, response.NoAnswer)
+	require.Len(t, response.Sources, 2)
+	assert.Equal(t, "a", response.Sources[0].ID)
+	assert.Equal(t, "b", response.Sources[1].ID)
+	assert.NotContains(t, prompt, "far away")
+}
+
+func TestQuery_MinSimilarityHybrid(t *testing.T) {
+	vectorHits := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "a", Content: "distant"}, Score: 0.15},
+		{Chunk: types.DocumentChunk{ID: "b", Content: "further"}, Score: 0.1},
+	}
+
+	tests := []struct {
+		name        string
+		keywordHits []types.ScoredChunk
+		sources     []string
+	}{
+		{
+			// Fusion scores the top vector hit at least 0.5 of the best
+			// possible, however far away it is
+			name:    "judges vector hits by their cosine similarity",
+			sources: []string{},
+		},
+		{
+			name:        "keeps chunks with a strong keyword match",
+			keywordHits: []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "b", Content: "further"}, Score: 8}},
+			sources:     []string{"b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					return makeEmbeddingResponse([][]float64{{0.1}}), nil
+				},
+			}
+			cc := &mockChatCompleter{
+				newFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) (*openai.ChatCompletion, error) {
+					return makeChatCompletion("answer"), nil
+				},
+			}
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func([]float64, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+					return vectorHits, nil
+				},
+			}
+			pipeline := newTestPipeline(ec, cc, vs)
+			pipeline.config.MinSimilarity = 0.2
+			pipeline.keywordSearcher = &vectorstore.MockKeywordSearcher{
+				KeywordSearchFunc: func(string, int, types.SearchOptions) ([]types.ScoredChunk, error) {
+					return tt.keywordHits, nil
+				},
+			}
+
+			response, err := pipeline.Query(types.QueryRequest{Question: "q", Mode: types.RetrievalModeHybrid})
+
+			require.NoError(t, err)
+			ids := make([]string, len(response.Sources))
+			for i, source := range response.Sources {
+				ids[i] = source.ID
+			}
+			assert.Equal(t, tt.sources, ids)
+			assert.Equal(t, len(tt.sources) == 0, response.NoAnswer)
+		})
+	}
 }
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+
+	"rag-backend/internal/config"
+	"rag-backend/pkg/ratelimit"
+	"rag-backend/pkg/types"
+)
+
+// Reranker reorders retrieved chunks by how well they answer the query. It
+// returns every candidate, best first, with its retrieval score replaced by
+// the reranker's own score in [0, 1].
+type Reranker interface {
+	Rerank(ctx context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error)
+}
+
+// newReranker builds the configured reranker, or returns nil when reranking
+// is off
+func newReranker(cfg *config.Config, chatCompleter ChatCompletionCreator) Reranker {
+	switch cfg.Reranker {
+	case config.RerankerLexical:
+		return LexicalReranker{}
+	case config.RerankerLLM:
+		return NewLLMReranker(chatCompleter, cfg.Chat.Model)
+	case config.RerankerHTTP:
+		return NewHTTPReranker(cfg.Rerank)
+	default:
+		return nil
+	}
+}
+
+// rankByScores gives each candidate its score and sorts them best first.
+// Candidates scored alike keep their retrieval order.
+func rankByScores(candidates []types.ScoredChunk, scores []float64) []types.ScoredChunk {
+	ranked := make([]types.ScoredChunk, len(candidates))
+	for i, candidate := range candidates {
+		ranked[i] = types.ScoredChunk{Chunk: candidate.Chunk, Score: clampUnit(scores[i])}
+	}
+	slices.SortStableFunc(ranked, func(a, b types.ScoredChunk) int { return cmp.Compare(b.Score, a.Score) })
+	return ranked
+}
+
+// LexicalReranker scores each candidate by the share of the query's content
+// words it contains. It needs no model, so it also stands in when another
+// reranker fails.
+type LexicalReranker struct{}
+
+func (LexicalReranker) Rerank(_ context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error) {
+	terms := contentTerms(query)
+	scores := make([]float64, len(candidates))
+	if len(terms) == 0 {
+		return rankByScores(candidates, scores), nil
+	}
+
+	for i, candidate := range candidates {
+		chunkTerms := contentTerms(candidate.Chunk.Content)
+		for term := range terms {
+			if _, ok := chunkTerms[term]; ok {
+				scores[i]++
+			}
+		}
+		scores[i] /= float64(len(terms))
+	}
+	return rankByScores(candidates, scores), nil
+}
+
+// llmRating matches a line of the judge's reply, such as "3: 0.8"
+var llmRating = regexp.MustCompile(`(?m)^\s*\[?(\d+)\]?\s*[:.)=-]\s*(\d+(?:\.\d+)?)`)
+
+// LLMReranker asks the chat model to judge how relevant each candidate is to
+// the query. Candidates the reply leaves out score 0.
+type LLMReranker struct {
+	chatCompleter ChatCompletionCreator
+	model         string
+}
+
+func NewLLMReranker(chatCompleter ChatCompletionCreator, model string) *LLMReranker {
+	return &LLMReranker{
+		chatCompleter: chatCompleter,
+		model:         model,
+	}
+}
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error) {
+	if len(candidates) == 0 {
+		return []types.ScoredChunk{}, nil
+	}
+
+	completion, err := r.chatCompleter.New(ctx, openai.ChatCompletionNewParams{
+		Messages:    []openai.ChatCompletionMessageParamUnion{openai.UserMessage(buildRerankPrompt(query, candidates))},
+		Model:       r.model,
+		Temperature: openai.Float(0.0),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank with chat model: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("no response from chat completion API")
+	}
+
+	scores := make([]float64, len(candidates))
+	rated := 0
+	for _, match := range llmRating.FindAllStringSubmatch(completion.Choices[0].Message.Content, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 || n > len(candidates) {
+			continue
+		}
+		rating, err := strconv.ParseFloat(match[2], 64)
+		if err != nil || rating > 1 {
+			continue
+		}
+		scores[n-1] = rating
+		rated++
+	}
+	if rated == 0 {
+		return nil, fmt.Errorf("chat model reply has no relevance ratings")
+	}
+	return rankByScores(candidates, scores), nil
+}
+
+func buildRerankPrompt(query string, candidates []types.ScoredChunk) string {
+	var passages strings.Builder
+	for i, candidate := range candidates {
+		fmt.Fprintf(&passages, "[%d] %s\n\n", i+1, candidate.Chunk.Content)
+	}
+
+	return fmt.Sprintf(`Passages:
+%sQuestion: %s
+
+On a scale from 0 to 1, how relevant is each passage to answering the question? Reply with one line per passage in the form "n: score", for example "1: 0.8", and nothing else.`, passages.String(), query)
+}
+
+// HTTPReranker calls a rerank API in the style of Cohere's and Jina's: the
+// query and documents are posted to {BaseURL}/rerank, which replies with a
+// relevance score for each document index. Calls that fail transiently are
+// retried and kept within the provider's rate limits.
+type HTTPReranker struct {
+	provider config.ProviderConfig
+	client   *http.Client
+	retrier  retrier
+}
+
+func NewHTTPReranker(provider config.ProviderConfig) *HTTPReranker {
+	return &HTTPReranker{
+		provider: provider,
+		client:   &http.Client{},
+		retrier:  newRetrier(NewRetryPolicy(provider), ratelimit.NewLimiter(provider.RequestsPerMinute, provider.TokensPerMinute)),
+	}
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error) {
+	if len(candidates) == 0 {
+		return []types.ScoredChunk{}, nil
+	}
+
+	request := rerankRequest{
+		Model:     r.provider.Model,
+		Query:     query,
+		Documents: make([]string, len(candidates)),
+		TopN:      len(candidates),
+	}
+	for i, candidate := range candidates {
+		request.Documents[i] = candidate.Chunk.Content
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rerank request: %w", err)
+	}
+
+	// Each attempt decodes into its own response, so a failed one can't leave
+	// results behind for the next
+	var response *rerankResponse
+	err = r.retrier.do(ctx, estimateTokens(request), func(ctx context.Context) error {
+		attempt, err := r.post(ctx, body)
+		if err != nil {
+			return err
+		}
+		response = attempt
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank: %w", err)
+	}
+
+	scores := make([]float64, len(candidates))
+	for _, result := range response.Results {
+		if result.Index < 0 || result.Index >= len(candidates) {
+			return nil, fmt.Errorf("rerank API returned unknown document index %d", result.Index)
+		}
+		scores[result.Index] = result.RelevanceScore
+	}
+	return rankByScores(candidates, scores), nil
+}
+
+// post makes one rerank call and decodes its reply
+func (r *HTTPReranker) post(ctx context.Context, body []byte) (*rerankResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(r.provider.BaseURL, "/")+"/rerank", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.provider.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.provider.APIKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &httpStatusError{StatusCode: resp.StatusCode, Header: resp.Header, Message: strings.TrimSpace(string(message))}
+	}
+	var response rerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"context"
+
+	"rag-backend/pkg/types"
+)
+
+type mockReranker struct {
+	rerankFunc func(ctx context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error)
+}
+
+func (m *mockReranker) Rerank(ctx context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error) {
+	return m.rerankFunc(ctx, query, candidates)
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/config"
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/types"
+)
+
+func rerankCandidates(contents ...string) []types.ScoredChunk {
+	candidates := make([]types.ScoredChunk, len(contents))
+	for i, content := range contents {
+		candidates[i] = types.ScoredChunk{
+			Chunk: types.DocumentChunk{ID: string(rune('a' + i)), Content: content},
+			Score: 0.9 - 0.1*float64(i),
+		}
+	}
+	return candidates
+}
+
+func rankedIDs(ranked []types.ScoredChunk) ([]string, []float64) {
+	ids := make([]string, len(ranked))
+	scores := make([]float64, len(ranked))
+	for i, scored := range ranked {
+		ids[i], scores[i] = scored.Chunk.ID, scored.Score
+	}
+	return ids, scores
+}
+
+func TestLexicalReranker(t *testing.T) {
+	candidates := rerankCandidates(
+		"The weather in Paris is mild.",
+		"Berlin is the capital of Germany.",
+		"Paris is the capital of France.",
+	)
+
+	ranked, err := LexicalReranker{}.Rerank(context.Background(), "What is the capital of France?", candidates)
+
+	require.NoError(t, err)
+	ids, scores := rankedIDs(ranked)
+	assert.Equal(t, []string{"c", "b", "a"}, ids)
+	assert.InDeltaSlice(t, []float64{1, 0.5, 0}, scores, 1e-9)
+	assert.Equal(t, 0.9, candidates[0].Score, "candidates are not modified")
+}
+
+func TestLexicalReranker_NoContentWords(t *testing.T) {
+	ranked, err := LexicalReranker{}.Rerank(context.Background(), "what is it?", rerankCandidates("one", "two"))
+
+	require.NoError(t, err)
+	ids, scores := rankedIDs(ranked)
+	assert.Equal(t, []string{"a", "b"}, ids)
+	assert.Equal(t, []float64{0, 0}, scores)
+}
+
+func TestLLMReranker(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		replyErr  error
+		ids       []string
+		scores    []float64
+		expectErr bool
+	}{
+		{name: "orders by rating", reply: "1: 0.2\n2: 0.9\n3: 0.5", ids: []string{"b", "c", "a"}, scores: []float64{0.9, 0.5, 0.2}},
+		{name: "accepts bracketed numbers", reply: "[1] - 0.1\n[2] = 0.3\n[3]: 1", ids: []string{"c", "b", "a"}, scores: []float64{1, 0.3, 0.1}},
+		{name: "passages left out score 0", reply: "3: 0.7", ids: []string{"c", "a", "b"}, scores: []float64{0.7, 0, 0}},
+		{name: "ignores unknown passages and ratings out of range", reply: "4: 0.9\n1: 7\n2: 0.4", ids: []string{"b", "a", "c"}, scores: []float64{0.4, 0, 0}},
+		{name: "reply without ratings", reply: "All of them are relevant.", expectErr: true},
+		{name: "failed call", replyErr: errors.New("rate limited"), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request openai.ChatCompletionNewParams
+			cc := &mockChatCompleter{
+				newFunc: func(_ context.Context, body openai.ChatCompletionNewParams, _ ...option.RequestOption) (*openai.ChatCompletion, error) {
+					request = body
+					if tt.replyErr != nil {
+						return nil, tt.replyErr
+					}
+					return makeChatCompletion(tt.reply), nil
+				},
+			}
+			reranker := NewLLMReranker(cc, "judge-model")
+
+			ranked, err := reranker.Rerank(context.Background(), "Where is the Louvre?", rerankCandidates("first", "second", "third"))
+
+			assert.Equal(t, "judge-model", request.Model)
+			prompt := messageTexts(request.Messages)[0]
+			assert.Contains(t, prompt, "[2] second")
+			assert.Contains(t, prompt, "Question: Where is the Louvre?")
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			ids, scores := rankedIDs(ranked)
+			assert.Equal(t, tt.ids, ids)
+			assert.Equal(t, tt.scores, scores)
+		})
+	}
+}
+
+func TestHTTPReranker(t *testing.T) {
+	var requests []rerankRequest
+	statuses := []int{http.StatusTooManyRequests}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/rerank", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var request rerankRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+		w.Write([]byte(`{"results": [{"index": 2, "relevance_score": 0.95}, {"index": 0, "relevance_score": 0.4}, {"index": 1, "relevance_score": 0.01}]}`))
+	}))
+	defer server.Close()
+
+	reranker := NewHTTPReranker(config.ProviderConfig{BaseURL: server.URL + "/v2/", APIKey: "test-key", Model: "rerank-test", MaxRetries: 1})
+	reranker.retrier.sleep = func(context.Context, time.Duration) error { return nil }
+
+	ranked, err := reranker.Rerank(context.Background(), "capital of France", rerankCandidates("first", "second", "third"))
+
+	require.NoError(t, err)
+	ids, scores := rankedIDs(ranked)
+	assert.Equal(t, []string{"c", "a", "b"}, ids)
+	assert.Equal(t, []float64{0.95, 0.4, 0.01}, scores)
+	require.Len(t, requests, 2, "a rate limited call is retried")
+	assert.Equal(t, rerankRequest{Model: "rerank-test", Query: "capital of France", Documents: []string{"first", "second", "third"}, TopN: 3}, requests[1])
+}
+
+func TestHTTPReranker_RetriesTruncatedReply(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		if calls == 1 {
+			// The connection drops part way through the first reply
+			w.Header().Set("Content-Length", "200")
+			w.Write([]byte(`{"results": [{"index": 0, "relevance_score": 0.9}, {"index": 1,`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"index": 1, "relevance_score": 0.8}]}`))
+	}))
+	defer server.Close()
+
+	reranker := NewHTTPReranker(config.ProviderConfig{BaseURL: server.URL, MaxRetries: 1})
+	reranker.retrier.sleep = func(context.Context, time.Duration) error { return nil }
+
+	ranked, err := reranker.Rerank(context.Background(), "q", rerankCandidates("first", "second"))
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	ids, scores := rankedIDs(ranked)
+	assert.Equal(t, []string{"b", "a"}, ids)
+	assert.Equal(t, []float64{0.8, 0}, scores, "only the successful attempt's scores count")
+}
+
+func TestHTTPReranker_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		calls  int
+	}{
+		{name: "client errors are not retried", status: http.StatusUnauthorized, body: `{"message": "invalid api token"}`, calls: 1},
+		{name: "server errors are retried", status: http.StatusBadGateway, calls: 2},
+		{name: "unknown document index", status: http.StatusOK, body: `{"results": [{"index": 5, "relevance_score": 0.5}]}`, calls: 1},
+		{name: "malformed reply", status: http.StatusOK, body: `not json`, calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls++
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			reranker := NewHTTPReranker(config.ProviderConfig{BaseURL: server.URL, MaxRetries: 1})
+			reranker.retrier.sleep = func(context.Context, time.Duration) error { return nil }
+
+			_, err := reranker.Rerank(context.Background(), "q", rerankCandidates("first"))
+
+			assert.Error(t, err)
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
+
+func TestQuery_Rerank(t *testing.T) {
+	candidates := rerankCandidates("one", "two", "three", "four", "five", "six")
+	rescored := map[string]float64{"a": 0.1, "b": 0.6, "c": 0.05, "d": 0.9, "e": 0.3, "f": 0.7}
+
+	tests := []struct {
+		name      string
+		rerankErr error
+		minScore  float64
+		ids       []string
+		scores    []float64
+		logged    string
+	}{
+		{name: "reorders the candidates", ids: []string{"d", "f", "b", "e", "a", "c"}, scores: []float64{0.9, 0.7, 0.6, 0.3, 0.1, 0.05}},
+		{name: "drops candidates below the minimum score", minScore: 0.5, ids: []string{"d", "f", "b"}, scores: []float64{0.9, 0.7, 0.6}},
+		{name: "falls back to lexical overlap", rerankErr: errors.New("rerank API down"), ids: []string{"b", "a", "c", "d", "e", "f"}, scores: []float64{1, 0, 0, 0, 0, 0},
+			logged: "Reranking with http failed, falling back to lexical overlap: rerank API down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					return makeEmbeddingResponse([][]float64{{0.1}}), nil
+				},
+			}
+			cc := &mockChatCompleter{
+				newFunc: func(context.Context, openai.ChatCompletionNewParams, ...option.RequestOption) (*openai.ChatCompletion, error) {
+					return makeChatCompletion("answer"), nil
+				},
+			}
+			var searchLimit int
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func(_ []float64, limit int, _ types.SearchOptions) ([]types.ScoredChunk, error) {
+					searchLimit = limit
+					return candidates[:min(limit, len(candidates))], nil
+				},
+			}
+			var reranked []types.ScoredChunk
+			pipeline := newTestPipeline(ec, cc, vs)
+			pipeline.config.Reranker = config.RerankerHTTP
+			pipeline.config.RerankCandidates = 30
+			pipeline.config.RerankMinScore = tt.minScore
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+			pipeline.reranker = &mockReranker{
+				rerankFunc: func(_ context.Context, query string, candidates []types.ScoredChunk) ([]types.ScoredChunk, error) {
+					assert.Equal(t, "Which one is two?", query)
+					reranked = candidates
+					if tt.rerankErr != nil {
+						return nil, tt.rerankErr
+					}
+					scores := make([]float64, len(candidates))
+					for i, candidate := range candidates {
+						scores[i] = rescored[candidate.Chunk.ID]
+					}
+					return rankByScores(candidates, scores), nil
+				},
+			}
+
+			response, err := pipeline.Query(types.QueryRequest{Question: "Which one is two?"})
+
+			require.NoError(t, err)
+			assert.Equal(t, 30, searchLimit, "over-fetches for the reranker")
+			assert.Len(t, reranked, 6)
+			ids := make([]string, len(response.Sources))
+			for i, source := range response.Sources {
+				ids[i] = source.ID
+			}
+			assert.Equal(t, tt.ids, ids)
+			assert.Equal(t, tt.scores, response.SourceScores)
+			if tt.logged == "" {
+				assert.Empty(t, logs.String())
+			} else {
+				assert.Contains(t, logs.String(), tt.logged)
+			}
+		})
+	}
+}
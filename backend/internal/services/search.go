@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"rag-backend/pkg/types"
+)
+
+// defaultSearchResults is how many results a search returns when it doesn't
+// ask for a number
+const defaultSearchResults = 10
+
+// ErrEmbeddingDimension is returned by Search when the caller's embedding has
+// a different dimension than the indexed ones
+var ErrEmbeddingDimension = errors.New("embedding dimension does not match the index")
+
+// Search returns the chunks most similar to the request's query, or to its
+// embedding when the caller embedded the query themselves, without asking
+// the chat model. Each result highlights the words that match the query's
+// content words. Embeddings are left out of the results.
+func (rp *RAGPipeline) Search(request types.SearchRequest) ([]types.SearchResult, error) {
+	embedding := request.Embedding
+	if len(embedding) > 0 {
+		// Stores find nothing for a vector of another dimension, which would
+		// pass for a search without matches, so refuse it up front
+		if rp.dimensioner != nil {
+			if indexed := rp.dimensioner.Dimension(); indexed > 0 && indexed != len(embedding) {
+				return nil, fmt.Errorf("%w: got %d values, expected %d", ErrEmbeddingDimension, len(embedding), indexed)
+			}
+		}
+	} else {
+		var err error
+		embedding, err = rp.generateEmbedding(request.Query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate embedding for query: %w", err)
+		}
+	}
+
+	topK := request.TopK
+	if topK <= 0 {
+		topK = defaultSearchResults
+	}
+
+	scoredChunks, err := rp.vectorStore.Search(embedding, topK, searchOptions(types.QueryRequest{
+		Collection:  request.Collection,
+		Collections: request.Collections,
+		Filter:      request.Filter,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vector store: %w", err)
+	}
+
+	results := make([]types.SearchResult, len(scoredChunks))
+	for i, scored := range scoredChunks {
+		scored.Chunk.Embedding = nil
+		results[i] = types.SearchResult{
+			ScoredChunk: scored,
+			Highlights:  highlightTerms(request.Query, scored.Chunk.Content),
+		}
+	}
+	return results, nil
+}
+
+// highlightTerms finds the words of text that are content words of query,
+// matching them as keyword search does, case-insensitively and whole
+func highlightTerms(query, text string) []types.Highlight {
+	highlights := []types.Highlight{}
+	terms := contentTerms(query)
+	if len(terms) == 0 {
+		return highlights
+	}
+
+	// start is the byte offset of the word being read, or -1 between words
+	start, position := -1, 0
+	for i, r := range text + " " {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			word := strings.ToLower(text[start:i])
+			if _, ok := terms[word]; ok {
+				length := utf8.RuneCountInString(text[start:i])
+				highlights = append(highlights, types.Highlight{Term: word, Start: position - length, End: position})
+			}
+			start = -1
+		}
+		position++
+	}
+	return highlights
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"rag-backend/internal/repositories/vectorstore"
+	"rag-backend/pkg/filter"
+	"rag-backend/pkg/types"
+)
+
+func TestSearch(t *testing.T) {
+	stored := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "c1", Content: "Paris is the capital of France.", Embedding: []float64{1, 0, 0}, Metadata: map[string]string{"source": "a.txt"}}, Score: 0.9},
+		{Chunk: types.DocumentChunk{ID: "c2", Content: "Berlin is in Germany.", Embedding: []float64{0, 1, 0}}, Score: 0.4},
+	}
+
+	tests := []struct {
+		name       string
+		request    types.SearchRequest
+		embedCalls int
+		embedding  []float64
+		limit      int
+		highlights [][]types.Highlight
+		// dimension is the store's embedding dimension, 0 when it can't tell
+		dimension int
+		err       error
+	}{
+		{
+			name:       "embeds the query",
+			request:    types.SearchRequest{Query: "capital of France", TopK: 2},
+			embedCalls: 1,
+			embedding:  []float64{0.5, 0.5, 0},
+			limit:      2,
+			highlights: [][]types.Highlight{
+				{{Term: "capital", Start: 13, End: 20}, {Term: "france", Start: 24, End: 30}},
+				{},
+			},
+		},
+		{
+			name:       "searches with the caller's embedding",
+			request:    types.SearchRequest{Embedding: []float64{1, 0, 0}},
+			embedding:  []float64{1, 0, 0},
+			limit:      defaultSearchResults,
+			highlights: [][]types.Highlight{{}, {}},
+		},
+		{
+			name:       "highlights the query alongside an embedding",
+			request:    types.SearchRequest{Query: "germany", Embedding: []float64{0, 1, 0}},
+			embedding:  []float64{0, 1, 0},
+			limit:      defaultSearchResults,
+			highlights: [][]types.Highlight{{}, {{Term: "germany", Start: 13, End: 20}}},
+		},
+		{
+			name:       "checks the caller's embedding against the store",
+			request:    types.SearchRequest{Embedding: []float64{1, 0, 0}},
+			embedding:  []float64{1, 0, 0},
+			limit:      defaultSearchResults,
+			highlights: [][]types.Highlight{{}, {}},
+			dimension:  3,
+		},
+		{
+			name:      "rejects an embedding of another dimension before searching",
+			request:   types.SearchRequest{Embedding: []float64{1, 0}},
+			dimension: 3,
+			err:       ErrEmbeddingDimension,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedCalls := 0
+			ec := &mockEmbeddingCreator{
+				newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+					embedCalls++
+					return makeEmbeddingResponse([][]float64{{0.5, 0.5, 0}}), nil
+				},
+			}
+			var embedding []float64
+			var limit int
+			var options types.SearchOptions
+			vs := &vectorstore.MockVectorStore{
+				SearchFunc: func(e []float64, l int, o types.SearchOptions) ([]types.ScoredChunk, error) {
+					embedding, limit, options = e, l, o
+					return stored, nil
+				},
+			}
+			pipeline := newTestPipeline(ec, nil, vs)
+			if tt.dimension > 0 {
+				pipeline.dimensioner = &vectorstore.MockDimensioner{
+					DimensionFunc: func() int { return tt.dimension },
+				}
+			}
+
+			request := tt.request
+			request.Collections = []string{"default"}
+			request.Filter = &filter.Expr{Field: "source", In: []filter.Value{"a.txt"}}
+			results, err := pipeline.Search(request)
+
+			assert.Equal(t, tt.limit, limit)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, embedding, "the store is not searched")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"default"}, options.Collections)
+			assert.Equal(t, request.Filter, options.MetadataFilter)
+			assert.Equal(t, tt.embedCalls, embedCalls)
+			assert.Equal(t, tt.embedding, embedding)
+			require.Len(t, results, 2)
+			for i, result := range results {
+				assert.Equal(t, stored[i].Chunk.ID, result.Chunk.ID)
+				assert.Equal(t, stored[i].Score, result.Score)
+				assert.Equal(t, stored[i].Chunk.Metadata, result.Chunk.Metadata)
+				assert.Nil(t, result.Chunk.Embedding, "embeddings are left out")
+				assert.Equal(t, tt.highlights[i], result.Highlights)
+			}
+			assert.NotNil(t, stored[0].Chunk.Embedding, "stored chunks are not modified")
+		})
+	}
+}
+
+func TestSearch_EmbeddingError(t *testing.T) {
+	ec := &mockEmbeddingCreator{
+		newFunc: func(context.Context, openai.EmbeddingNewParams, ...option.RequestOption) (*openai.CreateEmbeddingResponse, error) {
+			return nil, errors.New("rate limited")
+		},
+	}
+	pipeline := newTestPipeline(ec, nil, &vectorstore.MockVectorStore{})
+
+	_, err := pipeline.Search(types.SearchRequest{Query: "q"})
+
+	assert.ErrorContains(t, err, "failed to generate embedding for query: rate limited")
+}
+
+func TestHighlightTerms(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		text     string
+		expected []types.Highlight
+	}{
+		{
+			name:     "matches whole words case-insensitively",
+			query:    "Timeout errors",
+			text:     "A TIMEOUT. Errors, timeouts and ERR_TIMEOUT.",
+			expected: []types.Highlight{{Term: "timeout", Start: 2, End: 9}, {Term: "errors", Start: 11, End: 17}},
+		},
+		{
+			name:     "offsets are in characters",
+			query:    "café",
+			text:     "Ein Café in Köln: café.",
+			expected: []types.Highlight{{Term: "café", Start: 4, End: 8}, {Term: "café", Start: 18, End: 22}},
+		},
+		{name: "stopwords and short words are not highlighted", query: "what is it", text: "What is it?", expected: []types.Highlight{}},
+		{name: "no query", text: "anything", expected: []types.Highlight{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, highlightTerms(tt.query, tt.text))
+		})
+	}
+}
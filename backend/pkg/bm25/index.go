@@ -0,0 +1,169 @@
+package bm25
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"rag-backend/pkg/types"
+)
+
+const (
+	// DefaultK1 controls term frequency saturation
+	DefaultK1 = 1.2
+	// DefaultB controls document length normalization
+	DefaultB = 0.75
+)
+
+type entry struct {
+	chunk  types.DocumentChunk
+	length int
+}
+
+// Index is an in-memory inverted index that ranks chunks with Okapi BM25.
+type Index struct {
+	k1          float64
+	b           float64
+	postings    map[string]map[int]int
+	entries     map[int]entry
+	byDocument  map[string][]int
+	nextID      int
+	totalLength int
+	mutex       sync.RWMutex
+}
+
+func NewIndex() *Index {
+	return &Index{
+		k1:         DefaultK1,
+		b:          DefaultB,
+		postings:   make(map[string]map[int]int),
+		entries:    make(map[int]entry),
+		byDocument: make(map[string][]int),
+	}
+}
+
+func (idx *Index) Add(chunks []types.DocumentChunk) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.add(chunks)
+}
+
+// RemoveDocument drops every chunk of the document and returns how many were removed.
+func (idx *Index) RemoveDocument(documentID string) int {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	return idx.remove(documentID)
+}
+
+// ReplaceDocument swaps the document's chunks for new ones in a single step,
+// so searches never see both versions or neither. It returns how many chunks
+// were removed.
+func (idx *Index) ReplaceDocument(documentID string, chunks []types.DocumentChunk) int {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	removed := idx.remove(documentID)
+	idx.add(chunks)
+	return removed
+}
+
+func (idx *Index) add(chunks []types.DocumentChunk) {
+	for _, chunk := range chunks {
+		terms := Tokenize(chunk.Content)
+		id := idx.nextID
+		idx.nextID++
+
+		// The index only needs the text; embeddings stay in the vector store
+		chunk.Embedding = nil
+		idx.entries[id] = entry{chunk: chunk, length: len(terms)}
+		idx.byDocument[chunk.DocumentID] = append(idx.byDocument[chunk.DocumentID], id)
+		idx.totalLength += len(terms)
+
+		for _, term := range terms {
+			postings, ok := idx.postings[term]
+			if !ok {
+				postings = make(map[int]int)
+				idx.postings[term] = postings
+			}
+			postings[id]++
+		}
+	}
+}
+
+func (idx *Index) remove(documentID string) int {
+	ids := idx.byDocument[documentID]
+	for _, id := range ids {
+		e := idx.entries[id]
+		for _, term := range Tokenize(e.chunk.Content) {
+			postings := idx.postings[term]
+			delete(postings, id)
+			if len(postings) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+		idx.totalLength -= e.length
+		delete(idx.entries, id)
+	}
+	delete(idx.byDocument, documentID)
+	return len(ids)
+}
+
+// Search returns up to limit chunks within the options' scope, ranked by BM25
+// score against the query. Chunks that share no term with the query are not
+// returned. Corpus statistics cover the whole index, not just the scope.
+func (idx *Index) Search(query string, limit int, options types.SearchOptions) []types.ScoredChunk {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if len(idx.entries) == 0 || limit <= 0 {
+		return []types.ScoredChunk{}
+	}
+
+	n := float64(len(idx.entries))
+	avgLength := float64(idx.totalLength) / n
+	scores := make(map[int]float64)
+
+	seen := make(map[string]struct{})
+	for _, term := range Tokenize(query) {
+		if _, dup := seen[term]; dup {
+			continue
+		}
+		seen[term] = struct{}{}
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			lengthNorm := 1 - idx.b
+			if avgLength > 0 {
+				lengthNorm += idx.b * float64(idx.entries[id].length) / avgLength
+			}
+			f := float64(tf)
+			scores[id] += idf * f * (idx.k1 + 1) / (f + idx.k1*lengthNorm)
+		}
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		if options.Matches(idx.entries[id].chunk) {
+			ids = append(ids, id)
+		}
+	}
+	// Ties fall back to insertion order so results are deterministic
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	k := min(limit, len(ids))
+	results := make([]types.ScoredChunk, k)
+	for i := 0; i < k; i++ {
+		results[i] = types.ScoredChunk{Chunk: idx.entries[ids[i]].chunk, Score: scores[ids[i]]}
+	}
+	return results
+}
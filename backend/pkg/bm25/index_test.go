@@ -0,0 +1,181 @@
+package bm25
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/pkg/types"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "lowercases and splits on punctuation", text: "Hello, World!", expected: []string{"hello", "world"}},
+		{name: "keeps identifiers with underscores whole", text: "got ERR_CONN_RESET (E1234)", expected: []string{"got", "err_conn_reset", "e1234"}},
+		{name: "splits dotted versions into parts", text: "v1.2", expected: []string{"v1", "2"}},
+		{name: "handles unicode letters", text: "café naïve", expected: []string{"café", "naïve"}},
+		{name: "returns empty for punctuation only", text: "!!! ---", expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Tokenize(tt.text)
+			if len(tt.expected) == 0 {
+				assert.Empty(t, result)
+				return
+			}
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func ids(results []types.ScoredChunk) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Chunk.ID
+	}
+	return out
+}
+
+func TestIndexSearch(t *testing.T) {
+	chunks := []types.DocumentChunk{
+		{ID: "timeout", DocumentID: "d1", Content: "The client returns ERR_TIMEOUT when the server is slow."},
+		{ID: "reset", DocumentID: "d1", Content: "ERR_CONN_RESET means the connection was reset by the peer."},
+		{ID: "install", DocumentID: "d2", Content: "Install the package and restart the server."},
+		{ID: "server-heavy", DocumentID: "d2", Content: "server server server configuration for the server"},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		limit    int
+		expected []string
+	}{
+		{
+			name:     "finds exact identifier",
+			query:    "what does ERR_CONN_RESET mean?",
+			limit:    4,
+			expected: []string{"reset"},
+		},
+		{
+			name:     "ranks higher term frequency first",
+			query:    "server",
+			limit:    4,
+			expected: []string{"server-heavy", "install", "timeout"},
+		},
+		{
+			name:     "rare terms outweigh common ones",
+			query:    "server timeout err_timeout",
+			limit:    1,
+			expected: []string{"timeout"},
+		},
+		{
+			name:     "respects limit",
+			query:    "server",
+			limit:    1,
+			expected: []string{"server-heavy"},
+		},
+		{
+			name:     "returns nothing for unknown terms",
+			query:    "kubernetes",
+			limit:    4,
+			expected: []string{},
+		},
+		{
+			name:     "returns nothing for zero limit",
+			query:    "server",
+			limit:    0,
+			expected: []string{},
+		},
+	}
+
+	idx := NewIndex()
+	idx.Add(chunks)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := idx.Search(tt.query, tt.limit, types.SearchOptions{})
+			assert.Equal(t, tt.expected, ids(results))
+			for i := 1; i < len(results); i++ {
+				assert.GreaterOrEqual(t, results[i-1].Score, results[i].Score)
+			}
+		})
+	}
+}
+
+func TestIndexSearch_EmptyIndex(t *testing.T) {
+	assert.Empty(t, NewIndex().Search("anything", 5, types.SearchOptions{}))
+}
+
+func TestIndexAdd_DropsEmbeddings(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]types.DocumentChunk{{ID: "c", Content: "hello", Embedding: []float64{1, 2}}})
+
+	results := idx.Search("hello", 1, types.SearchOptions{})
+
+	assert.Len(t, results, 1)
+	assert.Nil(t, results[0].Chunk.Embedding)
+}
+
+func TestIndexRemoveDocument(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]types.DocumentChunk{
+		{ID: "a-0", DocumentID: "a", Content: "shared alpha"},
+		{ID: "a-1", DocumentID: "a", Content: "shared beta"},
+		{ID: "b-0", DocumentID: "b", Content: "shared gamma"},
+	})
+
+	assert.Equal(t, 2, idx.RemoveDocument("a"))
+	assert.Equal(t, 0, idx.RemoveDocument("a"))
+
+	assert.Equal(t, []string{"b-0"}, ids(idx.Search("shared alpha beta gamma", 10, types.SearchOptions{})))
+	assert.Empty(t, idx.Search("alpha", 10, types.SearchOptions{}))
+	assert.NotContains(t, idx.postings, "alpha", "empty posting lists should be dropped")
+	assert.Equal(t, 2, idx.totalLength)
+}
+
+func TestIndexReplaceDocument(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]types.DocumentChunk{
+		{ID: "a-0", DocumentID: "a", Content: "old alpha"},
+		{ID: "b-0", DocumentID: "b", Content: "gamma"},
+	})
+
+	removed := idx.ReplaceDocument("a", []types.DocumentChunk{
+		{ID: "a-0", DocumentID: "a", Content: "new alpha"},
+	})
+
+	assert.Equal(t, 1, removed)
+	assert.Empty(t, idx.Search("old", 10, types.SearchOptions{}))
+	assert.Equal(t, []string{"a-0"}, ids(idx.Search("new", 10, types.SearchOptions{})))
+	assert.Equal(t, []string{"b-0"}, ids(idx.Search("gamma", 10, types.SearchOptions{})))
+}
+
+func TestIndexSearch_CollectionScope(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]types.DocumentChunk{
+		{ID: "legacy", Content: "invoice terms"},
+		{ID: "contract", Collection: "contracts", Content: "invoice terms and penalties"},
+	})
+
+	tests := []struct {
+		name        string
+		collections []string
+		expected    []string
+	}{
+		{name: "unscoped", expected: []string{"legacy", "contract"}},
+		{name: "default collection", collections: []string{types.DefaultCollection}, expected: []string{"legacy"}},
+		{name: "named collection", collections: []string{"contracts"}, expected: []string{"contract"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := idx.Search("invoice", 10, types.SearchOptions{Collections: tt.collections})
+			assert.ElementsMatch(t, tt.expected, ids(results))
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package bm25
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize lowercases text and splits it on anything that is not a letter,
+// digit or underscore, so identifiers like ERR_TIMEOUT or E1234 stay whole.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
@@ -2,11 +2,19 @@ package codes
 
 // Upload error codes
 const (
-	ErrNoFile       = "NO_FILE"
-	ErrFileTooLarge = "FILE_TOO_LARGE"
-	ErrProcessing   = "PROCESSING_ERROR"
-	ErrChunking     = "CHUNKING_ERROR"
-	ErrStorage      = "STORAGE_ERROR"
+	ErrNoFile          = "NO_FILE"
+	ErrFileTooLarge    = "FILE_TOO_LARGE"
+	ErrProcessing      = "PROCESSING_ERROR"
+	ErrChunking        = "CHUNKING_ERROR"
+	ErrStorage         = "STORAGE_ERROR"
+	ErrInvalidMetadata = "INVALID_METADATA"
+	// ErrUnsupportedFileType means no extractor handles the detected file type
+	ErrUnsupportedFileType = "UNSUPPORTED_FILE_TYPE"
+	// ErrContentTypeMismatch means the file's bytes contradict its declared
+	// Content-Type or extension
+	ErrContentTypeMismatch = "CONTENT_TYPE_MISMATCH"
+	// ErrQueueFull means the ingestion queue has no room; retry later
+	ErrQueueFull = "QUEUE_FULL"
 )
 
 // Query error codes
@@ -15,4 +23,52 @@ const (
 	ErrEmptyQuestion  = "EMPTY_QUESTION"
 	ErrQueryError     = "QUERY_ERROR"
 	ErrStreamError    = "STREAM_ERROR"
+	ErrInvalidFilter  = "INVALID_FILTER"
+)
+
+// No-answer codes, sent with a query response that was answered without
+// asking the chat model
+const (
+	// NoDocuments means nothing is indexed in the query's collections that
+	// matches its filter
+	NoDocuments = "NO_DOCUMENTS"
+	// NoRelevantContext means no retrieved chunk was relevant enough to
+	// answer from
+	NoRelevantContext = "NO_RELEVANT_CONTEXT"
+)
+
+// Search error codes
+const (
+	ErrEmptyQuery  = "EMPTY_QUERY"
+	ErrSearchError = "SEARCH_ERROR"
+	// ErrInvalidEmbedding means a search embedding's dimension doesn't match
+	// the index
+	ErrInvalidEmbedding = "INVALID_EMBEDDING"
+)
+
+// Document error codes
+const (
+	ErrDocumentNotFound = "DOCUMENT_NOT_FOUND"
+	ErrDocumentError    = "DOCUMENT_ERROR"
+)
+
+// Conversation error codes
+const (
+	ErrConversationNotFound = "CONVERSATION_NOT_FOUND"
+	ErrConversationError    = "CONVERSATION_ERROR"
+)
+
+// Collection error codes
+const (
+	ErrCollectionNotFound = "COLLECTION_NOT_FOUND"
+	ErrCollectionExists   = "COLLECTION_EXISTS"
+	ErrInvalidCollection  = "INVALID_COLLECTION"
+	ErrCollectionError    = "COLLECTION_ERROR"
+)
+
+// Job error codes
+const (
+	ErrJobNotFound       = "JOB_NOT_FOUND"
+	ErrJobNotCancellable = "JOB_NOT_CANCELLABLE"
+	ErrJobError          = "JOB_ERROR"
 )
@@ -0,0 +1,303 @@
+// Package filter evaluates metadata filter expressions against the string
+// metadata attached to document chunks.
+//
+// Expressions are JSON trees. A leaf tests one metadata field with a single
+// operator; "and" and "or" combine sub-expressions:
+//
+//	{"and": [
+//	  {"field": "department", "in": ["legal", "finance"]},
+//	  {"field": "version", "gte": 2},
+//	  {"or": [
+//	    {"field": "tag", "prefix": "contract-"},
+//	    {"field": "published", "gte": "2024-01-01", "lt": "2025-01-01"}
+//	  ]}
+//	]}
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilter is returned by Validate for malformed expressions.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// maxDepth bounds how deeply "and"/"or" may nest
+const maxDepth = 8
+
+// dateLayouts are the date formats accepted by range operators
+var dateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// Value is a scalar operand. JSON strings, numbers and booleans are all
+// accepted and kept in their textual form, since metadata is stored as
+// strings. Equality compares numerically when both sides are numbers.
+type Value string
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch raw := raw.(type) {
+	case string:
+		*v = Value(raw)
+	case float64, bool:
+		*v = Value(strings.Trim(string(data), " \t\r\n"))
+	default:
+		return fmt.Errorf("filter values must be strings, numbers or booleans, got %s", data)
+	}
+	return nil
+}
+
+// Expr is a filter expression. Exactly one of And, Or or Field is set. A leaf
+// sets exactly one of Eq, In or Prefix, or any of the range bounds.
+type Expr struct {
+	And []Expr `json:"and,omitempty"`
+	Or  []Expr `json:"or,omitempty"`
+
+	Field  string  `json:"field,omitempty"`
+	Eq     *Value  `json:"eq,omitempty"`
+	In     []Value `json:"in,omitempty"`
+	Prefix *Value  `json:"prefix,omitempty"`
+	// Range bounds compare numerically when both sides are numbers and
+	// chronologically when both are dates (RFC 3339 or YYYY-MM-DD)
+	Gt  *Value `json:"gt,omitempty"`
+	Gte *Value `json:"gte,omitempty"`
+	Lt  *Value `json:"lt,omitempty"`
+	Lte *Value `json:"lte,omitempty"`
+}
+
+// Validate reports whether the expression is well formed. A nil expression
+// is valid and matches everything.
+func (e *Expr) Validate() error {
+	if e == nil {
+		return nil
+	}
+	return e.validate(1)
+}
+
+func (e *Expr) validate(depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("%w: expressions nest deeper than %d levels", ErrInvalidFilter, maxDepth)
+	}
+
+	kinds := 0
+	for _, set := range []bool{e.And != nil, e.Or != nil, e.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf(`%w: each expression needs exactly one of "and", "or" or "field"`, ErrInvalidFilter)
+	}
+
+	switch {
+	case e.And != nil:
+		return validateAll("and", e.And, depth)
+	case e.Or != nil:
+		return validateAll("or", e.Or, depth)
+	}
+	return e.validateLeaf()
+}
+
+func validateAll(operator string, exprs []Expr, depth int) error {
+	if len(exprs) == 0 {
+		return fmt.Errorf("%w: %q needs at least one expression", ErrInvalidFilter, operator)
+	}
+	for i := range exprs {
+		if err := exprs[i].validate(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Expr) validateLeaf() error {
+	operators := 0
+	if e.Eq != nil {
+		operators++
+	}
+	if e.In != nil {
+		operators++
+		if len(e.In) == 0 {
+			return fmt.Errorf(`%w: "in" on %q needs at least one value`, ErrInvalidFilter, e.Field)
+		}
+	}
+	if e.Prefix != nil {
+		operators++
+	}
+	bounds := e.bounds()
+	if len(bounds) > 0 {
+		operators++
+	}
+	if operators != 1 {
+		return fmt.Errorf(`%w: field %q needs exactly one of "eq", "in", "prefix" or a range`, ErrInvalidFilter, e.Field)
+	}
+
+	if e.Gt != nil && e.Gte != nil || e.Lt != nil && e.Lte != nil {
+		return fmt.Errorf("%w: field %q sets the same range bound twice", ErrInvalidFilter, e.Field)
+	}
+
+	// Mixing numbers and dates in one range can never match, so reject it
+	var kind valueKind
+	for _, bound := range bounds {
+		boundKind := kindOf(string(*bound.value))
+		if boundKind == kindText {
+			return fmt.Errorf("%w: range bound %q on field %q is neither a number nor a date", ErrInvalidFilter, *bound.value, e.Field)
+		}
+		if kind != kindText && kind != boundKind {
+			return fmt.Errorf("%w: range on field %q mixes numbers and dates", ErrInvalidFilter, e.Field)
+		}
+		kind = boundKind
+	}
+	return nil
+}
+
+// Match reports whether metadata satisfies the expression. A nil expression
+// matches everything; a missing field matches nothing.
+func (e *Expr) Match(metadata map[string]string) bool {
+	if e == nil {
+		return true
+	}
+
+	switch {
+	case e.And != nil:
+		for i := range e.And {
+			if !e.And[i].Match(metadata) {
+				return false
+			}
+		}
+		return true
+	case e.Or != nil:
+		for i := range e.Or {
+			if e.Or[i].Match(metadata) {
+				return true
+			}
+		}
+		return false
+	}
+
+	value, ok := metadata[e.Field]
+	if !ok {
+		return false
+	}
+
+	switch {
+	case e.Eq != nil:
+		return equal(value, string(*e.Eq))
+	case e.In != nil:
+		return slices.ContainsFunc(e.In, func(v Value) bool { return equal(value, string(v)) })
+	case e.Prefix != nil:
+		return strings.HasPrefix(value, string(*e.Prefix))
+	}
+
+	for _, bound := range e.bounds() {
+		order, ok := compare(value, string(*bound.value))
+		if !ok || !bound.accepts(order) {
+			return false
+		}
+	}
+	return true
+}
+
+type bound struct {
+	value   *Value
+	accepts func(order int) bool
+}
+
+func (e *Expr) bounds() []bound {
+	var bounds []bound
+	if e.Gt != nil {
+		bounds = append(bounds, bound{e.Gt, func(order int) bool { return order > 0 }})
+	}
+	if e.Gte != nil {
+		bounds = append(bounds, bound{e.Gte, func(order int) bool { return order >= 0 }})
+	}
+	if e.Lt != nil {
+		bounds = append(bounds, bound{e.Lt, func(order int) bool { return order < 0 }})
+	}
+	if e.Lte != nil {
+		bounds = append(bounds, bound{e.Lte, func(order int) bool { return order <= 0 }})
+	}
+	return bounds
+}
+
+type valueKind int
+
+const (
+	kindText valueKind = iota
+	kindNumber
+	kindDate
+)
+
+func kindOf(s string) valueKind {
+	if _, ok := parseNumber(s); ok {
+		return kindNumber
+	}
+	if _, ok := parseDate(s); ok {
+		return kindDate
+	}
+	return kindText
+}
+
+// equal reports whether a metadata value equals an operand, numerically when
+// both are numbers so that 2 matches 2.0
+func equal(value, operand string) bool {
+	if value == operand {
+		return true
+	}
+	v, ok := parseNumber(value)
+	if !ok {
+		return false
+	}
+	o, ok := parseNumber(operand)
+	return ok && v == o
+}
+
+// compare orders a metadata value against a range bound. It reports false
+// when the two are not both numbers or both dates.
+func compare(value, bound string) (int, bool) {
+	if b, ok := parseNumber(bound); ok {
+		v, ok := parseNumber(value)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case v < b:
+			return -1, true
+		case v > b:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	b, ok := parseDate(bound)
+	if !ok {
+		return 0, false
+	}
+	v, ok := parseDate(value)
+	if !ok {
+		return 0, false
+	}
+	return v.Compare(b), true
+}
+
+func parseNumber(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f, err == nil
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, raw string) *Expr {
+	t.Helper()
+	var expr Expr
+	require.NoError(t, json.Unmarshal([]byte(raw), &expr))
+	return &expr
+}
+
+func TestValueUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected Value
+		err      bool
+	}{
+		{name: "string", raw: `"legal"`, expected: "legal"},
+		{name: "integer keeps its text", raw: `2`, expected: "2"},
+		{name: "decimal keeps its text", raw: `1.50`, expected: "1.50"},
+		{name: "boolean", raw: `true`, expected: "true"},
+		{name: "rejects arrays", raw: `["a"]`, err: true},
+		{name: "rejects objects", raw: `{"a":1}`, err: true},
+		{name: "rejects null", raw: `null`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Value
+			err := json.Unmarshal([]byte(tt.raw), &v)
+
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, v)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{name: "equality", raw: `{"field":"department","eq":"legal"}`},
+		{name: "in list", raw: `{"field":"department","in":["legal","hr"]}`},
+		{name: "prefix", raw: `{"field":"tag","prefix":"contract-"}`},
+		{name: "numeric range", raw: `{"field":"version","gte":2,"lt":"5"}`},
+		{name: "date range", raw: `{"field":"published","gt":"2024-01-01","lte":"2024-12-31T23:59:59Z"}`},
+		{name: "nested and/or", raw: `{"and":[{"field":"a","eq":"1"},{"or":[{"field":"b","eq":"2"},{"field":"c","prefix":"x"}]}]}`},
+		{name: "empty expression", raw: `{}`, expected: `exactly one of "and", "or" or "field"`},
+		{name: "field and combinator", raw: `{"field":"a","eq":"1","and":[{"field":"b","eq":"2"}]}`, expected: `exactly one of "and", "or" or "field"`},
+		{name: "empty and", raw: `{"and":[]}`, expected: `"and" needs at least one expression`},
+		{name: "invalid child", raw: `{"or":[{"field":"a"}]}`, expected: `field "a" needs exactly one of`},
+		{name: "two operators", raw: `{"field":"a","eq":"1","prefix":"x"}`, expected: `field "a" needs exactly one of`},
+		{name: "empty in list", raw: `{"field":"a","in":[]}`, expected: `"in" on "a" needs at least one value`},
+		{name: "duplicate bound", raw: `{"field":"a","gt":1,"gte":2}`, expected: "sets the same range bound twice"},
+		{name: "text range bound", raw: `{"field":"a","gt":"abc"}`, expected: `range bound "abc" on field "a" is neither a number nor a date`},
+		{name: "mixed range kinds", raw: `{"field":"a","gt":1,"lt":"2024-01-01"}`, expected: "mixes numbers and dates"},
+		{
+			name:     "too deep",
+			raw:      `{"and":[{"and":[{"and":[{"and":[{"and":[{"and":[{"and":[{"and":[{"field":"a","eq":"1"}]}]}]}]}]}]}]}]}`,
+			expected: "nest deeper than 8 levels",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parse(t, tt.raw).Validate()
+
+			if tt.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidFilter)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestValidate_NilExpression(t *testing.T) {
+	var expr *Expr
+
+	assert.NoError(t, expr.Validate())
+	assert.True(t, expr.Match(nil))
+}
+
+func TestMatch(t *testing.T) {
+	metadata := map[string]string{
+		"department": "legal",
+		"tag":        "contract-nda",
+		"version":    "10",
+		"published":  "2024-06-15",
+		"reviewed":   "2024-06-15T09:30:00Z",
+	}
+
+	tests := []struct {
+		name     string
+		raw      string
+		expected bool
+	}{
+		{name: "equality matches", raw: `{"field":"department","eq":"legal"}`, expected: true},
+		{name: "equality is case sensitive", raw: `{"field":"department","eq":"Legal"}`},
+		{name: "missing field never matches", raw: `{"field":"owner","eq":"legal"}`},
+		{name: "in list matches", raw: `{"field":"department","in":["hr","legal"]}`, expected: true},
+		{name: "in list misses", raw: `{"field":"department","in":["hr","finance"]}`},
+		{name: "in list matches numbers", raw: `{"field":"version","in":[9,10]}`, expected: true},
+		{name: "equality compares numbers numerically", raw: `{"field":"version","eq":10.0}`, expected: true},
+		{name: "in list compares numbers numerically", raw: `{"field":"version","in":["1e1"]}`, expected: true},
+		{name: "equality of a number against text", raw: `{"field":"department","eq":0}`},
+		{name: "prefix matches", raw: `{"field":"tag","prefix":"contract-"}`, expected: true},
+		{name: "prefix misses", raw: `{"field":"tag","prefix":"invoice-"}`},
+		{name: "numeric range compares numerically", raw: `{"field":"version","gt":9,"lte":10}`, expected: true},
+		{name: "numeric range excludes bound", raw: `{"field":"version","lt":10}`},
+		{name: "numeric bound against text value", raw: `{"field":"department","gt":1}`},
+		{name: "date range", raw: `{"field":"published","gte":"2024-01-01","lt":"2025-01-01"}`, expected: true},
+		{name: "date range mixes layouts", raw: `{"field":"reviewed","gt":"2024-06-15"}`, expected: true},
+		{name: "date range misses", raw: `{"field":"published","lt":"2024-06-15"}`},
+		{name: "date bound against number value", raw: `{"field":"version","gt":"2024-01-01"}`},
+		{name: "and requires every clause", raw: `{"and":[{"field":"department","eq":"legal"},{"field":"version","gte":11}]}`},
+		{name: "or accepts any clause", raw: `{"or":[{"field":"department","eq":"hr"},{"field":"version","gte":10}]}`, expected: true},
+		{
+			name:     "nested",
+			raw:      `{"and":[{"field":"tag","prefix":"contract"},{"or":[{"field":"department","eq":"hr"},{"field":"published","gte":"2024-06-01"}]}]}`,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr := parse(t, tt.raw)
+			require.NoError(t, expr.Validate())
+
+			assert.Equal(t, tt.expected, expr.Match(metadata))
+		})
+	}
+}
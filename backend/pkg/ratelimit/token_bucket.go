@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket refills at a steady rate per minute and holds at most one
+// minute's worth of tokens, so a quiet client may burst up to the full limit.
+//
+// Reservations are allowed to overdraw the bucket: the caller is told how long
+// to wait until the overdraft is repaid. Waiters are therefore served in the
+// order they reserved, and a large request can't be starved by small ones.
+type TokenBucket struct {
+	capacity  float64
+	perSecond float64
+	now       func() time.Time
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket that refills perMinute tokens a minute
+func NewTokenBucket(perMinute int) *TokenBucket {
+	return newTokenBucket(perMinute, time.Now)
+}
+
+func newTokenBucket(perMinute int, now func() time.Time) *TokenBucket {
+	return &TokenBucket{
+		capacity:  float64(perMinute),
+		perSecond: float64(perMinute) / 60,
+		now:       now,
+		tokens:    float64(perMinute),
+		last:      now(),
+	}
+}
+
+// Reserve takes n tokens and returns how long the caller must wait before
+// using them. Requests larger than the bucket are treated as taking all of
+// it, otherwise they could never be served.
+func (b *TokenBucket) Reserve(n int) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.perSecond)
+	b.last = now
+
+	b.tokens -= min(float64(n), b.capacity)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.perSecond * float64(time.Second))
+}
+
+// Limiter caps requests per minute and tokens per minute. A zero limit is not
+// enforced, and a nil Limiter allows everything.
+type Limiter struct {
+	requests *TokenBucket
+	tokens   *TokenBucket
+}
+
+func NewLimiter(requestsPerMinute, tokensPerMinute int) *Limiter {
+	limiter := &Limiter{}
+	if requestsPerMinute > 0 {
+		limiter.requests = NewTokenBucket(requestsPerMinute)
+	}
+	if tokensPerMinute > 0 {
+		limiter.tokens = NewTokenBucket(tokensPerMinute)
+	}
+	return limiter
+}
+
+// Wait blocks until one request using the given number of tokens is allowed,
+// or ctx is done. Capacity reserved by a cancelled wait is not given back.
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return nil
+	}
+	var delay time.Duration
+	if l.requests != nil {
+		delay = l.requests.Reserve(1)
+	}
+	if l.tokens != nil {
+		delay = max(delay, l.tokens.Reserve(tokens))
+	}
+	return Sleep(ctx, delay)
+}
+
+// Sleep waits for d, returning early with ctx's error when ctx is done first
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(60, func() time.Time { return now })
+
+	// A full bucket serves a burst of up to a minute's worth at once
+	assert.Zero(t, bucket.Reserve(59))
+	assert.Zero(t, bucket.Reserve(1))
+
+	// Then callers wait for the refill, in the order they reserved
+	assert.Equal(t, time.Second, bucket.Reserve(1))
+	assert.Equal(t, 3*time.Second, bucket.Reserve(2))
+
+	// Time repays the overdraft
+	now = now.Add(3 * time.Second)
+	assert.Equal(t, time.Second, bucket.Reserve(1))
+
+	// Idle time never fills the bucket beyond its capacity
+	now = now.Add(time.Hour)
+	assert.Zero(t, bucket.Reserve(60))
+	assert.Equal(t, 2*time.Second, bucket.Reserve(2))
+}
+
+func TestTokenBucket_OversizedRequestTakesWholeBucket(t *testing.T) {
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(60, func() time.Time { return now })
+
+	assert.Zero(t, bucket.Reserve(1000))
+	assert.Equal(t, time.Second, bucket.Reserve(1))
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *Limiter
+	}{
+		{name: "nil limiter", limiter: nil},
+		{name: "no limits", limiter: NewLimiter(0, 0)},
+		{name: "within limits", limiter: NewLimiter(10, 1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.limiter.Wait(context.Background(), 500))
+		})
+	}
+}
+
+func TestLimiter_WaitStopsWhenContextEnds(t *testing.T) {
+	limiter := NewLimiter(1, 0)
+	assert.NoError(t, limiter.Wait(context.Background(), 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := limiter.Wait(ctx, 0)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -31,6 +31,17 @@ func Search(embedding []float64, chunks []types.DocumentChunk, limit int) ([]typ
 	return scored[:k], nil
 }
 
+// Dimension returns the length of the first embedding among chunks, or 0 when
+// none of them has one
+func Dimension(chunks []types.DocumentChunk) int {
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) > 0 {
+			return len(chunk.Embedding)
+		}
+	}
+	return 0
+}
+
 // cosineSimilarity calculates cosine similarity between two vectors
 func cosineSimilarity(a, b []float64) float64 {
 	if len(a) != len(b) {
@@ -134,6 +134,28 @@ func TestSearch(t *testing.T) {
 	}
 }
 
+func TestDimension(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []types.DocumentChunk
+		expected int
+	}{
+		{name: "no chunks", chunks: nil, expected: 0},
+		{name: "no embeddings", chunks: []types.DocumentChunk{{ID: "a"}}, expected: 0},
+		{
+			name:     "first embedding",
+			chunks:   []types.DocumentChunk{{ID: "a"}, {ID: "b", Embedding: []float64{1, 0, 0}}},
+			expected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Dimension(tt.chunks))
+		})
+	}
+}
+
 func TestCosineSimilarity(t *testing.T) {
 	type input struct {
 		a []float64
@@ -0,0 +1,65 @@
+package similarity
+
+import (
+	"sort"
+
+	"rag-backend/pkg/types"
+)
+
+// rrfK dampens the advantage of top ranks, as in Cormack et al. (2009)
+const rrfK = 60
+
+// MaxFusedScore is the score of a chunk ranked first in both lists, the
+// highest score ReciprocalRankFusion can produce for any keyword weight
+const MaxFusedScore = 1.0 / (rrfK + 1)
+
+// ReciprocalRankFusion merges two ranked lists into one. Each chunk scores
+// (1-keywordWeight)/(k+rank) from the vector list plus keywordWeight/(k+rank)
+// from the keyword list, so only ranks matter and the lists' raw score scales
+// (cosine vs BM25) never need to be reconciled.
+func ReciprocalRankFusion(vector, keyword []types.ScoredChunk, keywordWeight float64, limit int) []types.ScoredChunk {
+	type fused struct {
+		chunk types.DocumentChunk
+		score float64
+		order int
+	}
+
+	byKey := make(map[string]*fused)
+	var order int
+	add := func(list []types.ScoredChunk, weight float64) {
+		for rank, scored := range list {
+			key := scored.Chunk.DocumentID + "\x00" + scored.Chunk.ID
+			f, ok := byKey[key]
+			if !ok {
+				f = &fused{chunk: scored.Chunk, order: order}
+				byKey[key] = f
+				order++
+			}
+			// Prefer the vector copy, which still carries its embedding
+			if len(f.chunk.Embedding) == 0 {
+				f.chunk = scored.Chunk
+			}
+			f.score += weight / float64(rrfK+rank+1)
+		}
+	}
+	add(vector, 1-keywordWeight)
+	add(keyword, keywordWeight)
+
+	results := make([]*fused, 0, len(byKey))
+	for _, f := range byKey {
+		results = append(results, f)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].order < results[j].order
+	})
+
+	k := max(0, min(limit, len(results)))
+	scored := make([]types.ScoredChunk, k)
+	for i := 0; i < k; i++ {
+		scored[i] = types.ScoredChunk{Chunk: results[i].chunk, Score: results[i].score}
+	}
+	return scored
+}
@@ -0,0 +1,98 @@
+package similarity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/pkg/types"
+)
+
+func scoredIDs(results []types.ScoredChunk) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Chunk.ID
+	}
+	return out
+}
+
+func TestReciprocalRankFusion(t *testing.T) {
+	chunk := func(id string) types.ScoredChunk {
+		return types.ScoredChunk{Chunk: types.DocumentChunk{ID: id, DocumentID: "d"}}
+	}
+	vector := []types.ScoredChunk{chunk("a"), chunk("b"), chunk("c")}
+	keyword := []types.ScoredChunk{chunk("c"), chunk("d"), chunk("a")}
+
+	tests := []struct {
+		name          string
+		vector        []types.ScoredChunk
+		keyword       []types.ScoredChunk
+		keywordWeight float64
+		limit         int
+		expected      []string
+	}{
+		{
+			name:          "chunks found by both lists rank first",
+			vector:        vector,
+			keyword:       keyword,
+			keywordWeight: 0.5,
+			limit:         4,
+			expected:      []string{"a", "c", "b", "d"},
+		},
+		{
+			name:          "zero keyword weight keeps vector order",
+			vector:        vector,
+			keyword:       keyword,
+			keywordWeight: 0,
+			limit:         3,
+			expected:      []string{"a", "b", "c"},
+		},
+		{
+			name:          "full keyword weight keeps keyword order",
+			vector:        vector,
+			keyword:       keyword,
+			keywordWeight: 1,
+			limit:         3,
+			expected:      []string{"c", "d", "a"},
+		},
+		{
+			name:          "works with an empty keyword list",
+			vector:        vector,
+			keyword:       nil,
+			keywordWeight: 0.5,
+			limit:         2,
+			expected:      []string{"a", "b"},
+		},
+		{
+			name:          "returns empty for empty inputs",
+			keywordWeight: 0.5,
+			limit:         4,
+			expected:      []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ReciprocalRankFusion(tt.vector, tt.keyword, tt.keywordWeight, tt.limit)
+			assert.Equal(t, tt.expected, scoredIDs(result))
+		})
+	}
+}
+
+func TestReciprocalRankFusion_DistinguishesDocuments(t *testing.T) {
+	vector := []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "x-chunk-0", DocumentID: "d1"}}}
+	keyword := []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "x-chunk-0", DocumentID: "d2"}}}
+
+	result := ReciprocalRankFusion(vector, keyword, 0.5, 10)
+
+	assert.Len(t, result, 2)
+}
+
+func TestReciprocalRankFusion_PrefersChunkWithEmbedding(t *testing.T) {
+	vector := []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "a", Embedding: []float64{1}}}}
+	keyword := []types.ScoredChunk{{Chunk: types.DocumentChunk{ID: "a"}}}
+
+	result := ReciprocalRankFusion(keyword, vector, 0.5, 1)
+
+	assert.Equal(t, []float64{1}, result[0].Chunk.Embedding)
+}
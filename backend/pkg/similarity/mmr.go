@@ -0,0 +1,71 @@
+package similarity
+
+import (
+	"math"
+
+	"rag-backend/pkg/types"
+)
+
+// MaximalMarginalRelevance re-selects up to limit of the candidates so they
+// cover the query without repeating each other (Carbonell and Goldstein,
+// 1998). Each pick is the candidate with the highest
+//
+//	lambda*relevance - (1-lambda)*(highest similarity to a picked candidate)
+//
+// so lambda 1 keeps the ranking as it is and lambda 0 only seeks diversity.
+// Relevance is the candidate's score as a share of the best one, which
+// treats cosine, BM25 and fused scores alike. Similarity is the cosine
+// of the embeddings; a candidate without one counts as unlike the others.
+// Picked candidates keep their original scores.
+func MaximalMarginalRelevance(candidates []types.ScoredChunk, lambda float64, limit int) []types.ScoredChunk {
+	k := max(0, min(limit, len(candidates)))
+	if k == 0 {
+		return []types.ScoredChunk{}
+	}
+
+	highest := candidates[0].Score
+	for _, candidate := range candidates {
+		highest = max(highest, candidate.Score)
+	}
+	relevance := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		relevance[i] = 1
+		if highest > 0 {
+			relevance[i] = max(candidate.Score, 0) / highest
+		}
+	}
+
+	// redundancy[i] is candidate i's highest similarity to a picked candidate
+	redundancy := make([]float64, len(candidates))
+	picked := make([]bool, len(candidates))
+	selected := make([]types.ScoredChunk, 0, k)
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range candidates {
+			if picked[i] {
+				continue
+			}
+			if score := lambda*relevance[i] - (1-lambda)*redundancy[i]; score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		selected = append(selected, candidates[best])
+		for i := range candidates {
+			if !picked[i] {
+				redundancy[i] = max(redundancy[i], embeddingSimilarity(candidates[i].Chunk, candidates[best].Chunk))
+			}
+		}
+	}
+	return selected
+}
+
+// embeddingSimilarity is the cosine of two chunks' embeddings, or 0 if either
+// has none
+func embeddingSimilarity(a, b types.DocumentChunk) float64 {
+	if len(a.Embedding) == 0 || len(b.Embedding) == 0 {
+		return 0
+	}
+	return cosineSimilarity(a.Embedding, b.Embedding)
+}
@@ -0,0 +1,110 @@
+package similarity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"rag-backend/pkg/types"
+)
+
+func TestMaximalMarginalRelevance(t *testing.T) {
+	// The query points along the first axis. a, a2 and a3 are overlapping
+	// neighbours of one passage; b and c are other passages, less relevant
+	// but different.
+	query := []float64{1, 0, 0}
+	chunk := func(id string, embedding ...float64) types.ScoredChunk {
+		return types.ScoredChunk{
+			Chunk: types.DocumentChunk{ID: id, Embedding: embedding},
+			Score: cosineSimilarity(query, embedding),
+		}
+	}
+	candidates := []types.ScoredChunk{
+		chunk("a", 0.99, 0.14, 0),
+		chunk("a2", 0.98, 0.17, 0),
+		chunk("a3", 0.97, 0.2, 0),
+		chunk("b", 0.8, 0, 0.6),
+		chunk("c", 0.7, -0.7, 0.1),
+	}
+
+	tests := []struct {
+		name       string
+		candidates []types.ScoredChunk
+		lambda     float64
+		limit      int
+		expected   []string
+	}{
+		{
+			name:       "balances relevance and diversity",
+			candidates: candidates,
+			lambda:     0.5,
+			limit:      3,
+			expected:   []string{"a", "c", "b"},
+		},
+		{
+			name:       "lambda 1 keeps the ranking",
+			candidates: candidates,
+			lambda:     1,
+			limit:      3,
+			expected:   []string{"a", "a2", "a3"},
+		},
+		{
+			name:       "high lambda tolerates some repetition",
+			candidates: candidates,
+			lambda:     0.9,
+			limit:      3,
+			expected:   []string{"a", "a2", "a3"},
+		},
+		{
+			name:       "lambda 0 only seeks diversity",
+			candidates: candidates,
+			lambda:     0,
+			limit:      4,
+			expected:   []string{"a", "c", "b", "a3"},
+		},
+		{
+			name:       "limit larger than the candidates returns them all",
+			candidates: candidates[:2],
+			lambda:     0.5,
+			limit:      4,
+			expected:   []string{"a", "a2"},
+		},
+		{
+			name:       "no candidates",
+			candidates: nil,
+			lambda:     0.5,
+			limit:      4,
+			expected:   []string{},
+		},
+		{
+			name: "candidates without embeddings count as different",
+			candidates: []types.ScoredChunk{
+				chunk("a", 1, 0, 0),
+				chunk("a2", 1, 0.01, 0),
+				{Chunk: types.DocumentChunk{ID: "keyword-only"}, Score: 0.6},
+			},
+			lambda:   0.5,
+			limit:    2,
+			expected: []string{"a", "keyword-only"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := MaximalMarginalRelevance(tt.candidates, tt.lambda, tt.limit)
+			assert.Equal(t, tt.expected, scoredIDs(selected))
+		})
+	}
+}
+
+func TestMaximalMarginalRelevance_KeepsScores(t *testing.T) {
+	candidates := []types.ScoredChunk{
+		{Chunk: types.DocumentChunk{ID: "a", Embedding: []float64{1, 0}}, Score: 0.9},
+		{Chunk: types.DocumentChunk{ID: "b", Embedding: []float64{1, 0}}, Score: 0.8},
+		{Chunk: types.DocumentChunk{ID: "c", Embedding: []float64{0, 1}}, Score: 0.5},
+	}
+
+	selected := MaximalMarginalRelevance(candidates, 0.5, 2)
+
+	assert.Equal(t, []types.ScoredChunk{candidates[0], candidates[2]}, selected)
+}
@@ -0,0 +1,230 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// BPE is a byte-level byte pair encoding tokenizer reading vocabularies in
+// tiktoken's format: text is pretokenized, and each piece is encoded by
+// repeatedly merging the adjacent pair of byte sequences with the lowest
+// rank. Its counts match a model's only with that model's vocabulary.
+type BPE struct {
+	ranks map[string]int
+	// tokens maps ranks back to byte sequences for Decode
+	tokens map[int]string
+}
+
+// Token is one token of encoded text together with where it came from
+type Token struct {
+	ID int
+	// Start and End are byte offsets into the encoded text. A token may cover
+	// part of a multi-byte character.
+	Start int
+	End   int
+}
+
+//go:embed data/compact_8k.tiktoken
+var compactVocabulary []byte
+
+// Compact returns the tokenizer built from the compact vocabulary bundled
+// with the binary, 8,192 tokens trained by internal/vocabgen on English prose
+// and code. It is not any model's vocabulary, so its counts are only a rough
+// guide to the models': English prose takes up to about 1.5 times as many
+// tokens as with cl100k_base, and CJK text, which the training text barely
+// covers, close to one token per byte. Use LoadFile for a model's own
+// vocabulary.
+var Compact = sync.OnceValue(func() *BPE {
+	bpe, err := Load(bytes.NewReader(compactVocabulary))
+	if err != nil {
+		panic(fmt.Sprintf("bundled tokenizer vocabulary is invalid: %v", err))
+	}
+	return bpe
+})
+
+// LoadFile reads a vocabulary in tiktoken's format, such as
+// cl100k_base.tiktoken
+func LoadFile(path string) (*BPE, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokenizer vocabulary: %w", err)
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Load reads a vocabulary in tiktoken's format: one base64 encoded token and
+// its rank per line. Every single byte must be a token, so any text can be
+// encoded.
+func Load(r io.Reader) (*BPE, error) {
+	bpe := &BPE{
+		ranks:  make(map[string]int),
+		tokens: make(map[int]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a token and a rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid token: %w", line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rank: %w", line, err)
+		}
+		bpe.ranks[string(token)] = rank
+		bpe.tokens[rank] = string(token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer vocabulary: %w", err)
+	}
+
+	for b := range 256 {
+		if _, ok := bpe.ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("vocabulary has no token for byte %#02x", b)
+		}
+	}
+	return bpe, nil
+}
+
+// Encode returns the token IDs of text
+func (b *BPE) Encode(text string) []int {
+	tokens := b.EncodeWithOffsets(text)
+	ids := make([]int, len(tokens))
+	for i, token := range tokens {
+		ids[i] = token.ID
+	}
+	return ids
+}
+
+// EncodeWithOffsets returns the tokens of text along with the bytes each one
+// covers
+func (b *BPE) EncodeWithOffsets(text string) []Token {
+	var tokens []Token
+	offset := 0
+	for _, piece := range Pretokenize(text) {
+		for _, part := range b.encodePiece(piece) {
+			tokens = append(tokens, Token{ID: b.ranks[part], Start: offset, End: offset + len(part)})
+			offset += len(part)
+		}
+	}
+	return tokens
+}
+
+// Count returns how many tokens text encodes to
+func (b *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range Pretokenize(text) {
+		count += len(b.encodePiece(piece))
+	}
+	return count
+}
+
+// Decode returns the text of the given token IDs, skipping unknown IDs
+func (b *BPE) Decode(ids []int) string {
+	var text bytes.Buffer
+	for _, id := range ids {
+		text.WriteString(b.tokens[id])
+	}
+	return text.String()
+}
+
+// encodePiece splits a piece into its tokens' byte sequences. Starting from
+// single bytes, it repeatedly merges the adjacent pair of parts with the
+// lowest rank, the leftmost on a tie. Parts are a linked list of byte ranges
+// and candidate pairs wait in a heap by rank, so a merge only ranks the two
+// new pairs it forms.
+func (b *BPE) encodePiece(piece string) []string {
+	if _, ok := b.ranks[piece]; ok {
+		return []string{piece}
+	}
+
+	// The part starting at byte i ends at next[i], where the next part
+	// starts; prev[i] is where the previous part starts, or merged once the
+	// byte is no longer the start of a part
+	const merged = -2
+	n := len(piece)
+	next := make([]int, n)
+	prev := make([]int, n)
+	for i := range n {
+		next[i], prev[i] = i+1, i-1
+	}
+
+	pairs := &mergeQueue{}
+	push := func(start int) {
+		if start < 0 || next[start] >= n {
+			return
+		}
+		end := next[next[start]]
+		if rank, ok := b.ranks[piece[start:end]]; ok {
+			heap.Push(pairs, merge{rank: rank, start: start, end: end})
+		}
+	}
+	for i := range n - 1 {
+		push(i)
+	}
+
+	for pairs.Len() > 0 {
+		m := heap.Pop(pairs).(merge)
+		// Skip pairs an earlier merge changed: the part at start must still be
+		// followed by exactly one part ending at end
+		if prev[m.start] == merged || next[m.start] >= m.end || next[next[m.start]] != m.end {
+			continue
+		}
+		middle := next[m.start]
+		next[m.start] = m.end
+		prev[middle] = merged
+		if m.end < n {
+			prev[m.end] = m.start
+		}
+		push(prev[m.start])
+		push(m.start)
+	}
+
+	var parts []string
+	for i := 0; i < n; i = next[i] {
+		parts = append(parts, piece[i:next[i]])
+	}
+	return parts
+}
+
+// merge is a candidate merge of the two parts covering piece[start:end]
+type merge struct {
+	rank  int
+	start int
+	end   int
+}
+
+// mergeQueue orders candidate merges by rank, then leftmost first
+type mergeQueue []merge
+
+func (q mergeQueue) Len() int { return len(q) }
+func (q mergeQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].start < q[j].start
+}
+func (q mergeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *mergeQueue) Push(x any)   { *q = append(*q, x.(merge)) }
+func (q *mergeQueue) Pop() any {
+	old := *q
+	m := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return m
+}
@@ -0,0 +1,130 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testVocabulary has every byte plus the merges "ab" and "abc", in tiktoken's
+// format
+func testVocabulary(extra ...string) string {
+	var vocab strings.Builder
+	for b := range 256 {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	for i, token := range append([]string{"ab", "abc"}, extra...) {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), 256+i)
+	}
+	return vocab.String()
+}
+
+func TestBPE_Encode(t *testing.T) {
+	bpe, err := Load(strings.NewReader(testVocabulary(" x")))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want []int
+	}{
+		{name: "empty", text: "", want: []int{}},
+		{name: "whole piece in vocabulary", text: "abc", want: []int{257}},
+		{name: "lowest rank merges first", text: "abcab", want: []int{257, 256}},
+		{name: "unknown bytes stay single", text: "zab", want: []int{'z', 256}},
+		{name: "merges stay within pieces", text: "ab x", want: []int{256, 258}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, bpe.Encode(tt.text))
+			assert.Equal(t, len(tt.want), bpe.Count(tt.text))
+			assert.Equal(t, tt.text, bpe.Decode(tt.want))
+		})
+	}
+}
+
+func TestBPE_EncodeLongPiece(t *testing.T) {
+	bpe, err := Load(strings.NewReader(testVocabulary()))
+	require.NoError(t, err)
+
+	// One 200,000 byte piece; merging pair by pair in a rescanned slice would
+	// take minutes
+	tokens := bpe.Encode(strings.Repeat("ab", 100_000))
+
+	assert.Len(t, tokens, 100_000)
+	assert.Equal(t, 256, tokens[0])
+	assert.Equal(t, 256, tokens[len(tokens)-1])
+}
+
+func TestBPE_EncodeWithOffsets(t *testing.T) {
+	bpe, err := Load(strings.NewReader(testVocabulary()))
+	require.NoError(t, err)
+
+	assert.Equal(t, []Token{
+		{ID: 256, Start: 0, End: 2},
+		{ID: 'd', Start: 2, End: 3},
+		{ID: ' ', Start: 3, End: 4},
+		{ID: 0xc3, Start: 4, End: 5},
+		{ID: 0xa9, Start: 5, End: 6},
+	}, bpe.EncodeWithOffsets("abd é"))
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		vocab   string
+		wantErr string
+	}{
+		{name: "missing byte", vocab: "YQ== 0\n", wantErr: "vocabulary has no token for byte 0x00"},
+		{name: "missing rank", vocab: "YQ==\n", wantErr: "line 1: expected a token and a rank"},
+		{name: "bad base64", vocab: "!!! 0\n", wantErr: "line 1: invalid token"},
+		{name: "bad rank", vocab: "YQ== first\n", wantErr: "line 1: invalid rank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tt.vocab))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	require.NoError(t, os.WriteFile(path, []byte(testVocabulary()), 0o644))
+
+	bpe, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []int{257}, bpe.Encode("abc"))
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.tiktoken"))
+	assert.ErrorContains(t, err, "failed to open tokenizer vocabulary")
+}
+
+func TestCompact(t *testing.T) {
+	bpe := Compact()
+
+	texts := []string{
+		"The configuration file lives in /etc/app/config.yaml.",
+		"func main() {\n\tfmt.Println(\"hello\")\n}",
+		"日本語のテキストと中文文本。",
+		"Ünïcödé façade — naïve café.",
+	}
+	for _, text := range texts {
+		tokens := bpe.Encode(text)
+		assert.Equal(t, text, bpe.Decode(tokens), "round trip of %q", text)
+		assert.Less(t, len(tokens), len(text), "%q should compress", text)
+	}
+
+	// Common English words are single tokens
+	assert.Equal(t, 1, bpe.Count(" the"))
+	assert.Equal(t, 1, bpe.Count(" configuration"))
+}
@@ -0,0 +1,129 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pretokenize splits text into the pieces BPE merges are applied within, the
+// same way cl100k_base does. Its pattern is
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// which Go's regexp package can't express because of the lookahead, so the
+// alternatives are matched by hand, in order.
+func Pretokenize(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		n := nextPiece(text)
+		pieces = append(pieces, text[:n])
+		text = text[n:]
+	}
+	return pieces
+}
+
+// nextPiece returns the byte length of the piece text starts with
+func nextPiece(text string) int {
+	if n := contraction(text); n > 0 {
+		return n
+	}
+
+	r, size := utf8.DecodeRuneInString(text)
+	next, _ := utf8.DecodeRuneInString(text[size:])
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if unicode.IsLetter(r) {
+		return size + spanOf(text[size:], unicode.IsLetter)
+	}
+	if !isNewline(r) && !unicode.IsNumber(r) && unicode.IsLetter(next) {
+		return size + spanOf(text[size:], unicode.IsLetter)
+	}
+
+	// \p{N}{1,3}
+	if unicode.IsNumber(r) {
+		n := size
+		for digits := 1; digits < 3 && n < len(text); digits++ {
+			d, dsize := utf8.DecodeRuneInString(text[n:])
+			if !unicode.IsNumber(d) {
+				break
+			}
+			n += dsize
+		}
+		return n
+	}
+
+	// ?[^\s\p{L}\p{N}]+[\r\n]*
+	start := 0
+	if r == ' ' && isSymbol(next) {
+		start = size
+	}
+	if n := spanOf(text[start:], isSymbol); n > 0 {
+		n += start
+		return n + spanOf(text[n:], isNewline)
+	}
+
+	// Only whitespace is left
+	space := spanOf(text, unicode.IsSpace)
+
+	// \s*[\r\n]+ takes the whitespace up to the last newline in the run
+	lastNewline := -1
+	for i, c := range text[:space] {
+		if isNewline(c) {
+			lastNewline = i
+		}
+	}
+	if lastNewline >= 0 {
+		return lastNewline + 1
+	}
+
+	// \s+(?!\S) leaves the last space to start the next word, unless the
+	// run ends the text
+	if space < len(text) {
+		_, lastSize := utf8.DecodeLastRuneInString(text[:space])
+		if space-lastSize > 0 {
+			return space - lastSize
+		}
+	}
+
+	// \s+
+	return space
+}
+
+// contraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d)
+func contraction(text string) int {
+	if len(text) < 2 || text[0] != '\'' {
+		return 0
+	}
+	lower := func(b byte) byte { return b | 0x20 }
+	switch lower(text[1]) {
+	case 's', 't', 'm', 'd':
+		return 2
+	}
+	if len(text) < 3 {
+		return 0
+	}
+	switch string([]byte{lower(text[1]), lower(text[2])}) {
+	case "re", "ve", "ll":
+		return 3
+	}
+	return 0
+}
+
+// spanOf returns the byte length of the prefix whose runes all match
+func spanOf(text string, match func(rune) bool) int {
+	for i, r := range text {
+		if !match(r) {
+			return i
+		}
+	}
+	return len(text)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// isSymbol matches [^\s\p{L}\p{N}]
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
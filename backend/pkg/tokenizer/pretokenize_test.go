@@ -0,0 +1,35 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPretokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "empty", text: "", want: nil},
+		{name: "words keep their leading space", text: "Hello world", want: []string{"Hello", " world"}},
+		{name: "contractions", text: "it's we'RE they'll", want: []string{"it", "'s", " we", "'RE", " they", "'ll"}},
+		{name: "numbers in groups of three", text: "1234567", want: []string{"123", "456", "7"}},
+		{name: "punctuation takes one leading space", text: "a ... b", want: []string{"a", " ...", " b"}},
+		{name: "punctuation keeps trailing newlines", text: "end.\n\nNext", want: []string{"end", ".\n\n", "Next"}},
+		{name: "symbol prefixes a word", text: "/etc/app", want: []string{"/etc", "/app"}},
+		{name: "space runs leave one space for the next word", text: "a   b", want: []string{"a", "  ", " b"}},
+		{name: "whitespace up to the last newline", text: "a \n \n  b", want: []string{"a", " \n \n", " ", " b"}},
+		{name: "trailing whitespace", text: "a  ", want: []string{"a", "  "}},
+		{name: "code", text: "func main() {\n\tx := 1\n}", want: []string{"func", " main", "()", " {\n", "\tx", " :=", " ", "1", "\n", "}"}},
+		{name: "CJK runs stay together", text: "日本語のテキスト。", want: []string{"日本語のテキスト", "。"}},
+		{name: "accented letters", text: "café déjà", want: []string{"café", " déjà"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Pretokenize(tt.text))
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package types
+
+import "time"
+
+// Ingestion job statuses. A job moves forward through queued, extracting,
+// embedding and storing, and ends as done, failed or cancelled.
+const (
+	JobStatusQueued     = "queued"
+	JobStatusExtracting = "extracting"
+	JobStatusEmbedding  = "embedding"
+	JobStatusStoring    = "storing"
+	JobStatusDone       = "done"
+	JobStatusFailed     = "failed"
+	JobStatusCancelled  = "cancelled"
+)
+
+// Job tracks the ingestion of one uploaded file
+type Job struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	FileName   string `json:"fileName"`
+	Collection string `json:"collection"`
+	// ChunksTotal is known once the document has been split; ChunksProcessed
+	// counts the chunks embedded so far
+	ChunksTotal     int `json:"chunksTotal"`
+	ChunksProcessed int `json:"chunksProcessed"`
+	// Error and ErrorCode describe why a failed job failed
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Result is set once the job is done
+	Result    *UploadResponse `json:"result,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Finished reports whether the job has reached a final status
+func (j Job) Finished() bool {
+	return j.Status == JobStatusDone || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
+
+type JobResponse struct {
+	Job *Job `json:"job"`
+}
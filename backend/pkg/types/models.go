@@ -1,47 +1,281 @@
 package types
 
-import "time"
+import (
+	"time"
+
+	"rag-backend/pkg/filter"
+)
+
+// DefaultCollection holds documents uploaded without a collection, including
+// chunks stored before collections existed.
+const DefaultCollection = "default"
 
 type Document struct {
 	ID         string          `json:"id"`
 	Name       string          `json:"name"`
+	Collection string          `json:"collection"`
 	Content    string          `json:"content"`
 	Chunks     []DocumentChunk `json:"chunks"`
-	UploadedAt time.Time       `json:"uploadedAt"`
+	// Metadata holds the user metadata supplied at upload time
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ContentType is the file type detected from the uploaded bytes
+	ContentType string `json:"contentType,omitempty"`
+	// ContentHash is the hex SHA-256 of the extracted text
+	ContentHash string `json:"contentHash,omitempty"`
+	// Info is what the file records about itself, for formats that do
+	Info       *DocumentInfo `json:"info,omitempty"`
+	UploadedAt time.Time     `json:"uploadedAt"`
+}
+
+// DocumentInfo is the title, author and creation date a file such as a PDF
+// records about itself
+type DocumentInfo struct {
+	Title     string     `json:"title,omitempty"`
+	Author    string     `json:"author,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// ExtractedFile is the text of an uploaded file and the type detected from
+// its content
+type ExtractedFile struct {
+	Content     string
+	ContentType string
+	// Pages marks where each page starts in Content, for formats with pages
+	Pages []PageOffset
+	// SkippedPages are the pages no text could be extracted from
+	SkippedPages []SkippedPage
+	Info         *DocumentInfo
+}
+
+// PageOffset is the byte offset in the extracted text where a page starts
+type PageOffset struct {
+	Page   int
+	Offset int
+}
+
+// SkippedPage is a page of an upload that contributed no text, and why
+type SkippedPage struct {
+	Page   int    `json:"page"`
+	Reason string `json:"reason"`
 }
 
 type DocumentChunk struct {
-	ID        string            `json:"id"`
-	Content   string            `json:"content"`
-	Embedding []float64         `json:"embedding,omitempty"`
-	Metadata  map[string]string `json:"metadata"`
+	ID         string            `json:"id"`
+	DocumentID string            `json:"documentId,omitempty"`
+	Collection string            `json:"collection,omitempty"`
+	Content    string            `json:"content"`
+	Embedding  []float64         `json:"embedding,omitempty"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+// Citation links a sentence of the answer to a source chunk that supports it.
+// A sentence citing several sources yields one citation per source.
+type Citation struct {
+	// Number is the n of the [n] marker, the 1-based position in Sources
+	Number  int    `json:"number"`
+	ChunkID string `json:"chunkId"`
+	// Start and End delimit the cited sentence in the answer, in characters
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Text is the cited sentence without its markers
+	Text string `json:"text"`
 }
 
 type RAGResponse struct {
-	Answer     string          `json:"answer"`
-	Sources    []DocumentChunk `json:"sources"`
-	Confidence float64         `json:"confidence"`
+	Answer  string          `json:"answer"`
+	Sources []DocumentChunk `json:"sources"`
+	// SourceScores holds the relevance of each source in [0, 1], in the same order
+	SourceScores []float64 `json:"sourceScores"`
+	// DroppedChunks lists the IDs of retrieved chunks left out of the context
+	// to keep the prompt within its token budget
+	DroppedChunks []string   `json:"droppedChunks,omitempty"`
+	Citations     []Citation `json:"citations"`
+	// InvalidCitations lists [n] markers that matched no source; they are
+	// removed from Answer
+	InvalidCitations []int `json:"invalidCitations,omitempty"`
+	// NoAnswer is set when the question was answered without asking the chat
+	// model because there was no relevant context; NoAnswerCode says why
+	NoAnswer           bool    `json:"noAnswer,omitempty"`
+	NoAnswerCode       string  `json:"noAnswerCode,omitempty"`
+	Confidence         float64 `json:"confidence"`
+	ConversationID     string  `json:"conversationId"`
+	StandaloneQuestion string  `json:"standaloneQuestion,omitempty"`
 }
 
+// Upload outcomes. Uploads are matched to earlier ones by file name within a
+// collection.
+const (
+	// UploadOutcomeCreated means no document had the file's name
+	UploadOutcomeCreated = "created"
+	// UploadOutcomeUnchanged means the document already held the same content
+	// and metadata, so nothing was embedded or stored
+	UploadOutcomeUnchanged = "unchanged"
+	// UploadOutcomeReplaced means the upload replaced an older version
+	UploadOutcomeReplaced = "replaced"
+)
+
 type UploadResponse struct {
 	Document *UploadDocumentSummary `json:"document"`
+	Outcome  string                 `json:"outcome"`
+	// SkippedPages lists the pages of a PDF that had no readable text
+	SkippedPages []SkippedPage `json:"skippedPages,omitempty"`
 }
 
 type UploadDocumentSummary struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	ChunksCount int       `json:"chunksCount"`
-	UploadedAt  time.Time `json:"uploadedAt"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Collection  string            `json:"collection"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Info        *DocumentInfo     `json:"info,omitempty"`
+	ChunksCount int               `json:"chunksCount"`
+	UploadedAt  time.Time         `json:"uploadedAt"`
+}
+
+type DocumentListResponse struct {
+	Documents []UploadDocumentSummary `json:"documents"`
+}
+
+type DocumentDetailResponse struct {
+	Document *UploadDocumentSummary `json:"document"`
+	Chunks   []DocumentChunk        `json:"chunks"`
+}
+
+type DeleteDocumentResponse struct {
+	ID            string `json:"id"`
+	DeletedChunks int    `json:"deletedChunks"`
 }
 
 type QueryResponse struct {
-	Answer     string          `json:"answer"`
-	Sources    []DocumentChunk `json:"sources"`
-	Confidence float64         `json:"confidence"`
+	Answer             string          `json:"answer"`
+	Sources            []DocumentChunk `json:"sources"`
+	SourceScores       []float64       `json:"sourceScores"`
+	DroppedChunks      []string        `json:"droppedChunks,omitempty"`
+	Citations          []Citation      `json:"citations"`
+	InvalidCitations   []int           `json:"invalidCitations,omitempty"`
+	NoAnswer           bool            `json:"noAnswer,omitempty"`
+	NoAnswerCode       string          `json:"noAnswerCode,omitempty"`
+	Confidence         float64         `json:"confidence"`
+	ConversationID     string          `json:"conversationId"`
+	StandaloneQuestion string          `json:"standaloneQuestion,omitempty"`
 }
 
+// Retrieval modes accepted in QueryRequest.Mode
+const (
+	RetrievalModeVector  = "vector"
+	RetrievalModeKeyword = "keyword"
+	RetrievalModeHybrid  = "hybrid"
+)
+
 type QueryRequest struct {
 	Question string `json:"question" binding:"required"`
+	// Mode selects vector (default), keyword (BM25) or hybrid retrieval
+	Mode string `json:"mode,omitempty"`
+	// KeywordWeight is the share of the keyword ranking in hybrid mode, between 0 and 1
+	KeywordWeight *float64 `json:"keywordWeight,omitempty"`
+	// ConversationID continues an earlier conversation; omit it to start a new one
+	ConversationID string `json:"conversationId,omitempty"`
+	// Collection and Collections scope retrieval; both empty means the default collection
+	Collection  string   `json:"collection,omitempty"`
+	Collections []string `json:"collections,omitempty"`
+	// Filter restricts retrieval to chunks whose metadata matches the expression
+	Filter *filter.Expr `json:"filter,omitempty"`
+	// MMRLambda, when set, re-selects the retrieved chunks by maximal marginal
+	// relevance so they don't repeat each other: 1 weighs relevance only, 0
+	// diversity only. It needs vector or hybrid retrieval.
+	MMRLambda *float64 `json:"mmrLambda,omitempty"`
+	// MMRCandidates is how many chunks MMR chooses from; 0 uses the default
+	MMRCandidates int `json:"mmrCandidates,omitempty"`
+}
+
+// SearchRequest asks for the chunks most similar to Query, without
+// generating an answer. Callers that embed the query themselves send it as
+// Embedding instead; Query then only picks the terms to highlight.
+type SearchRequest struct {
+	Query     string    `json:"query,omitempty"`
+	Embedding []float64 `json:"embedding,omitempty"`
+	// TopK is how many results to return; 0 uses the default
+	TopK int `json:"topK,omitempty"`
+	// Collection and Collections scope the search; both empty means the default collection
+	Collection  string   `json:"collection,omitempty"`
+	Collections []string `json:"collections,omitempty"`
+	// Filter restricts the search to chunks whose metadata matches the expression
+	Filter *filter.Expr `json:"filter,omitempty"`
+}
+
+// Highlight marks a word of a chunk that matches a term of the query. Start
+// and End delimit it in the chunk's content, in characters.
+type Highlight struct {
+	Term  string `json:"term"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type SearchResult struct {
+	ScoredChunk
+	Highlights []Highlight `json:"highlights"`
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+type Collection struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type CollectionSummary struct {
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	DocumentCount int       `json:"documentCount"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type CreateCollectionRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type CollectionResponse struct {
+	Collection *CollectionSummary `json:"collection"`
+}
+
+type CollectionListResponse struct {
+	Collections []CollectionSummary `json:"collections"`
+}
+
+type DeleteCollectionResponse struct {
+	Name             string `json:"name"`
+	DeletedDocuments int    `json:"deletedDocuments"`
+	DeletedChunks    int    `json:"deletedChunks"`
+}
+
+// Chat roles used in conversation history
+const (
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Conversation struct {
+	ID        string        `json:"id"`
+	Messages  []ChatMessage `json:"messages"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+type ConversationResponse struct {
+	Conversation *Conversation `json:"conversation"`
+}
+
+type DeleteConversationResponse struct {
+	ID string `json:"id"`
 }
 
 type ScoredChunk struct {
@@ -58,4 +292,13 @@ type ErrorResponse struct {
 type HealthResponse struct {
 	Status    string    `json:"status"`
 	Timestamp time.Time `json:"timestamp"`
+	// EmbeddingCache is set when embeddings are cached
+	EmbeddingCache *EmbeddingCacheStats `json:"embeddingCache,omitempty"`
+}
+
+// EmbeddingCacheStats counts texts served from the embedding cache (hits) and
+// texts sent to the embeddings API (misses) since startup
+type EmbeddingCacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
 }
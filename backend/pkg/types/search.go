@@ -0,0 +1,52 @@
+package types
+
+import (
+	"slices"
+
+	"rag-backend/pkg/filter"
+)
+
+// SearchOptions scopes a vector or keyword search. The zero value searches
+// every stored chunk.
+type SearchOptions struct {
+	// Collections restricts results to chunks in any of these collections
+	Collections []string
+	// MetadataFilter restricts results to chunks whose metadata matches the
+	// expression
+	MetadataFilter *filter.Expr
+}
+
+// Scoped reports whether the options restrict the search at all.
+func (o SearchOptions) Scoped() bool {
+	return len(o.Collections) > 0 || o.MetadataFilter != nil
+}
+
+// Matches reports whether the chunk falls within the search scope. Chunks
+// without a collection belong to DefaultCollection.
+func (o SearchOptions) Matches(chunk DocumentChunk) bool {
+	if len(o.Collections) > 0 {
+		collection := chunk.Collection
+		if collection == "" {
+			collection = DefaultCollection
+		}
+		if !slices.Contains(o.Collections, collection) {
+			return false
+		}
+	}
+	return o.MetadataFilter.Match(chunk.Metadata)
+}
+
+// Filter returns the chunks within the search scope. An unscoped search
+// returns the input slice itself rather than a copy.
+func (o SearchOptions) Filter(chunks []DocumentChunk) []DocumentChunk {
+	if !o.Scoped() {
+		return chunks
+	}
+	matched := make([]DocumentChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if o.Matches(chunk) {
+			matched = append(matched, chunk)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SectionSeparator joins the headings of a section path, as in
+// "Install > Linux > Proxy"
+const SectionSeparator = " > "
+
+var (
+	// atxHeading matches "# Title" up to "###### Title", with an optional
+	// closing run of #s
+	atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	// tableDelimiter matches the row under a Markdown table's header, such as
+	// "|---|:---:|"
+	tableDelimiter = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// MarkdownChunk is a chunk of a Markdown document together with the headings
+// of the section it comes from, outermost first
+type MarkdownChunk struct {
+	Content  string
+	Headings []string
+}
+
+// Section returns the chunk's heading path, such as "Install > Linux > Proxy",
+// or "" for text before the first heading
+func (c MarkdownChunk) Section() string {
+	return strings.Join(c.Headings, SectionSeparator)
+}
+
+// markdownSection is the text between one heading and the next
+type markdownSection struct {
+	headings []string
+	lines    []string
+}
+
+// SplitMarkdown splits a Markdown document into chunks that never span two
+// sections: each heading starts a new chunk. Within a section, fenced code
+// blocks and tables are kept whole when they fit in a chunk; longer ones are
+// split between lines, with the fence reopened or the table header repeated
+// in every part. Everything else is split like SplitText.
+func (ts *TextSplitter) SplitMarkdown(text string) []MarkdownChunk {
+	var chunks []MarkdownChunk
+	for _, section := range markdownSections(text) {
+		for _, chunk := range ts.pack(ts.sectionUnits(section.lines)) {
+			chunks = append(chunks, MarkdownChunk{Content: chunk.Content, Headings: section.headings})
+		}
+	}
+	return chunks
+}
+
+// markdownSections splits a document at its headings, ignoring lines in code
+// blocks that only look like headings. Each section records the path of
+// headings leading to it.
+func markdownSections(text string) []markdownSection {
+	type heading struct {
+		level int
+		text  string
+	}
+	var stack []heading
+	sections := []markdownSection{{}}
+
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		current := &sections[len(sections)-1]
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			current.lines = append(current.lines, line)
+			continue
+		}
+		if fence = openingFence(line); fence != "" {
+			current.lines = append(current.lines, line)
+			continue
+		}
+
+		match := atxHeading.FindStringSubmatch(line)
+		if match == nil || strings.TrimSpace(match[2]) == "" {
+			current.lines = append(current.lines, line)
+			continue
+		}
+
+		level := len(match[1])
+		for len(stack) > 0 && stack[len(stack)-1].level >= level {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, heading{level: level, text: strings.TrimSpace(match[2])})
+
+		headings := make([]string, len(stack))
+		for i, h := range stack {
+			headings[i] = h.text
+		}
+		sections = append(sections, markdownSection{headings: headings})
+	}
+	return sections
+}
+
+// sectionUnits breaks a section's lines into units. A code block or table is
+// a single unit when it fits in a chunk, so it is never cut.
+func (ts *TextSplitter) sectionUnits(lines []string) []unit {
+	var units []unit
+	var text []string
+	flushText := func() {
+		if joined := strings.Join(text, "\n"); strings.TrimSpace(joined) != "" {
+			units = ts.appendUnits(units, joined+"\n\n", 0, boundaryParagraph)
+		}
+		text = nil
+	}
+
+	for i := 0; i < len(lines); {
+		if fence := openingFence(lines[i]); fence != "" {
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), fence) {
+				end++
+			}
+			end = min(end+1, len(lines))
+
+			flushText()
+			units = ts.appendCodeBlock(units, lines[i:end])
+			i = end
+			continue
+		}
+
+		end := i
+		for end < len(lines) && isTableRow(lines[end]) {
+			end++
+		}
+		if end-i >= 2 {
+			flushText()
+			units = ts.appendTable(units, lines[i:end])
+			i = end
+			continue
+		}
+
+		text = append(text, lines[i])
+		i++
+	}
+	flushText()
+
+	return units
+}
+
+// appendCodeBlock appends a fenced code block, split between lines into
+// blocks of their own if it is longer than a chunk
+func (ts *TextSplitter) appendCodeBlock(units []unit, lines []string) []unit {
+	fence := openingFence(lines[0])
+	head, body := lines[:1], lines[1:]
+	// An unterminated block runs to the end of the section
+	tail := []string{fence}
+	if len(body) > 0 && strings.HasPrefix(strings.TrimSpace(body[len(body)-1]), fence) {
+		body, tail = body[:len(body)-1], body[len(body)-1:]
+	}
+	return ts.appendBlock(units, head, body, tail)
+}
+
+// appendTable appends a table, split between rows into tables of their own if
+// it is longer than a chunk, each repeating the header
+func (ts *TextSplitter) appendTable(units []unit, rows []string) []unit {
+	header := rows[:1]
+	if tableDelimiter.MatchString(rows[1]) {
+		header = rows[:2]
+	}
+	return ts.appendBlock(units, header, rows[len(header):], nil)
+}
+
+// appendBlock appends head, body and tail as one unit if they fit in a chunk.
+// Otherwise body is split between lines and each part is wrapped in head and
+// tail. A single line longer than a chunk is split like any other text.
+func (ts *TextSplitter) appendBlock(units []unit, head, body, tail []string) []unit {
+	wrap := func(lines []string) string {
+		return strings.Join(slices.Concat(head, lines, tail), "\n")
+	}
+
+	var parts []string
+	var part []string
+	for _, line := range body {
+		if len(part) > 0 && ts.length(wrap(append(part, line))) > ts.ChunkSize {
+			parts = append(parts, wrap(part))
+			part = nil
+		}
+		part = append(part, line)
+	}
+	if len(part) > 0 || len(parts) == 0 {
+		parts = append(parts, wrap(part))
+	}
+
+	for i, part := range parts {
+		text, boundary := part+"\n", boundaryLine
+		if i == len(parts)-1 {
+			text, boundary = part+"\n\n", boundaryParagraph
+		}
+
+		u := ts.newUnit(text, boundary)
+		if u.trimmed > ts.ChunkSize {
+			units = ts.appendUnits(units, text, 1, boundary)
+			continue
+		}
+		units = append(units, u)
+	}
+	return units
+}
+
+// openingFence returns the fence a line opens a code block with, ``` or ~~~,
+// or "" if it doesn't open one
+func openingFence(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		return trimmed[:3]
+	}
+	return ""
+}
+
+// isTableRow reports whether a line can be part of a table: Markdown tables
+// and the tables the HTML extractor renders both separate cells with "|"
+func isTableRow(line string) bool {
+	return strings.TrimSpace(line) != "" && strings.Contains(line, "|")
+}
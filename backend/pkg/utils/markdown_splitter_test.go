@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMarkdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize int
+		text      string
+		want      []MarkdownChunk
+	}{
+		{
+			name:      "blank document",
+			chunkSize: 100,
+			text:      " \n\n ",
+			want:      nil,
+		},
+		{
+			name:      "text before the first heading has no section",
+			chunkSize: 100,
+			text:      "Intro.\n\n# Install\n\nRun the installer.",
+			want: []MarkdownChunk{
+				{Content: "Intro."},
+				{Content: "Run the installer.", Headings: []string{"Install"}},
+			},
+		},
+		{
+			name:      "headings nest by level",
+			chunkSize: 100,
+			text: "# Install\n\nSteps.\n\n## Linux\n\nUse apt.\n\n### Proxy\n\nSet HTTPS_PROXY.\n\n" +
+				"## macOS ##\n\nUse brew.\n\n# Usage\n\nRun it.",
+			want: []MarkdownChunk{
+				{Content: "Steps.", Headings: []string{"Install"}},
+				{Content: "Use apt.", Headings: []string{"Install", "Linux"}},
+				{Content: "Set HTTPS_PROXY.", Headings: []string{"Install", "Linux", "Proxy"}},
+				{Content: "Use brew.", Headings: []string{"Install", "macOS"}},
+				{Content: "Run it.", Headings: []string{"Usage"}},
+			},
+		},
+		{
+			name:      "skipped levels and empty sections",
+			chunkSize: 100,
+			text:      "# Guide\n\n### Deep\n\nText.\n\n#\n\n#hashtag is not a heading.",
+			want: []MarkdownChunk{
+				{Content: "Text.\n\n#\n\n#hashtag is not a heading.", Headings: []string{"Guide", "Deep"}},
+			},
+		},
+		{
+			name:      "headings inside code blocks are code",
+			chunkSize: 100,
+			text:      "# Config\n\n```sh\n# comment\necho hi\n```",
+			want: []MarkdownChunk{
+				{Content: "```sh\n# comment\necho hi\n```", Headings: []string{"Config"}},
+			},
+		},
+		{
+			name:      "code block that fits is never cut",
+			chunkSize: 40,
+			text:      "# Run\n\nFirst install it.\n\n```\nmake build\nmake install\n```\n\nThen run it.",
+			want: []MarkdownChunk{
+				{Content: "First install it.", Headings: []string{"Run"}},
+				{Content: "```\nmake build\nmake install\n```", Headings: []string{"Run"}},
+				{Content: "Then run it.", Headings: []string{"Run"}},
+			},
+		},
+		{
+			name:      "long code block reopens its fence in every part",
+			chunkSize: 35,
+			text:      "~~~go\nfunc a() {}\nfunc b() {}\nfunc c() {}\n~~~",
+			want: []MarkdownChunk{
+				{Content: "~~~go\nfunc a() {}\nfunc b() {}\n~~~"},
+				{Content: "~~~go\nfunc c() {}\n~~~"},
+			},
+		},
+		{
+			name:      "unterminated code block is closed",
+			chunkSize: 20,
+			text:      "```\nline one\nline two",
+			want: []MarkdownChunk{
+				{Content: "```\nline one\n```"},
+				{Content: "```\nline two\n```"},
+			},
+		},
+		{
+			name:      "table that fits is never cut",
+			chunkSize: 40,
+			text:      "Sizes:\n\n| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |",
+			want: []MarkdownChunk{
+				{Content: "Sizes:"},
+				{Content: "| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |"},
+			},
+		},
+		{
+			name:      "long table repeats its header in every part",
+			chunkSize: 40,
+			text:      "| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |\n| 5 | 6 |",
+			want: []MarkdownChunk{
+				{Content: "| a | b |\n|---|---|\n| 1 | 2 |\n| 3 | 4 |"},
+				{Content: "| a | b |\n|---|---|\n| 5 | 6 |"},
+			},
+		},
+		{
+			name:      "tables from HTML have no outer pipes",
+			chunkSize: 25,
+			text:      "Name | Size\nalpha | 1\nbeta | 2",
+			want: []MarkdownChunk{
+				{Content: "Name | Size\nalpha | 1"},
+				{Content: "Name | Size\nbeta | 2"},
+			},
+		},
+		{
+			name:      "long sections split like plain text",
+			chunkSize: 30,
+			text:      "# Notes\n\nThe first sentence is here. The second one follows it.",
+			want: []MarkdownChunk{
+				{Content: "The first sentence is here.", Headings: []string{"Notes"}},
+				{Content: "The second one follows it.", Headings: []string{"Notes"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := NewTextSplitter(tt.chunkSize, 0)
+			assert.Equal(t, tt.want, ts.SplitMarkdown(tt.text))
+		})
+	}
+}
+
+func TestSplitMarkdown_ChunksFit(t *testing.T) {
+	var doc strings.Builder
+	for i := range 20 {
+		doc.WriteString("## Section\n\nSome prose that goes on for a while, and then some more.\n\n")
+		doc.WriteString("```\n" + strings.Repeat("code line\n", i) + "```\n\n")
+		doc.WriteString("| k | v |\n|---|---|\n" + strings.Repeat("| key | value |\n", i) + "\n")
+	}
+
+	ts := NewTextSplitter(120, 20)
+	for _, chunk := range ts.SplitMarkdown(doc.String()) {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk.Content), 120)
+		assert.Equal(t, []string{"Section"}, chunk.Headings)
+		if strings.HasPrefix(chunk.Content, "```") {
+			assert.True(t, strings.HasSuffix(chunk.Content, "```"), "code block %q left open", chunk.Content)
+		}
+	}
+}
+
+func TestMarkdownChunk_Section(t *testing.T) {
+	assert.Equal(t, "", MarkdownChunk{}.Section())
+	assert.Equal(t, "Install > Linux > Proxy", MarkdownChunk{Headings: []string{"Install", "Linux", "Proxy"}}.Section())
+}
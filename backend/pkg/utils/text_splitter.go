@@ -1,13 +1,56 @@
 package utils
 
 import (
+	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf8"
+
+	"rag-backend/pkg/tokenizer"
+)
+
+// Boundaries a chunk can end at, weakest first. Chunks end at the strongest
+// boundary available, so a paragraph break is preferred to a line break, a
+// line break to the end of a sentence and so on, down to a hard cut.
+const (
+	boundaryNone = iota
+	boundaryWord
+	boundarySentence
+	boundaryLine
+	boundaryParagraph
+)
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t\r]*\n\s*`)
+	lineBreak      = regexp.MustCompile(`\n\s*`)
+	// sentenceEnd matches terminal punctuation and any closing quotes or
+	// brackets after it. Latin punctuation must be followed by whitespace, so
+	// "3.14" and "example.com" stay whole; CJK punctuation needn't be.
+	sentenceEnd = regexp.MustCompile(`(?:[.!?…؟।]+["'”’»«)\]]*\s+|[。！？．]+[」』”’）】]*\s*)`)
+	wordBreak   = regexp.MustCompile(`\s+`)
 )
 
+// levels lists the separators tried in turn, with the boundary each one marks
+var levels = []struct {
+	separator *regexp.Regexp
+	boundary  int
+}{
+	{separator: paragraphBreak, boundary: boundaryParagraph},
+	{separator: lineBreak, boundary: boundaryLine},
+	{separator: sentenceEnd, boundary: boundarySentence},
+	{separator: wordBreak, boundary: boundaryWord},
+}
+
+// TextSplitter splits text into chunks of at most ChunkSize, with neighbouring
+// chunks sharing up to ChunkOverlap. Chunks end at the strongest boundary
+// available (paragraph, line, sentence, word) and only fall back to cutting
+// mid-word when a single word is longer than a chunk.
 type TextSplitter struct {
 	ChunkSize    int
 	ChunkOverlap int
+	// Tokenizer, when set, measures ChunkSize and ChunkOverlap in tokens
+	// rather than runes
+	Tokenizer *tokenizer.BPE
 }
 
 func NewTextSplitter(chunkSize, chunkOverlap int) *TextSplitter {
@@ -17,28 +60,232 @@ func NewTextSplitter(chunkSize, chunkOverlap int) *TextSplitter {
 	}
 }
 
+// NewTokenTextSplitter returns a splitter whose ChunkSize and ChunkOverlap are
+// counted in tokens of the given tokenizer, which is what embedding models
+// are limited by.
+func NewTokenTextSplitter(chunkSize, chunkOverlap int, bpe *tokenizer.BPE) *TextSplitter {
+	return &TextSplitter{
+		ChunkSize:    chunkSize,
+		ChunkOverlap: chunkOverlap,
+		Tokenizer:    bpe,
+	}
+}
+
+// unit is the smallest piece of text chunks are built from: a sentence, or
+// part of one that is too long for a chunk by itself. Units keep the
+// separator that follows them, so joining them gives back the text.
+type unit struct {
+	text   string
+	length int
+	// trimmed is the length without the trailing separator, which doesn't
+	// count when the unit ends a chunk
+	trimmed int
+	// boundary is the kind of break that follows the unit
+	boundary int
+}
+
+// Chunk is a chunk of text along with where it was found
+type Chunk struct {
+	Content string
+	// Start and End are the byte offsets of Content in the text it was split
+	// from
+	Start int
+	End   int
+}
+
 // SplitText splits the input text into chunks based on the configured ChunkSize and ChunkOverlap.
+// Text that fits in one chunk is returned as is; otherwise chunks are trimmed
+// of surrounding whitespace. Empty or blank text produces no chunks, as
+// there is nothing in it to embed.
 func (ts *TextSplitter) SplitText(text string) []string {
-	if utf8.RuneCountInString(text) <= ts.ChunkSize {
-		return []string{text}
+	chunks := ts.SplitTextWithOffsets(text)
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Content
 	}
+	return texts
+}
 
-	var chunks []string
-	runes := []rune(text)
+// SplitTextWithOffsets splits text like SplitText, and also returns where in
+// text each chunk is, so chunks can be traced back to pages or lines.
+func (ts *TextSplitter) SplitTextWithOffsets(text string) []Chunk {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if ts.length(text) <= ts.ChunkSize {
+		return []Chunk{{Content: text, Start: 0, End: len(text)}}
+	}
+
+	return ts.pack(ts.appendUnits(nil, text, 0, boundaryParagraph))
+}
+
+// pack joins units into chunks of at most ChunkSize, trimmed of surrounding
+// whitespace. Blank chunks are dropped. Offsets are into the units' text
+// joined together.
+func (ts *TextSplitter) pack(units []unit) []Chunk {
+	// offsets[i] is the length of the units before unit i, and bytes[i] the
+	// same in bytes
+	offsets := make([]int, len(units)+1)
+	bytes := make([]int, len(units)+1)
+	for i, u := range units {
+		offsets[i+1] = offsets[i] + u.length
+		bytes[i+1] = bytes[i] + len(u.text)
+	}
+
+	var chunks []Chunk
 	start := 0
+	for start < len(units) {
+		end := start + 1
+		for end < len(units) && offsets[end]-offsets[start]+units[end].trimmed <= ts.ChunkSize {
+			end++
+		}
+		if end < len(units) {
+			end = ts.bestBreak(units, offsets, start, end)
+		}
 
-	for start < len(runes) {
-		end := min(start+ts.ChunkSize, len(runes))
+		var chunk strings.Builder
+		for _, u := range units[start:end] {
+			chunk.WriteString(u.text)
+		}
+		if trimmed := strings.TrimSpace(chunk.String()); trimmed != "" {
+			leading := chunk.Len() - len(strings.TrimLeftFunc(chunk.String(), unicode.IsSpace))
+			chunkStart := bytes[start] + leading
+			chunks = append(chunks, Chunk{Content: trimmed, Start: chunkStart, End: chunkStart + len(trimmed)})
+		}
 
-		chunk := string(runes[start:end])
-		chunks = append(chunks, strings.TrimSpace(chunk))
+		if end >= len(units) {
+			break
+		}
+		start = ts.overlapStart(units, offsets, start, end)
+	}
 
-		if end >= len(runes) {
+	return chunks
+}
+
+// bestBreak picks where a chunk covering units[start:end] should end. Any
+// break in its second half will do, so the strongest one there wins, the
+// latest if several are as strong.
+func (ts *TextSplitter) bestBreak(units []unit, offsets []int, start, end int) int {
+	best := end
+	for k := end - 1; k > start; k-- {
+		if offsets[k]-offsets[start] < ts.ChunkSize/2 {
 			break
 		}
+		if units[k-1].boundary > units[best-1].boundary {
+			best = k
+		}
+	}
+	return best
+}
 
-		start = max(end-ts.ChunkOverlap, 0)
+// overlapStart returns where the chunk after units[start:end] starts. It
+// repeats as many of the previous chunk's trailing units as fit in
+// ChunkOverlap, starting on a boundary at least as strong as the one the
+// previous chunk ended on, up to a sentence. Chunks that end between
+// sentences therefore overlap by whole sentences, and only chunks cut inside
+// a long sentence overlap by words or by a hard cut.
+func (ts *TextSplitter) overlapStart(units []unit, offsets []int, start, end int) int {
+	need := min(units[end-1].boundary, boundarySentence)
+	next := end
+	for k := end - 1; k > start; k-- {
+		if offsets[end-1]-offsets[k]+units[end-1].trimmed > ts.ChunkOverlap {
+			break
+		}
+		if units[k-1].boundary >= need {
+			next = k
+		}
 	}
+	return next
+}
 
-	return chunks
+// appendUnits breaks text into units at the given separator level and
+// appends them. Text is always broken down to sentences, and further only
+// while a piece is longer than a chunk. The last unit gets boundary, the kind
+// of break that follows the whole text.
+func (ts *TextSplitter) appendUnits(units []unit, text string, level, boundary int) []unit {
+	if level == len(levels) {
+		return ts.appendHardCuts(units, text, boundary)
+	}
+
+	separator, separatorBoundary := levels[level].separator, levels[level].boundary
+	pieces := splitAfter(text, separator)
+	for i, piece := range pieces {
+		pieceBoundary := separatorBoundary
+		if i == len(pieces)-1 {
+			pieceBoundary = boundary
+		}
+
+		u := ts.newUnit(piece, pieceBoundary)
+		if separatorBoundary > boundarySentence || u.trimmed > ts.ChunkSize {
+			units = ts.appendUnits(units, piece, level+1, pieceBoundary)
+			continue
+		}
+		units = append(units, u)
+	}
+	return units
+}
+
+// appendHardCuts breaks a word longer than a chunk into runes, or in token
+// mode into tokens widened to whole runes.
+func (ts *TextSplitter) appendHardCuts(units []unit, text string, boundary int) []unit {
+	var pieces []string
+	if ts.Tokenizer == nil {
+		for _, r := range text {
+			pieces = append(pieces, string(r))
+		}
+	} else {
+		from := 0
+		for _, token := range ts.Tokenizer.EncodeWithOffsets(text) {
+			if token.End <= from || (token.End < len(text) && !utf8.RuneStart(text[token.End])) {
+				continue
+			}
+			pieces = append(pieces, text[from:token.End])
+			from = token.End
+		}
+	}
+
+	for i, piece := range pieces {
+		pieceBoundary := boundaryNone
+		if i == len(pieces)-1 {
+			pieceBoundary = boundary
+		}
+		units = append(units, ts.newUnit(piece, pieceBoundary))
+	}
+	return units
+}
+
+// length measures text in runes, or in tokens when a tokenizer is set
+func (ts *TextSplitter) length(text string) int {
+	if ts.Tokenizer != nil {
+		return ts.Tokenizer.Count(text)
+	}
+	return utf8.RuneCountInString(text)
+}
+
+// newUnit measures a unit. In token mode the whitespace after a unit is not
+// counted at all: the tokenizer folds it into the first token of the next
+// unit.
+func (ts *TextSplitter) newUnit(text string, boundary int) unit {
+	trimmed := ts.length(strings.TrimRightFunc(text, unicode.IsSpace))
+	length := trimmed
+	if ts.Tokenizer == nil {
+		length = utf8.RuneCountInString(text)
+	}
+	return unit{text: text, length: length, trimmed: trimmed, boundary: boundary}
+}
+
+// splitAfter splits text after each match of separator, keeping the
+// separator at the end of the piece before it, so the pieces join back into
+// text. It never returns empty pieces.
+func splitAfter(text string, separator *regexp.Regexp) []string {
+	var pieces []string
+	from := 0
+	for _, match := range separator.FindAllStringIndex(text, -1) {
+		if match[1] == from || match[1] == len(text) {
+			continue
+		}
+		pieces = append(pieces, text[from:match[1]])
+		from = match[1]
+	}
+	return append(pieces, text[from:])
 }
@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
+
+	"rag-backend/pkg/tokenizer"
 )
 
 func TestNewTextSplitter(t *testing.T) {
@@ -12,6 +16,13 @@ func TestNewTextSplitter(t *testing.T) {
 	assert.NotNil(t, ts)
 	assert.Equal(t, 1000, ts.ChunkSize)
 	assert.Equal(t, 200, ts.ChunkOverlap)
+	assert.Nil(t, ts.Tokenizer)
+
+	bpe := tokenizer.Compact()
+	ts = NewTokenTextSplitter(250, 50, bpe)
+	assert.Equal(t, 250, ts.ChunkSize)
+	assert.Equal(t, 50, ts.ChunkOverlap)
+	assert.Same(t, bpe, ts.Tokenizer)
 }
 
 func TestSplitText(t *testing.T) {
@@ -45,10 +56,10 @@ func TestSplitText(t *testing.T) {
 			expected: expected{chunks: []string{"hello"}},
 		},
 		{
-			name:     "returns single chunk for empty text",
+			name:     "returns no chunks for empty text",
 			splitter: splitter{chunkSize: 100, chunkOverlap: 10},
 			text:     "",
-			expected: expected{chunks: []string{""}},
+			expected: expected{chunks: []string{}},
 		},
 		{
 			name:     "preserves whitespace when text fits in single chunk",
@@ -104,3 +115,274 @@ func TestSplitText(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitText_Tokens(t *testing.T) {
+	bpe := tokenizer.Compact()
+
+	type splitter struct {
+		chunkSize    int
+		chunkOverlap int
+	}
+
+	tests := []struct {
+		name     string
+		splitter splitter
+		text     string
+		expected []string
+	}{
+		{
+			name:     "returns single chunk when text fits in chunk size",
+			splitter: splitter{chunkSize: 10, chunkOverlap: 2},
+			text:     "  The configuration file  ",
+			expected: []string{"  The configuration file  "},
+		},
+		{
+			name:     "returns no chunks for blank text",
+			splitter: splitter{chunkSize: 10, chunkOverlap: 2},
+			text:     " \n\t ",
+			expected: []string{},
+		},
+		{
+			name:     "splits between words without overlap",
+			splitter: splitter{chunkSize: 3, chunkOverlap: 0},
+			text:     "The file is in the home directory of the user",
+			expected: []string{"The file is", "in the", "home directory", "of the user"},
+		},
+		{
+			name:     "overlaps by whole words inside a long sentence",
+			splitter: splitter{chunkSize: 4, chunkOverlap: 2},
+			text:     "The file is in the home directory of the user",
+			expected: []string{"The file is in", "is in the", "in the home", "home directory of", "directory of the user"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := NewTokenTextSplitter(tt.splitter.chunkSize, tt.splitter.chunkOverlap, bpe)
+
+			assert.Equal(t, tt.expected, ts.SplitText(tt.text))
+		})
+	}
+}
+
+func TestSplitText_TokensKeepCharactersWhole(t *testing.T) {
+	bpe := tokenizer.Compact()
+	// CJK characters take several byte-level tokens each
+	text := "日本語のテキストを分割します。中文文本也一样。"
+	ts := NewTokenTextSplitter(4, 1, bpe)
+
+	chunks := ts.SplitText(text)
+
+	assert.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		assert.True(t, utf8.ValidString(chunk), "chunk %q must be valid UTF-8", chunk)
+		assert.NotEmpty(t, chunk)
+	}
+	assert.True(t, strings.HasPrefix(text, chunks[0]))
+	assert.True(t, strings.HasSuffix(text, chunks[len(chunks)-1]))
+}
+
+func TestSplitText_TokenSizeTracksTokenCost(t *testing.T) {
+	bpe := tokenizer.Compact()
+	english := strings.Repeat("The service reads its configuration from the environment. ", 40)
+	code := strings.Repeat("if err != nil {\n\treturn fmt.Errorf(\"read: %w\", err)\n}\n", 40)
+
+	for _, text := range []string{english, code} {
+		ts := NewTokenTextSplitter(50, 10, bpe)
+		for _, chunk := range ts.SplitText(text) {
+			// Re-encoding a chunk can split the pieces at its edges differently
+			assert.LessOrEqual(t, bpe.Count(chunk), 52)
+		}
+	}
+}
+
+func TestSplitText_Recursive(t *testing.T) {
+	type splitter struct {
+		chunkSize    int
+		chunkOverlap int
+	}
+
+	tests := []struct {
+		name     string
+		splitter splitter
+		text     string
+		expected []string
+	}{
+		{
+			name:     "prefers paragraph breaks",
+			splitter: splitter{chunkSize: 40, chunkOverlap: 0},
+			text:     "Install the agent. Then start it.\n\nConfigure the proxy. Restart.",
+			expected: []string{"Install the agent. Then start it.", "Configure the proxy. Restart."},
+		},
+		{
+			name:     "prefers line breaks to sentence ends",
+			splitter: splitter{chunkSize: 30, chunkOverlap: 0},
+			text:     "- step one. step two\n- step three. four",
+			expected: []string{"- step one. step two", "- step three. four"},
+		},
+		{
+			name:     "never cuts words",
+			splitter: splitter{chunkSize: 20, chunkOverlap: 0},
+			text:     "Edit the configuration file before starting the service",
+			expected: []string{"Edit the", "configuration file", "before starting the", "service"},
+		},
+		{
+			name:     "overlaps by whole sentences",
+			splitter: splitter{chunkSize: 40, chunkOverlap: 20},
+			text:     "One is first. Two is second. Three is third. Four is last.",
+			expected: []string{"One is first. Two is second.", "Two is second. Three is third.", "Three is third. Four is last."},
+		},
+		{
+			name:     "skips overlap when no whole sentence fits",
+			splitter: splitter{chunkSize: 40, chunkOverlap: 5},
+			text:     "One is first. Two is second. Three is third. Four is last.",
+			expected: []string{"One is first. Two is second.", "Three is third. Four is last."},
+		},
+		{
+			name:     "keeps decimals and domains whole",
+			splitter: splitter{chunkSize: 30, chunkOverlap: 0},
+			text:     "Version 3.14 is out. See example.com for details.",
+			expected: []string{"Version 3.14 is out.", "See example.com for details."},
+		},
+		{
+			name:     "never emits blank chunks",
+			splitter: splitter{chunkSize: 10, chunkOverlap: 0},
+			text:     "\n\n\n   alpha beta\n\n\n\n   \n\ngamma delta\n\n\n",
+			expected: []string{"alpha beta", "gamma", "delta"},
+		},
+		{
+			name:     "Japanese sentences end without spaces",
+			splitter: splitter{chunkSize: 12, chunkOverlap: 0},
+			text:     "設定ファイルを開きます。サービスを再起動します。完了です。",
+			expected: []string{"設定ファイルを開きます。", "サービスを再起動します。", "完了です。"},
+		},
+		{
+			name:     "Chinese overlap by sentence",
+			splitter: splitter{chunkSize: 12, chunkOverlap: 6},
+			text:     "打开配置文件。重启服务！检查日志？完成。",
+			expected: []string{"打开配置文件。重启服务！", "重启服务！检查日志？", "检查日志？完成。"},
+		},
+		{
+			name:     "German with closing quotes",
+			splitter: splitter{chunkSize: 45, chunkOverlap: 0},
+			text:     "Er sagte: »Die Größe ist falsch.« Danach änderte er die Übersetzung.",
+			expected: []string{"Er sagte: »Die Größe ist falsch.«", "Danach änderte er die Übersetzung."},
+		},
+		{
+			name:     "Russian words are not cut",
+			splitter: splitter{chunkSize: 25, chunkOverlap: 0},
+			text:     "Откройте файл конфигурации и перезапустите службу",
+			expected: []string{"Откройте файл", "конфигурации и", "перезапустите службу"},
+		},
+		{
+			name:     "Hindi danda ends sentences",
+			splitter: splitter{chunkSize: 20, chunkOverlap: 0},
+			text:     "फ़ाइल खोलें। सेवा शुरू करें।",
+			expected: []string{"फ़ाइल खोलें।", "सेवा शुरू करें।"},
+		},
+		{
+			name:     "hard cuts words longer than a chunk",
+			splitter: splitter{chunkSize: 8, chunkOverlap: 0},
+			text:     "see Donaudampfschiff now",
+			expected: []string{"see", "Donaudam", "pfschiff", "now"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := NewTextSplitter(tt.splitter.chunkSize, tt.splitter.chunkOverlap)
+
+			result := ts.SplitText(tt.text)
+
+			assert.Equal(t, tt.expected, result)
+			for _, chunk := range result {
+				assert.LessOrEqual(t, utf8.RuneCountInString(chunk), tt.splitter.chunkSize)
+			}
+		})
+	}
+}
+
+func TestSplitText_NeverCutsWordsInLongText(t *testing.T) {
+	sentences := []string{
+		"The agent reads its configuration at startup.",
+		"Proxy settings apply to every outgoing request.",
+		"Restart the service after changing them!",
+		"Does the log show any errors?",
+	}
+	var text strings.Builder
+	for i := range 30 {
+		text.WriteString(sentences[i%len(sentences)])
+		if i%5 == 4 {
+			text.WriteString("\n\n")
+		} else {
+			text.WriteString(" ")
+		}
+	}
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(text.String()) {
+		words[word] = true
+	}
+
+	for _, ts := range []*TextSplitter{NewTextSplitter(200, 50), NewTokenTextSplitter(40, 10, tokenizer.Compact())} {
+		chunks := ts.SplitText(text.String())
+
+		assert.Greater(t, len(chunks), 3)
+		for _, chunk := range chunks {
+			assert.NotEmpty(t, chunk)
+			for _, word := range strings.Fields(chunk) {
+				assert.True(t, words[word], "chunk %q contains a cut word %q", chunk, word)
+			}
+		}
+	}
+}
+
+// Empty and blank text used to come back as a single chunk of itself. It has
+// nothing worth embedding, so it now gives no chunks, in every mode, and the
+// pipeline rejects documents without text instead of indexing a blank chunk.
+func TestSplitText_BlankTextHasNoChunks(t *testing.T) {
+	splitters := map[string]*TextSplitter{
+		"runes":  NewTextSplitter(100, 10),
+		"tokens": NewTokenTextSplitter(100, 10, tokenizer.Compact()),
+	}
+
+	for mode, ts := range splitters {
+		for _, text := range []string{"", " ", "\n\n", " \t\r\n "} {
+			assert.Empty(t, ts.SplitText(text), "%s: %q", mode, text)
+			assert.Empty(t, ts.SplitTextWithOffsets(text), "%s: %q", mode, text)
+			assert.Empty(t, ts.SplitMarkdown(text), "%s: %q", mode, text)
+		}
+	}
+}
+
+func TestSplitTextWithOffsets(t *testing.T) {
+	text := "  First paragraph, with a sentence. And another one.\n\nSecond paragraph here.\n\n\tThird one ends it.  "
+
+	tests := []struct {
+		name     string
+		splitter *TextSplitter
+		text     string
+	}{
+		{name: "runes", splitter: NewTextSplitter(30, 10), text: text},
+		{name: "tokens", splitter: NewTokenTextSplitter(8, 2, tokenizer.Compact()), text: text},
+		{name: "multibyte", splitter: NewTextSplitter(4, 1), text: "日本語。テスト。中文。"},
+		{name: "fits in one chunk", splitter: NewTextSplitter(1000, 10), text: text},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := tt.splitter.SplitTextWithOffsets(tt.text)
+
+			texts := make([]string, len(chunks))
+			for i, chunk := range chunks {
+				texts[i] = chunk.Content
+				assert.Equal(t, chunk.Content, tt.text[chunk.Start:chunk.End])
+				if i > 0 {
+					assert.Greater(t, chunk.Start, chunks[i-1].Start)
+				}
+			}
+			assert.Equal(t, tt.splitter.SplitText(tt.text), texts)
+		})
+	}
+
+	assert.Empty(t, NewTextSplitter(10, 2).SplitTextWithOffsets(" \n "))
+}
@@ -1,7 +1,7 @@
 'use client';
 
 import { useState, useEffect } from 'react';
-import { ChatMessage, DocumentChunk, UploadResponse, ErrorResponse } from '@/types';
+import { ChatMessage, DocumentChunk, Job, JobResponse, ErrorResponse } from '@/types';
 import { sendQuery, QueryMode } from '@/lib/api/query';
 
 export default function Home() {
@@ -31,6 +31,13 @@ export default function Home() {
     return () => clearInterval(interval);
   }, [isLoading]);
 
+  const describeJob = (job: Job): string => {
+    if (job.status === 'embedding' && job.chunksTotal > 0) {
+      return `Embedding ${job.fileName}... (${job.chunksProcessed}/${job.chunksTotal} chunks)`;
+    }
+    return `Processing ${job.fileName}... (${job.status})`;
+  };
+
   const handleFileUpload = async (e: React.ChangeEvent<HTMLInputElement>) => {
     const file = e.target.files?.[0];
     if (!file) return;
@@ -46,12 +53,37 @@ export default function Home() {
         body: formData,
       });
 
-      if (response.ok) {
-        const result: UploadResponse = await response.json();
-        setUploadStatus(`✅ ${file.name} uploaded successfully! (${result.document.chunksCount} chunks)`);
-      } else {
+      if (!response.ok) {
         const error: ErrorResponse = await response.json();
         setUploadStatus(`❌ Failed to upload: ${error.error}`);
+        return;
+      }
+
+      // The upload is processed in the background; poll its job until it finishes
+      let { job }: JobResponse = await response.json();
+      while (job.status !== 'done' && job.status !== 'failed' && job.status !== 'cancelled') {
+        setUploadStatus(describeJob(job));
+        await new Promise((resolve) => setTimeout(resolve, 1000));
+        const jobResponse = await fetch(`${backendUrl}/api/jobs/${job.id}`);
+        if (!jobResponse.ok) {
+          const error: ErrorResponse = await jobResponse.json();
+          setUploadStatus(`❌ Failed to check upload: ${error.error}`);
+          return;
+        }
+        ({ job } = await jobResponse.json());
+      }
+
+      if (job.status === 'done' && job.result?.outcome === 'unchanged') {
+        setUploadStatus(`✅ ${file.name} is already up to date (${job.result.document.chunksCount} chunks)`);
+      } else if (job.status === 'done') {
+        const verb = job.result?.outcome === 'replaced' ? 'updated' : 'uploaded';
+        const skipped = job.result?.skippedPages ?? [];
+        const skippedNote = skipped.length > 0 ? `, skipped unreadable pages ${skipped.map(p => p.page).join(', ')}` : '';
+        setUploadStatus(`✅ ${file.name} ${verb} successfully! (${job.result?.document.chunksCount ?? 0} chunks${skippedNote})`);
+      } else if (job.status === 'failed') {
+        setUploadStatus(`❌ Failed to upload: ${job.error}`);
+      } else {
+        setUploadStatus(`❌ Upload of ${file.name} was cancelled`);
       }
     } catch (error) {
       setUploadStatus(`❌ Upload error: ${error}`);
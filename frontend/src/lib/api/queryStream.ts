@@ -63,6 +63,10 @@ export async function sendQueryStream(
           case 'token':
             callbacks.onToken(event.content);
             break;
+          case 'no_answer':
+            callbacks.onToken(event.answer);
+            done = true;
+            break;
           case 'error':
             callbacks.onError(event.error, event.code);
             done = true;
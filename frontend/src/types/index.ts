@@ -3,6 +3,9 @@ export interface DocumentChunk {
   content: string;
   metadata: {
     page?: number;
+    page_start?: string;
+    page_end?: string;
+    section?: string;
     source: string;
   };
 }
@@ -27,7 +30,44 @@ export interface UploadResponse {
     name: string;
     chunksCount: number;
     uploadedAt: Date;
+    info?: {
+      title?: string;
+      author?: string;
+      createdAt?: string;
+    };
   };
+  outcome: 'created' | 'unchanged' | 'replaced';
+  skippedPages?: SkippedPage[];
+}
+
+export interface SkippedPage {
+  page: number;
+  reason: string;
+}
+
+export type JobStatus =
+  | 'queued'
+  | 'extracting'
+  | 'embedding'
+  | 'storing'
+  | 'done'
+  | 'failed'
+  | 'cancelled';
+
+export interface Job {
+  id: string;
+  status: JobStatus;
+  fileName: string;
+  collection: string;
+  chunksTotal: number;
+  chunksProcessed: number;
+  error?: string;
+  errorCode?: string;
+  result?: UploadResponse;
+}
+
+export interface JobResponse {
+  job: Job;
 }
 
 export interface ErrorResponse {
@@ -39,5 +79,6 @@ export interface ErrorResponse {
 export type StreamEvent =
   | { type: 'sources'; sources: DocumentChunk[]; confidence: number }
   | { type: 'token'; content: string }
+  | { type: 'no_answer'; answer: string; code: string }
   | { type: 'done' }
   | { type: 'error'; error: string; code?: string };
\ No newline at end of file